@@ -2,18 +2,28 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/finlleyl/shorty_reborn/internal/config"
+	"github.com/finlleyl/shorty_reborn/internal/dashboard"
 	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/geoip"
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver"
 	"github.com/finlleyl/shorty_reborn/internal/handlers"
 	"github.com/finlleyl/shorty_reborn/internal/httpserver"
+	zapmv "github.com/finlleyl/shorty_reborn/internal/httpserver/middleware"
 	"github.com/finlleyl/shorty_reborn/internal/logger"
+	"github.com/finlleyl/shorty_reborn/internal/oidc"
+	"github.com/finlleyl/shorty_reborn/internal/pagemeta"
 	"github.com/finlleyl/shorty_reborn/internal/service"
 )
 
@@ -34,15 +44,250 @@ func main() {
 	logger.Info("DB created")
 	defer db.Close()
 
-	urlRepo := database.NewURLRepository(db)
+	var urlRepoOpts []database.URLRepositoryOption
+	if cfg.Aliases.CaseInsensitive {
+		if err := database.MigrateCaseInsensitiveAliases(context.Background(), db); err != nil {
+			logger.Fatalf("Failed to enable case-insensitive aliases: %s", err)
+		}
+		urlRepoOpts = append(urlRepoOpts, database.CaseInsensitiveAliases())
+	}
+	urlRepo := database.NewURLRepository(db, urlRepoOpts...)
+	domainRepo := database.NewDomainRepository(db)
+	clickRepo := database.NewClickRepository(db)
+	webhookRepo := database.NewWebhookRepository(db)
+	outboxRepo := database.NewOutboxRepository(db)
+	auditRepo := database.NewAuditRepository(db)
+	defaultDomain := cfg.HTTPServer.DefaultDomainName()
+
+	urlOpts := []service.Option{
+		service.WithDomains(domainRepo, defaultDomain),
+		service.WithClicks(clickRepo),
+		service.WithDeleteGrace(cfg.SoftDelete.GracePeriod),
+	}
+
+	var workspaceService service.WorkspaceService
+	workspaceRepo := database.NewWorkspaceRepository(db)
+	if len(cfg.Workspaces) > 0 || cfg.Auth.Enabled {
+		workspaceService = service.NewWorkspaceService(workspaceRepo)
+		urlOpts = append(urlOpts, service.WithWorkspaces(workspaceRepo))
+	}
+	if len(cfg.Workspaces) > 0 {
+
+		workspaces := make([]service.Workspace, 0, len(cfg.Workspaces))
+		for _, w := range cfg.Workspaces {
+			workspaces = append(workspaces, service.Workspace{
+				Name:             w.Name,
+				KeyHashes:        w.APIKeys,
+				MaxLinks:         w.MaxLinks,
+				MaxMonthlyClicks: w.MaxMonthlyClicks,
+				Roles:            w.Roles,
+			})
+		}
+		if err := workspaceService.Sync(context.Background(), workspaces); err != nil {
+			logger.Fatalf("Failed to sync workspaces: %s", err)
+		}
+		logger.Infof("%d workspaces configured", len(workspaces))
+	}
+
+	var authService service.AuthService
+	if cfg.Auth.Enabled {
+		authService = service.NewAuthService(database.NewUserRepository(db), workspaceRepo, cfg.Auth.SessionTTL)
+
+		accounts := make([]service.Account, 0, len(cfg.Auth.Users))
+		for _, u := range cfg.Auth.Users {
+			accounts = append(accounts, service.Account{
+				Email:        u.Email,
+				PasswordHash: u.PasswordHash,
+				Workspace:    u.Workspace,
+				Roles:        u.Roles,
+			})
+		}
+		if err := authService.SyncUsers(context.Background(), accounts); err != nil {
+			logger.Fatalf("Failed to sync users: %s", err)
+		}
+		logger.Infof("%d users configured", len(accounts))
+	}
+
+	var provider *oidc.Provider
+	if cfg.Auth.OIDC.Enabled {
+		if authService == nil {
+			logger.Fatal("OIDC requires auth to be enabled")
+		}
+
+		redirectURL := cfg.Auth.OIDC.RedirectURL
+		if redirectURL == "" {
+			redirectURL = strings.TrimRight(cfg.HTTPServer.BaseURL, "/") + "/api/auth/oidc/callback"
+		}
+		provider, err = oidc.Discover(context.Background(), oidc.ProviderOptions{
+			Issuer:         cfg.Auth.OIDC.Issuer,
+			ClientID:       cfg.Auth.OIDC.ClientID,
+			ClientSecret:   cfg.Auth.OIDC.ClientSecret,
+			RedirectURL:    redirectURL,
+			Scopes:         cfg.Auth.OIDC.Scopes,
+			Audience:       cfg.Auth.OIDC.Audience,
+			JWKSURL:        cfg.Auth.OIDC.JWKSURL,
+			JWKSFile:       cfg.Auth.OIDC.JWKSFile,
+			KeySet:         oidc.KeySetOptions{CacheTTL: cfg.Auth.OIDC.JWKSCacheTTL},
+			RolesClaim:     cfg.Auth.OIDC.RolesClaim,
+			WorkspaceClaim: cfg.Auth.OIDC.WorkspaceClaim,
+			Workspace:      cfg.Auth.OIDC.Workspace,
+			HTTPClient:     &http.Client{Timeout: 10 * time.Second},
+		})
+		if err != nil {
+			logger.Fatalf("Failed to set up OIDC: %s", err)
+		}
+		logger.Infof("OIDC issuer %s configured", cfg.Auth.OIDC.Issuer)
+	}
+
+	var blocklist []string
+	if cfg.Aliases.BlocklistPath != "" {
+		blocklist, err = service.LoadBlocklist(cfg.Aliases.BlocklistPath)
+		if err != nil {
+			logger.Fatalf("Failed to load alias blocklist: %s", err)
+		}
+	}
+	urlOpts = append(urlOpts, service.WithAliasPolicy(service.NewAliasPolicy(cfg.Aliases.Reserved, blocklist)))
+
+	randomAlphabet, sequenceAlphabet := service.Base64URLAlphabet, service.Base62Alphabet
+	if cfg.Aliases.CaseInsensitive {
+		randomAlphabet, sequenceAlphabet = service.UnambiguousAlphabet, service.UnambiguousAlphabet
+		urlOpts = append(urlOpts, service.WithCaseInsensitiveAliases())
+	}
+	if cfg.Aliases.Unicode {
+		urlOpts = append(urlOpts, service.WithUnicodeAliases(cfg.Aliases.MaxGraphemes))
+	}
+
+	var generator service.AliasGenerator
+	switch cfg.Aliases.Generator {
+	case "random":
+		generator, err = service.NewRandomAliasGenerator(randomAlphabet, cfg.Aliases.Length)
+	case "sequence":
+		generator, err = service.NewSequenceAliasGenerator(database.NewAliasSequence(db), sequenceAlphabet)
+	case "hashids":
+		generator, err = service.NewHashidsAliasGenerator(database.NewAliasSequence(db), sequenceAlphabet, cfg.Aliases.Salt)
+	default:
+		err = fmt.Errorf("unknown generator %q", cfg.Aliases.Generator)
+	}
+	if err != nil {
+		logger.Fatalf("Failed to create alias generator: %s", err)
+	}
+	urlOpts = append(urlOpts, service.WithAliasGenerator(generator))
+
+	if cfg.GeoIP.DatabasePath != "" {
+		geo, err := geoip.Open(cfg.GeoIP.DatabasePath)
+		if err != nil {
+			logger.Fatalf("Failed to open GeoIP database: %s", err)
+		}
+		defer geo.Close()
+		urlOpts = append(urlOpts, service.WithGeoIP(geo))
+		logger.Info("GeoIP database loaded")
+	}
 
-	urlService := service.NewURLService(urlRepo)
-	handler := handlers.NewHandler(urlService)
+	var pageWorker *service.PageWorker
+	if cfg.PageMeta.Enabled {
+		fetcher := pagemeta.NewFetcher(pagemeta.Options{
+			Timeout:      cfg.PageMeta.Timeout,
+			MaxBytes:     cfg.PageMeta.MaxBytes,
+			MaxRedirects: cfg.PageMeta.MaxRedirects,
+			AllowPrivate: cfg.PageMeta.AllowPrivate,
+		})
+		pageWorker = service.NewPageWorker(urlRepo, fetcher, logger, cfg.PageMeta.Workers, cfg.PageMeta.QueueSize)
+		urlOpts = append(urlOpts, service.WithPageWorker(pageWorker))
+	}
 
-	r := httpserver.NewRouter(handler, logger)
+	var webhooks *service.WebhookDispatcher
+	if cfg.Webhooks.Enabled {
+		webhooks = service.NewWebhookDispatcher(webhookRepo, logger, service.WebhookOptions{
+			Workers:      cfg.Webhooks.Workers,
+			QueueSize:    cfg.Webhooks.QueueSize,
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+			Backoff:      cfg.Webhooks.Backoff,
+			MaxBackoff:   cfg.Webhooks.MaxBackoff,
+			Timeout:      cfg.Webhooks.Timeout,
+			AllowPrivate: cfg.Webhooks.AllowPrivate,
+		})
+	}
+
+	var relay *service.OutboxRelay
+	if cfg.Outbox.Enabled {
+		var sinks []service.EventSink
+		for _, name := range cfg.Outbox.Sinks {
+			switch name {
+			case "log":
+				sinks = append(sinks, service.NewLogSink(logger))
+			case "webhook":
+				if webhooks == nil {
+					logger.Fatal("Outbox webhook sink requires webhooks to be enabled")
+				}
+				sinks = append(sinks, webhooks)
+			case "file":
+				fileSink, err := service.NewFileSink(cfg.Outbox.FilePath)
+				if err != nil {
+					logger.Fatalf("Failed to open outbox file sink: %s", err)
+				}
+				defer fileSink.Close()
+				sinks = append(sinks, fileSink)
+			default:
+				logger.Fatalf("Unknown outbox sink %q", name)
+			}
+		}
+		relay = service.NewOutboxRelay(outboxRepo, logger, service.OutboxOptions{
+			Interval:    cfg.Outbox.Interval,
+			BatchSize:   cfg.Outbox.BatchSize,
+			Workers:     cfg.Outbox.Workers,
+			MaxAttempts: cfg.Outbox.MaxAttempts,
+			Backoff:     cfg.Outbox.Backoff,
+			MaxBackoff:  cfg.Outbox.MaxBackoff,
+			Retention:   cfg.Outbox.Retention,
+		}, sinks...)
+		urlOpts = append(urlOpts, service.WithOutbox(outboxRepo))
+	} else if webhooks != nil {
+		urlOpts = append(urlOpts, service.WithWebhooks(webhooks))
+	}
+
+	for _, role := range cfg.Auth.DefaultRoles {
+		if _, err := service.ParseRole(role); err != nil {
+			logger.Fatalf("Invalid default role: %s", err)
+		}
+	}
+	urlService := service.NewAuditedURLService(service.NewURLService(urlRepo, urlOpts...), auditRepo, logger)
+	domainService := service.NewAuditedDomainService(service.NewDomainService(domainRepo, defaultDomain), auditRepo, logger)
+	webhookService := service.NewAuditedWebhookService(service.NewWebhookService(webhookRepo, cfg.Webhooks.AllowPrivate), auditRepo, logger)
+	auditService := service.NewAuditService(auditRepo)
+	// Roles come with workspace keys and users, so links, domains, webhooks
+	// and the audit log are only open to everyone in deployments without
+	// either.
+	if workspaceService != nil {
+		urlService = service.NewAuthorizedURLService(urlService, cfg.Auth.DefaultRoles)
+		domainService = service.NewAuthorizedDomainService(domainService, cfg.Auth.DefaultRoles)
+		webhookService = service.NewAuthorizedWebhookService(webhookService, cfg.Auth.DefaultRoles)
+		auditService = service.NewAuthorizedAuditService(auditService, cfg.Auth.DefaultRoles)
+	}
+	handler := handlers.NewHandler(urlService, domainService, webhookService, auditService, cfg.HTTPServer.BaseURL)
+	handler.WorkspaceService = workspaceService
+	handler.AuthService = authService
+	handler.OIDC = provider
+	handler.SecureCookies = cfg.Auth.SecureCookies
+	if cfg.HTTPServer.Dashboard {
+		handler.Dashboard = dashboard.Handler()
+	}
+
+	trustedProxies, err := zapmv.ParseTrustedProxies(cfg.HTTPServer.TrustedProxies)
+	if err != nil {
+		logger.Fatalf("Failed to parse trusted proxies: %s", err)
+	}
+
+	r := httpserver.NewRouter(handler, logger, cfg.HTTPServer.CORSOrigins, trustedProxies)
 
 	srv := httpserver.NewServer(&cfg.HTTPServer, r)
 
+	grpcHandler := grpcserver.NewHandler(urlService)
+	grpcHandler.Workspaces = workspaceService
+	grpcHandler.AuthService = authService
+	if provider != nil {
+		grpcHandler.OIDC = provider
+	}
+	grpcSrv := grpcserver.NewServer(&cfg.GRPCServer, grpcHandler, logger)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -63,6 +308,56 @@ func main() {
 		return srv.Shutdown(ctxTimeout)
 	})
 
+	g.Go(func() error {
+		lis, err := net.Listen("tcp", cfg.GRPCServer.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen grpc: %w", err)
+		}
+
+		logger.Infof("Starting gRPC server on %s", cfg.GRPCServer.Address)
+		return grpcSrv.Serve(lis)
+	})
+
+	g.Go(func() error {
+		<-gCtx.Done()
+		logger.Info("Shutting down gRPC server...")
+
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(15 * time.Second):
+			grpcSrv.Stop()
+		}
+
+		return nil
+	})
+
+	if pageWorker != nil {
+		g.Go(func() error {
+			return pageWorker.Run(gCtx)
+		})
+	}
+
+	if relay != nil {
+		g.Go(func() error {
+			return relay.Run(gCtx)
+		})
+	} else if webhooks != nil {
+		g.Go(func() error {
+			return webhooks.Run(gCtx)
+		})
+	}
+
+	purger := service.NewPurger(urlRepo, logger, cfg.SoftDelete.GracePeriod, cfg.SoftDelete.PurgeInterval)
+	g.Go(func() error {
+		return purger.Run(gCtx)
+	})
+
 	if err := g.Wait(); err != nil {
 		logger.Fatalf("Server stopped: %s", err)
 	}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"time"
 
@@ -12,13 +13,201 @@ import (
 type Config struct {
 	Env        string     `yaml:"env" env-default:"local"`
 	HTTPServer HTTPServer `yaml:"http_server"`
+	GRPCServer GRPCServer `yaml:"grpc_server"`
 	Database   Database   `yaml:"database"`
+	GeoIP      GeoIP      `yaml:"geoip"`
+	PageMeta   PageMeta   `yaml:"page_meta"`
+	Webhooks   Webhooks   `yaml:"webhooks"`
+	Outbox     Outbox     `yaml:"outbox"`
+	SoftDelete SoftDelete `yaml:"soft_delete"`
+	Aliases    Aliases    `yaml:"aliases"`
+	// Workspaces enables multi-tenancy when not empty.
+	Workspaces []Workspace `yaml:"workspaces"`
+	Auth       Auth        `yaml:"auth"`
 }
 
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"localhost:8080"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Address       string        `yaml:"address" env-default:"localhost:8080"`
+	BaseURL       string        `yaml:"base_url" env:"BASE_URL" env-default:"http://localhost:8080"`
+	DefaultDomain string        `yaml:"default_domain" env:"DEFAULT_DOMAIN"`
+	Timeout       time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout   time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// CORSOrigins lists the origins browsers may call the API from, e.g.
+	// "https://dashboard.example.com". "*" allows any origin, but without
+	// cookies. Cross-origin requests are refused when it is empty.
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ORIGINS"`
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed. Headers from
+	// other peers are ignored.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// Dashboard serves the web dashboard at /dashboard/.
+	Dashboard bool `yaml:"dashboard" env:"DASHBOARD" env-default:"true"`
+}
+
+// DefaultDomainName returns the host serving the default alias namespace:
+// DefaultDomain when set, the host of BaseURL otherwise.
+func (c *HTTPServer) DefaultDomainName() string {
+	if c.DefaultDomain != "" {
+		return c.DefaultDomain
+	}
+
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+type GRPCServer struct {
+	Address           string        `yaml:"address" env:"GRPC_ADDRESS" env-default:"localhost:9090"`
+	ConnectionTimeout time.Duration `yaml:"connection_timeout" env-default:"4s"`
+}
+
+type GeoIP struct {
+	// DatabasePath points to a MaxMind DB country database. Country
+	// targeting rules never match when it is empty.
+	DatabasePath string `yaml:"database_path" env:"GEOIP_DATABASE_PATH"`
+}
+
+// PageMeta configures the background fetch of destination page titles,
+// OpenGraph data and favicons.
+type PageMeta struct {
+	Enabled      bool          `yaml:"enabled" env:"PAGE_META_ENABLED" env-default:"true"`
+	Timeout      time.Duration `yaml:"timeout" env-default:"5s"`
+	MaxBytes     int64         `yaml:"max_bytes" env-default:"1048576"`
+	MaxRedirects int           `yaml:"max_redirects" env-default:"5"`
+	Workers      int           `yaml:"workers" env-default:"2"`
+	QueueSize    int           `yaml:"queue_size" env-default:"100"`
+	// AllowPrivate lets the fetcher reach loopback and private networks.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// Webhooks configures delivery of link events to webhook subscriptions.
+type Webhooks struct {
+	Enabled     bool          `yaml:"enabled" env:"WEBHOOKS_ENABLED" env-default:"true"`
+	Workers     int           `yaml:"workers" env-default:"2"`
+	QueueSize   int           `yaml:"queue_size" env-default:"1000"`
+	MaxAttempts int           `yaml:"max_attempts" env-default:"5"`
+	Backoff     time.Duration `yaml:"backoff" env-default:"1s"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" env-default:"1m"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"10s"`
+	// AllowPrivate accepts webhooks of loopback, private and link-local
+	// addresses. Only meant for development.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// Outbox configures the transactional outbox of link events. When it is
+// disabled, events are handed to the webhook dispatcher directly and may be
+// lost if the process stops.
+type Outbox struct {
+	Enabled bool `yaml:"enabled" env:"OUTBOX_ENABLED" env-default:"true"`
+	// Sinks lists where events are published: "log", "webhook" and "file".
+	Sinks     []string      `yaml:"sinks" env:"OUTBOX_SINKS" env-default:"webhook"`
+	FilePath  string        `yaml:"file_path" env:"OUTBOX_FILE_PATH"`
+	Interval  time.Duration `yaml:"interval" env-default:"1s"`
+	BatchSize int           `yaml:"batch_size" env-default:"100"`
+	Workers   int           `yaml:"workers" env-default:"4"`
+	// MaxAttempts is how often an event is tried before it is
+	// dead-lettered.
+	MaxAttempts int           `yaml:"max_attempts" env-default:"10"`
+	Backoff     time.Duration `yaml:"backoff" env-default:"5s"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" env-default:"1h"`
+	Retention   time.Duration `yaml:"retention" env-default:"168h"`
+}
+
+// SoftDelete configures how long deleted links can be restored before they
+// are purged. A zero grace period purges them on the next run.
+type SoftDelete struct {
+	GracePeriod   time.Duration `yaml:"grace_period" env:"SOFT_DELETE_GRACE_PERIOD" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// Aliases configures how aliases are generated and which aliases may not
+// be used, for custom and generated links alike.
+type Aliases struct {
+	// Generator is one of "random", "sequence" (base62 of a database
+	// sequence) and "hashids" (the sequence obfuscated with Salt).
+	Generator string `yaml:"generator" env:"ALIAS_GENERATOR" env-default:"random"`
+	// Length of random aliases.
+	Length int `yaml:"length" env-default:"6"`
+	// Salt of hashids aliases, required with that generator.
+	Salt string `yaml:"salt" env:"ALIAS_SALT"`
+	// CaseInsensitive lowercases aliases on create and lookup, and limits
+	// generated aliases to lowercase letters and digits without look-alikes.
+	CaseInsensitive bool `yaml:"case_insensitive" env:"ALIAS_CASE_INSENSITIVE"`
+	// Unicode accepts custom aliases in any script and with emoji, of at
+	// most MaxGraphemes characters.
+	Unicode      bool `yaml:"unicode" env:"ALIAS_UNICODE"`
+	MaxGraphemes int  `yaml:"max_graphemes" env:"ALIAS_MAX_GRAPHEMES" env-default:"16"`
+	// Reserved aliases are rejected when they match exactly, ignoring case.
+	Reserved []string `yaml:"reserved" env:"RESERVED_ALIASES" env-default:"admin,api,app,auth,dashboard,docs,help,login,logout,metrics,register,settings,signup,static,status,support"`
+	// BlocklistPath is a file of blocked words, one per line. Aliases
+	// containing one of them, also in leetspeak, are rejected.
+	BlocklistPath string `yaml:"blocklist_path" env:"ALIAS_BLOCKLIST_PATH"`
+}
+
+// Workspace is a tenant whose API keys only see its own links. APIKeys are
+// hex SHA-256 digests of the keys, so that the keys themselves are not
+// stored in the configuration. A workspace named "default" configures the
+// one of requests without a key. Zero quotas mean no limit.
+type Workspace struct {
+	Name             string   `yaml:"name"`
+	APIKeys          []string `yaml:"api_keys"`
+	MaxLinks         int64    `yaml:"max_links"`
+	MaxMonthlyClicks int64    `yaml:"max_monthly_clicks"`
+	// Roles are the roles of the workspace's API keys when auth is enabled.
+	Roles []string `yaml:"roles"`
+}
+
+// Auth configures user accounts of the web dashboard, which sign in with a
+// session cookie. Users are given with a bcrypt hash of their password.
+type Auth struct {
+	Enabled    bool          `yaml:"enabled" env:"AUTH_ENABLED"`
+	SessionTTL time.Duration `yaml:"session_ttl" env:"AUTH_SESSION_TTL" env-default:"168h"`
+	// SecureCookies limits the session cookie to HTTPS. Only turn it off
+	// for local development over plain HTTP.
+	SecureCookies bool `yaml:"secure_cookies" env:"AUTH_SECURE_COOKIES" env-default:"true"`
+	// DefaultRoles are granted to callers without a role: anonymous ones,
+	// API keys of workspaces without roles and users the configuration or
+	// SSO provider gives none. Roles are viewer, editor and admin.
+	DefaultRoles []string `yaml:"default_roles" env:"AUTH_DEFAULT_ROLES" env-default:"viewer"`
+	Users        []User   `yaml:"users"`
+	OIDC         OIDC     `yaml:"oidc"`
+}
+
+// OIDC configures single sign-on with an OpenID Connect provider: browsers
+// sign in through /api/auth/oidc/login, and API clients send the provider's
+// JWTs as bearer tokens. Users are created on first sign-in.
+type OIDC struct {
+	Enabled      bool   `yaml:"enabled" env:"OIDC_ENABLED"`
+	Issuer       string `yaml:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	// RedirectURL defaults to BaseURL followed by /api/auth/oidc/callback.
+	RedirectURL string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes      []string `yaml:"scopes" env-default:"openid,email,profile"`
+	// Audience of bearer tokens, ClientID when empty.
+	Audience string `yaml:"audience" env:"OIDC_AUDIENCE"`
+	// JWKSURL or JWKSFile replace the jwks_uri of the discovery document.
+	JWKSURL      string        `yaml:"jwks_url" env:"OIDC_JWKS_URL"`
+	JWKSFile     string        `yaml:"jwks_file" env:"OIDC_JWKS_FILE"`
+	JWKSCacheTTL time.Duration `yaml:"jwks_cache_ttl" env-default:"1h"`
+	// RolesClaim and WorkspaceClaim name the claims, as dotted paths, that
+	// hold the roles and the workspace name of users. Users whose token has
+	// no workspace claim work in Workspace.
+	RolesClaim     string `yaml:"roles_claim" env-default:"roles"`
+	WorkspaceClaim string `yaml:"workspace_claim"`
+	Workspace      string `yaml:"workspace" env-default:"default"`
+}
+
+// User is an account of the web dashboard. Workspace is the name of the
+// workspace the user works in, "default" when empty.
+type User struct {
+	Email        string   `yaml:"email"`
+	PasswordHash string   `yaml:"password_hash"`
+	Workspace    string   `yaml:"workspace"`
+	Roles        []string `yaml:"roles"`
 }
 
 type Database struct {
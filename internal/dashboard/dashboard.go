@@ -0,0 +1,39 @@
+// Package dashboard serves the web admin dashboard: a static single-page
+// app embedded into the binary that manages links through the JSON API
+// under /api.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// contentSecurityPolicy only lets the dashboard load its own files and
+// call its own origin, so that injected markup cannot run scripts. QR
+// previews are shown from blob: URLs.
+const contentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; img-src 'self' blob:; " +
+	"connect-src 'self'; form-action 'self'; base-uri 'none'; frame-ancestors 'none'"
+
+// Handler serves the files of the dashboard relative to the path it is
+// mounted at, e.g. with http.StripPrefix.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServerFS(files)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "same-origin")
+		// Embedded files have no modification time to revalidate
+		// against, and must not outlive an upgrade of the binary.
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
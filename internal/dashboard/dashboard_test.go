@@ -0,0 +1,40 @@
+package dashboard_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/dashboard"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	h := http.StripPrefix("/dashboard", dashboard.Handler())
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/dashboard/", http.StatusOK, "text/html; charset=utf-8"},
+		{"/dashboard/app.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/dashboard/style.css", http.StatusOK, "text/css; charset=utf-8"},
+		{"/dashboard/missing.js", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			require.Equal(t, tt.status, rec.Code)
+			require.Contains(t, rec.Header().Get("Content-Security-Policy"), "script-src 'self'")
+			if tt.contentType != "" {
+				require.Equal(t, tt.contentType, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,524 @@
+"use strict";
+
+// The dashboard talks to the JSON API of the same origin. Signed-in users
+// are authenticated by the session cookie, whose CSRF token has to
+// accompany every unsafe request; API keys are kept for the browser tab
+// only.
+
+const PAGE_SIZE = 50;
+const KEY_STORAGE = "shorty_api_key";
+const SVG_NS = "http://www.w3.org/2000/svg";
+
+const $ = (id) => document.getElementById(id);
+
+class APIError extends Error {
+  constructor(status, message) {
+    super(message);
+    this.status = status;
+  }
+}
+
+const api = {
+  csrf: "",
+  key: sessionStorage.getItem(KEY_STORAGE) || "",
+
+  async fetch(method, path, body) {
+    const headers = { Accept: "application/json" };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    if (this.key) {
+      headers.Authorization = "Bearer " + this.key;
+    }
+    if (this.csrf && method !== "GET") {
+      headers["X-CSRF-Token"] = this.csrf;
+    }
+
+    const resp = await fetch(path, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+      credentials: "same-origin",
+    });
+    if (!resp.ok) {
+      let message = resp.statusText || "request failed";
+      try {
+        const problem = await resp.json();
+        message = problem.detail || problem.error || message;
+      } catch {
+        // The body is not JSON, keep the status text.
+      }
+      throw new APIError(resp.status, message);
+    }
+
+    return resp;
+  },
+
+  async json(method, path, body) {
+    const resp = await this.fetch(method, path, body);
+    if (resp.status === 204) {
+      return null;
+    }
+
+    return resp.json();
+  },
+};
+
+// linkPath returns the API path of a link, with the domain of links
+// outside the default namespace.
+function linkPath(link, suffix = "", params = {}) {
+  const query = new URLSearchParams(params);
+  if (link.domain) {
+    query.set("domain", link.domain);
+  }
+  const qs = query.toString();
+
+  return "/api/urls/" + encodeURIComponent(link.alias) + suffix + (qs ? "?" + qs : "");
+}
+
+// Notices
+
+function notify(message, kind = "error", action) {
+  const notice = $("notice");
+  notice.replaceChildren(message);
+  notice.className = kind;
+  if (action) {
+    const button = document.createElement("button");
+    button.type = "button";
+    button.className = "link";
+    button.textContent = action.label;
+    button.addEventListener("click", () => {
+      notice.hidden = true;
+      action.run();
+    });
+    notice.append(" ", button);
+  }
+  notice.hidden = false;
+}
+
+function clearNotice() {
+  $("notice").hidden = true;
+}
+
+function report(err) {
+  if (err instanceof APIError && err.status === 401) {
+    signOut(true);
+    notify("Your session has ended, please sign in again.");
+    return;
+  }
+  notify(err.message || String(err));
+}
+
+// Sign-in
+
+async function boot() {
+  clearNotice();
+  if (api.key) {
+    showApp("API key");
+    return;
+  }
+
+  try {
+    const session = await api.json("GET", "/api/auth/me");
+    api.csrf = session.csrf_token;
+    showApp(session.user.email);
+  } catch (err) {
+    if (err.status === 401) {
+      showLogin();
+    } else if (err.status === 404) {
+      // Accounts are disabled: the API is open or takes API keys.
+      showApp("");
+    } else {
+      report(err);
+    }
+  }
+}
+
+async function showLogin() {
+  $("app").hidden = true;
+  $("account").hidden = true;
+  $("login").hidden = false;
+
+  // The SSO sign-in redirects when it is configured and 404s otherwise.
+  try {
+    const resp = await fetch($("sso-link").href, { redirect: "manual", credentials: "same-origin" });
+    $("sso").hidden = resp.type !== "opaqueredirect";
+  } catch {
+    $("sso").hidden = true;
+  }
+}
+
+function showApp(account) {
+  $("login").hidden = true;
+  $("app").hidden = false;
+  $("account").hidden = account === "";
+  $("account-email").textContent = account;
+  loadLinks(true);
+}
+
+async function signOut(expired) {
+  if (api.key) {
+    api.key = "";
+    sessionStorage.removeItem(KEY_STORAGE);
+  } else if (!expired) {
+    try {
+      await api.fetch("POST", "/api/auth/logout");
+    } catch (err) {
+      report(err);
+      return;
+    }
+  }
+  api.csrf = "";
+  $("link-rows").replaceChildren();
+  showLogin();
+}
+
+$("login-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  try {
+    const session = await api.json("POST", "/api/auth/login", {
+      email: form.email.value,
+      password: form.password.value,
+    });
+    api.csrf = session.csrf_token;
+    form.reset();
+    clearNotice();
+    showApp(session.user.email);
+  } catch (err) {
+    notify(err.message);
+  }
+});
+
+$("key-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  api.key = event.target.key.value.trim();
+  sessionStorage.setItem(KEY_STORAGE, api.key);
+  event.target.reset();
+  boot();
+});
+
+$("logout").addEventListener("click", () => signOut(false));
+
+// Link list
+
+// seq tells the response of the latest request apart from those of
+// searches typed over since.
+const list = { offset: 0, search: "", links: new Map(), seq: 0 };
+
+async function loadLinks(reset) {
+  const seq = ++list.seq;
+  if (reset) {
+    list.offset = 0;
+    list.links.clear();
+    $("link-rows").replaceChildren();
+  }
+
+  const params = new URLSearchParams({ limit: PAGE_SIZE, offset: list.offset });
+  if (list.search) {
+    params.set("q", list.search);
+  }
+
+  let links;
+  try {
+    links = await api.json("GET", "/api/urls?" + params);
+  } catch (err) {
+    if (err.status === 401 && api.key) {
+      signOut(true);
+      notify("The API key is not valid.");
+      return;
+    }
+    report(err);
+    return;
+  }
+  if (seq !== list.seq) {
+    return;
+  }
+
+  for (const link of links) {
+    $("link-rows").append(linkRow(link));
+  }
+  list.offset += links.length;
+  $("more").hidden = links.length < PAGE_SIZE;
+  $("empty").hidden = list.offset > 0;
+}
+
+function linkKey(link) {
+  return (link.domain || "") + "/" + link.alias;
+}
+
+function linkRow(link) {
+  list.links.set(linkKey(link), link);
+
+  const row = document.createElement("tr");
+  row.dataset.key = linkKey(link);
+
+  const short = document.createElement("td");
+  const open = document.createElement("button");
+  open.type = "button";
+  open.className = "link";
+  open.textContent = link.short_url;
+  open.title = "Statistics, QR code and deletion";
+  open.addEventListener("click", () => showDetails(link));
+  short.append(open);
+  if (link.title) {
+    const title = document.createElement("div");
+    title.className = "muted";
+    title.textContent = link.title;
+    short.append(title);
+  }
+
+  const dest = document.createElement("td");
+  dest.className = "url";
+  dest.textContent = link.url;
+  dest.title = link.url;
+
+  const tags = document.createElement("td");
+  for (const tag of link.tags || []) {
+    const chip = document.createElement("span");
+    chip.className = "tag";
+    chip.textContent = tag;
+    tags.append(chip);
+  }
+
+  const created = document.createElement("td");
+  created.className = "muted";
+  created.textContent = link.created_at ? new Date(link.created_at).toLocaleDateString() : "";
+
+  const actions = document.createElement("td");
+  actions.className = "actions";
+  const remove = document.createElement("button");
+  remove.type = "button";
+  remove.className = "secondary";
+  remove.textContent = "Delete";
+  remove.addEventListener("click", () => deleteLink(link));
+  actions.append(remove);
+
+  row.append(short, dest, tags, created, actions);
+
+  return row;
+}
+
+let searchTimer;
+$("search").addEventListener("input", (event) => {
+  clearTimeout(searchTimer);
+  searchTimer = setTimeout(() => {
+    list.search = event.target.value.trim();
+    loadLinks(true);
+  }, 250);
+});
+
+$("more").addEventListener("click", () => loadLinks(false));
+
+// Creating and deleting
+
+$("create-form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = event.target;
+
+  const body = { url: form.url.value.trim() };
+  for (const name of ["alias", "title", "password"]) {
+    const value = form[name].value.trim();
+    if (value) {
+      body[name] = value;
+    }
+  }
+  const tags = form.tags.value.split(",").map((t) => t.trim()).filter(Boolean);
+  if (tags.length) {
+    body.tags = tags;
+  }
+  if (form.max_clicks.value) {
+    body.max_clicks = Number(form.max_clicks.value);
+  }
+
+  try {
+    const link = await api.json("POST", "/api/urls", body);
+    form.reset();
+    if (!list.links.has(linkKey(link))) {
+      $("link-rows").prepend(linkRow(link));
+      $("empty").hidden = true;
+    }
+    notify("Created " + link.short_url, "info");
+  } catch (err) {
+    report(err);
+  }
+});
+
+async function deleteLink(link) {
+  if (!confirm("Delete " + link.short_url + "?")) {
+    return;
+  }
+
+  try {
+    await api.fetch("DELETE", linkPath(link));
+  } catch (err) {
+    report(err);
+    return;
+  }
+
+  list.links.delete(linkKey(link));
+  document.querySelector(`tr[data-key="${CSS.escape(linkKey(link))}"]`)?.remove();
+  if ($("details").open) {
+    $("details").close();
+  }
+  notify("Deleted " + link.short_url + ".", "info", { label: "Undo", run: () => restoreLink(link) });
+}
+
+async function restoreLink(link) {
+  try {
+    const restored = await api.json("POST", linkPath(link, "/restore"));
+    $("link-rows").prepend(linkRow(restored));
+    $("empty").hidden = true;
+  } catch (err) {
+    report(err);
+  }
+}
+
+// Details: statistics and QR code
+
+let current = null;
+let qrURL = "";
+
+function showDetails(link) {
+  current = link;
+  $("details-title").textContent = link.title || link.alias;
+  $("details-short").textContent = link.short_url;
+  $("details-short").href = link.short_url;
+  $("details-url").textContent = link.url;
+  $("details-total").textContent = "";
+  $("daily-chart").replaceChildren();
+  $("variant-chart").replaceChildren();
+  $("variants").hidden = true;
+  $("stats-error").hidden = true;
+  $("qr-image").removeAttribute("src");
+  $("details").showModal();
+
+  loadStats(link);
+  loadQR(link);
+}
+
+async function loadStats(link) {
+  let stats;
+  try {
+    stats = await api.json("GET", linkPath(link, "/stats"));
+  } catch (err) {
+    $("stats-error").textContent = err.message;
+    $("stats-error").hidden = false;
+    return;
+  }
+  if (current !== link) {
+    return;
+  }
+
+  $("details-total").textContent = "· " + stats.clicks + " in total";
+  $("daily-chart").append(columnChart(stats.daily.map((d) => ({ label: d.day.slice(5), value: d.clicks }))));
+  if (stats.variants && stats.variants.length) {
+    $("variant-chart").append(barChart(stats.variants.map((v) => ({ label: v.name, value: v.clicks }))));
+    $("variants").hidden = false;
+  }
+}
+
+async function qrBlob(link, format) {
+  const resp = await api.fetch("GET", linkPath(link, "/qr", { format, size: 512 }));
+
+  return resp.blob();
+}
+
+async function loadQR(link) {
+  try {
+    const blob = await qrBlob(link, "png");
+    if (current !== link) {
+      return;
+    }
+    URL.revokeObjectURL(qrURL);
+    qrURL = URL.createObjectURL(blob);
+    $("qr-image").src = qrURL;
+  } catch (err) {
+    report(err);
+  }
+}
+
+async function downloadQR(format) {
+  try {
+    const blob = await qrBlob(current, format);
+    const href = URL.createObjectURL(blob);
+    const a = document.createElement("a");
+    a.href = href;
+    a.download = current.alias + "." + format;
+    a.click();
+    setTimeout(() => URL.revokeObjectURL(href), 1000);
+  } catch (err) {
+    report(err);
+  }
+}
+
+$("qr-png").addEventListener("click", () => downloadQR("png"));
+$("qr-svg").addEventListener("click", () => downloadQR("svg"));
+$("delete").addEventListener("click", () => deleteLink(current));
+$("details").addEventListener("close", () => {
+  current = null;
+});
+
+// Charts are plain SVG, sized by their viewBox.
+
+function svg(name, attrs = {}, text) {
+  const el = document.createElementNS(SVG_NS, name);
+  for (const [k, v] of Object.entries(attrs)) {
+    el.setAttribute(k, v);
+  }
+  if (text !== undefined) {
+    el.textContent = text;
+  }
+
+  return el;
+}
+
+// columnChart draws one column per item, labelling every fifth.
+function columnChart(items) {
+  const width = 600;
+  const height = 160;
+  const bottom = 18;
+  const max = Math.max(1, ...items.map((i) => i.value));
+  const step = width / items.length;
+
+  const chart = svg("svg", { viewBox: `0 0 ${width} ${height}`, role: "img", "aria-label": "Clicks per day" });
+  chart.append(svg("text", { x: 0, y: 10, class: "axis" }, String(max)));
+  items.forEach((item, i) => {
+    const h = ((height - bottom - 14) * item.value) / max;
+    const bar = svg("rect", {
+      class: "bar",
+      x: i * step + 1,
+      y: height - bottom - h,
+      width: Math.max(1, step - 2),
+      height: h,
+    });
+    bar.append(svg("title", {}, `${item.label}: ${item.value}`));
+    chart.append(bar);
+    if (i % 5 === 0 || i === items.length - 1) {
+      chart.append(svg("text", { x: i * step, y: height - 4, class: "axis" }, item.label));
+    }
+  });
+
+  return chart;
+}
+
+// barChart draws one labelled horizontal bar per item.
+function barChart(items) {
+  const width = 600;
+  const row = 24;
+  const label = 120;
+  const max = Math.max(1, ...items.map((i) => i.value));
+
+  const chart = svg("svg", { viewBox: `0 0 ${width} ${row * items.length}`, role: "img", "aria-label": "Clicks per variant" });
+  items.forEach((item, i) => {
+    const w = ((width - label - 60) * item.value) / max;
+    const y = i * row;
+    chart.append(svg("text", { x: 0, y: y + 16, class: "axis" }, item.label || "(none)"));
+    chart.append(svg("rect", { class: "bar", x: label, y: y + 4, width: Math.max(1, w), height: row - 8 }));
+    chart.append(svg("text", { x: label + w + 6, y: y + 16, class: "value" }, String(item.value)));
+  });
+
+  return chart;
+}
+
+boot();
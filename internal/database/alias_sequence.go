@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AliasSequence hands out the numbers encoded by sequential alias
+// generators. Numbers are unique and increasing, but may have gaps.
+type AliasSequence interface {
+	Next(ctx context.Context) (int64, error)
+}
+
+type postgresAliasSequence struct {
+	db *sqlx.DB
+}
+
+func NewAliasSequence(db *sqlx.DB) AliasSequence {
+	return &postgresAliasSequence{db: db}
+}
+
+func (s *postgresAliasSequence) Next(ctx context.Context) (int64, error) {
+	var n int64
+	if err := s.db.GetContext(ctx, &n, "SELECT nextval('url_alias_seq');"); err != nil {
+		return 0, fmt.Errorf("failed to get next alias number: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,34 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestAliasSequenceNext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	seq := database.NewAliasSequence(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT nextval('url_alias_seq');")).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(3844))
+	n, err := seq.Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(3844), n)
+
+	mock.ExpectQuery(regexp.QuoteMeta("nextval")).WillReturnError(errors.New("boom"))
+	_, err = seq.Next(ctx)
+	require.ErrorContains(t, err, "failed to get next alias number")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditEntry records one management operation. OldValue and NewValue are
+// JSON snapshots of the changed resource and are nil when there is no
+// value before or after the change. Domain and Alias identify the link for
+// link operations; domain operations only set Domain.
+type AuditEntry struct {
+	ID        int64     `db:"id"`
+	Workspace int64     `db:"workspace_id"`
+	Action    string    `db:"action"`
+	Domain    string    `db:"domain"`
+	Alias     string    `db:"alias"`
+	Actor     string    `db:"actor"`
+	RequestID string    `db:"request_id"`
+	IP        string    `db:"ip"`
+	OldValue  []byte    `db:"old_value"`
+	NewValue  []byte    `db:"new_value"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// AuditFilter selects audit entries of a workspace, newest first. Empty
+// fields and zero times match every entry; To is exclusive.
+type AuditFilter struct {
+	Workspace int64
+	Alias     string
+	Actor     string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// AuditRepository is append-only: the audit_log table rejects updates and
+// deletes.
+type AuditRepository interface {
+	Append(ctx context.Context, e *AuditEntry) error
+	List(ctx context.Context, f AuditFilter) ([]*AuditEntry, error)
+}
+
+type postgresAuditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) AuditRepository {
+	return &postgresAuditRepository{db: db}
+}
+
+func (r *postgresAuditRepository) Append(ctx context.Context, e *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (workspace_id, action, domain, alias, actor, request_id, ip, old_value, new_value)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		e.Workspace, e.Action, e.Domain, e.Alias, e.Actor, e.RequestID, e.IP, jsonOrNull(e.OldValue), jsonOrNull(e.NewValue))
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresAuditRepository) List(ctx context.Context, f AuditFilter) ([]*AuditEntry, error) {
+	query := `
+		SELECT id, workspace_id, action, domain, alias, actor, request_id, ip, old_value, new_value, created_at
+		FROM audit_log
+		WHERE workspace_id = $1
+			AND ($2 = '' OR alias = $2)
+			AND ($3 = '' OR actor = $3)
+			AND ($4::timestamptz IS NULL OR created_at >= $4)
+			AND ($5::timestamptz IS NULL OR created_at < $5)
+		ORDER BY id DESC
+		LIMIT $6 OFFSET $7;
+	`
+
+	entries := []*AuditEntry{}
+	err := r.db.SelectContext(ctx, &entries, query, f.Workspace, f.Alias, f.Actor, timeOrNull(f.From), timeOrNull(f.To), f.Limit, f.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func jsonOrNull(b []byte) any {
+	if b == nil {
+		return nil
+	}
+
+	return string(b)
+}
+
+func timeOrNull(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestAuditAppend(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewAuditRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_log (workspace_id, action, domain, alias, actor, request_id, ip, old_value, new_value)")).
+		WithArgs(int64(3), "link.delete", "", "promo", "key:abc", "req-1", "203.0.113.7", `{"alias":"promo"}`, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = repo.Append(context.Background(), &database.AuditEntry{
+		Workspace: 3,
+		Action:    "link.delete",
+		Alias:     "promo",
+		Actor:     "key:abc",
+		RequestID: "req-1",
+		IP:        "203.0.113.7",
+		OldValue:  []byte(`{"alias":"promo"}`),
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuditList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewAuditRepository(sqlx.NewDb(db, "sqlmock"))
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log WHERE workspace_id = $1")).
+		WithArgs(int64(3), "promo", "", from, nil, 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "action", "domain", "alias", "actor", "request_id", "ip", "old_value", "new_value", "created_at"}).
+			AddRow(1, 3, "link.create", "", "promo", "anonymous", "", "", nil, []byte(`{"alias":"promo"}`), from))
+
+	entries, err := repo.List(context.Background(), database.AuditFilter{Workspace: 3, Alias: "promo", From: from, Limit: 20})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Nil(t, entries[0].OldValue)
+	require.JSONEq(t, `{"alias":"promo"}`, string(entries[0].NewValue))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Click struct {
+	ID        int64     `db:"id"`
+	URLID     int64     `db:"url_id"`
+	Variant   string    `db:"variant"`
+	ClickedAt time.Time `db:"clicked_at"`
+}
+
+// VariantClicks is the number of clicks served by one variant. Clicks on
+// links without variants are counted under the empty name.
+type VariantClicks struct {
+	Variant string `db:"variant"`
+	Clicks  int64  `db:"clicks"`
+}
+
+type ClickRepository interface {
+	Record(ctx context.Context, c *Click) error
+	CountByVariant(ctx context.Context, urlID int64) ([]VariantClicks, error)
+	// CountByDay returns the clicks per UTC day since the start of the day
+	// of since, oldest first. Days without clicks are left out.
+	CountByDay(ctx context.Context, urlID int64, since time.Time) ([]DailyClicks, error)
+}
+
+// DailyClicks is the number of clicks on one UTC day.
+type DailyClicks struct {
+	Day    time.Time `db:"day"`
+	Clicks int64     `db:"clicks"`
+}
+
+type postgresClickRepository struct {
+	db *sqlx.DB
+}
+
+func NewClickRepository(db *sqlx.DB) ClickRepository {
+	return &postgresClickRepository{db: db}
+}
+
+func (r *postgresClickRepository) Record(ctx context.Context, c *Click) error {
+	query := `
+		INSERT INTO clicks (url_id, variant)
+		VALUES ($1, $2);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, c.URLID, c.Variant); err != nil {
+		return fmt.Errorf("failed to record click: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresClickRepository) CountByVariant(ctx context.Context, urlID int64) ([]VariantClicks, error) {
+	query := `
+		SELECT variant, COUNT(*) AS clicks
+		FROM clicks
+		WHERE url_id = $1
+		GROUP BY variant
+		ORDER BY variant;
+	`
+
+	counts := []VariantClicks{}
+	if err := r.db.SelectContext(ctx, &counts, query, urlID); err != nil {
+		return nil, fmt.Errorf("failed to count clicks: %w", err)
+	}
+
+	return counts, nil
+}
+
+func (r *postgresClickRepository) CountByDay(ctx context.Context, urlID int64, since time.Time) ([]DailyClicks, error) {
+	query := `
+		SELECT (clicked_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS clicks
+		FROM clicks
+		WHERE url_id = $1 AND clicked_at >= $2
+		GROUP BY day
+		ORDER BY day;
+	`
+
+	since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC)
+
+	counts := []DailyClicks{}
+	if err := r.db.SelectContext(ctx, &counts, query, urlID, since); err != nil {
+		return nil, fmt.Errorf("failed to count clicks by day: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,65 @@
+package database_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestClickRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewClickRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO clicks (url_id, variant)")).
+		WithArgs(int64(7), "b").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	require.NoError(t, repo.Record(context.Background(), &database.Click{URLID: 7, Variant: "b"}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClickCountByVariant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewClickRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT variant, COUNT(*) AS clicks FROM clicks")).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"variant", "clicks"}).
+			AddRow("a", 3).
+			AddRow("b", 5))
+
+	counts, err := repo.CountByVariant(context.Background(), 7)
+	require.NoError(t, err)
+	require.Equal(t, []database.VariantClicks{{Variant: "a", Clicks: 3}, {Variant: "b", Clicks: 5}}, counts)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClickCountByDay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewClickRepository(sqlx.NewDb(db, "sqlmock"))
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT (clicked_at AT TIME ZONE 'UTC')::date AS day, COUNT(*) AS clicks")).
+		WithArgs(int64(7), day).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "clicks"}).
+			AddRow(day, 4).
+			AddRow(day.AddDate(0, 0, 2), 1))
+
+	counts, err := repo.CountByDay(context.Background(), 7, day.Add(15*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []database.DailyClicks{{Day: day, Clicks: 4}, {Day: day.AddDate(0, 0, 2), Clicks: 1}}, counts)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
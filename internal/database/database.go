@@ -1,7 +1,10 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/finlleyl/shorty_reborn/internal/config"
 	"github.com/jmoiron/sqlx"
@@ -54,6 +57,159 @@ func runMigrations(db *sqlx.DB) error {
 			alias TEXT NOT NULL UNIQUE,
 			url TEXT NOT NULL);
 		CREATE INDEX IF NOT EXISTS idx_alias ON url(alias);`,
+		`ALTER TABLE url ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE url
+			ADD COLUMN IF NOT EXISTS max_clicks BIGINT,
+			ADD COLUMN IF NOT EXISTS clicks_left BIGINT;`,
+		`CREATE TABLE IF NOT EXISTS domains (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());`,
+		`ALTER TABLE url ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT '';
+		ALTER TABLE url DROP CONSTRAINT IF EXISTS url_alias_key;
+		DROP INDEX IF EXISTS idx_alias;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_url_domain_alias ON url(domain, alias);`,
+		`ALTER TABLE url ADD COLUMN IF NOT EXISTS rules JSONB NOT NULL DEFAULT '[]';`,
+		`ALTER TABLE url ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]';`,
+		`CREATE TABLE IF NOT EXISTS clicks (
+			id BIGSERIAL PRIMARY KEY,
+			url_id INTEGER NOT NULL REFERENCES url(id) ON DELETE CASCADE,
+			variant TEXT NOT NULL DEFAULT '',
+			clicked_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE INDEX IF NOT EXISTS idx_clicks_url_id ON clicks(url_id, clicked_at);`,
+		`ALTER TABLE url
+			ADD COLUMN IF NOT EXISTS query_mode TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS utm JSONB NOT NULL DEFAULT '{}';`,
+		`ALTER TABLE url
+			ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}',
+			ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+		CREATE INDEX IF NOT EXISTS idx_url_tags ON url USING GIN (tags);`,
+		`ALTER TABLE url ADD COLUMN IF NOT EXISTS page JSONB;`,
+		`ALTER TABLE url
+			ADD COLUMN IF NOT EXISTS force_preview BOOLEAN NOT NULL DEFAULT false,
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id BIGSERIAL PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			attempt INTEGER NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id);`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			event_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			published_at TIMESTAMPTZ);
+		CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			action TEXT NOT NULL,
+			domain TEXT NOT NULL DEFAULT '',
+			alias TEXT NOT NULL DEFAULT '',
+			actor TEXT NOT NULL,
+			request_id TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			old_value JSONB,
+			new_value JSONB,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE INDEX IF NOT EXISTS idx_audit_log_alias ON audit_log(alias, created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, created_at);
+		CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+		CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+			FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();`,
+		`ALTER TABLE url ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+		DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_url_domain_alias' AND indexdef NOT LIKE '%WHERE%') THEN
+				DROP INDEX idx_url_domain_alias;
+			END IF;
+		END
+		$$;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_url_domain_alias ON url(domain, alias) WHERE deleted_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_url_deleted ON url(domain, alias, deleted_at) WHERE deleted_at IS NOT NULL;`,
+		`ALTER TABLE url
+			ADD COLUMN IF NOT EXISTS url_hash TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS created_by TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_url_hash ON url(domain, url_hash, created_by) WHERE deleted_at IS NULL AND url_hash <> '';`,
+		// Starting at 62^2 keeps base62 sequential aliases at least 3
+		// characters long, the minimum length of custom aliases.
+		`CREATE SEQUENCE IF NOT EXISTS url_alias_seq START 3844;`,
+		// Existing links move to the default workspace, which keeps ID 1.
+		`CREATE TABLE IF NOT EXISTS workspace (
+			id BIGSERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			max_links BIGINT,
+			max_monthly_clicks BIGINT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		INSERT INTO workspace (id, name) VALUES (1, 'default') ON CONFLICT DO NOTHING;
+		SELECT setval('workspace_id_seq', (SELECT max(id) FROM workspace));
+		CREATE TABLE IF NOT EXISTS workspace_key (
+			key_hash TEXT PRIMARY KEY,
+			workspace_id BIGINT NOT NULL REFERENCES workspace(id) ON DELETE CASCADE);
+		CREATE TABLE IF NOT EXISTS workspace_usage (
+			workspace_id BIGINT NOT NULL REFERENCES workspace(id) ON DELETE CASCADE,
+			month DATE NOT NULL,
+			clicks BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (workspace_id, month));
+		ALTER TABLE url ADD COLUMN IF NOT EXISTS workspace_id BIGINT NOT NULL DEFAULT 1 REFERENCES workspace(id);
+		CREATE INDEX IF NOT EXISTS idx_url_workspace ON url(workspace_id, id) WHERE deleted_at IS NULL;`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id BIGSERIAL PRIMARY KEY,
+			email TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			workspace_id BIGINT NOT NULL DEFAULT 1 REFERENCES workspace(id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE TABLE IF NOT EXISTS user_session (
+			token_hash TEXT PRIMARY KEY,
+			user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			csrf_token TEXT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now());
+		CREATE INDEX IF NOT EXISTS idx_user_session_user ON user_session(user_id, expires_at);
+		ALTER TABLE workspace_key
+			ADD COLUMN IF NOT EXISTS id BIGSERIAL,
+			ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+		CREATE INDEX IF NOT EXISTS idx_workspace_key_user ON workspace_key(user_id, id) WHERE user_id IS NOT NULL;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';`,
+		`ALTER TABLE workspace ADD COLUMN IF NOT EXISTS key_roles TEXT[] NOT NULL DEFAULT '{}';`,
+		// Webhooks registered before workspaces existed receive the events
+		// of the default workspace.
+		`ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS workspace_id BIGINT NOT NULL DEFAULT 1 REFERENCES workspace(id) ON DELETE CASCADE;
+		CREATE INDEX IF NOT EXISTS idx_webhooks_workspace ON webhooks(workspace_id, id);`,
+		// Failed outbox events are retried with a backoff and dead-lettered
+		// after too many attempts instead of blocking the events after them.
+		`ALTER TABLE outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now();
+		ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at TIMESTAMPTZ;
+		DROP INDEX IF EXISTS idx_outbox_pending;
+		CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(next_attempt_at, id) WHERE published_at IS NULL AND dead_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event_id ON webhook_deliveries(event_id);`,
+		// Entries written before workspaces existed belong to the default
+		// workspace. There is no foreign key: the log outlives workspaces.
+		`ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS workspace_id BIGINT NOT NULL DEFAULT 1;
+		CREATE INDEX IF NOT EXISTS idx_audit_log_workspace ON audit_log(workspace_id, id);`,
 	}
 
 	for _, stmt := range schema {
@@ -64,3 +220,50 @@ func runMigrations(db *sqlx.DB) error {
 
 	return nil
 }
+
+// ErrAliasCollisions is returned by MigrateCaseInsensitiveAliases when live
+// links have aliases that only differ in case.
+var ErrAliasCollisions = errors.New("aliases differ only in case")
+
+// MigrateCaseInsensitiveAliases prepares the database for case-insensitive
+// aliases: it adds a unique index on the lowercased alias of live links.
+// Links whose aliases collide when case is ignored, e.g. "Promo" and
+// "promo", would make one of them unreachable, so they are reported with
+// ErrAliasCollisions instead and have to be renamed or deleted first. The
+// index is kept when the mode is disabled again.
+func MigrateCaseInsensitiveAliases(ctx context.Context, db *sqlx.DB) error {
+	query := `
+		SELECT domain, array_agg(alias ORDER BY id) AS aliases
+		FROM url
+		WHERE deleted_at IS NULL
+		GROUP BY domain, lower(alias)
+		HAVING count(*) > 1
+		ORDER BY domain, lower(alias);
+	`
+
+	var collisions []struct {
+		Domain  string `db:"domain"`
+		Aliases Tags   `db:"aliases"`
+	}
+	if err := db.SelectContext(ctx, &collisions, query); err != nil {
+		return fmt.Errorf("failed to find alias collisions: %w", err)
+	}
+	if len(collisions) > 0 {
+		groups := make([]string, 0, len(collisions))
+		for _, c := range collisions {
+			group := strings.Join(c.Aliases, ", ")
+			if c.Domain != "" {
+				group = c.Domain + ": " + group
+			}
+			groups = append(groups, "["+group+"]")
+		}
+		return fmt.Errorf("%w: %s", ErrAliasCollisions, strings.Join(groups, " "))
+	}
+
+	index := `CREATE UNIQUE INDEX IF NOT EXISTS idx_url_domain_lower_alias ON url(domain, lower(alias)) WHERE deleted_at IS NULL;`
+	if _, err := db.ExecContext(ctx, index); err != nil {
+		return fmt.Errorf("failed to create case-insensitive alias index: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+)
+
+type Domain struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var (
+	ErrDomainNotFound = errors.New("domain not found")
+	ErrDomainExists   = errors.New("domain already exists")
+	ErrDomainInUse    = errors.New("domain has links")
+)
+
+type DomainRepository interface {
+	Create(ctx context.Context, name string) (*Domain, error)
+	Exists(ctx context.Context, name string) (bool, error)
+	List(ctx context.Context) ([]*Domain, error)
+	// Delete removes a domain that has no links left in its namespace.
+	Delete(ctx context.Context, name string) error
+}
+
+type postgresDomainRepository struct {
+	db *sqlx.DB
+}
+
+func NewDomainRepository(db *sqlx.DB) DomainRepository {
+	return &postgresDomainRepository{db: db}
+}
+
+func (r *postgresDomainRepository) Create(ctx context.Context, name string) (*Domain, error) {
+	query := `
+		INSERT INTO domains (name)
+		VALUES ($1)
+		RETURNING id, name, created_at;
+	`
+
+	var d Domain
+	if err := r.db.GetContext(ctx, &d, query, name); err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDomainExists
+		}
+		return nil, fmt.Errorf("failed to create domain: %w", err)
+	}
+
+	return &d, nil
+}
+
+func (r *postgresDomainRepository) Exists(ctx context.Context, name string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM domains
+			WHERE name = $1
+		)
+	`
+
+	var exists bool
+	if err := r.db.GetContext(ctx, &exists, query, name); err != nil {
+		return false, fmt.Errorf("failed to check if domain exists: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (r *postgresDomainRepository) List(ctx context.Context) ([]*Domain, error) {
+	query := `
+		SELECT id, name, created_at
+		FROM domains
+		ORDER BY name;
+	`
+
+	domains := []*Domain{}
+	if err := r.db.SelectContext(ctx, &domains, query); err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	return domains, nil
+}
+
+func (r *postgresDomainRepository) Delete(ctx context.Context, name string) error {
+	query := `
+		DELETE FROM domains
+		WHERE name = $1
+			AND NOT EXISTS (SELECT 1 FROM url WHERE domain = $1);
+	`
+
+	result, err := r.db.ExecContext(ctx, query, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	exists, err := r.Exists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDomainInUse
+	}
+
+	return ErrDomainNotFound
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
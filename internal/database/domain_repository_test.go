@@ -0,0 +1,100 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestDomainCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewDomainRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	insert := regexp.QuoteMeta("INSERT INTO domains (name)")
+
+	t.Run("success", func(t *testing.T) {
+		now := time.Now()
+		mock.ExpectQuery(insert).
+			WithArgs("go.example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(1, "go.example.com", now))
+
+		d, err := repo.Create(ctx, "go.example.com")
+		require.NoError(t, err)
+		require.Equal(t, "go.example.com", d.Name)
+		require.Equal(t, now, d.CreatedAt)
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		mock.ExpectQuery(insert).
+			WithArgs("go.example.com").
+			WillReturnError(&pgconn.PgError{Code: "23505"})
+
+		_, err := repo.Create(ctx, "go.example.com")
+		require.ErrorIs(t, err, database.ErrDomainExists)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDomainDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewDomainRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	del := regexp.QuoteMeta("DELETE FROM domains")
+	exists := regexp.QuoteMeta("SELECT EXISTS (")
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectExec(del).
+			WithArgs("go.example.com").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, repo.Delete(ctx, "go.example.com"))
+	})
+
+	t.Run("in use", func(t *testing.T) {
+		mock.ExpectExec(del).
+			WithArgs("go.example.com").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(exists).
+			WithArgs("go.example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		require.ErrorIs(t, repo.Delete(ctx, "go.example.com"), database.ErrDomainInUse)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectExec(del).
+			WithArgs("go.example.com").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(exists).
+			WithArgs("go.example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		require.ErrorIs(t, repo.Delete(ctx, "go.example.com"), database.ErrDomainNotFound)
+	})
+
+	t.Run("exec error", func(t *testing.T) {
+		mock.ExpectExec(del).
+			WithArgs("go.example.com").
+			WillReturnError(errors.New("boom"))
+
+		err := repo.Delete(ctx, "go.example.com")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to delete domain")
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
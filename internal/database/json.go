@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TargetRule redirects visitors matching every non-empty condition to URL.
+type TargetRule struct {
+	Platform string `json:"platform,omitempty"`
+	Language string `json:"language,omitempty"`
+	Country  string `json:"country,omitempty"`
+	URL      string `json:"url"`
+}
+
+// TargetRules is an ordered list of rules stored as a JSONB array.
+type TargetRules []TargetRule
+
+func (r TargetRules) Value() (driver.Value, error) {
+	return jsonArrayValue(r)
+}
+
+func (r *TargetRules) Scan(src any) error {
+	var rules TargetRules
+	if err := scanJSON(src, &rules); err != nil {
+		return fmt.Errorf("failed to decode target rules: %w", err)
+	}
+	if len(rules) == 0 {
+		rules = nil
+	}
+	*r = rules
+
+	return nil
+}
+
+// Variant is one weighted destination of an A/B split link.
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Variants is the list of split destinations stored as a JSONB array.
+type Variants []Variant
+
+func (v Variants) Value() (driver.Value, error) {
+	return jsonArrayValue(v)
+}
+
+func (v *Variants) Scan(src any) error {
+	var variants Variants
+	if err := scanJSON(src, &variants); err != nil {
+		return fmt.Errorf("failed to decode variants: %w", err)
+	}
+	if len(variants) == 0 {
+		variants = nil
+	}
+	*v = variants
+
+	return nil
+}
+
+// UTM holds the utm_* parameters attached to a link's destination. Values
+// may contain placeholders that are expanded on every redirect.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func (u UTM) Value() (driver.Value, error) {
+	return json.Marshal(u)
+}
+
+func (u *UTM) Scan(src any) error {
+	var utm UTM
+	if err := scanJSON(src, &utm); err != nil {
+		return fmt.Errorf("failed to decode utm: %w", err)
+	}
+	*u = utm
+
+	return nil
+}
+
+// Metadata is free-form key/value data attached to a link, stored as a
+// JSONB object.
+type Metadata map[string]string
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(m)
+}
+
+func (m *Metadata) Scan(src any) error {
+	var metadata Metadata
+	if err := scanJSON(src, &metadata); err != nil {
+		return fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	*m = metadata
+
+	return nil
+}
+
+// PageMeta describes the destination page of a link as fetched in the
+// background after the link was created.
+type PageMeta struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	Favicon     string    `json:"favicon,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+func (p PageMeta) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *PageMeta) Scan(src any) error {
+	if err := scanJSON(src, p); err != nil {
+		return fmt.Errorf("failed to decode page metadata: %w", err)
+	}
+
+	return nil
+}
+
+// jsonArrayValue encodes a slice for a JSONB column, storing nil as an empty
+// array so that the column can stay NOT NULL.
+func jsonArrayValue[T any](s []T) (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(s)
+}
+
+func scanJSON(src, dst any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("unsupported type %T", src)
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// OutboxEvent is a domain event waiting to be relayed. Payload is the JSON
+// encoded event.
+type OutboxEvent struct {
+	ID          int64      `db:"id"`
+	EventID     string     `db:"event_id"`
+	Type        string     `db:"type"`
+	Payload     []byte     `db:"payload"`
+	Attempts    int        `db:"attempts"`
+	LastError   string     `db:"last_error"`
+	CreatedAt   time.Time  `db:"created_at"`
+	PublishedAt *time.Time `db:"published_at"`
+	// DeadAt is set once the relay gave up on the event.
+	DeadAt *time.Time `db:"dead_at"`
+}
+
+type OutboxRepository interface {
+	// Add writes events to the outbox outside of any other change.
+	Add(ctx context.Context, events ...*OutboxEvent) error
+	// Pending returns up to limit unpublished events that are due for an
+	// attempt, oldest first. Dead events are never returned.
+	Pending(ctx context.Context, limit int) ([]*OutboxEvent, error)
+	MarkPublished(ctx context.Context, id int64) error
+	// MarkFailed records a failed relay attempt; the event stays pending
+	// and is due again at retryAt.
+	MarkFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error
+	// MarkDead records the last failed attempt of an event that will not
+	// be relayed again. It is kept until deleted by hand.
+	MarkDead(ctx context.Context, id int64, reason string) error
+	// Purge deletes events published before the given time.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type postgresOutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) OutboxRepository {
+	return &postgresOutboxRepository{db: db}
+}
+
+func (r *postgresOutboxRepository) Add(ctx context.Context, events ...*OutboxEvent) error {
+	return insertOutbox(ctx, r.db, events)
+}
+
+func (r *postgresOutboxRepository) Pending(ctx context.Context, limit int) ([]*OutboxEvent, error) {
+	query := `
+		SELECT id, event_id, type, payload, attempts, last_error, created_at, published_at, dead_at
+		FROM outbox
+		WHERE published_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()
+		ORDER BY id
+		LIMIT $1;
+	`
+
+	events := []*OutboxEvent{}
+	if err := r.db.SelectContext(ctx, &events, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to list pending outbox events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (r *postgresOutboxRepository) MarkPublished(ctx context.Context, id int64) error {
+	query := `
+		UPDATE outbox
+		SET published_at = now(), attempts = attempts + 1, last_error = ''
+		WHERE id = $1;
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresOutboxRepository) MarkFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1;
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, reason, retryAt); err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresOutboxRepository) MarkDead(ctx context.Context, id int64, reason string) error {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, dead_at = now()
+		WHERE id = $1;
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, reason); err != nil {
+		return fmt.Errorf("failed to mark outbox event dead: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresOutboxRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM outbox
+		WHERE published_at < $1;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
+func insertOutbox(ctx context.Context, q sqlx.ExecerContext, events []*OutboxEvent) error {
+	query := `
+		INSERT INTO outbox (event_id, type, payload)
+		VALUES ($1, $2, $3);
+	`
+
+	for _, e := range events {
+		if _, err := q.ExecContext(ctx, query, e.EventID, e.Type, string(e.Payload)); err != nil {
+			return fmt.Errorf("failed to write outbox event: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// withOutbox runs fn and writes events to the outbox in the same
+// transaction. Without events fn runs directly on db.
+func withOutbox(ctx context.Context, db *sqlx.DB, events []*OutboxEvent, fn func(q sqlx.ExtContext) error) error {
+	if len(events) == 0 {
+		return fn(db)
+	}
+
+	return withTx(ctx, db, func(tx sqlx.ExtContext) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return insertOutbox(ctx, tx, events)
+	})
+}
+
+// withTx runs fn in a transaction that is committed unless fn fails.
+func withTx(ctx context.Context, db *sqlx.DB, fn func(tx sqlx.ExtContext) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
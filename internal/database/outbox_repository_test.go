@@ -0,0 +1,108 @@
+package database_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestSave_WithOutboxEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	event := &database.OutboxEvent{EventID: "evt_1", Type: "link.created", Payload: []byte(`{"id":"evt_1"}`)}
+
+	t.Run("commits both", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO url")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox (event_id, type, payload)")).
+			WithArgs("evt_1", "link.created", `{"id":"evt_1"}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		u, err := repo.Save(ctx, &database.URL{Alias: "alias", URL: "http://example.com"}, event)
+		require.NoError(t, err)
+		require.Equal(t, int64(10), u.ID)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back on outbox error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO url")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox")).
+			WillReturnError(sqlmock.ErrCancelled)
+		mock.ExpectRollback()
+
+		_, err := repo.Save(ctx, &database.URL{Alias: "alias", URL: "http://example.com"}, event)
+		require.Error(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestDelete_WithOutboxEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	event := &database.OutboxEvent{EventID: "evt_1", Type: "link.deleted", Payload: []byte(`{}`)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SET deleted_at = now()")).
+		WithArgs("", "alias", database.DefaultWorkspace).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = repo.Delete(context.Background(), database.DefaultWorkspace, "", "alias", event)
+	require.ErrorIs(t, err, database.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxPending(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewOutboxRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE published_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now() ORDER BY id LIMIT $1")).
+		WithArgs(50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event_id", "type", "payload", "attempts", "last_error", "created_at", "published_at", "dead_at"}).
+			AddRow(1, "evt_1", "link.created", []byte(`{"id":"evt_1"}`), 0, "", time.Now(), nil, nil))
+
+	events, err := repo.Pending(context.Background(), 50)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "evt_1", events[0].EventID)
+	require.JSONEq(t, `{"id":"evt_1"}`, string(events[0].Payload))
+	require.Nil(t, events[0].PublishedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxMarkFailedAndDead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewOutboxRepository(sqlx.NewDb(db, "sqlmock"))
+	retryAt := time.Now().Add(time.Minute)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3")).
+		WithArgs(int64(1), "sink unavailable", retryAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1, last_error = $2, dead_at = now()")).
+		WithArgs(int64(1), "sink unavailable").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, repo.MarkFailed(context.Background(), 1, "sink unavailable", retryAt))
+	require.NoError(t, repo.MarkDead(context.Background(), 1, "sink unavailable"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Tags is stored as a TEXT[] column.
+type Tags []string
+
+var pgTypes = pgtype.NewMap()
+
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		t = Tags{}
+	}
+
+	buf, err := pgTypes.Encode(pgtype.TextArrayOID, pgtype.TextFormatCode, []string(t), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tags: %w", err)
+	}
+
+	return string(buf), nil
+}
+
+func (t *Tags) Scan(src any) error {
+	var tags []string
+	if err := pgTypes.SQLScanner(&tags).Scan(src); err != nil {
+		return fmt.Errorf("failed to decode tags: %w", err)
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	*t = tags
+
+	return nil
+}
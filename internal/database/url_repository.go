@@ -5,77 +5,193 @@ import (
 	"errors"
 	"fmt"
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )	
 
 type URL struct {
-	ID int64 `db:"id"`
-	Alias string `db:"alias"`
-	URL string `db:"url"`
+	ID           int64  `db:"id"`
+	// Domain is empty for links in the default domain's namespace.
+	Domain       string `db:"domain"`
+	Alias        string `db:"alias"`
+	URL          string `db:"url"`
+	PasswordHash string `db:"password_hash"`
+	// MaxClicks and ClicksLeft are nil for links without a click limit.
+	MaxClicks  *int64 `db:"max_clicks"`
+	ClicksLeft *int64 `db:"clicks_left"`
+	// Rules are evaluated in order on resolve; URL is the fallback target.
+	Rules TargetRules `db:"rules"`
+	// Variants split traffic that no rule matched between weighted
+	// destinations.
+	Variants Variants `db:"variants"`
+	// QueryMode tells how the query string of the short link is forwarded
+	// to the destination: "" drops it, "merge" and "override" keep it.
+	QueryMode string `db:"query_mode"`
+	UTM       UTM    `db:"utm"`
+	// Title, Description, Tags and Metadata describe the link for its
+	// owners; they do not affect redirects.
+	Title       string   `db:"title"`
+	Description string   `db:"description"`
+	Tags        Tags     `db:"tags"`
+	Metadata    Metadata `db:"metadata"`
+	// Page is nil until the destination page has been fetched.
+	Page *PageMeta `db:"page"`
+	// ForcePreview shows the preview interstitial to every visitor
+	// instead of redirecting.
+	ForcePreview bool      `db:"force_preview"`
+	CreatedAt    time.Time `db:"created_at"`
+	// URLHash is the hex SHA-256 of the normalized destination, used to
+	// find links to the same destination. It is empty for older links.
+	URLHash string `db:"url_hash"`
+	// CreatedBy is the ID of the actor who created the link.
+	CreatedBy string `db:"created_by"`
+	// Workspace is the ID of the workspace that owns the link.
+	Workspace int64 `db:"workspace_id"`
 }
 
-var ErrNotFound = errors.New("url not found")
+const urlColumns = "id, domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, page, force_preview, created_at, url_hash, created_by, workspace_id"
+
+var (
+	ErrNotFound   = errors.New("url not found")
+	ErrExhausted  = errors.New("url click limit exhausted")
+	ErrAliasInUse = errors.New("alias in use")
+)
+
+// URLRepository soft-deletes links: Delete sets deleted_at, and deleted
+// links are invisible to every other method until restored or purged.
+// Methods taking a workspace only see the links of that workspace, or of
+// all workspaces with AnyWorkspace.
 type URLRepository interface {
-	Exists(ctx context.Context, alias string) (bool, error)
-	Save(ctx context.Context, alias, url string) (*URL, error)
-	Get(ctx context.Context, alias string) (*URL, error)
-	Delete(ctx context.Context, alias string) error
+	Exists(ctx context.Context, workspace int64, domain, alias string) (bool, error)
+	// Save, Delete and Restore write events to the outbox in the same
+	// transaction as the change. Save returns ErrAliasInUse when the alias
+	// is taken, possibly by a link of another workspace.
+	Save(ctx context.Context, u *URL, events ...*OutboxEvent) (*URL, error)
+	Get(ctx context.Context, workspace int64, domain, alias string) (*URL, error)
+	Delete(ctx context.Context, workspace int64, domain, alias string, events ...*OutboxEvent) error
+	// DeletedSince reports whether a link with the alias was deleted at or
+	// after since.
+	DeletedSince(ctx context.Context, workspace int64, domain, alias string, since time.Time) (bool, error)
+	// Restore undeletes the latest link with the alias deleted at or after
+	// since. It returns ErrNotFound when there is none and ErrAliasInUse
+	// when the alias has been taken by a new link meanwhile. With quota
+	// the link quota of the link's workspace is checked in the same
+	// transaction; when the restored link would exceed it nothing is
+	// restored and ErrQuotaExceeded is returned.
+	Restore(ctx context.Context, workspace int64, domain, alias string, since time.Time, quota bool, events ...*OutboxEvent) (*URL, error)
+	// Purge permanently removes links deleted before the given time.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	List(ctx context.Context, f ListFilter) ([]*URL, error)
+	// FindReusable returns the newest plain link of the workspace in the
+	// domain created by the actor for the destination hash, or ErrNotFound.
+	// Plain links have no password, click limit, targeting, split, query
+	// mode, UTM parameters, details, tags or forced preview.
+	FindReusable(ctx context.Context, workspace int64, domain, urlHash, createdBy string) (*URL, error)
+	// ConsumeClick atomically decrements the remaining clicks of a limited
+	// link and returns the updated row, or ErrExhausted if none are left.
+	// Unless month is zero the click is also counted against the monthly
+	// quota of the link's workspace in the same transaction; when the
+	// quota is used up nothing is counted and ErrQuotaExceeded is
+	// returned.
+	ConsumeClick(ctx context.Context, domain, alias string, month time.Time) (*URL, error)
+	// SetPage stores the fetched metadata of the link's destination page.
+	SetPage(ctx context.Context, id int64, page *PageMeta) error
+}
+
+// ListFilter selects a page of links of a workspace, newest first. An
+// empty Tag matches every link.
+type ListFilter struct {
+	Workspace int64
+	Tag       string
+	// Search matches links whose alias, destination or title contain it,
+	// ignoring case.
+	Search string
+	Limit  int
+	Offset int
 }
 
 type postgresURLRepository struct {
 	db *sqlx.DB
+	// aliasMatch compares the alias column to the $2 parameter.
+	aliasMatch string
 }
 
-func NewURLRepository(db *sqlx.DB) URLRepository {
-	return &postgresURLRepository{db: db}
+type URLRepositoryOption func(*postgresURLRepository)
+
+// CaseInsensitiveAliases makes lookups by alias ignore case. Aliases are
+// stored as given; MigrateCaseInsensitiveAliases adds the index that keeps
+// them unique regardless of case.
+func CaseInsensitiveAliases() URLRepositoryOption {
+	return func(r *postgresURLRepository) {
+		r.aliasMatch = "lower(alias) = lower($2)"
+	}
 }
 
-func (r *postgresURLRepository) Exists(ctx context.Context, alias string) (bool, error) {
+func NewURLRepository(db *sqlx.DB, opts ...URLRepositoryOption) URLRepository {
+	r := &postgresURLRepository{db: db, aliasMatch: "alias = $2"}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+func (r *postgresURLRepository) Exists(ctx context.Context, workspace int64, domain, alias string) (bool, error) {
 	query := `
 		SELECT EXISTS (
 			SELECT 1
 			FROM url
-			WHERE alias = $1
+			WHERE domain = $1 AND ` + r.aliasMatch + ` AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3)
 		)
 	`
 
 	var exists bool
-	if err := r.db.GetContext(ctx, &exists, query, alias); err != nil {
+	if err := r.db.GetContext(ctx, &exists, query, domain, alias, workspace); err != nil {
 		return false, fmt.Errorf("failed to check if alias exists: %w", err)
 	}
 
 	return exists, nil
 }
 
-func (r *postgresURLRepository) Save(ctx context.Context, alias, url string) (*URL, error) {
+func (r *postgresURLRepository) Save(ctx context.Context, u *URL, events ...*OutboxEvent) (*URL, error) {
 	query := `
-		INSERT INTO url (alias, url)
-		VALUES ($1, $2)
-		RETURNING id;
+		INSERT INTO url (domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm,
+			title, description, tags, metadata, force_preview, url_hash, created_by, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING id, created_at;
 	`
 
-	urlEntity := &URL{
-		Alias: alias,
-		URL: url,
-	}
+	urlEntity := *u
+	urlEntity.ClicksLeft = u.MaxClicks
 
-	row := r.db.QueryRowContext(ctx, query, alias, url) 
-	if err := row.Scan(&urlEntity.ID); err != nil {
-		return nil, fmt.Errorf("failed to save url: %w", err)
+	err := withOutbox(ctx, r.db, events, func(q sqlx.ExtContext) error {
+		row := q.QueryRowxContext(ctx, query, u.Domain, u.Alias, u.URL, u.PasswordHash, u.MaxClicks, u.Rules, u.Variants, u.QueryMode, u.UTM,
+			u.Title, u.Description, u.Tags, u.Metadata, u.ForcePreview, u.URLHash, u.CreatedBy, u.Workspace)
+		if err := row.Scan(&urlEntity.ID, &urlEntity.CreatedAt); err != nil {
+			return fmt.Errorf("failed to save url: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrAliasInUse
+		}
+		return nil, err
 	}
 	
-	return urlEntity, nil
+	return &urlEntity, nil
 }
 
-func (r *postgresURLRepository) Get(ctx context.Context, alias string) (*URL, error) {
+func (r *postgresURLRepository) Get(ctx context.Context, workspace int64, domain, alias string) (*URL, error) {
     query := `
-        SELECT id, alias, url
+        SELECT ` + urlColumns + `
         FROM url
-        WHERE alias = $1;
+        WHERE domain = $1 AND ` + r.aliasMatch + ` AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);
     `
     var urlEntity URL
-    err := r.db.GetContext(ctx, &urlEntity, query, alias)
+    err := r.db.GetContext(ctx, &urlEntity, query, domain, alias, workspace)
     if err != nil {
         if errors.Is(err, sql.ErrNoRows) {
             return nil, ErrNotFound
@@ -85,15 +201,245 @@ func (r *postgresURLRepository) Get(ctx context.Context, alias string) (*URL, er
     return &urlEntity, nil
 }
 
-func (r *postgresURLRepository) Delete(ctx context.Context, alias string) error {
+func (r *postgresURLRepository) Delete(ctx context.Context, workspace int64, domain, alias string, events ...*OutboxEvent) error {
+	query := `
+		UPDATE url
+		SET deleted_at = now()
+		WHERE domain = $1 AND ` + r.aliasMatch + ` AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);
+	`
+
+	return withOutbox(ctx, r.db, events, func(q sqlx.ExtContext) error {
+		result, err := q.ExecContext(ctx, query, domain, alias, workspace)
+		if err != nil {
+			return fmt.Errorf("failed to delete url: %w", err)
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+func (r *postgresURLRepository) DeletedSince(ctx context.Context, workspace int64, domain, alias string, since time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM url
+			WHERE domain = $1 AND ` + r.aliasMatch + ` AND deleted_at >= $3 AND ($4::bigint = 0 OR workspace_id = $4)
+		)
+	`
+
+	var deleted bool
+	if err := r.db.GetContext(ctx, &deleted, query, domain, alias, since, workspace); err != nil {
+		return false, fmt.Errorf("failed to check deleted alias: %w", err)
+	}
+
+	return deleted, nil
+}
+
+func (r *postgresURLRepository) Restore(ctx context.Context, workspace int64, domain, alias string, since time.Time, quota bool, events ...*OutboxEvent) (*URL, error) {
+	query := `
+		UPDATE url
+		SET deleted_at = NULL
+		WHERE id = (
+			SELECT id
+			FROM url
+			WHERE domain = $1 AND ` + r.aliasMatch + ` AND deleted_at >= $3 AND ($4::bigint = 0 OR workspace_id = $4)
+			ORDER BY deleted_at DESC
+			LIMIT 1
+		)
+		RETURNING ` + urlColumns + `;
+	`
+
+	var urlEntity URL
+	restore := func(q sqlx.ExtContext) error {
+		if err := sqlx.GetContext(ctx, q, &urlEntity, query, domain, alias, since, workspace); err != nil {
+			return err
+		}
+		if !quota {
+			return nil
+		}
+		return checkWorkspaceLinks(ctx, q, urlEntity.Workspace)
+	}
+
+	var err error
+	if quota {
+		err = withTx(ctx, r.db, func(tx sqlx.ExtContext) error {
+			if err := restore(tx); err != nil {
+				return err
+			}
+			return insertOutbox(ctx, tx, events)
+		})
+	} else {
+		err = withOutbox(ctx, r.db, events, restore)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		case isUniqueViolation(err):
+			return nil, ErrAliasInUse
+		case errors.Is(err, ErrQuotaExceeded):
+			return nil, err
+		default:
+			return nil, fmt.Errorf("failed to restore url: %w", err)
+		}
+	}
+
+	return &urlEntity, nil
+}
+
+func (r *postgresURLRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
 	query := `
 		DELETE FROM url
-		WHERE alias = $1;
+		WHERE deleted_at < $1;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge urls: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
+func (r *postgresURLRepository) FindReusable(ctx context.Context, workspace int64, domain, urlHash, createdBy string) (*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM url
+		WHERE domain = $1 AND url_hash = $2 AND created_by = $3 AND workspace_id = $4
+			AND deleted_at IS NULL AND password_hash = '' AND max_clicks IS NULL
+			AND rules = '[]' AND variants = '[]' AND query_mode = '' AND utm = '{}'
+			AND title = '' AND description = '' AND tags = '{}' AND metadata = '{}'
+			AND NOT force_preview
+		ORDER BY id DESC
+		LIMIT 1;
 	`
 
-	result, err := r.db.ExecContext(ctx, query, alias)
+	var urlEntity URL
+	if err := r.db.GetContext(ctx, &urlEntity, query, domain, urlHash, createdBy, workspace); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find reusable url: %w", err)
+	}
+
+	return &urlEntity, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, so that searches
+// match them literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (r *postgresURLRepository) List(ctx context.Context, f ListFilter) ([]*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM url
+		WHERE deleted_at IS NULL AND ($1 = '' OR tags @> ARRAY[$1::text]) AND ($4::bigint = 0 OR workspace_id = $4)
+			AND ($5 = '' OR alias ILIKE $5 OR url ILIKE $5 OR title ILIKE $5)
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3;
+	`
+
+	var pattern string
+	if f.Search != "" {
+		pattern = "%" + likeEscaper.Replace(f.Search) + "%"
+	}
+
+	urls := []*URL{}
+	if err := r.db.SelectContext(ctx, &urls, query, f.Tag, f.Limit, f.Offset, f.Workspace, pattern); err != nil {
+		return nil, fmt.Errorf("failed to list urls: %w", err)
+	}
+
+	return urls, nil
+}
+
+func (r *postgresURLRepository) ConsumeClick(ctx context.Context, domain, alias string, month time.Time) (*URL, error) {
+	query := `
+		UPDATE url
+		SET clicks_left = clicks_left - 1
+		WHERE domain = $1 AND alias = $2 AND clicks_left > 0 AND deleted_at IS NULL
+		RETURNING ` + urlColumns + `;
+	`
+
+	var urlEntity URL
+	err := r.consumeClick(ctx, month, func(q sqlx.ExtContext) error {
+		if err := sqlx.GetContext(ctx, q, &urlEntity, query, domain, alias); err != nil {
+			return err
+		}
+		if month.IsZero() {
+			return nil
+		}
+		return consumeWorkspaceClick(ctx, q, urlEntity.Workspace, month)
+	})
+	if err == nil {
+		return &urlEntity, nil
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		return nil, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to consume click: %w", err)
+	}
+
+	// Nothing was updated: tell a missing alias apart from an exhausted one.
+	exists, err := r.Exists(ctx, AnyWorkspace, domain, alias)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return nil, ErrExhausted
+}
+
+// consumeClick runs fn in a transaction when the click is also counted
+// against the workspace quota, so an exceeded quota rolls back the
+// decrement, and directly on db otherwise.
+func (r *postgresURLRepository) consumeClick(ctx context.Context, month time.Time, fn func(q sqlx.ExtContext) error) error {
+	if month.IsZero() {
+		return fn(r.db)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresURLRepository) SetPage(ctx context.Context, id int64, page *PageMeta) error {
+	query := `
+		UPDATE url
+		SET page = $2
+		WHERE id = $1;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, page)
 	if err != nil {
-		return fmt.Errorf("failed to delete url: %w", err)
+		return fmt.Errorf("failed to set page metadata: %w", err)
 	}
 
 	rows, err := result.RowsAffected()
@@ -106,4 +452,4 @@ func (r *postgresURLRepository) Delete(ctx context.Context, alias string) error
 	}
 
 	return nil
-}
\ No newline at end of file
+}
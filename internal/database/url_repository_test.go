@@ -6,8 +6,10 @@ import (
 	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/require"
 
@@ -23,30 +25,30 @@ func TestExists(t *testing.T) {
 
 	t.Run("exists true", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (")).
-			WithArgs("alias123").
+			WithArgs("", "alias123", database.DefaultWorkspace).
 			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
-		ok, err := repo.Exists(ctx, "alias123")
+		ok, err := repo.Exists(ctx, database.DefaultWorkspace, "", "alias123")
 		require.NoError(t, err)
 		require.True(t, ok)
 	})
 
 	t.Run("exists false", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (")).
-			WithArgs("alias123").
+			WithArgs("", "alias123", database.DefaultWorkspace).
 			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
-		ok, err := repo.Exists(ctx, "alias123")
+		ok, err := repo.Exists(ctx, database.DefaultWorkspace, "", "alias123")
 		require.NoError(t, err)
 		require.False(t, ok)
 	})
 
 	t.Run("db error", func(t *testing.T) {
 		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (")).
-			WithArgs("alias123").
+			WithArgs("", "alias123", database.DefaultWorkspace).
 			WillReturnError(errors.New("db error"))
 
-		ok, err := repo.Exists(ctx, "alias123")
+		ok, err := repo.Exists(ctx, database.DefaultWorkspace, "", "alias123")
 		require.Error(t, err)
 		require.False(t, ok)
 	})
@@ -60,32 +62,41 @@ func TestSave(t *testing.T) {
 	defer db.Close()
 	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
 	ctx := context.Background()
+	now := time.Now()
 
 	t.Run("success", func(t *testing.T) {
-		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO url (alias, url)
-		VALUES ($1, $2)
-		RETURNING id;`)).
-			WithArgs("alias", "http://example.com").
-			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO url (domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, force_preview, url_hash, created_by, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING id, created_at;`)).
+			WithArgs("", "alias", "http://example.com", "", nil, []byte("[]"), []byte("[]"), "", []byte("{}"), "", "", "{}", []byte("{}"), false, "", "", int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, now))
 
-		entity, err := repo.Save(ctx, "alias", "http://example.com")
+		entity, err := repo.Save(ctx, &database.URL{Alias: "alias", URL: "http://example.com"})
 		require.NoError(t, err)
 		require.Equal(t, int64(10), entity.ID)
+		require.Equal(t, now, entity.CreatedAt)
 		require.Equal(t, "alias", entity.Alias)
 		require.Equal(t, "http://example.com", entity.URL)
 	})
 
 	t.Run("scan error", func(t *testing.T) {
-		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO url (alias, url)
-		VALUES ($1, $2)
-		RETURNING id;`)).
-			WithArgs("alias", "http://example.com").
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO url (domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, force_preview, url_hash, created_by, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING id, created_at;`)).
+			WithArgs("", "alias", "http://example.com", "", nil, []byte("[]"), []byte("[]"), "", []byte("{}"), "", "", "{}", []byte("{}"), false, "", "", int64(0)).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}))
-		_, err := repo.Save(ctx, "alias", "http://example.com")
+		_, err := repo.Save(ctx, &database.URL{Alias: "alias", URL: "http://example.com"})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to save url")
 	})
 
+	t.Run("alias in use", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO url")).
+			WillReturnError(&pgconn.PgError{Code: "23505"})
+		_, err := repo.Save(ctx, &database.URL{Alias: "alias", URL: "http://example.com", Workspace: 2})
+		require.ErrorIs(t, err, database.ErrAliasInUse)
+	})
+
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -97,40 +108,52 @@ func TestGet(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("success", func(t *testing.T) {
-		rows := sqlmock.NewRows([]string{"id", "alias", "url"}).
-			AddRow(5, "alias", "http://example.com")
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, alias, url
+		rows := sqlmock.NewRows([]string{"id", "domain", "alias", "url", "password_hash", "max_clicks", "clicks_left"}).
+			AddRow(5, "", "alias", "http://example.com", "", nil, nil)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, page, force_preview, created_at, url_hash, created_by, workspace_id
 		FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnRows(rows)
 
-		entity, err := repo.Get(ctx, "alias")
+		entity, err := repo.Get(ctx, database.DefaultWorkspace, "", "alias")
 		require.NoError(t, err)
 		require.Equal(t, int64(5), entity.ID)
 		require.Equal(t, "alias", entity.Alias)
 		require.Equal(t, "http://example.com", entity.URL)
 	})
 
+	t.Run("with rules", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "domain", "alias", "url", "password_hash", "max_clicks", "clicks_left", "rules"}).
+			AddRow(6, "", "app", "http://example.com", "", nil, nil, []byte(`[{"platform":"ios","url":"https://apps.apple.com"}]`))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("", "app", database.DefaultWorkspace).
+			WillReturnRows(rows)
+
+		entity, err := repo.Get(ctx, database.DefaultWorkspace, "", "app")
+		require.NoError(t, err)
+		require.Equal(t, database.TargetRules{{Platform: "ios", URL: "https://apps.apple.com"}}, entity.Rules)
+	})
+
 	t.Run("not found", func(t *testing.T) {
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, alias, url
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, page, force_preview, created_at, url_hash, created_by, workspace_id
 		FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnError(sql.ErrNoRows)
 
-		_, err := repo.Get(ctx, "alias")
+		_, err := repo.Get(ctx, database.DefaultWorkspace, "", "alias")
 		require.ErrorIs(t, err, database.ErrNotFound)
 	})
 
 	t.Run("db error", func(t *testing.T) {
-		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, alias, url
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, page, force_preview, created_at, url_hash, created_by, workspace_id
 		FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnError(errors.New("oh no"))
 
-		_, err := repo.Get(ctx, "alias")
+		_, err := repo.Get(ctx, database.DefaultWorkspace, "", "alias")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "postgresURLRepository.Get")
 	})
@@ -146,47 +169,461 @@ func TestDelete(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("success", func(t *testing.T) {
-		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE url
+		SET deleted_at = now()
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 
-		err := repo.Delete(ctx, "alias")
+		err := repo.Delete(ctx, database.DefaultWorkspace, "", "alias")
 		require.NoError(t, err)
 	})
 
 	t.Run("not found", func(t *testing.T) {
-		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE url
+		SET deleted_at = now()
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnResult(sqlmock.NewResult(0, 0))
 
-		err := repo.Delete(ctx, "alias")
+		err := repo.Delete(ctx, database.DefaultWorkspace, "", "alias")
 		require.ErrorIs(t, err, database.ErrNotFound)
 	})
 
 	t.Run("exec error", func(t *testing.T) {
-		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE url
+		SET deleted_at = now()
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnError(errors.New("exec fail"))
 
-		err := repo.Delete(ctx, "alias")
+		err := repo.Delete(ctx, database.DefaultWorkspace, "", "alias")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to delete url")
 	})
 
 	t.Run("rows affected error", func(t *testing.T) {
 		result := sqlmock.NewErrorResult(errors.New("nope"))
-		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM url
-		WHERE alias = $1;`)).
-			WithArgs("alias").
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE url
+		SET deleted_at = now()
+		WHERE domain = $1 AND alias = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR workspace_id = $3);`)).
+			WithArgs("", "alias", database.DefaultWorkspace).
 			WillReturnResult(result)
 
-		err := repo.Delete(ctx, "alias")
+		err := repo.Delete(ctx, database.DefaultWorkspace, "", "alias")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to get rows affected")
 	})
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestDeletedSince(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE domain = $1 AND alias = $2 AND deleted_at >= $3")).
+		WithArgs("", "promo", since, database.DefaultWorkspace).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	deleted, err := repo.DeletedSince(context.Background(), database.DefaultWorkspace, "", "promo", since)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	update := regexp.QuoteMeta(`UPDATE url
+		SET deleted_at = NULL`)
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "promo", since, database.DefaultWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "domain", "alias", "url"}).AddRow(5, "", "promo", "http://example.com"))
+
+		u, err := repo.Restore(ctx, database.DefaultWorkspace, "", "promo", since, false)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), u.ID)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "gone", since, database.DefaultWorkspace).
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.Restore(ctx, database.DefaultWorkspace, "", "gone", since, false)
+		require.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("alias taken", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "promo", since, database.DefaultWorkspace).
+			WillReturnError(&pgconn.PgError{Code: "23505"})
+
+		_, err := repo.Restore(ctx, database.DefaultWorkspace, "", "promo", since, false)
+		require.ErrorIs(t, err, database.ErrAliasInUse)
+	})
+
+	t.Run("within quota", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(update).
+			WithArgs("", "promo", since, database.DefaultWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "workspace_id"}).AddRow(5, "promo", 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT max_links FROM workspace WHERE id = $1 FOR UPDATE;`)).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"max_links"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM url`)).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectCommit()
+
+		u, err := repo.Restore(ctx, database.DefaultWorkspace, "", "promo", since, true)
+		require.NoError(t, err)
+		require.Equal(t, int64(5), u.ID)
+	})
+
+	t.Run("over quota", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(update).
+			WithArgs("", "promo", since, database.DefaultWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "workspace_id"}).AddRow(5, "promo", 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT max_links FROM workspace WHERE id = $1 FOR UPDATE;`)).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"max_links"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM url`)).
+			WithArgs(int64(1)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectRollback()
+
+		_, err := repo.Restore(ctx, database.DefaultWorkspace, "", "promo", since, true)
+		require.ErrorIs(t, err, database.ErrQuotaExceeded)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	before := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM url")).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := repo.Purge(context.Background(), before)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindReusable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("WHERE domain = $1 AND url_hash = $2 AND created_by = $3 AND workspace_id = $4")).
+			WithArgs("", "abc", "key:1", int64(2)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "url", "url_hash", "created_by"}).AddRow(4, "promo", "https://example.com", "abc", "key:1"))
+
+		u, err := repo.FindReusable(ctx, 2, "", "abc", "key:1")
+		require.NoError(t, err)
+		require.Equal(t, "promo", u.Alias)
+		require.Equal(t, "key:1", u.CreatedBy)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("", "abc", "key:2", int64(2)).
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.FindReusable(ctx, 2, "", "abc", "key:2")
+		require.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "domain", "alias", "url", "password_hash", "max_clicks", "clicks_left"}).
+			AddRow(2, "", "second", "http://two.com", "", 3, 1).
+			AddRow(1, "", "first", "http://one.com", "$2a$10$hash", nil, nil)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, domain, alias, url, password_hash, max_clicks, clicks_left, rules, variants, query_mode, utm, title, description, tags, metadata, page, force_preview, created_at, url_hash, created_by, workspace_id
+		FROM url
+		WHERE deleted_at IS NULL AND ($1 = '' OR tags @> ARRAY[$1::text]) AND ($4::bigint = 0 OR workspace_id = $4)
+			AND ($5 = '' OR alias ILIKE $5 OR url ILIKE $5 OR title ILIKE $5)
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3;`)).
+			WithArgs("", 10, 0, database.DefaultWorkspace, "").
+			WillReturnRows(rows)
+
+		urls, err := repo.List(ctx, database.ListFilter{Workspace: database.DefaultWorkspace, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, urls, 2)
+		require.Equal(t, "second", urls[0].Alias)
+		require.Equal(t, "http://one.com", urls[1].URL)
+		require.Equal(t, "$2a$10$hash", urls[1].PasswordHash)
+		require.Equal(t, int64(1), *urls[0].ClicksLeft)
+		require.Nil(t, urls[1].MaxClicks)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("", 10, 20, database.DefaultWorkspace, "").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "domain", "alias", "url", "password_hash", "max_clicks", "clicks_left"}))
+
+		urls, err := repo.List(ctx, database.ListFilter{Workspace: database.DefaultWorkspace, Limit: 10, Offset: 20})
+		require.NoError(t, err)
+		require.Empty(t, urls)
+	})
+
+	t.Run("by tag", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("promo", 10, 0, database.DefaultWorkspace, "").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "url", "title", "tags", "metadata"}).
+				AddRow(3, "spring", "http://spring.com", "Spring sale", `{promo,"spring 2025"}`, []byte(`{"owner":"growth"}`)))
+
+		urls, err := repo.List(ctx, database.ListFilter{Tag: "promo", Workspace: database.DefaultWorkspace, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, urls, 1)
+		require.Equal(t, "Spring sale", urls[0].Title)
+		require.Equal(t, database.Tags{"promo", "spring 2025"}, urls[0].Tags)
+		require.Equal(t, database.Metadata{"owner": "growth"}, urls[0].Metadata)
+	})
+
+	t.Run("search escapes wildcards", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("", 10, 0, database.DefaultWorkspace, `%50\%\_off%`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "url"}))
+
+		_, err := repo.List(ctx, database.ListFilter{Search: "50%_off", Workspace: database.DefaultWorkspace, Limit: 10})
+		require.NoError(t, err)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("", 10, 0, database.DefaultWorkspace, "").
+			WillReturnError(errors.New("boom"))
+
+		_, err := repo.List(ctx, database.ListFilter{Workspace: database.DefaultWorkspace, Limit: 10})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to list urls")
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConsumeClick(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+
+	update := regexp.QuoteMeta(`UPDATE url
+		SET clicks_left = clicks_left - 1
+		WHERE domain = $1 AND alias = $2 AND clicks_left > 0`)
+	columns := []string{"id", "domain", "alias", "url", "password_hash", "max_clicks", "clicks_left"}
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "once").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "", "once", "http://example.com", "", 1, 0))
+
+		entity, err := repo.ConsumeClick(ctx, "", "once", time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, int64(0), *entity.ClicksLeft)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "once").
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (")).
+			WithArgs("", "once", database.AnyWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		_, err := repo.ConsumeClick(ctx, "", "once", time.Time{})
+		require.ErrorIs(t, err, database.ErrExhausted)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "missing").
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (")).
+			WithArgs("", "missing", database.AnyWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		_, err := repo.ConsumeClick(ctx, "", "missing", time.Time{})
+		require.ErrorIs(t, err, database.ErrNotFound)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		mock.ExpectQuery(update).
+			WithArgs("", "once").
+			WillReturnError(errors.New("boom"))
+
+		_, err := repo.ConsumeClick(ctx, "", "once", time.Time{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to consume click")
+	})
+
+	month := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	usage := regexp.QuoteMeta("INSERT INTO workspace_usage AS u (workspace_id, month, clicks)")
+
+	t.Run("charges the workspace quota", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(update).
+			WithArgs("", "once").
+			WillReturnRows(sqlmock.NewRows(append(columns, "workspace_id")).AddRow(1, "", "once", "http://example.com", "", 1, 0, 3))
+		mock.ExpectExec(usage).
+			WithArgs(int64(3), month).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		entity, err := repo.ConsumeClick(ctx, "", "once", month)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), entity.Workspace)
+	})
+
+	t.Run("quota exceeded rolls back the click", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(update).
+			WithArgs("", "once").
+			WillReturnRows(sqlmock.NewRows(append(columns, "workspace_id")).AddRow(1, "", "once", "http://example.com", "", 1, 0, 3))
+		mock.ExpectExec(usage).
+			WithArgs(int64(3), month).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		_, err := repo.ConsumeClick(ctx, "", "once", month)
+		require.ErrorIs(t, err, database.ErrQuotaExceeded)
+	})
+
+	t.Run("exhausted link does not charge the quota", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(update).
+			WithArgs("", "once").
+			WillReturnRows(sqlmock.NewRows(columns))
+		mock.ExpectRollback()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (")).
+			WithArgs("", "once", database.AnyWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		_, err := repo.ConsumeClick(ctx, "", "once", month)
+		require.ErrorIs(t, err, database.ErrExhausted)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	update := regexp.QuoteMeta("UPDATE url SET page = $2 WHERE id = $1;")
+	page := &database.PageMeta{Title: "Example", FetchedAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectExec(update).
+			WithArgs(int64(5), []byte(`{"title":"Example","fetched_at":"2025-03-01T12:00:00Z"}`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, repo.SetPage(ctx, 5, page))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectExec(update).
+			WithArgs(int64(6), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		require.ErrorIs(t, repo.SetPage(ctx, 6, page), database.ErrNotFound)
+	})
+
+	t.Run("scan", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM url")).
+			WithArgs("", "alias", database.DefaultWorkspace).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "page"}).
+				AddRow(5, "alias", []byte(`{"title":"Example","favicon":"https://example.com/favicon.ico"}`)))
+
+		u, err := repo.Get(ctx, database.DefaultWorkspace, "", "alias")
+		require.NoError(t, err)
+		require.Equal(t, &database.PageMeta{Title: "Example", Favicon: "https://example.com/favicon.ico"}, u.Page)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCaseInsensitiveAliases(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewURLRepository(sqlx.NewDb(db, "sqlmock"), database.CaseInsensitiveAliases())
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "domain", "alias", "url"}).
+		AddRow(5, "", "Promo", "http://example.com")
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE domain = $1 AND lower(alias) = lower($2) AND deleted_at IS NULL`)).
+		WithArgs("", "PROMO", database.DefaultWorkspace).
+		WillReturnRows(rows)
+
+	entity, err := repo.Get(ctx, database.DefaultWorkspace, "", "PROMO")
+	require.NoError(t, err)
+	require.Equal(t, "Promo", entity.Alias)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrateCaseInsensitiveAliases(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	sdb := sqlx.NewDb(db, "sqlmock")
+	ctx := context.Background()
+
+	t.Run("collisions", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`GROUP BY domain, lower(alias)`)).
+			WillReturnRows(sqlmock.NewRows([]string{"domain", "aliases"}).
+				AddRow("", "{Promo,promo}").
+				AddRow("go.example.com", "{Sale,SALE}"))
+
+		err := database.MigrateCaseInsensitiveAliases(ctx, sdb)
+		require.ErrorIs(t, err, database.ErrAliasCollisions)
+		require.Contains(t, err.Error(), "[Promo, promo] [go.example.com: Sale, SALE]")
+	})
+
+	t.Run("creates index", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`GROUP BY domain, lower(alias)`)).
+			WillReturnRows(sqlmock.NewRows([]string{"domain", "aliases"}))
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE UNIQUE INDEX IF NOT EXISTS idx_url_domain_lower_alias ON url(domain, lower(alias)) WHERE deleted_at IS NULL;`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		require.NoError(t, database.MigrateCaseInsensitiveAliases(ctx, sdb))
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type User struct {
+	ID           int64     `db:"id"`
+	Email        string    `db:"email"`
+	PasswordHash string    `db:"password_hash"`
+	Workspace    int64     `db:"workspace_id"`
+	Roles        Tags      `db:"roles"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// Session is a signed-in browser. Only the SHA-256 of its cookie token is
+// stored, while the CSRF token is kept as is, since it has to be handed
+// back to the client.
+type Session struct {
+	TokenHash string    `db:"token_hash"`
+	UserID    int64     `db:"user_id"`
+	CSRFToken string    `db:"csrf_token"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+type UserRepository interface {
+	// Upsert creates or updates the user with the email as a member of the
+	// workspace with the name. It returns ErrWorkspaceNotFound when there
+	// is no such workspace.
+	Upsert(ctx context.Context, u *User, workspace string) (*User, error)
+	// UpsertSSO creates or updates the user with the email, roles and
+	// workspace asserted by the SSO provider. The password of existing
+	// users is kept, and nothing is written when nothing changed.
+	UpsertSSO(ctx context.Context, u *User, workspace string) (*User, error)
+	ByEmail(ctx context.Context, email string) (*User, error)
+	// CreateSession stores the session and drops the expired ones of its
+	// user.
+	CreateSession(ctx context.Context, s *Session) error
+	// Session returns the session with the token hash together with its
+	// user, ErrSessionNotFound when there is none or it expired before
+	// now.
+	Session(ctx context.Context, tokenHash string, now time.Time) (*Session, *User, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+}
+
+type postgresUserRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserRepository(db *sqlx.DB) UserRepository {
+	return &postgresUserRepository{db: db}
+}
+
+func (r *postgresUserRepository) Upsert(ctx context.Context, u *User, workspace string) (*User, error) {
+	query := `
+		INSERT INTO users (email, password_hash, workspace_id, roles)
+		SELECT $1, $2, id, $4
+		FROM workspace
+		WHERE name = $3
+		ON CONFLICT (email) DO UPDATE
+		SET password_hash = EXCLUDED.password_hash, workspace_id = EXCLUDED.workspace_id, roles = EXCLUDED.roles
+		RETURNING id, email, password_hash, workspace_id, roles, created_at;
+	`
+
+	var out User
+	if err := r.db.GetContext(ctx, &out, query, u.Email, u.PasswordHash, workspace, u.Roles); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to upsert user: %w", err)
+	}
+
+	return &out, nil
+}
+
+func (r *postgresUserRepository) UpsertSSO(ctx context.Context, u *User, workspace string) (*User, error) {
+	// The update is skipped for users that are up to date, who are then
+	// returned as they are. No row is returned for unknown workspaces.
+	query := `
+		WITH w AS (
+			SELECT id FROM workspace WHERE name = $2
+		), upserted AS (
+			INSERT INTO users (email, password_hash, workspace_id, roles)
+			SELECT $1, '', id, $3 FROM w
+			ON CONFLICT (email) DO UPDATE
+			SET workspace_id = EXCLUDED.workspace_id, roles = EXCLUDED.roles
+			WHERE (users.workspace_id, users.roles) IS DISTINCT FROM (EXCLUDED.workspace_id, EXCLUDED.roles)
+			RETURNING id, email, password_hash, workspace_id, roles, created_at
+		)
+		SELECT id, email, password_hash, workspace_id, roles, created_at FROM upserted
+		UNION ALL
+		SELECT u.id, u.email, u.password_hash, u.workspace_id, u.roles, u.created_at
+		FROM users u
+		WHERE u.email = $1 AND EXISTS (SELECT 1 FROM w) AND NOT EXISTS (SELECT 1 FROM upserted);
+	`
+
+	var out User
+	if err := r.db.GetContext(ctx, &out, query, u.Email, workspace, u.Roles); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to upsert user: %w", err)
+	}
+
+	return &out, nil
+}
+
+func (r *postgresUserRepository) ByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, email, password_hash, workspace_id, roles, created_at
+		FROM users
+		WHERE email = $1;
+	`
+
+	var u User
+	if err := r.db.GetContext(ctx, &u, query, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to find user by email: %w", err)
+	}
+
+	return &u, nil
+}
+
+func (r *postgresUserRepository) CreateSession(ctx context.Context, s *Session) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_session WHERE user_id = $1 AND expires_at <= now();`, s.UserID); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	query := `
+		INSERT INTO user_session (token_hash, user_id, csrf_token, expires_at)
+		VALUES ($1, $2, $3, $4);
+	`
+	if _, err := tx.ExecContext(ctx, query, s.TokenHash, s.UserID, s.CSRFToken, s.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresUserRepository) Session(ctx context.Context, tokenHash string, now time.Time) (*Session, *User, error) {
+	query := `
+		SELECT s.token_hash, s.user_id, s.csrf_token, s.expires_at, s.created_at,
+			u.email, u.password_hash, u.workspace_id, u.roles, u.created_at AS user_created_at
+		FROM user_session s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > $2;
+	`
+
+	var row struct {
+		Session
+		Email         string    `db:"email"`
+		PasswordHash  string    `db:"password_hash"`
+		Workspace     int64     `db:"workspace_id"`
+		Roles         Tags      `db:"roles"`
+		UserCreatedAt time.Time `db:"user_created_at"`
+	}
+	if err := r.db.GetContext(ctx, &row, query, tokenHash, now); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrSessionNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	u := &User{
+		ID:           row.UserID,
+		Email:        row.Email,
+		PasswordHash: row.PasswordHash,
+		Workspace:    row.Workspace,
+		Roles:        row.Roles,
+		CreatedAt:    row.UserCreatedAt,
+	}
+
+	return &row.Session, u, nil
+}
+
+func (r *postgresUserRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM user_session WHERE token_hash = $1;`, tokenHash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return nil
+}
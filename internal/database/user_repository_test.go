@@ -0,0 +1,129 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestUserUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewUserRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	query := regexp.QuoteMeta("INSERT INTO users (email, password_hash, workspace_id, roles)")
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs("a@example.com", "hash", "team", "{editor}").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password_hash", "workspace_id", "roles", "created_at"}).
+				AddRow(1, "a@example.com", "hash", 2, "{editor}", time.Now()))
+
+		u, err := repo.Upsert(ctx, &database.User{Email: "a@example.com", PasswordHash: "hash", Roles: database.Tags{"editor"}}, "team")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), u.Workspace)
+		require.Equal(t, database.Tags{"editor"}, u.Roles)
+	})
+
+	t.Run("unknown workspace", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs("a@example.com", "hash", "nope", "{}").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.Upsert(ctx, &database.User{Email: "a@example.com", PasswordHash: "hash"}, "nope")
+		require.ErrorIs(t, err, database.ErrWorkspaceNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserUpsertSSO(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewUserRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	query := regexp.QuoteMeta("INSERT INTO users (email, password_hash, workspace_id, roles)")
+
+	t.Run("success", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs("a@example.com", "team", "{admin,editor}").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password_hash", "workspace_id", "roles", "created_at"}).
+				AddRow(1, "a@example.com", "", 2, "{admin,editor}", time.Now()))
+
+		u, err := repo.UpsertSSO(ctx, &database.User{Email: "a@example.com", Roles: database.Tags{"admin", "editor"}}, "team")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), u.Workspace)
+		require.Equal(t, database.Tags{"admin", "editor"}, u.Roles)
+	})
+
+	t.Run("unknown workspace", func(t *testing.T) {
+		mock.ExpectQuery(query).
+			WithArgs("a@example.com", "nope", "{}").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := repo.UpsertSSO(ctx, &database.User{Email: "a@example.com"}, "nope")
+		require.ErrorIs(t, err, database.ErrWorkspaceNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewUserRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	t.Run("create drops expired sessions", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_session WHERE user_id = $1 AND expires_at <= now();")).
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_session (token_hash, user_id, csrf_token, expires_at)")).
+			WithArgs("abc", int64(1), "csrf", expiresAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.CreateSession(ctx, &database.Session{TokenHash: "abc", UserID: 1, CSRFToken: "csrf", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+	})
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("WHERE s.token_hash = $1 AND s.expires_at > $2;")).
+			WithArgs("abc", now).
+			WillReturnRows(sqlmock.NewRows([]string{
+				"token_hash", "user_id", "csrf_token", "expires_at", "created_at",
+				"email", "password_hash", "workspace_id", "user_created_at",
+			}).AddRow("abc", 1, "csrf", expiresAt, now, "a@example.com", "hash", 2, now))
+
+		s, u, err := repo.Session(ctx, "abc", now)
+		require.NoError(t, err)
+		require.Equal(t, "csrf", s.CSRFToken)
+		require.Equal(t, int64(1), u.ID)
+		require.Equal(t, int64(2), u.Workspace)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM user_session s")).
+			WithArgs("old", now).
+			WillReturnError(sql.ErrNoRows)
+
+		_, _, err := repo.Session(ctx, "old", now)
+		require.ErrorIs(t, err, database.ErrSessionNotFound)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
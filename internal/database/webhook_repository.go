@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Webhook is a subscription to the link events of a workspace. An empty
+// Events list subscribes to every event.
+type Webhook struct {
+	ID        int64     `db:"id"`
+	Workspace int64     `db:"workspace_id"`
+	URL       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	Events    Tags      `db:"events"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to a webhook.
+// StatusCode is zero when no response was received.
+type WebhookDelivery struct {
+	ID         int64     `db:"id"`
+	WebhookID  int64     `db:"webhook_id"`
+	EventID    string    `db:"event_id"`
+	Event      string    `db:"event"`
+	Attempt    int       `db:"attempt"`
+	StatusCode int       `db:"status_code"`
+	Error      string    `db:"error"`
+	DurationMS int64     `db:"duration_ms"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookRepository stores webhooks per workspace: lookups of another
+// workspace's webhook return ErrWebhookNotFound.
+type WebhookRepository interface {
+	Create(ctx context.Context, w *Webhook) (*Webhook, error)
+	Get(ctx context.Context, workspace, id int64) (*Webhook, error)
+	List(ctx context.Context, workspace int64) ([]*Webhook, error)
+	// ListForEvent returns the webhooks of the workspace subscribed to the
+	// event.
+	ListForEvent(ctx context.Context, workspace int64, event string) ([]*Webhook, error)
+	Delete(ctx context.Context, workspace, id int64) error
+	LogDelivery(ctx context.Context, d *WebhookDelivery) error
+	// Deliveries returns the latest delivery attempts of a webhook, newest
+	// first.
+	Deliveries(ctx context.Context, webhookID int64, limit int) ([]*WebhookDelivery, error)
+	// EventDeliveries returns every delivery attempt of an event, oldest
+	// first.
+	EventDeliveries(ctx context.Context, eventID string) ([]*WebhookDelivery, error)
+}
+
+type postgresWebhookRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebhookRepository(db *sqlx.DB) WebhookRepository {
+	return &postgresWebhookRepository{db: db}
+}
+
+func (r *postgresWebhookRepository) Create(ctx context.Context, w *Webhook) (*Webhook, error) {
+	query := `
+		INSERT INTO webhooks (workspace_id, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, workspace_id, url, secret, events, created_at;
+	`
+
+	var out Webhook
+	if err := r.db.GetContext(ctx, &out, query, w.Workspace, w.URL, w.Secret, w.Events); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return &out, nil
+}
+
+func (r *postgresWebhookRepository) Get(ctx context.Context, workspace, id int64) (*Webhook, error) {
+	query := `
+		SELECT id, workspace_id, url, secret, events, created_at
+		FROM webhooks
+		WHERE id = $1 AND workspace_id = $2;
+	`
+
+	var w Webhook
+	if err := r.db.GetContext(ctx, &w, query, id, workspace); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return &w, nil
+}
+
+func (r *postgresWebhookRepository) List(ctx context.Context, workspace int64) ([]*Webhook, error) {
+	query := `
+		SELECT id, workspace_id, url, secret, events, created_at
+		FROM webhooks
+		WHERE workspace_id = $1
+		ORDER BY id;
+	`
+
+	webhooks := []*Webhook{}
+	if err := r.db.SelectContext(ctx, &webhooks, query, workspace); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+func (r *postgresWebhookRepository) ListForEvent(ctx context.Context, workspace int64, event string) ([]*Webhook, error) {
+	query := `
+		SELECT id, workspace_id, url, secret, events, created_at
+		FROM webhooks
+		WHERE workspace_id = $1 AND (events = '{}' OR $2 = ANY(events))
+		ORDER BY id;
+	`
+
+	webhooks := []*Webhook{}
+	if err := r.db.SelectContext(ctx, &webhooks, query, workspace, event); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks for event: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+func (r *postgresWebhookRepository) Delete(ctx context.Context, workspace, id int64) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND workspace_id = $2;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, workspace)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresWebhookRepository) LogDelivery(ctx context.Context, d *WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, attempt, status_code, error, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		d.WebhookID, d.EventID, d.Event, d.Attempt, d.StatusCode, d.Error, d.DurationMS)
+	if err != nil {
+		return fmt.Errorf("failed to log webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresWebhookRepository) Deliveries(ctx context.Context, webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event_id, event, attempt, status_code, error, duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2;
+	`
+
+	deliveries := []*WebhookDelivery{}
+	if err := r.db.SelectContext(ctx, &deliveries, query, webhookID, limit); err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (r *postgresWebhookRepository) EventDeliveries(ctx context.Context, eventID string) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event_id, event, attempt, status_code, error, duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE event_id = $1
+		ORDER BY id;
+	`
+
+	deliveries := []*WebhookDelivery{}
+	if err := r.db.SelectContext(ctx, &deliveries, query, eventID); err != nil {
+		return nil, fmt.Errorf("failed to list event deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,96 @@
+package database_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestWebhookCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWebhookRepository(sqlx.NewDb(db, "sqlmock"))
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks (workspace_id, url, secret, events)")).
+		WithArgs(int64(2), "https://crm.example.com", "secret", database.Tags{"link.created"}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "url", "secret", "events", "created_at"}).
+			AddRow(1, 2, "https://crm.example.com", "secret", "{link.created}", now))
+
+	w, err := repo.Create(context.Background(), &database.Webhook{
+		Workspace: 2,
+		URL:       "https://crm.example.com",
+		Secret:    "secret",
+		Events:    database.Tags{"link.created"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), w.ID)
+	require.Equal(t, int64(2), w.Workspace)
+	require.Equal(t, database.Tags{"link.created"}, w.Events)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookListForEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWebhookRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE workspace_id = $1 AND (events = '{}' OR $2 = ANY(events))")).
+		WithArgs(int64(2), "link.clicked").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "url", "secret", "events", "created_at"}).
+			AddRow(1, 2, "https://a.example.com", "s1", "{}", time.Now()).
+			AddRow(2, 2, "https://b.example.com", "s2", "{link.clicked}", time.Now()))
+
+	webhooks, err := repo.ListForEvent(context.Background(), 2, "link.clicked")
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	require.Nil(t, webhooks[0].Events)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookDelete_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWebhookRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks")).
+		WithArgs(int64(9), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Webhooks of other workspaces are not found either.
+	require.ErrorIs(t, repo.Delete(context.Background(), 2, 9), database.ErrWebhookNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookLogDelivery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWebhookRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries")).
+		WithArgs(int64(1), "evt_1", "link.created", 2, 503, "unexpected status 503", int64(12)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = repo.LogDelivery(context.Background(), &database.WebhookDelivery{
+		WebhookID:  1,
+		EventID:    "evt_1",
+		Event:      "link.created",
+		Attempt:    2,
+		StatusCode: 503,
+		Error:      "unexpected status 503",
+		DurationMS: 12,
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultWorkspace owns the links created before workspaces existed and
+// those of callers without an API key.
+const DefaultWorkspace int64 = 1
+
+// AnyWorkspace disables workspace scoping in URLRepository lookups. Public
+// redirects use it, since the namespace of aliases is shared by all
+// workspaces.
+const AnyWorkspace int64 = 0
+
+type Workspace struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+	// MaxLinks and MaxMonthlyClicks are nil for unlimited workspaces.
+	MaxLinks         *int64 `db:"max_links"`
+	MaxMonthlyClicks *int64 `db:"max_monthly_clicks"`
+	// KeyRoles are the roles of the workspace's API keys of the
+	// configuration.
+	KeyRoles  Tags      `db:"key_roles"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// KeyOwner is who an API key acts for: its user, or the workspace itself
+// for keys of the configuration.
+type KeyOwner struct {
+	Workspace int64  `db:"workspace_id"`
+	UserID    *int64 `db:"user_id"`
+	Roles     Tags   `db:"roles"`
+}
+
+// APIKey is a key a user created for scripts. Keys of the configuration
+// have no user and are not listed.
+type APIKey struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	KeyHash   string    `db:"key_hash"`
+	Workspace int64     `db:"workspace_id"`
+	UserID    *int64    `db:"user_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var (
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrQuotaExceeded     = errors.New("workspace quota exceeded")
+	ErrAPIKeyNotFound    = errors.New("API key not found")
+)
+
+type WorkspaceRepository interface {
+	// Upsert creates or updates the workspace with the name and replaces
+	// the set of API keys bound to it with keyHashes. Keys of users are
+	// kept.
+	Upsert(ctx context.Context, w *Workspace, keyHashes []string) (*Workspace, error)
+	Get(ctx context.Context, id int64) (*Workspace, error)
+	// ByKey returns the owner of the API key with the hash. Keys of a
+	// user act in the user's current workspace with the user's roles.
+	ByKey(ctx context.Context, keyHash string) (*KeyOwner, error)
+	// CountLinks returns the number of links of the workspace that are not
+	// deleted.
+	CountLinks(ctx context.Context, id int64) (int64, error)
+	// ConsumeClick atomically counts a click against the workspace's
+	// usage in the month and returns ErrQuotaExceeded, without counting
+	// it, once the monthly click quota is used up.
+	ConsumeClick(ctx context.Context, id int64, month time.Time) error
+	CreateKey(ctx context.Context, k *APIKey) (*APIKey, error)
+	// ListKeys returns the keys of the user, newest first.
+	ListKeys(ctx context.Context, userID int64) ([]*APIKey, error)
+	// DeleteKey deletes a key of the user, ErrAPIKeyNotFound when the user
+	// has no key with the ID.
+	DeleteKey(ctx context.Context, userID, id int64) error
+}
+
+type postgresWorkspaceRepository struct {
+	db *sqlx.DB
+}
+
+func NewWorkspaceRepository(db *sqlx.DB) WorkspaceRepository {
+	return &postgresWorkspaceRepository{db: db}
+}
+
+func (r *postgresWorkspaceRepository) Upsert(ctx context.Context, w *Workspace, keyHashes []string) (*Workspace, error) {
+	query := `
+		INSERT INTO workspace (name, max_links, max_monthly_clicks, key_roles)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET max_links = EXCLUDED.max_links, max_monthly_clicks = EXCLUDED.max_monthly_clicks, key_roles = EXCLUDED.key_roles
+		RETURNING id, name, max_links, max_monthly_clicks, key_roles, created_at;
+	`
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var out Workspace
+	if err := tx.GetContext(ctx, &out, query, w.Name, w.MaxLinks, w.MaxMonthlyClicks, w.KeyRoles); err != nil {
+		return nil, fmt.Errorf("failed to upsert workspace: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM workspace_key WHERE workspace_id = $1 AND user_id IS NULL;`, out.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete workspace keys: %w", err)
+	}
+	for _, hash := range keyHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO workspace_key (key_hash, workspace_id) VALUES ($1, $2);`, hash, out.ID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return nil, fmt.Errorf("failed to add workspace key: key is bound to another workspace")
+			}
+			return nil, fmt.Errorf("failed to add workspace key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &out, nil
+}
+
+func (r *postgresWorkspaceRepository) Get(ctx context.Context, id int64) (*Workspace, error) {
+	query := `
+		SELECT id, name, max_links, max_monthly_clicks, key_roles, created_at
+		FROM workspace
+		WHERE id = $1;
+	`
+
+	var w Workspace
+	if err := r.db.GetContext(ctx, &w, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	return &w, nil
+}
+
+func (r *postgresWorkspaceRepository) ByKey(ctx context.Context, keyHash string) (*KeyOwner, error) {
+	query := `
+		SELECT w.id AS workspace_id, k.user_id, COALESCE(u.roles, w.key_roles) AS roles
+		FROM workspace_key k
+		LEFT JOIN users u ON u.id = k.user_id
+		JOIN workspace w ON w.id = COALESCE(u.workspace_id, k.workspace_id)
+		WHERE k.key_hash = $1;
+	`
+
+	var o KeyOwner
+	if err := r.db.GetContext(ctx, &o, query, keyHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to find workspace by key: %w", err)
+	}
+
+	return &o, nil
+}
+
+func (r *postgresWorkspaceRepository) CountLinks(ctx context.Context, id int64) (int64, error) {
+	query := `
+		SELECT count(*)
+		FROM url
+		WHERE workspace_id = $1 AND deleted_at IS NULL;
+	`
+
+	var n int64
+	if err := r.db.GetContext(ctx, &n, query, id); err != nil {
+		return 0, fmt.Errorf("failed to count workspace links: %w", err)
+	}
+
+	return n, nil
+}
+
+func (r *postgresWorkspaceRepository) ConsumeClick(ctx context.Context, id int64, month time.Time) error {
+	return consumeWorkspaceClick(ctx, r.db, id, month)
+}
+
+// consumeWorkspaceClick counts a click against the workspace's monthly
+// quota on q, which may be a transaction of the click itself.
+func consumeWorkspaceClick(ctx context.Context, q sqlx.ExecerContext, id int64, month time.Time) error {
+	query := `
+		INSERT INTO workspace_usage AS u (workspace_id, month, clicks)
+		SELECT id, $2, 1
+		FROM workspace
+		WHERE id = $1 AND (max_monthly_clicks IS NULL OR max_monthly_clicks > 0)
+		ON CONFLICT (workspace_id, month) DO UPDATE
+		SET clicks = u.clicks + 1
+		WHERE u.clicks < COALESCE((SELECT max_monthly_clicks FROM workspace WHERE id = $1), u.clicks + 1);
+	`
+
+	result, err := q.ExecContext(ctx, query, id, month)
+	if err != nil {
+		return fmt.Errorf("failed to count workspace click: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// checkWorkspaceLinks returns ErrQuotaExceeded when the workspace has more
+// links than its quota allows. It runs in the transaction that added a
+// link and locks the workspace row, so concurrent additions are checked
+// one after another.
+func checkWorkspaceLinks(ctx context.Context, q sqlx.QueryerContext, id int64) error {
+	var maxLinks *int64
+	if err := sqlx.GetContext(ctx, q, &maxLinks, `SELECT max_links FROM workspace WHERE id = $1 FOR UPDATE;`, id); err != nil {
+		return fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if maxLinks == nil {
+		return nil
+	}
+
+	var n int64
+	if err := sqlx.GetContext(ctx, q, &n, `SELECT count(*) FROM url WHERE workspace_id = $1 AND deleted_at IS NULL;`, id); err != nil {
+		return fmt.Errorf("failed to count workspace links: %w", err)
+	}
+	if n > *maxLinks {
+		return fmt.Errorf("%w: %d links", ErrQuotaExceeded, *maxLinks)
+	}
+
+	return nil
+}
+
+func (r *postgresWorkspaceRepository) CreateKey(ctx context.Context, k *APIKey) (*APIKey, error) {
+	query := `
+		INSERT INTO workspace_key (key_hash, workspace_id, name, user_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, name, key_hash, workspace_id, user_id, created_at;
+	`
+
+	var out APIKey
+	if err := r.db.GetContext(ctx, &out, query, k.KeyHash, k.Workspace, k.Name, k.UserID); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return &out, nil
+}
+
+func (r *postgresWorkspaceRepository) ListKeys(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, name, key_hash, workspace_id, user_id, created_at
+		FROM workspace_key
+		WHERE user_id = $1
+		ORDER BY id DESC;
+	`
+
+	var keys []*APIKey
+	if err := r.db.SelectContext(ctx, &keys, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *postgresWorkspaceRepository) DeleteKey(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM workspace_key WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
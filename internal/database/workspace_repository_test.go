@@ -0,0 +1,152 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+func TestWorkspaceUpsert(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWorkspaceRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	maxLinks := int64(10)
+	columns := []string{"id", "name", "max_links", "max_monthly_clicks", "key_roles", "created_at"}
+
+	t.Run("replaces keys", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO workspace (name, max_links, max_monthly_clicks, key_roles)")).
+			WithArgs("team", &maxLinks, nil, "{editor}").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "team", 10, nil, "{editor}", time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM workspace_key WHERE workspace_id = $1 AND user_id IS NULL;")).
+			WithArgs(int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO workspace_key (key_hash, workspace_id)")).
+			WithArgs("abc", int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		w, err := repo.Upsert(ctx, &database.Workspace{Name: "team", MaxLinks: &maxLinks, KeyRoles: database.Tags{"editor"}}, []string{"abc"})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), w.ID)
+		require.Equal(t, int64(10), *w.MaxLinks)
+		require.Nil(t, w.MaxMonthlyClicks)
+	})
+
+	t.Run("key of another workspace", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO workspace")).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "other", nil, nil, "{}", time.Now()))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM workspace_key")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO workspace_key")).
+			WillReturnError(&pgconn.PgError{Code: "23505"})
+		mock.ExpectRollback()
+
+		_, err := repo.Upsert(ctx, &database.Workspace{Name: "other"}, []string{"abc"})
+		require.ErrorContains(t, err, "bound to another workspace")
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceByKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWorkspaceRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE k.key_hash = $1;")).
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"workspace_id", "user_id", "roles"}).AddRow(2, nil, "{viewer}"))
+	o, err := repo.ByKey(ctx, "abc")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), o.Workspace)
+	require.Nil(t, o.UserID)
+	require.Equal(t, database.Tags{"viewer"}, o.Roles)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE k.key_hash = $1;")).
+		WithArgs("nope").
+		WillReturnError(sql.ErrNoRows)
+	_, err = repo.ByKey(ctx, "nope")
+	require.ErrorIs(t, err, database.ErrWorkspaceNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceCountLinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWorkspaceRepository(sqlx.NewDb(db, "sqlmock"))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE workspace_id = $1 AND deleted_at IS NULL;")).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+	n, err := repo.CountLinks(context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceConsumeClick(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWorkspaceRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	month := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	upsert := regexp.QuoteMeta("INSERT INTO workspace_usage AS u (workspace_id, month, clicks)")
+
+	t.Run("counted", func(t *testing.T) {
+		mock.ExpectExec(upsert).
+			WithArgs(int64(2), month).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, repo.ConsumeClick(ctx, 2, month))
+	})
+
+	t.Run("quota exceeded", func(t *testing.T) {
+		mock.ExpectExec(upsert).
+			WithArgs(int64(2), month).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		require.ErrorIs(t, repo.ConsumeClick(ctx, 2, month), database.ErrQuotaExceeded)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceDeleteKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := database.NewWorkspaceRepository(sqlx.NewDb(db, "sqlmock"))
+	ctx := context.Background()
+	query := regexp.QuoteMeta("DELETE FROM workspace_key WHERE id = $1 AND user_id = $2;")
+
+	mock.ExpectExec(query).
+		WithArgs(int64(5), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, repo.DeleteKey(ctx, 1, 5))
+
+	mock.ExpectExec(query).
+		WithArgs(int64(5), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.ErrorIs(t, repo.DeleteKey(ctx, 2, 5), database.ErrAPIKeyNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,45 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Reader looks up countries in a local MaxMind DB file such as
+// GeoLite2-Country.mmdb or DB-IP's free country database.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+
+	return &Reader{db: db}, nil
+}
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip belongs to,
+// or an empty string when the address is not in the database.
+func (r *Reader) Country(ip net.IP) (string, error) {
+	var rec record
+	if err := r.db.Lookup(ip, &rec); err != nil {
+		return "", fmt.Errorf("geoip lookup: %w", err)
+	}
+
+	return strings.ToUpper(rec.Country.ISOCode), nil
+}
+
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,66 @@
+package geoip_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/geoip"
+)
+
+func writeTestDB(t *testing.T, networks map[string]string) string {
+	t.Helper()
+
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "Test-Country", RecordSize: 24})
+	require.NoError(t, err)
+
+	for cidr, country := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		require.NoError(t, tree.Insert(network, mmdbtype.Map{
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String(country)},
+		}))
+	}
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = tree.WriteTo(f)
+	require.NoError(t, err)
+
+	return path
+}
+
+func TestCountry(t *testing.T) {
+	path := writeTestDB(t, map[string]string{
+		"81.2.69.0/24": "gb",
+		"2.125.0.0/16": "DE",
+	})
+
+	r, err := geoip.Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	country, err := r.Country(net.ParseIP("81.2.69.142"))
+	require.NoError(t, err)
+	require.Equal(t, "GB", country)
+
+	country, err = r.Country(net.ParseIP("2.125.160.216"))
+	require.NoError(t, err)
+	require.Equal(t, "DE", country)
+
+	country, err = r.Country(net.ParseIP("8.8.8.8"))
+	require.NoError(t, err)
+	require.Empty(t, country)
+}
+
+func TestOpen_Missing(t *testing.T) {
+	_, err := geoip.Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	require.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/finlleyl/shorty_reborn/internal/config"
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver/urlpb"
+	"github.com/finlleyl/shorty_reborn/internal/oidc"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+func NewServer(cfg *config.GRPCServer, h *Handler, logger *zap.SugaredLogger) *grpc.Server {
+	interceptors := []grpc.UnaryServerInterceptor{zapLogger(logger), actor}
+	if h.OIDC != nil && h.AuthService != nil {
+		interceptors = append(interceptors, jwt(h.OIDC, h.AuthService))
+	}
+	interceptors = append(interceptors, workspace(h.Workspaces))
+
+	srv := grpc.NewServer(
+		grpc.ConnectionTimeout(cfg.ConnectionTimeout),
+		grpc.ChainUnaryInterceptor(interceptors...),
+	)
+	urlpb.RegisterURLServiceServer(srv, h)
+
+	return srv
+}
+
+func zapLogger(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		elapsed := time.Since(start)
+
+		logger.Infow("gRPC request",
+			"method", info.FullMethod,
+			"code", status.Code(err).String(),
+			"duration", elapsed.String(),
+		)
+
+		return resp, err
+	}
+}
+
+// actor attributes calls to the same actor IDs as HTTP requests, using the
+// authorization and x-request-id metadata and the peer address.
+func actor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	a := service.Actor{
+		ID:        service.ActorID(first(md.Get("authorization"))),
+		RequestID: first(md.Get("x-request-id")),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		a.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(a.IP); err == nil {
+			a.IP = host
+		}
+	}
+
+	return handler(service.ContextWithActor(ctx, a), req)
+}
+
+// TokenVerifier verifies the bearer tokens of an SSO provider.
+type TokenVerifier interface {
+	Verify(ctx context.Context, raw string) (*oidc.Claims, error)
+}
+
+// jwt attributes calls with a bearer JWT of the SSO provider to the user
+// it identifies, in the user's workspace and with the user's roles, like
+// the HTTP middleware. Other credentials are left to the API key.
+func jwt(verifier TokenVerifier, auth service.AuthService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		token, ok := bearerJWT(first(md.Get("authorization")))
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		claims, err := verifier.Verify(ctx, token)
+		if err != nil {
+			if errors.Is(err, oidc.ErrInvalidToken) || errors.Is(err, oidc.ErrUnknownKey) {
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			return nil, status.Error(codes.Internal, "failed to authenticate")
+		}
+
+		u, err := auth.Identify(ctx, service.Identity{
+			Issuer:    claims.Issuer,
+			Subject:   claims.Subject,
+			Email:     claims.Email,
+			Roles:     claims.Roles,
+			Workspace: claims.Workspace,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidAccount):
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			case errors.Is(err, service.ErrWorkspaceNotFound):
+				return nil, status.Error(codes.PermissionDenied, "unknown workspace")
+			default:
+				return nil, status.Error(codes.Internal, "failed to authenticate")
+			}
+		}
+
+		a := service.ActorFromContext(ctx)
+		a.ID = service.UserActorID(u.ID)
+		a.User = u.ID
+		a.Workspace = u.Workspace
+		a.Roles = u.Roles
+		a.Authenticated = true
+
+		return handler(service.ContextWithActor(ctx, a), req)
+	}
+}
+
+// bearerJWT returns the token of a "Bearer" authorization value if it has
+// the three dot-separated parts of a JWT. Generated API keys have none.
+func bearerJWT(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+
+	return token, strings.Count(token, ".") == 2
+}
+
+// workspace scopes calls to the workspace of the API key in the
+// authorization metadata, like the HTTP middleware. Calls already
+// attributed to a user by jwt are left as they are; other bearer JWTs are
+// rejected as unknown keys.
+func workspace(workspaces service.WorkspaceService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if workspaces == nil || service.ActorFromContext(ctx).User != 0 {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		authorization := first(md.Get("authorization"))
+		p, err := workspaces.Authenticate(ctx, authorization)
+		if err != nil {
+			if errors.Is(err, service.ErrUnknownAPIKey) {
+				return nil, status.Error(codes.Unauthenticated, "invalid API key")
+			}
+			return nil, status.Error(codes.Internal, "failed to authenticate")
+		}
+
+		a := service.ActorFromContext(ctx)
+		a.Workspace = p.Workspace
+		a.Roles = p.Roles
+		a.Authenticated = authorization != ""
+		if p.User != 0 {
+			a.ID = service.UserActorID(p.User)
+			a.User = p.User
+		}
+
+		return handler(service.ContextWithActor(ctx, a), req)
+	}
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
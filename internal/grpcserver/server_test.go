@@ -0,0 +1,110 @@
+package grpcserver_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/finlleyl/shorty_reborn/internal/config"
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver"
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver/urlpb"
+	"github.com/finlleyl/shorty_reborn/internal/oidc"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+type stubVerifier map[string]*oidc.Claims
+
+func (v stubVerifier) Verify(_ context.Context, raw string) (*oidc.Claims, error) {
+	if c, ok := v[raw]; ok {
+		return c, nil
+	}
+
+	return nil, oidc.ErrInvalidToken
+}
+
+func serve(t *testing.T, h *grpcserver.Handler) urlpb.URLServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpcserver.NewServer(&config.GRPCServer{}, h, zap.NewNop().Sugar())
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return urlpb.NewURLServiceClient(conn)
+}
+
+func withAuthorization(value string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", value)
+}
+
+func TestJWT(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	users := servicetest.NewMockUserRepository(ctrl)
+	workspaces := servicetest.NewMockWorkspaceRepository(ctrl)
+
+	h := grpcserver.NewHandler(service.NewURLService(repo))
+	h.Workspaces = service.NewWorkspaceService(workspaces)
+	h.AuthService = service.NewAuthService(users, workspaces, 0)
+	h.OIDC = stubVerifier{"a.b.c": {Email: "a@example.com", Roles: []string{"viewer"}, Workspace: "team"}}
+	client := serve(t, h)
+
+	t.Run("scoped to the user's workspace", func(t *testing.T) {
+		users.EXPECT().
+			UpsertSSO(gomock.Any(), &database.User{Email: "a@example.com", Roles: database.Tags{"viewer"}}, "team").
+			Return(&database.User{ID: 7, Email: "a@example.com", Workspace: 4, Roles: database.Tags{"viewer"}}, nil)
+		repo.EXPECT().
+			List(gomock.Any(), database.ListFilter{Workspace: 4, Limit: 20}).
+			Return(nil, nil)
+
+		_, err := client.ListURLs(withAuthorization("Bearer a.b.c"), &urlpb.ListURLsRequest{})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, err := client.ListURLs(withAuthorization("Bearer x.y.z"), &urlpb.ListURLsRequest{})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("unknown workspace", func(t *testing.T) {
+		users.EXPECT().UpsertSSO(gomock.Any(), gomock.Any(), "team").Return(nil, database.ErrWorkspaceNotFound)
+
+		_, err := client.ListURLs(withAuthorization("Bearer a.b.c"), &urlpb.ListURLsRequest{})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func TestJWTWithoutOIDC(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	workspaces := servicetest.NewMockWorkspaceRepository(ctrl)
+
+	h := grpcserver.NewHandler(service.NewURLService(servicetest.NewMockURLRepository(ctrl)))
+	h.Workspaces = service.NewWorkspaceService(workspaces)
+	client := serve(t, h)
+
+	workspaces.EXPECT().ByKey(gomock.Any(), service.KeyHash("a.b.c")).Return(nil, database.ErrWorkspaceNotFound)
+
+	_, err := client.ListURLs(withAuthorization("Bearer a.b.c"), &urlpb.ListURLsRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
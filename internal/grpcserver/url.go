@@ -0,0 +1,313 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver/urlpb"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+type Handler struct {
+	urlpb.UnimplementedURLServiceServer
+
+	URLService service.URLService
+	// Workspaces is nil unless workspaces are configured.
+	Workspaces service.WorkspaceService
+	// OIDC verifies bearer JWTs of the SSO provider; nil unless OIDC is
+	// configured.
+	OIDC        TokenVerifier
+	AuthService service.AuthService
+}
+
+func NewHandler(urlService service.URLService) *Handler {
+	return &Handler{URLService: urlService}
+}
+
+func (h *Handler) CreateURL(ctx context.Context, req *urlpb.CreateURLRequest) (*urlpb.CreateURLResponse, error) {
+	u, err := h.URLService.Create(ctx, req.GetUrl(), req.GetAlias(),
+		service.WithPassword(req.GetPassword()),
+		service.WithMaxClicks(req.GetMaxClicks()),
+		service.WithDomain(req.GetDomain()),
+		service.WithRules(fromProtoRules(req.GetRules())),
+		service.WithVariants(fromProtoVariants(req.GetVariants())),
+		service.WithQueryMode(req.GetQueryMode()),
+		service.WithUTM(fromProtoUTM(req.GetUtm())),
+		service.WithTitle(req.GetTitle()),
+		service.WithDescription(req.GetDescription()),
+		service.WithTags(req.GetTags()),
+		service.WithMetadata(req.GetMetadata()),
+		service.WithForcePreview(req.GetForcePreview()),
+		service.WithReuse(req.GetReuse()),
+	)
+	if err != nil {
+		return nil, toStatus(err, "failed to create url")
+	}
+
+	return &urlpb.CreateURLResponse{Url: toProto(u), Reused: u.Reused}, nil
+}
+
+func (h *Handler) ResolveURL(ctx context.Context, req *urlpb.ResolveURLRequest) (*urlpb.ResolveURLResponse, error) {
+	if req.GetAlias() == "" {
+		return nil, status.Error(codes.InvalidArgument, "alias is required")
+	}
+
+	v := service.Visitor{
+		Host:           req.GetDomain(),
+		IP:             req.GetClientIp(),
+		UserAgent:      req.GetUserAgent(),
+		AcceptLanguage: req.GetAcceptLanguage(),
+		Query:          req.GetQuery(),
+		Variant:        req.GetVariant(),
+		SkipPreview:    req.GetSkipPreview(),
+	}
+	if v.IP == "" {
+		v.IP = peerAddr(ctx)
+	}
+
+	var (
+		u   *service.URL
+		err error
+	)
+	if req.GetPassword() != "" {
+		u, err = h.URLService.Unlock(ctx, req.GetAlias(), req.GetPassword(), v)
+	} else {
+		u, err = h.URLService.Resolve(ctx, req.GetAlias(), v)
+	}
+	if err != nil {
+		return nil, toStatus(err, "failed to resolve url")
+	}
+
+	return &urlpb.ResolveURLResponse{Url: toProto(u)}, nil
+}
+
+func (h *Handler) DeleteURL(ctx context.Context, req *urlpb.DeleteURLRequest) (*urlpb.DeleteURLResponse, error) {
+	if req.GetAlias() == "" {
+		return nil, status.Error(codes.InvalidArgument, "alias is required")
+	}
+
+	if err := h.URLService.Delete(ctx, req.GetDomain(), req.GetAlias()); err != nil {
+		return nil, toStatus(err, "failed to delete url")
+	}
+
+	return &urlpb.DeleteURLResponse{}, nil
+}
+
+func (h *Handler) RestoreURL(ctx context.Context, req *urlpb.RestoreURLRequest) (*urlpb.RestoreURLResponse, error) {
+	if req.GetAlias() == "" {
+		return nil, status.Error(codes.InvalidArgument, "alias is required")
+	}
+
+	u, err := h.URLService.Restore(ctx, req.GetDomain(), req.GetAlias())
+	if err != nil {
+		return nil, toStatus(err, "failed to restore url")
+	}
+
+	return &urlpb.RestoreURLResponse{Url: toProto(u)}, nil
+}
+
+func (h *Handler) ListURLs(ctx context.Context, req *urlpb.ListURLsRequest) (*urlpb.ListURLsResponse, error) {
+	urls, err := h.URLService.List(ctx, service.ListFilter{
+		Tag:    req.GetTag(),
+		Limit:  int(req.GetLimit()),
+		Offset: int(req.GetOffset()),
+	})
+	if err != nil {
+		return nil, toStatus(err, "failed to list urls")
+	}
+
+	resp := &urlpb.ListURLsResponse{Urls: make([]*urlpb.URL, 0, len(urls))}
+	for _, u := range urls {
+		resp.Urls = append(resp.Urls, toProto(u))
+	}
+
+	return resp, nil
+}
+
+func toProto(u *service.URL) *urlpb.URL {
+	pb := &urlpb.URL{
+		Domain:       u.Domain,
+		Alias:        u.Alias,
+		Url:          u.OrigURL,
+		Protected:    u.Protected,
+		MaxClicks:    u.MaxClicks,
+		ClicksLeft:   u.ClicksLeft,
+		Rules:        toProtoRules(u.Rules),
+		Variants:     toProtoVariants(u.Variants),
+		Variant:      u.Variant,
+		QueryMode:    u.QueryMode,
+		Utm:          toProtoUTM(u.UTM),
+		Title:        u.Title,
+		Description:  u.Description,
+		Tags:         u.Tags,
+		Metadata:     u.Metadata,
+		Page:         toProtoPage(u.Page),
+		ForcePreview: u.ForcePreview,
+	}
+	if !u.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(u.CreatedAt)
+	}
+
+	return pb
+}
+
+func toProtoRules(rules []service.Rule) []*urlpb.Rule {
+	out := make([]*urlpb.Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, &urlpb.Rule{
+			Platform: r.Platform,
+			Language: r.Language,
+			Country:  r.Country,
+			Url:      r.URL,
+		})
+	}
+
+	return out
+}
+
+func fromProtoRules(rules []*urlpb.Rule) []service.Rule {
+	out := make([]service.Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, service.Rule{
+			Platform: r.GetPlatform(),
+			Language: r.GetLanguage(),
+			Country:  r.GetCountry(),
+			URL:      r.GetUrl(),
+		})
+	}
+
+	return out
+}
+
+func toProtoVariants(variants []service.Variant) []*urlpb.Variant {
+	out := make([]*urlpb.Variant, 0, len(variants))
+	for _, v := range variants {
+		out = append(out, &urlpb.Variant{
+			Name:   v.Name,
+			Url:    v.URL,
+			Weight: int32(v.Weight),
+		})
+	}
+
+	return out
+}
+
+func fromProtoVariants(variants []*urlpb.Variant) []service.Variant {
+	out := make([]service.Variant, 0, len(variants))
+	for _, v := range variants {
+		out = append(out, service.Variant{
+			Name:   v.GetName(),
+			URL:    v.GetUrl(),
+			Weight: int(v.GetWeight()),
+		})
+	}
+
+	return out
+}
+
+func toProtoUTM(utm service.UTM) *urlpb.UTM {
+	if utm == (service.UTM{}) {
+		return nil
+	}
+
+	return &urlpb.UTM{
+		Source:   utm.Source,
+		Medium:   utm.Medium,
+		Campaign: utm.Campaign,
+		Term:     utm.Term,
+		Content:  utm.Content,
+	}
+}
+
+func fromProtoUTM(utm *urlpb.UTM) service.UTM {
+	return service.UTM{
+		Source:   utm.GetSource(),
+		Medium:   utm.GetMedium(),
+		Campaign: utm.GetCampaign(),
+		Term:     utm.GetTerm(),
+		Content:  utm.GetContent(),
+	}
+}
+
+func toProtoPage(page *service.PageMeta) *urlpb.PageMeta {
+	if page == nil {
+		return nil
+	}
+
+	return &urlpb.PageMeta{
+		Title:       page.Title,
+		Description: page.Description,
+		Image:       page.Image,
+		SiteName:    page.SiteName,
+		Favicon:     page.Favicon,
+		FetchedAt:   timestamppb.New(page.FetchedAt),
+	}
+}
+
+func peerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// toStatus maps service sentinel errors to gRPC status codes. Unknown errors
+// are reported as Internal with a generic message so that details of the
+// storage layer do not leak to clients.
+func toStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidURL):
+		return status.Error(codes.InvalidArgument, "invalid url")
+	case errors.Is(err, service.ErrInvalidAlias):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrAliasNotAllowed):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrInvalidPassword):
+		return status.Error(codes.InvalidArgument, "invalid password")
+	case errors.Is(err, service.ErrPasswordRequired):
+		return status.Error(codes.PermissionDenied, "password required")
+	case errors.Is(err, service.ErrWrongPassword):
+		return status.Error(codes.PermissionDenied, "wrong password")
+	case errors.Is(err, service.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrInvalidRule), errors.Is(err, service.ErrInvalidVariant),
+		errors.Is(err, service.ErrInvalidQueryMode), errors.Is(err, service.ErrInvalidUTM),
+		errors.Is(err, service.ErrInvalidTag), errors.Is(err, service.ErrInvalidMetadata):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrInvalidMaxClicks):
+		return status.Error(codes.InvalidArgument, "invalid max clicks")
+	case errors.Is(err, service.ErrPreviewRequired):
+		return status.Error(codes.FailedPrecondition, "preview required")
+	case errors.Is(err, service.ErrLinkExhausted):
+		return status.Error(codes.FailedPrecondition, "link is no longer available")
+	case errors.Is(err, service.ErrTooManyAttempts):
+		return status.Error(codes.ResourceExhausted, "too many attempts")
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrAliasExists):
+		return status.Error(codes.AlreadyExists, "alias already exists")
+	case errors.Is(err, service.ErrURLNotFound):
+		return status.Error(codes.NotFound, "url not found")
+	case errors.Is(err, service.ErrDomainNotFound):
+		return status.Error(codes.NotFound, "domain not found")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
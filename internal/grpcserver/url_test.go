@@ -0,0 +1,141 @@
+package grpcserver_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver"
+	"github.com/finlleyl/shorty_reborn/internal/grpcserver/urlpb"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func newClient(t *testing.T, repo database.URLRepository) urlpb.URLServiceClient {
+	t.Helper()
+
+	return serve(t, grpcserver.NewHandler(service.NewURLService(repo)))
+}
+
+func TestCreateURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	client := newClient(t, repo)
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		repo.EXPECT().Exists(gomock.Any(), service.DefaultWorkspace, "", "myalias").Return(false, nil)
+		repo.EXPECT().
+			Save(gomock.Any(), &database.URL{
+				Alias: "myalias",
+				URL:   "https://ok.com",
+				// SHA-256 of the normalized destination.
+				URLHash:   "4690ec87b46ab5f3ecd557b33f6b05ea4e6b16c973d6a8f3993f98a1059f541e",
+				CreatedBy: service.AnonymousActor,
+				Workspace: service.DefaultWorkspace,
+			}).
+			Return(&database.URL{ID: 1, Alias: "myalias", URL: "https://ok.com"}, nil)
+
+		resp, err := client.CreateURL(ctx, &urlpb.CreateURLRequest{Url: "https://ok.com", Alias: "myalias"})
+		require.NoError(t, err)
+		require.Equal(t, "myalias", resp.GetUrl().GetAlias())
+		require.Equal(t, "https://ok.com", resp.GetUrl().GetUrl())
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		_, err := client.CreateURL(ctx, &urlpb.CreateURLRequest{Url: "%%%://bad"})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("alias exists", func(t *testing.T) {
+		repo.EXPECT().Exists(gomock.Any(), service.DefaultWorkspace, "", "taken").Return(true, nil)
+
+		_, err := client.CreateURL(ctx, &urlpb.CreateURLRequest{Url: "https://ok.com", Alias: "taken"})
+		require.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+}
+
+func TestResolveURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	client := newClient(t, repo)
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		repo.EXPECT().
+			Get(gomock.Any(), database.AnyWorkspace, "", "good").
+			Return(&database.URL{Alias: "good", URL: "https://ok.com"}, nil)
+
+		resp, err := client.ResolveURL(ctx, &urlpb.ResolveURLRequest{Alias: "good"})
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", resp.GetUrl().GetUrl())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo.EXPECT().Get(gomock.Any(), database.AnyWorkspace, "", "missing").Return(nil, database.ErrNotFound)
+
+		_, err := client.ResolveURL(ctx, &urlpb.ResolveURLRequest{Alias: "missing"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("password required", func(t *testing.T) {
+		repo.EXPECT().
+			Get(gomock.Any(), database.AnyWorkspace, "", "secret").
+			Return(&database.URL{Alias: "secret", URL: "https://ok.com", PasswordHash: "hash"}, nil)
+
+		_, err := client.ResolveURL(ctx, &urlpb.ResolveURLRequest{Alias: "secret"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("empty alias", func(t *testing.T) {
+		_, err := client.ResolveURL(ctx, &urlpb.ResolveURLRequest{})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("internal error is not leaked", func(t *testing.T) {
+		repo.EXPECT().Get(gomock.Any(), database.AnyWorkspace, "", "alias").Return(nil, fmt.Errorf("password=secret"))
+
+		_, err := client.ResolveURL(ctx, &urlpb.ResolveURLRequest{Alias: "alias"})
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.NotContains(t, err.Error(), "secret")
+	})
+}
+
+func TestDeleteURL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	client := newClient(t, repo)
+	ctx := context.Background()
+
+	repo.EXPECT().Delete(gomock.Any(), service.DefaultWorkspace, "", "foo").Return(nil)
+	_, err := client.DeleteURL(ctx, &urlpb.DeleteURLRequest{Alias: "foo"})
+	require.NoError(t, err)
+
+	repo.EXPECT().Delete(gomock.Any(), service.DefaultWorkspace, "", "missing").Return(database.ErrNotFound)
+	_, err = client.DeleteURL(ctx, &urlpb.DeleteURLRequest{Alias: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestListURLs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	client := newClient(t, repo)
+
+	repo.EXPECT().
+		List(gomock.Any(), database.ListFilter{Workspace: service.DefaultWorkspace, Tag: "promo", Limit: 2}).
+		Return([]*database.URL{
+			{ID: 2, Alias: "b", URL: "https://b.com"},
+			{ID: 1, Alias: "a", URL: "https://a.com"},
+		}, nil)
+
+	resp, err := client.ListURLs(context.Background(), &urlpb.ListURLsRequest{Limit: 2, Tag: "promo"})
+	require.NoError(t, err)
+	require.Len(t, resp.GetUrls(), 2)
+	require.Equal(t, "b", resp.GetUrls()[0].GetAlias())
+}
@@ -0,0 +1,275 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: url/v1/url.proto
+
+package urlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	URLService_CreateURL_FullMethodName  = "/url.v1.URLService/CreateURL"
+	URLService_ResolveURL_FullMethodName = "/url.v1.URLService/ResolveURL"
+	URLService_DeleteURL_FullMethodName  = "/url.v1.URLService/DeleteURL"
+	URLService_RestoreURL_FullMethodName = "/url.v1.URLService/RestoreURL"
+	URLService_ListURLs_FullMethodName   = "/url.v1.URLService/ListURLs"
+)
+
+// URLServiceClient is the client API for URLService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type URLServiceClient interface {
+	CreateURL(ctx context.Context, in *CreateURLRequest, opts ...grpc.CallOption) (*CreateURLResponse, error)
+	ResolveURL(ctx context.Context, in *ResolveURLRequest, opts ...grpc.CallOption) (*ResolveURLResponse, error)
+	DeleteURL(ctx context.Context, in *DeleteURLRequest, opts ...grpc.CallOption) (*DeleteURLResponse, error)
+	// Undeletes a link deleted within the grace period.
+	RestoreURL(ctx context.Context, in *RestoreURLRequest, opts ...grpc.CallOption) (*RestoreURLResponse, error)
+	ListURLs(ctx context.Context, in *ListURLsRequest, opts ...grpc.CallOption) (*ListURLsResponse, error)
+}
+
+type uRLServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewURLServiceClient(cc grpc.ClientConnInterface) URLServiceClient {
+	return &uRLServiceClient{cc}
+}
+
+func (c *uRLServiceClient) CreateURL(ctx context.Context, in *CreateURLRequest, opts ...grpc.CallOption) (*CreateURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateURLResponse)
+	err := c.cc.Invoke(ctx, URLService_CreateURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLServiceClient) ResolveURL(ctx context.Context, in *ResolveURLRequest, opts ...grpc.CallOption) (*ResolveURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResolveURLResponse)
+	err := c.cc.Invoke(ctx, URLService_ResolveURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLServiceClient) DeleteURL(ctx context.Context, in *DeleteURLRequest, opts ...grpc.CallOption) (*DeleteURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteURLResponse)
+	err := c.cc.Invoke(ctx, URLService_DeleteURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLServiceClient) RestoreURL(ctx context.Context, in *RestoreURLRequest, opts ...grpc.CallOption) (*RestoreURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestoreURLResponse)
+	err := c.cc.Invoke(ctx, URLService_RestoreURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLServiceClient) ListURLs(ctx context.Context, in *ListURLsRequest, opts ...grpc.CallOption) (*ListURLsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListURLsResponse)
+	err := c.cc.Invoke(ctx, URLService_ListURLs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// URLServiceServer is the server API for URLService service.
+// All implementations must embed UnimplementedURLServiceServer
+// for forward compatibility.
+type URLServiceServer interface {
+	CreateURL(context.Context, *CreateURLRequest) (*CreateURLResponse, error)
+	ResolveURL(context.Context, *ResolveURLRequest) (*ResolveURLResponse, error)
+	DeleteURL(context.Context, *DeleteURLRequest) (*DeleteURLResponse, error)
+	// Undeletes a link deleted within the grace period.
+	RestoreURL(context.Context, *RestoreURLRequest) (*RestoreURLResponse, error)
+	ListURLs(context.Context, *ListURLsRequest) (*ListURLsResponse, error)
+	mustEmbedUnimplementedURLServiceServer()
+}
+
+// UnimplementedURLServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedURLServiceServer struct{}
+
+func (UnimplementedURLServiceServer) CreateURL(context.Context, *CreateURLRequest) (*CreateURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateURL not implemented")
+}
+func (UnimplementedURLServiceServer) ResolveURL(context.Context, *ResolveURLRequest) (*ResolveURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveURL not implemented")
+}
+func (UnimplementedURLServiceServer) DeleteURL(context.Context, *DeleteURLRequest) (*DeleteURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteURL not implemented")
+}
+func (UnimplementedURLServiceServer) RestoreURL(context.Context, *RestoreURLRequest) (*RestoreURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreURL not implemented")
+}
+func (UnimplementedURLServiceServer) ListURLs(context.Context, *ListURLsRequest) (*ListURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListURLs not implemented")
+}
+func (UnimplementedURLServiceServer) mustEmbedUnimplementedURLServiceServer() {}
+func (UnimplementedURLServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeURLServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to URLServiceServer will
+// result in compilation errors.
+type UnsafeURLServiceServer interface {
+	mustEmbedUnimplementedURLServiceServer()
+}
+
+func RegisterURLServiceServer(s grpc.ServiceRegistrar, srv URLServiceServer) {
+	// If the following call pancis, it indicates UnimplementedURLServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&URLService_ServiceDesc, srv)
+}
+
+func _URLService_CreateURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLServiceServer).CreateURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLService_CreateURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLServiceServer).CreateURL(ctx, req.(*CreateURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLService_ResolveURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLServiceServer).ResolveURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLService_ResolveURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLServiceServer).ResolveURL(ctx, req.(*ResolveURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLService_DeleteURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLServiceServer).DeleteURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLService_DeleteURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLServiceServer).DeleteURL(ctx, req.(*DeleteURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLService_RestoreURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLServiceServer).RestoreURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLService_RestoreURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLServiceServer).RestoreURL(ctx, req.(*RestoreURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLService_ListURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLServiceServer).ListURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLService_ListURLs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLServiceServer).ListURLs(ctx, req.(*ListURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// URLService_ServiceDesc is the grpc.ServiceDesc for URLService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var URLService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "url.v1.URLService",
+	HandlerType: (*URLServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateURL",
+			Handler:    _URLService_CreateURL_Handler,
+		},
+		{
+			MethodName: "ResolveURL",
+			Handler:    _URLService_ResolveURL_Handler,
+		},
+		{
+			MethodName: "DeleteURL",
+			Handler:    _URLService_DeleteURL_Handler,
+		},
+		{
+			MethodName: "RestoreURL",
+			Handler:    _URLService_RestoreURL_Handler,
+		},
+		{
+			MethodName: "ListURLs",
+			Handler:    _URLService_ListURLs_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "url/v1/url.proto",
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+type auditEntryResponse struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	Domain    string          `json:"domain,omitempty"`
+	Alias     string          `json:"alias,omitempty"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	OldValue  json.RawMessage `json:"old_value,omitempty"`
+	NewValue  json.RawMessage `json:"new_value,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ListAudit serves GET /api/audit. from and to are RFC 3339 timestamps.
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f := service.AuditFilter{Alias: q.Get("alias"), Actor: q.Get("actor")}
+	for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dst = t
+		}
+	}
+	for name, dst := range map[string]*int{"limit": &f.Limit, "offset": &f.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dst = n
+		}
+	}
+
+	entries, err := h.AuditService.List(r.Context(), f)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAuditFilter) {
+			writeJSONError(w, http.StatusBadRequest, "from must be before to")
+			return
+		}
+		if writeAccessError(w, err) {
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to list audit log")
+		return
+	}
+
+	resp := make([]auditEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, auditEntryResponse{
+			ID:        e.ID,
+			Action:    e.Action,
+			Domain:    e.Domain,
+			Alias:     e.Alias,
+			Actor:     e.Actor,
+			RequestID: e.RequestID,
+			IP:        e.IP,
+			OldValue:  e.OldValue,
+			NewValue:  e.NewValue,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
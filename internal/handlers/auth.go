@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+
+	zapmv "github.com/finlleyl/shorty_reborn/internal/httpserver/middleware"
+)
+
+func (h *Handler) AuthRoutes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Post("/login", h.Login)
+	r.Post("/logout", h.Logout)
+	r.Get("/me", h.Me)
+	if h.OIDC != nil {
+		r.Get("/oidc/login", h.OIDCLogin)
+		r.Get("/oidc/callback", h.OIDCCallback)
+	}
+
+	return r
+}
+
+func (h *Handler) APIKeyRoutes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Post("/", h.CreateAPIKey)
+	r.Get("/", h.ListAPIKeys)
+	r.Delete("/{id}", h.DeleteAPIKey)
+
+	return r
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type userResponse struct {
+	ID        int64    `json:"id"`
+	Email     string   `json:"email"`
+	Workspace int64    `json:"workspace"`
+	Roles     []string `json:"roles"`
+}
+
+type sessionResponse struct {
+	User      userResponse `json:"user"`
+	CSRFToken string       `json:"csrf_token"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+type createAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type apiKeyResponse struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toSessionResponse(s *service.Session) sessionResponse {
+	roles := s.User.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return sessionResponse{
+		User: userResponse{
+			ID:        s.User.ID,
+			Email:     s.User.Email,
+			Workspace: s.User.Workspace,
+			Roles:     roles,
+		},
+		CSRFToken: s.CSRFToken,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+func toAPIKeyResponse(k *service.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		Key:       k.Key,
+		CreatedAt: k.CreatedAt,
+	}
+}
+
+// Login signs the user in and sets the session cookie. The CSRF token of
+// the session is only returned in the body, so that scripts of other
+// origins cannot read it.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<12)
+	defer r.Body.Close()
+
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s, err := h.AuthService.Login(r.Context(), req.Email, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			writeJSONError(w, http.StatusUnauthorized, "invalid email or password")
+		case errors.Is(err, service.ErrTooManyAttempts):
+			writeJSONError(w, http.StatusTooManyRequests, "too many attempts")
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to sign in")
+		}
+		return
+	}
+
+	h.setSessionCookie(w, s)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toSessionResponse(s))
+}
+
+// setSessionCookie sets the cookie of a new session. SameSite=Lax keeps it
+// from being sent with cross-site POST requests, on top of the CSRF token.
+func (h *Handler) setSessionCookie(w http.ResponseWriter, s *service.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     zapmv.SessionCookie,
+		Value:    s.Token,
+		Path:     "/",
+		Expires:  s.ExpiresAt,
+		HttpOnly: true,
+		Secure:   h.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(zapmv.SessionCookie); err == nil {
+		if err := h.AuthService.Logout(r.Context(), cookie.Value); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to sign out")
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     zapmv.SessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me returns the signed-in user and the CSRF token of the session, e.g. for
+// a dashboard reloaded after sign-in.
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	var token string
+	if cookie, err := r.Cookie(zapmv.SessionCookie); err == nil {
+		token = cookie.Value
+	}
+
+	s, err := h.AuthService.Session(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, service.ErrUnauthenticated) {
+			writeJSONError(w, http.StatusUnauthorized, "not signed in")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toSessionResponse(s))
+}
+
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<12)
+	defer r.Body.Close()
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	k, err := h.AuthService.CreateAPIKey(r.Context(), req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnauthenticated):
+			writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		case errors.Is(err, service.ErrInvalidKeyName):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to create API key")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/keys/"+strconv.FormatInt(k.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toAPIKeyResponse(k))
+}
+
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.AuthService.ListAPIKeys(r.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrUnauthenticated) {
+			writeJSONError(w, http.StatusUnauthorized, "not signed in")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to list API keys")
+		return
+	}
+
+	resp := make([]apiKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, toAPIKeyResponse(k))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	if err := h.AuthService.DeleteAPIKey(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnauthenticated):
+			writeJSONError(w, http.StatusUnauthorized, "not signed in")
+		case errors.Is(err, service.ErrAPIKeyNotFound):
+			writeJSONError(w, http.StatusNotFound, "API key not found")
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to delete API key")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
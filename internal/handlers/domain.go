@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+func (h *Handler) DomainRoutes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Post("/", h.CreateDomain)
+	r.Get("/", h.ListDomains)
+	r.Delete("/{name}", h.DeleteDomain)
+
+	return r
+}
+
+type createDomainRequest struct {
+	Name string `json:"name"`
+}
+
+func (h *Handler) CreateDomain(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+	defer r.Body.Close()
+
+	var req createDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	d, err := h.DomainService.Create(r.Context(), req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidDomain):
+			writeJSONError(w, http.StatusBadRequest, "invalid domain")
+		case errors.Is(err, service.ErrDomainExists):
+			writeJSONError(w, http.StatusConflict, "domain already exists")
+		case writeAccessError(w, err):
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to create domain")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/domains/"+d.Name)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+func (h *Handler) ListDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := h.DomainService.List(r.Context())
+	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to list domains")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
+}
+
+func (h *Handler) DeleteDomain(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := h.DomainService.Delete(r.Context(), name); err != nil {
+		switch {
+		case errors.Is(err, service.ErrDomainNotFound):
+			writeJSONError(w, http.StatusNotFound, "domain not found")
+		case errors.Is(err, service.ErrDomainInUse):
+			writeJSONError(w, http.StatusConflict, "domain still has links")
+		case writeAccessError(w, err):
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to delete domain")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
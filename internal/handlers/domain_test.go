@@ -0,0 +1,34 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/handlers"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+type domainLister struct {
+	service.DomainService
+}
+
+func (domainLister) List(context.Context) ([]*service.Domain, error) {
+	return []*service.Domain{{Name: "go.example.com", CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}}, nil
+}
+
+func TestListDomains(t *testing.T) {
+	t.Parallel()
+
+	h := handlers.NewHandler(nil, domainLister{}, nil, nil, "http://localhost")
+	rec := httptest.NewRecorder()
+
+	h.DomainRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `[{"name":"go.example.com","created_at":"2025-01-02T03:04:05Z"}]`, rec.Body.String())
+}
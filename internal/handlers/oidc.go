@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// oidcCookie carries the state of a sign-in in progress from OIDCLogin to
+// OIDCCallback.
+const (
+	oidcCookie       = "shorty_oidc"
+	oidcCookieMaxAge = 600
+)
+
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+}
+
+// OIDCLogin sends the browser to the sign-in page of the SSO provider. The
+// optional redirect parameter is the path the browser returns to once
+// signed in.
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	st := oidcState{
+		State:    rand.Text(),
+		Nonce:    rand.Text(),
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: localPath(r.URL.Query().Get("redirect")),
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(b),
+		Path:     "/api/auth/oidc",
+		MaxAge:   oidcCookieMaxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.OIDC.AuthCodeURL(st.State, st.Nonce, st.Verifier), http.StatusFound)
+}
+
+// OIDCCallback completes a sign-in: it redeems the code for an ID token,
+// signs the user of its claims in and returns the browser to where it
+// started.
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	st, ok := readOIDCState(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Path:     "/api/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := r.URL.Query()
+	if !ok || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(st.State)) != 1 {
+		writeJSONError(w, http.StatusBadRequest, "invalid sign-in state")
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		writeJSONError(w, http.StatusUnauthorized, "sign-in failed: "+e)
+		return
+	}
+
+	claims, err := h.OIDC.Exchange(r.Context(), q.Get("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "sign-in failed")
+		return
+	}
+
+	s, err := h.AuthService.SignInSSO(r.Context(), service.Identity{
+		Email:     claims.Email,
+		Roles:     claims.Roles,
+		Workspace: claims.Workspace,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAccount):
+			writeJSONError(w, http.StatusUnauthorized, "sign-in failed")
+		case errors.Is(err, service.ErrWorkspaceNotFound):
+			writeJSONError(w, http.StatusForbidden, "unknown workspace")
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to sign in")
+		}
+		return
+	}
+
+	h.setSessionCookie(w, s)
+	http.Redirect(w, r, st.Redirect, http.StatusFound)
+}
+
+func readOIDCState(r *http.Request) (oidcState, bool) {
+	var st oidcState
+
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return st, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || json.Unmarshal(b, &st) != nil || st.State == "" {
+		return st, false
+	}
+
+	return st, true
+}
+
+// localPath returns p if it is a path on this host, "/" otherwise, so that
+// the sign-in cannot be used as an open redirect.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+
+	return p
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+var passwordFormTmpl = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body{font-family:system-ui,sans-serif;display:flex;justify-content:center;margin-top:15vh;color:#222}
+form{display:flex;flex-direction:column;gap:.75rem;width:18rem}
+input,button{font-size:1rem;padding:.5rem}
+.error{color:#b00020}
+</style>
+</head>
+<body>
+<form method="post">
+<h1>Password required</h1>
+<p>This link is protected. Enter the password to continue.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<input type="password" name="password" autocomplete="current-password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+func renderPasswordForm(w http.ResponseWriter, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	passwordFormTmpl.Execute(w, struct {
+		Error string
+	}{
+		Error: errMsg,
+	})
+}
+
+func (h *Handler) Unlock(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<10)
+	defer r.Body.Close()
+
+	// The password form is also rendered on preview URLs and posts back
+	// to them.
+	alias, mode := previewModeOf(r)
+	if alias == "" {
+		writeJSONError(w, http.StatusBadRequest, "alias is required")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		renderPasswordForm(w, http.StatusBadRequest, "Invalid form submission.")
+		return
+	}
+
+	password := r.PostForm.Get("password")
+	v := visitor(r)
+	v.SkipPreview = mode == previewSkip
+
+	u, err := h.URLService.Unlock(r.Context(), alias, password, v)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrURLNotFound):
+			writeJSONError(w, http.StatusNotFound, "url not found")
+		case errors.Is(err, service.ErrPreviewRequired):
+			h.writePreview(w, r, u, password)
+		case errors.Is(err, service.ErrWrongPassword):
+			renderPasswordForm(w, http.StatusUnauthorized, "Wrong password.")
+		case errors.Is(err, service.ErrLinkExhausted):
+			writeJSONError(w, http.StatusGone, "link is no longer available")
+		case errors.Is(err, service.ErrQuotaExceeded):
+			writeJSONError(w, http.StatusTooManyRequests, "monthly click quota exceeded")
+		case errors.Is(err, service.ErrLinkThrottled):
+			w.Header().Set("Retry-After", strconv.Itoa(int(service.LinkAttemptInterval.Seconds())))
+			renderPasswordForm(w, http.StatusTooManyRequests, "Too many attempts. Try again in a few seconds.")
+		case errors.Is(err, service.ErrTooManyAttempts):
+			w.Header().Set("Retry-After", strconv.Itoa(int(service.PasswordAttemptWindow.Seconds())))
+			renderPasswordForm(w, http.StatusTooManyRequests, "Too many attempts. Try again later.")
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve url")
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	setVariantCookie(w, r, u)
+	http.Redirect(w, r, u.OrigURL, http.StatusSeeOther)
+}
+
+// clientIP returns the client address without the port. RealIP middleware
+// replaces RemoteAddr with a bare IP when a proxy header is present.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/handlers"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// previewUnlocker accepts any password for a link that forces the preview.
+type previewUnlocker struct {
+	service.URLService
+}
+
+func (previewUnlocker) Unlock(_ context.Context, alias, _ string, v service.Visitor) (*service.URL, error) {
+	u := &service.URL{Alias: alias, OrigURL: "https://example.com", ForcePreview: true}
+	if !v.SkipPreview {
+		return u, service.ErrPreviewRequired
+	}
+
+	return u, nil
+}
+
+func TestUnlock_ForcePreview(t *testing.T) {
+	t.Parallel()
+
+	r := chi.NewRouter()
+	handlers.NewHandler(previewUnlocker{}, nil, nil, nil, "http://localhost").RedirectRoutes(r)
+
+	unlock := func(target string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {"s3cret"}}
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := unlock("/promo")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `action="/promo?preview=0"`)
+	require.Contains(t, rec.Body.String(), `value="s3cret"`)
+
+	rec = unlock("/promo?preview=0")
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	require.Equal(t, "https://example.com", rec.Header().Get("Location"))
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+const (
+	// previewSuffix appended to an alias, e.g. /abc+, shows the preview.
+	previewSuffix = "+"
+	// previewParam=1 shows the preview, previewParam=0 skips a forced one.
+	previewParam = "preview"
+)
+
+type previewMode int
+
+const (
+	previewDefault previewMode = iota
+	previewShow
+	previewSkip
+)
+
+var previewTmpl = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link preview</title>
+<style>
+body{font-family:system-ui,sans-serif;display:flex;justify-content:center;margin-top:12vh;color:#222}
+main{width:32rem;max-width:90vw}
+.dest{word-break:break-all;background:#f4f4f4;padding:.75rem;border-radius:4px}
+.host{font-weight:bold}
+.muted{color:#666;font-size:.9rem}
+a.button,button{display:inline-block;margin-top:1rem;padding:.5rem 1rem;background:#1a73e8;color:#fff;text-decoration:none;border:0;border-radius:4px;font-size:1rem}
+</style>
+</head>
+<body>
+<main>
+<h1>{{if .Title}}{{.Title}}{{else}}Where this link goes{{end}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<p><span class="muted">{{.ShortURL}}</span> leads to <span class="host">{{.Host}}</span>:</p>
+<p class="dest">{{.Destination}}</p>
+{{if not .CreatedAt.IsZero}}<p class="muted">Created {{.CreatedAt.Format "2 January 2006"}}</p>{{end}}
+{{if .Password}}<form method="post" action="{{.Continue}}">
+<input type="hidden" name="password" value="{{.Password}}">
+<button type="submit">Continue</button>
+</form>{{else}}<a class="button" href="{{.Continue}}" rel="noreferrer">Continue</a>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// previewModeOf strips the preview suffix from the alias and reports
+// whether the visitor asked for the preview or to skip it.
+func previewModeOf(r *http.Request) (string, previewMode) {
+	alias := aliasParam(r)
+	if trimmed, ok := strings.CutSuffix(alias, previewSuffix); ok {
+		return trimmed, previewShow
+	}
+
+	switch r.URL.Query().Get(previewParam) {
+	case "1", "true":
+		return alias, previewShow
+	case "0", "false":
+		return alias, previewSkip
+	}
+
+	return alias, previewDefault
+}
+
+func (h *Handler) renderPreview(w http.ResponseWriter, r *http.Request, alias string, v service.Visitor) {
+	u, err := h.URLService.Preview(r.Context(), alias, v)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrURLNotFound):
+			writeJSONError(w, http.StatusNotFound, "url not found")
+		case errors.Is(err, service.ErrPasswordRequired):
+			renderPasswordForm(w, http.StatusOK, "")
+		case errors.Is(err, service.ErrLinkExhausted):
+			writeJSONError(w, http.StatusGone, "link is no longer available")
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to preview url")
+		}
+		return
+	}
+
+	h.writePreview(w, r, u, "")
+}
+
+// writePreview renders the preview of u. Unlocked links pass the verified
+// password, which Continue posts back so the link is unlocked again with
+// the preview skipped.
+func (h *Handler) writePreview(w http.ResponseWriter, r *http.Request, u *service.URL, password string) {
+	data := struct {
+		Title       string
+		Description string
+		ShortURL    string
+		Host        string
+		Destination string
+		Continue    string
+		Password    string
+		CreatedAt   time.Time
+	}{
+		Title:       u.Title,
+		Description: u.Description,
+		ShortURL:    h.shortURL(u.Domain, u.Alias),
+		Destination: u.OrigURL,
+		Password:    password,
+		CreatedAt:   u.CreatedAt,
+	}
+	if u.Page != nil {
+		if data.Title == "" {
+			data.Title = u.Page.Title
+		}
+		if data.Description == "" {
+			data.Description = u.Page.Description
+		}
+	}
+	if dest, err := url.Parse(u.OrigURL); err == nil {
+		data.Host = dest.Hostname()
+	}
+
+	// Continue goes through the short link again so that the click is
+	// counted, with the preview skipped.
+	next := url.URL{
+		Path:     strings.TrimSuffix(r.URL.Path, previewSuffix),
+		RawQuery: withoutParam(r.URL.RawQuery, previewParam),
+	}
+	if next.RawQuery != "" {
+		next.RawQuery += "&"
+	}
+	next.RawQuery += previewParam + "=0"
+	data.Continue = next.String()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	previewTmpl.Execute(w, data)
+}
+
+// withoutParam removes every occurrence of name from a raw query string,
+// leaving the other parameters untouched.
+func withoutParam(rawQuery, name string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, p := range pairs {
+		key, _, _ := strings.Cut(p, "=")
+		if k, err := url.QueryUnescape(key); err == nil && k == name {
+			continue
+		}
+		kept = append(kept, p)
+	}
+
+	return strings.Join(kept, "&")
+}
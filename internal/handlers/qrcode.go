@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/finlleyl/shorty_reborn/internal/qrcode"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+const qrCacheSize = 1024
+
+func (h *Handler) QRCode(w http.ResponseWriter, r *http.Request) {
+	alias := aliasParam(r)
+	if alias == "" {
+		writeJSONError(w, http.StatusBadRequest, "alias is required")
+		return
+	}
+
+	opts, err := parseQROptions(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	u, err := h.URLService.Get(r.Context(), r.URL.Query().Get("domain"), alias)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrURLNotFound), errors.Is(err, service.ErrDomainNotFound):
+			writeJSONError(w, http.StatusNotFound, "url not found")
+		case writeAccessError(w, err):
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve url")
+		}
+		return
+	}
+
+	content := h.shortURL(u.Domain, u.Alias)
+	etag := qrcode.ETag(content, opts)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", h.qrCacheControl(r))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, _, err := h.QRCache.Render(content, opts)
+	if err != nil {
+		if errors.Is(err, qrcode.ErrInvalidSize) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to render qr code")
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func parseQROptions(r *http.Request) (qrcode.Options, error) {
+	opts := qrcode.DefaultOptions()
+	q := r.URL.Query()
+
+	if v := q.Get("format"); v != "" {
+		opts.Format = qrcode.Format(v)
+	}
+	if v := q.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, qrcode.ErrInvalidSize
+		}
+		opts.Size = size
+	}
+	if v := q.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, qrcode.ErrInvalidMargin
+		}
+		opts.Margin = margin
+	}
+	if v := q.Get("level"); v != "" {
+		level, err := qrcode.ParseLevel(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Level = level
+	}
+	if v := q.Get("fg"); v != "" {
+		c, err := qrcode.ParseColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Foreground = c
+	}
+	if v := q.Get("bg"); v != "" {
+		c, err := qrcode.ParseColor(v)
+		if err != nil {
+			return opts, err
+		}
+		opts.Background = c
+	}
+
+	return opts, opts.Validate()
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// qrCacheControl keeps QR codes out of shared caches when reading the link
+// depends on who asks: with workspaces or user accounts every link is
+// scoped to a workspace and reading it is authorized, and credentials may
+// grant access anonymous callers do not have.
+func (h *Handler) qrCacheControl(r *http.Request) string {
+	if h.WorkspaceService != nil || r.Header.Get("Authorization") != "" {
+		return "private, max-age=86400"
+	}
+
+	return "public, max-age=86400"
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/handlers"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// linkGetter serves every alias as a link to example.com.
+type linkGetter struct {
+	service.URLService
+}
+
+func (linkGetter) Get(_ context.Context, domain, alias string) (*service.URL, error) {
+	return &service.URL{Domain: domain, Alias: alias, OrigURL: "https://example.com"}, nil
+}
+
+func TestQRCode_CacheControl(t *testing.T) {
+	t.Parallel()
+
+	qr := func(h *handlers.Handler, authorization string) string {
+		req := httptest.NewRequest(http.MethodGet, "/promo/qr", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.URLRoutes().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		return rec.Header().Get("Cache-Control")
+	}
+
+	open := handlers.NewHandler(linkGetter{}, nil, nil, nil, "http://localhost")
+	require.Equal(t, "public, max-age=86400", qr(open, ""))
+	require.Equal(t, "private, max-age=86400", qr(open, "Bearer secret"))
+
+	scoped := handlers.NewHandler(linkGetter{}, nil, nil, nil, "http://localhost")
+	scoped.WorkspaceService = service.NewWorkspaceService(nil)
+	require.Equal(t, "private, max-age=86400", qr(scoped, ""))
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+const (
+	variantCookie       = "shorty_variant"
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+type variantStatsResponse struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+	Clicks int64  `json:"clicks"`
+}
+
+type dailyStatsResponse struct {
+	Day    string `json:"day"`
+	Clicks int64  `json:"clicks"`
+}
+
+type statsResponse struct {
+	Alias    string                 `json:"alias"`
+	Clicks   int64                  `json:"clicks"`
+	Variants []variantStatsResponse `json:"variants,omitempty"`
+	Daily    []dailyStatsResponse   `json:"daily"`
+}
+
+// setVariantCookie makes the split sticky for the visitor. The cookie is
+// scoped to the request path of the link so that variants of different
+// links do not overwrite each other.
+func setVariantCookie(w http.ResponseWriter, r *http.Request, u *service.URL) {
+	if u.Variant == "" {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookie,
+		Value:    u.Variant,
+		Path:     r.URL.EscapedPath(),
+		MaxAge:   int(variantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func variantFromCookie(r *http.Request) string {
+	c, err := r.Cookie(variantCookie)
+	if err != nil {
+		return ""
+	}
+
+	return c.Value
+}
+
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	alias := aliasParam(r)
+
+	stats, err := h.URLService.Stats(r.Context(), r.URL.Query().Get("domain"), alias)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrURLNotFound), errors.Is(err, service.ErrDomainNotFound):
+			writeJSONError(w, http.StatusNotFound, "url not found")
+		case errors.Is(err, service.ErrAnalyticsDisabled):
+			writeJSONError(w, http.StatusNotImplemented, "click analytics is disabled")
+		case errors.Is(err, service.ErrForbidden):
+			writeProblem(w, http.StatusForbidden, err.Error())
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to get stats")
+		}
+		return
+	}
+
+	resp := statsResponse{Alias: stats.Alias, Clicks: stats.Clicks}
+	for _, v := range stats.Variants {
+		resp.Variants = append(resp.Variants, variantStatsResponse(v))
+	}
+	resp.Daily = make([]dailyStatsResponse, 0, len(stats.Daily))
+	for _, d := range stats.Daily {
+		resp.Daily = append(resp.Daily, dailyStatsResponse{Day: d.Day.Format(time.DateOnly), Clicks: d.Clicks})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
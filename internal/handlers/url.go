@@ -5,26 +5,69 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/finlleyl/shorty_reborn/internal/oidc"
+	"github.com/finlleyl/shorty_reborn/internal/qrcode"
 	"github.com/finlleyl/shorty_reborn/internal/service"
 )
 
 type Handler struct {
-	URLService service.URLService
+	URLService     service.URLService
+	DomainService  service.DomainService
+	WebhookService service.WebhookService
+	AuditService   service.AuditService
+	// WorkspaceService is nil unless workspaces or user accounts are
+	// configured.
+	WorkspaceService service.WorkspaceService
+	// AuthService is nil unless user accounts are enabled, and OIDC unless
+	// single sign-on is configured as well.
+	AuthService service.AuthService
+	OIDC        *oidc.Provider
+	// SecureCookies limits the session cookie to HTTPS.
+	SecureCookies bool
+	// Dashboard serves the web dashboard under /dashboard/, nil when it is
+	// disabled.
+	Dashboard http.Handler
+	BaseURL       string
+	QRCache       *qrcode.Cache
 }
 
-func NewHandler(urlService service.URLService) *Handler {
-	return &Handler{URLService: urlService}
+func NewHandler(urlService service.URLService, domainService service.DomainService, webhookService service.WebhookService, auditService service.AuditService, baseURL string) *Handler {
+	return &Handler{
+		URLService:     urlService,
+		DomainService:  domainService,
+		WebhookService: webhookService,
+		AuditService:   auditService,
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		QRCache:        qrcode.NewCache(qrCacheSize),
+	}
 }
 
+// RedirectRoutes serves short links at the root of every domain, e.g.
+// https://go.example.com/{alias}.
+func (h *Handler) RedirectRoutes(r chi.Router) {
+	r.Get("/{alias}", h.Resolve)
+	r.Post("/{alias}", h.Unlock)
+}
+
+// URLRoutes serves the link API. Unlock is routed by the server itself,
+// outside the session middleware.
 func (h *Handler) URLRoutes() http.Handler {
 	r := chi.NewRouter()
 
+	r.Get("/", h.List)
 	r.Post("/", h.Create)
 	r.Get("/{alias}", h.Resolve)
 	r.Delete("/{alias}", h.Delete)
+	r.Post("/{alias}/restore", h.Restore)
+	r.Get("/{alias}/qr", h.QRCode)
+	r.Get("/{alias}/stats", h.Stats)
 
 	return r
 }
@@ -32,6 +75,69 @@ func (h *Handler) URLRoutes() http.Handler {
 type createURLRequest struct {
 	URL string `json:"url"`
 	Alias string `json:"alias"`
+	Password string `json:"password"`
+	MaxClicks int64 `json:"max_clicks"`
+	Domain string `json:"domain"`
+	Rules []service.Rule `json:"rules"`
+	Variants []service.Variant `json:"variants"`
+	QueryMode string `json:"query_mode"`
+	UTM service.UTM `json:"utm"`
+	Title string `json:"title"`
+	Description string `json:"description"`
+	Tags []string `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
+	ForcePreview bool `json:"force_preview"`
+	Reuse bool `json:"reuse"`
+}
+
+type urlResponse struct {
+	Domain       string            `json:"domain,omitempty"`
+	Alias        string            `json:"alias"`
+	URL          string            `json:"url"`
+	ShortURL     string            `json:"short_url"`
+	Protected    bool              `json:"protected,omitempty"`
+	MaxClicks    *int64            `json:"max_clicks,omitempty"`
+	ClicksLeft   *int64            `json:"clicks_left,omitempty"`
+	Rules        []service.Rule    `json:"rules,omitempty"`
+	Variants     []service.Variant `json:"variants,omitempty"`
+	QueryMode    string            `json:"query_mode,omitempty"`
+	UTM          *service.UTM      `json:"utm,omitempty"`
+	Title        string            `json:"title,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Page         *service.PageMeta `json:"page,omitempty"`
+	ForcePreview bool              `json:"force_preview,omitempty"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+}
+
+func (h *Handler) toResponse(u *service.URL) urlResponse {
+	resp := urlResponse{
+		Domain:       u.Domain,
+		Alias:        u.Alias,
+		URL:          u.OrigURL,
+		ShortURL:     h.shortURL(u.Domain, u.Alias),
+		Protected:    u.Protected,
+		MaxClicks:    u.MaxClicks,
+		ClicksLeft:   u.ClicksLeft,
+		Rules:        u.Rules,
+		Variants:     u.Variants,
+		QueryMode:    u.QueryMode,
+		Title:        u.Title,
+		Description:  u.Description,
+		Tags:         u.Tags,
+		Metadata:     u.Metadata,
+		Page:         u.Page,
+		ForcePreview: u.ForcePreview,
+	}
+	if !u.CreatedAt.IsZero() {
+		resp.CreatedAt = &u.CreatedAt
+	}
+	if u.UTM != (service.UTM{}) {
+		resp.UTM = &u.UTM
+	}
+
+	return resp
 }
 
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
@@ -44,11 +150,41 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := h.URLService.Create(r.Context(), req.URL, req.Alias)
+	u, err := h.URLService.Create(r.Context(), req.URL, req.Alias,
+		service.WithPassword(req.Password),
+		service.WithMaxClicks(req.MaxClicks),
+		service.WithDomain(req.Domain),
+		service.WithRules(req.Rules),
+		service.WithVariants(req.Variants),
+		service.WithQueryMode(req.QueryMode),
+		service.WithUTM(req.UTM),
+		service.WithTitle(req.Title),
+		service.WithDescription(req.Description),
+		service.WithTags(req.Tags),
+		service.WithMetadata(req.Metadata),
+		service.WithForcePreview(req.ForcePreview),
+		service.WithReuse(req.Reuse),
+	)
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrAliasExists):
 			writeJSONError(w, http.StatusConflict, "alias already exists")
+		case errors.Is(err, service.ErrInvalidAlias), errors.Is(err, service.ErrAliasNotAllowed):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrInvalidPassword):
+			writeJSONError(w, http.StatusBadRequest, "invalid password")
+		case errors.Is(err, service.ErrInvalidMaxClicks):
+			writeJSONError(w, http.StatusBadRequest, "invalid max_clicks")
+		case errors.Is(err, service.ErrDomainNotFound):
+			writeJSONError(w, http.StatusBadRequest, "unknown domain")
+		case errors.Is(err, service.ErrQuotaExceeded):
+			writeJSONError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrForbidden):
+			writeProblem(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrInvalidRule), errors.Is(err, service.ErrInvalidVariant),
+			errors.Is(err, service.ErrInvalidQueryMode), errors.Is(err, service.ErrInvalidUTM),
+			errors.Is(err, service.ErrInvalidTag), errors.Is(err, service.ErrInvalidMetadata):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
 		default:
 			writeJSONError(w, http.StatusInternalServerError, "failed to create url")
 		}
@@ -57,45 +193,120 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Location", fmt.Sprintf("/api/urls/%s", u.Alias))
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(u)	
+	w.Header().Set("Location", fmt.Sprintf("/api/urls/%s", url.PathEscape(u.Alias)))
+	if u.Reused {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(h.toResponse(u))
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f := service.ListFilter{Tag: q.Get("tag"), Search: q.Get("q")}
+	for name, dst := range map[string]*int{"limit": &f.Limit, "offset": &f.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dst = n
+		}
+	}
+
+	urls, err := h.URLService.List(r.Context(), f)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTag):
+			writeJSONError(w, http.StatusBadRequest, "invalid tag")
+		case errors.Is(err, service.ErrInvalidSearch):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrForbidden):
+			writeProblem(w, http.StatusForbidden, err.Error())
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to list urls")
+		}
+		return
+	}
+
+	resp := make([]urlResponse, 0, len(urls))
+	for _, u := range urls {
+		resp = append(resp, h.toResponse(u))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *Handler) Resolve(w http.ResponseWriter, r *http.Request) {
-	alias := chi.URLParam(r, "alias")
+	alias, mode := previewModeOf(r)
 	if alias == "" {
 		writeJSONError(w, http.StatusBadRequest, "alias is required")
 		return
 	}
+
+	v := visitor(r)
+	if mode == previewShow {
+		h.renderPreview(w, r, alias, v)
+		return
+	}
+	v.SkipPreview = mode == previewSkip
 	
-	u, err := h.URLService.Resolve(r.Context(), alias)
+	u, err := h.URLService.Resolve(r.Context(), alias, v)
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrURLNotFound):
 			writeJSONError(w, http.StatusNotFound, "url not found")
+		case errors.Is(err, service.ErrPasswordRequired):
+			renderPasswordForm(w, http.StatusOK, "")
+		case errors.Is(err, service.ErrPreviewRequired):
+			h.renderPreview(w, r, alias, v)
+		case errors.Is(err, service.ErrLinkExhausted):
+			writeJSONError(w, http.StatusGone, "link is no longer available")
+		case errors.Is(err, service.ErrQuotaExceeded):
+			writeJSONError(w, http.StatusTooManyRequests, "monthly click quota exceeded")
 		default:
 			writeJSONError(w, http.StatusInternalServerError, "failed to resolve url")
 		}
 		return
 	}
 
-	w.Header().Set("Cache-Control", "public, max-age=60")
+	// Every visit of a click-limited or split link has to reach the server,
+	// and targeted redirects or UTM values naming the platform differ per
+	// visitor so shared caches must not keep them.
+	switch {
+	case u.MaxClicks != nil, len(u.Variants) > 0:
+		w.Header().Set("Cache-Control", "no-store")
+	case len(u.Rules) > 0:
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Header().Set("Vary", "User-Agent, Accept-Language")
+	case service.UTMVariesByPlatform(u.UTM):
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Header().Set("Vary", "User-Agent")
+	default:
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	}
+	setVariantCookie(w, r, u)
 	http.Redirect(w, r, u.OrigURL, http.StatusFound)
 }
 
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
-	alias := chi.URLParam(r, "alias")
+	alias := aliasParam(r)
 
 	if alias == "" {
 		writeJSONError(w, http.StatusBadRequest, "alias is required")
 		return
 	}
 
-	if err := h.URLService.Delete(r.Context(), alias); err != nil {
+	if err := h.URLService.Delete(r.Context(), r.URL.Query().Get("domain"), alias); err != nil {
 		switch {
-		case errors.Is(err, service.ErrURLNotFound):
+		case errors.Is(err, service.ErrURLNotFound), errors.Is(err, service.ErrDomainNotFound):
 			writeJSONError(w, http.StatusNotFound, "url not found")
+		case errors.Is(err, service.ErrForbidden):
+			writeProblem(w, http.StatusForbidden, err.Error())
 		default:
 			writeJSONError(w, http.StatusInternalServerError, "failed to delete url")
 		}
@@ -106,9 +317,116 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Restore serves POST /api/urls/{alias}/restore and undeletes a link deleted
+// within the grace period.
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	alias := aliasParam(r)
+
+	u, err := h.URLService.Restore(r.Context(), r.URL.Query().Get("domain"), alias)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrURLNotFound), errors.Is(err, service.ErrDomainNotFound):
+			writeJSONError(w, http.StatusNotFound, "url not found")
+		case errors.Is(err, service.ErrAliasExists):
+			writeJSONError(w, http.StatusConflict, "alias already in use")
+		case errors.Is(err, service.ErrQuotaExceeded):
+			writeJSONError(w, http.StatusForbidden, err.Error())
+		case errors.Is(err, service.ErrForbidden):
+			writeProblem(w, http.StatusForbidden, err.Error())
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to restore url")
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.toResponse(u))
+}
+
+// aliasParam returns the percent-decoded {alias} route parameter. chi
+// matches routes against the raw path whenever the client's escaping is
+// not the canonical one, so Unicode aliases may arrive encoded; otherwise
+// the parameter is already decoded and must not be decoded twice.
+func aliasParam(r *http.Request) string {
+	raw := chi.URLParam(r, "alias")
+	if r.URL.RawPath == "" {
+		return raw
+	}
+	alias, err := url.PathUnescape(raw)
+	if err != nil {
+		return raw
+	}
+
+	return alias
+}
+
+func visitor(r *http.Request) service.Visitor {
+	return service.Visitor{
+		Host:           r.Host,
+		IP:             clientIP(r),
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          withoutParam(r.URL.RawQuery, previewParam),
+		Variant:        variantFromCookie(r),
+	}
+}
+
+// shortURL is the public address of a link: the base URL for the default
+// namespace, the link's own domain with the base URL's scheme otherwise.
+func (h *Handler) shortURL(domain, alias string) string {
+	base := h.BaseURL
+	if domain != "" {
+		scheme := "https"
+		if u, err := url.Parse(h.BaseURL); err == nil && u.Scheme != "" {
+			scheme = u.Scheme
+		}
+		base = scheme + "://" + domain
+	}
+
+	return base + "/" + url.PathEscape(alias)
+}
+
 func writeJSONError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]string{"error": msg})
   }
+
+// writeAccessError writes the problem for ErrUnauthenticated and
+// ErrForbidden and reports whether err was one of them.
+func writeAccessError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrUnauthenticated):
+		writeProblem(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		writeProblem(w, http.StatusForbidden, err.Error())
+	default:
+		return false
+	}
+
+	return true
+}
+
+// problem is an RFC 9457 problem details body. Error repeats the detail for
+// clients reading the error field of the other responses.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Error:  detail,
+	})
+}
   
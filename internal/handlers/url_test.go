@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/handlers"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// deleteRecorder records the alias the handler passes to Delete.
+type deleteRecorder struct {
+	service.URLService
+	alias string
+}
+
+func (s *deleteRecorder) Delete(_ context.Context, _, alias string) error {
+	s.alias = alias
+	return nil
+}
+
+func TestAliasParam(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		alias string
+	}{
+		{name: "plain", path: "/promo", alias: "promo"},
+		{name: "escaped percent is decoded once", path: "/a%2541", alias: "a%41"},
+		{name: "literal percent", path: "/100%25", alias: "100%"},
+		{name: "non-canonical escaping", path: "/a%7eb", alias: "a~b"},
+		{name: "unicode", path: "/%D0%BF%D1%80%D0%B8%D0%B2%D0%B5%D1%82", alias: "привет"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc := &deleteRecorder{}
+			h := handlers.NewHandler(svc, nil, nil, nil, "http://localhost")
+			rec := httptest.NewRecorder()
+
+			h.URLRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+
+			require.Equal(t, http.StatusNoContent, rec.Code)
+			require.Equal(t, tc.alias, svc.alias)
+		})
+	}
+}
+
+// linkResolver serves the stored link for every alias.
+type linkResolver struct {
+	service.URLService
+	link service.URL
+}
+
+func (s linkResolver) Resolve(_ context.Context, alias string, _ service.Visitor) (*service.URL, error) {
+	u := s.link
+	u.Alias = alias
+	return &u, nil
+}
+
+func TestResolve_CacheControl(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		link         service.URL
+		cacheControl string
+		vary         string
+	}{
+		{"plain", service.URL{}, "public, max-age=60", ""},
+		{"static utm", service.URL{UTM: service.UTM{Source: "{alias}"}}, "public, max-age=60", ""},
+		{"platform utm", service.URL{UTM: service.UTM{Medium: "app-{platform}"}}, "private, max-age=60", "User-Agent"},
+		{"targeted", service.URL{Rules: []service.Rule{{Platform: "ios", URL: "https://apps.apple.com"}}}, "private, max-age=60", "User-Agent, Accept-Language"},
+		{"click limited", service.URL{MaxClicks: new(int64)}, "no-store", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.link.OrigURL = "https://example.com"
+			h := handlers.NewHandler(linkResolver{link: tc.link}, nil, nil, nil, "http://localhost")
+
+			rec := httptest.NewRecorder()
+			h.URLRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/promo", nil))
+
+			require.Equal(t, http.StatusFound, rec.Code)
+			require.Equal(t, tc.cacheControl, rec.Header().Get("Cache-Control"))
+			require.Equal(t, tc.vary, rec.Header().Get("Vary"))
+		})
+	}
+}
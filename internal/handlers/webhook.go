@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+func (h *Handler) WebhookRoutes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Post("/", h.CreateWebhook)
+	r.Get("/", h.ListWebhooks)
+	r.Delete("/{id}", h.DeleteWebhook)
+	r.Get("/{id}/deliveries", h.WebhookDeliveries)
+
+	return r
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+type webhookResponse struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type webhookDeliveryResponse struct {
+	ID         int64     `json:"id"`
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func toWebhookResponse(w *service.Webhook) webhookResponse {
+	events := w.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	return webhookResponse{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    events,
+		Secret:    w.Secret,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<12)
+	defer r.Body.Close()
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	wh, err := h.WebhookService.Create(r.Context(), req.URL, req.Events, req.Secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidWebhookURL):
+			writeJSONError(w, http.StatusBadRequest, "invalid webhook url")
+		case errors.Is(err, service.ErrInvalidEvent), errors.Is(err, service.ErrInvalidSecret):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case writeAccessError(w, err):
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to create webhook")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/webhooks/"+strconv.FormatInt(wh.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toWebhookResponse(wh))
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.WebhookService.List(r.Context())
+	if err != nil {
+		if writeAccessError(w, err) {
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to list webhooks")
+		return
+	}
+
+	resp := make([]webhookResponse, 0, len(webhooks))
+	for _, wh := range webhooks {
+		resp = append(resp, toWebhookResponse(wh))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	if err := h.WebhookService.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			writeJSONError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		if writeAccessError(w, err) {
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	deliveries, err := h.WebhookService.Deliveries(r.Context(), id, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			writeJSONError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		if writeAccessError(w, err) {
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to list webhook deliveries")
+		return
+	}
+
+	resp := make([]webhookDeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp = append(resp, webhookDeliveryResponse{
+			ID:         d.ID,
+			EventID:    d.EventID,
+			Event:      d.Event,
+			Attempt:    d.Attempt,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+			DurationMS: d.DurationMS,
+			CreatedAt:  d.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// Actor puts the service.Actor of the request into its context. It has to
+// run after middleware.RequestID and RealIP. Requests with an
+// Authorization header are attributed to a fingerprint of the credential,
+// so that the credential itself never reaches the audit log.
+func Actor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := service.Actor{
+			ID:        service.ActorID(r.Header.Get("Authorization")),
+			RequestID: middleware.GetReqID(r.Context()),
+			IP:        remoteIP(r.RemoteAddr),
+		}
+
+		next.ServeHTTP(w, r.WithContext(service.ContextWithActor(r.Context(), actor)))
+	})
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
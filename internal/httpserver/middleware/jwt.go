@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/finlleyl/shorty_reborn/internal/oidc"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// TokenVerifier verifies the bearer tokens of an SSO provider.
+type TokenVerifier interface {
+	Verify(ctx context.Context, raw string) (*oidc.Claims, error)
+}
+
+// JWT attributes requests with a bearer JWT of the SSO provider to the
+// user it identifies, who is created or updated with the email, roles and
+// workspace of the token. It has to run after Actor and before Workspace.
+// Other bearer credentials are left to the API key.
+func JWT(verifier TokenVerifier, auth service.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerJWT(r.Header.Get("Authorization"))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				if errors.Is(err, oidc.ErrInvalidToken) || errors.Is(err, oidc.ErrUnknownKey) {
+					writeError(w, http.StatusUnauthorized, "invalid token")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "failed to authenticate")
+				return
+			}
+
+			u, err := auth.Identify(r.Context(), service.Identity{
+				Issuer:    claims.Issuer,
+				Subject:   claims.Subject,
+				Email:     claims.Email,
+				Roles:     claims.Roles,
+				Workspace: claims.Workspace,
+			})
+			if err != nil {
+				switch {
+				case errors.Is(err, service.ErrInvalidAccount):
+					writeError(w, http.StatusUnauthorized, "invalid token")
+				case errors.Is(err, service.ErrWorkspaceNotFound):
+					writeError(w, http.StatusForbidden, "unknown workspace")
+				default:
+					writeError(w, http.StatusInternalServerError, "failed to authenticate")
+				}
+				return
+			}
+
+			actor := service.ActorFromContext(r.Context())
+			actor.ID = service.UserActorID(u.ID)
+			actor.User = u.ID
+			actor.Workspace = u.Workspace
+			actor.Roles = u.Roles
+			actor.Authenticated = true
+			next.ServeHTTP(w, r.WithContext(service.ContextWithActor(r.Context(), actor)))
+		})
+	}
+}
+
+// bearerJWT returns the token of a "Bearer" Authorization header value if
+// it has the three dot-separated parts of a JWT. Generated API keys have
+// none.
+func bearerJWT(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+
+	return token, strings.Count(token, ".") == 2
+}
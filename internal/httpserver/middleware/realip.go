@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses addresses and CIDR ranges of reverse proxies,
+// e.g. "10.0.0.0/8" or "127.0.0.1".
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// RealIP replaces RemoteAddr with the client address forwarded by a trusted
+// proxy. X-Forwarded-For is read from the right, skipping trusted hops, so
+// that addresses a client prepends itself are ignored; X-Real-IP is used
+// when it is absent. Requests from any other peer keep their address,
+// whatever headers they send.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, err := netip.ParseAddr(remoteIP(r.RemoteAddr)); err == nil && isTrusted(peer) {
+				if ip := forwardedFor(r.Header, isTrusted); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forwardedFor(h http.Header, isTrusted func(netip.Addr) bool) string {
+	var hops []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return ""
+		}
+		if i == 0 || !isTrusted(addr) {
+			return addr.Unmap().String()
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(h.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,51 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/httpserver/middleware"
+)
+
+func TestRealIP(t *testing.T) {
+	t.Parallel()
+
+	trusted, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	require.NoError(t, err)
+
+	_, err = middleware.ParseTrustedProxies([]string{"proxy.local"})
+	require.Error(t, err)
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer", "203.0.113.7:4000", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"}, "203.0.113.7:4000"},
+		{"trusted peer", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "1.2.3.4"},
+		{"spoofed hops are skipped", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "6.6.6.6, 1.2.3.4, 10.0.0.2"}, "1.2.3.4"},
+		{"real ip header", "[::1]:4000", map[string]string{"X-Real-IP": "1.2.3.4"}, "1.2.3.4"},
+		{"no header", "10.0.0.1:4000", nil, "10.0.0.1:4000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := middleware.RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+const (
+	// SessionCookie holds the token of a signed-in browser.
+	SessionCookie = "shorty_session"
+	// CSRFHeader has to carry the session's CSRF token on every unsafe
+	// request authenticated with the session cookie.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Session attributes requests with a valid session cookie to its user and
+// moves them into the user's workspace. It has to run after Actor and
+// Workspace. Requests with an Authorization header are left to the API key,
+// and unknown or expired sessions are treated as anonymous.
+//
+// Since browsers send the cookie with cross-site requests too, POST, PUT,
+// PATCH and DELETE requests are rejected unless CSRFHeader matches the
+// token issued with the session.
+func Session(auth service.AuthService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(SessionCookie)
+			if err != nil || r.Header.Get("Authorization") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			s, err := auth.Session(r.Context(), cookie.Value)
+			if err != nil {
+				if errors.Is(err, service.ErrUnauthenticated) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "failed to authenticate")
+				return
+			}
+
+			if !safeMethod(r.Method) && subtle.ConstantTimeCompare([]byte(r.Header.Get(CSRFHeader)), []byte(s.CSRFToken)) != 1 {
+				writeError(w, http.StatusForbidden, "invalid CSRF token")
+				return
+			}
+
+			actor := service.ActorFromContext(r.Context())
+			actor.ID = service.UserActorID(s.User.ID)
+			actor.User = s.User.ID
+			actor.Workspace = s.User.Workspace
+			actor.Roles = s.User.Roles
+			actor.Authenticated = true
+			next.ServeHTTP(w, r.WithContext(service.ContextWithActor(r.Context(), actor)))
+		})
+	}
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/finlleyl/shorty_reborn/internal/service"
+)
+
+// Workspace scopes the request to the workspace of its API key and grants
+// it the key's roles; personal keys act as their user. It has to run after
+// Actor. Requests without an Authorization header stay in the
+// default workspace; requests with a key of no workspace are rejected.
+// Requests already attributed to a user, e.g. by JWT, are left as they are.
+func Workspace(workspaces service.WorkspaceService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if service.ActorFromContext(r.Context()).User != 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			authorization := r.Header.Get("Authorization")
+			p, err := workspaces.Authenticate(r.Context(), authorization)
+			if err != nil {
+				status, msg := http.StatusInternalServerError, "failed to authenticate"
+				if errors.Is(err, service.ErrUnknownAPIKey) {
+					status, msg = http.StatusUnauthorized, "invalid API key"
+				}
+				writeError(w, status, msg)
+				return
+			}
+
+			actor := service.ActorFromContext(r.Context())
+			actor.Workspace = p.Workspace
+			actor.Roles = p.Roles
+			actor.Authenticated = authorization != ""
+			if p.User != 0 {
+				actor.ID = service.UserActorID(p.User)
+				actor.User = p.User
+			}
+			next.ServeHTTP(w, r.WithContext(service.ContextWithActor(r.Context(), actor)))
+		})
+	}
+}
@@ -2,6 +2,8 @@ package httpserver
 
 import (
 	"net/http"
+	"net/netip"
+	"slices"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -14,25 +16,61 @@ import (
 	zapmv "github.com/finlleyl/shorty_reborn/internal/httpserver/middleware"
 )
 
-func NewRouter(h *handlers.Handler, logger *zap.SugaredLogger) http.Handler {
+// NewRouter builds the routes of the HTTP API. Browsers on corsOrigins may
+// call the API cross-origin, with credentials unless the list is "*". Other
+// origins are refused, and CORS is disabled altogether when the list is
+// empty. Client addresses forwarded by proxies are only taken from peers in
+// trustedProxies.
+func NewRouter(h *handlers.Handler, logger *zap.SugaredLogger, corsOrigins []string, trustedProxies []netip.Prefix) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(zapmv.RealIP(trustedProxies))
 	r.Use(zapmv.ZapLogger(logger))
+	r.Use(zapmv.Actor)
+	if h.OIDC != nil && h.AuthService != nil {
+		r.Use(zapmv.JWT(h.OIDC, h.AuthService))
+	}
+	if h.WorkspaceService != nil {
+		r.Use(zapmv.Workspace(h.WorkspaceService))
+	}
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
-	r.Use(cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "DELETE"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		AllowCredentials: true,
-	}).Handler)
+	if len(corsOrigins) > 0 {
+		r.Use(cors.New(cors.Options{
+			AllowedOrigins:   corsOrigins,
+			AllowedMethods:   []string{"GET", "POST", "DELETE"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", zapmv.CSRFHeader},
+			AllowCredentials: !slices.Contains(corsOrigins, "*"),
+		}).Handler)
+	}
 
 	r.Route("/api", func(r chi.Router) {
-		r.Mount("/urls", h.URLRoutes())
+		// The password form of a protected link posts back to the page it
+		// was rendered on, without a CSRF token. Unlocking does not act as
+		// the signed-in user, so it bypasses the session.
+		r.Post("/urls/{alias}", h.Unlock)
+
+		r.Group(func(r chi.Router) {
+			if h.AuthService != nil {
+				r.Use(zapmv.Session(h.AuthService))
+				r.Mount("/auth", h.AuthRoutes())
+				r.Mount("/keys", h.APIKeyRoutes())
+			}
+			r.Mount("/urls", h.URLRoutes())
+			r.Mount("/domains", h.DomainRoutes())
+			r.Mount("/webhooks", h.WebhookRoutes())
+			r.Get("/audit", h.ListAudit)
+		})
 	})
 
+	if h.Dashboard != nil {
+		r.Get("/dashboard", http.RedirectHandler("/dashboard/", http.StatusMovedPermanently).ServeHTTP)
+		r.Handle("/dashboard/*", http.StripPrefix("/dashboard", h.Dashboard))
+	}
+
+	h.RedirectRoutes(r)
+
 	return r
 }
@@ -0,0 +1,88 @@
+package httpserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/handlers"
+	"github.com/finlleyl/shorty_reborn/internal/httpserver"
+	zapmv "github.com/finlleyl/shorty_reborn/internal/httpserver/middleware"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestRouter_SessionCSRF(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	users := servicetest.NewMockUserRepository(ctrl)
+	h := handlers.NewHandler(service.NewURLService(repo), nil, nil, nil, "http://localhost")
+	h.AuthService = service.NewAuthService(users, servicetest.NewMockWorkspaceRepository(ctrl), time.Hour)
+	router := httpserver.NewRouter(h, zap.NewNop().Sugar(), nil, nil)
+
+	users.EXPECT().
+		Session(gomock.Any(), service.KeyHash("token"), gomock.Any()).
+		Return(&database.Session{CSRFToken: "csrf"}, &database.User{ID: 7, Workspace: service.DefaultWorkspace, Roles: database.Tags{"admin"}}, nil).
+		AnyTimes()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	protected := &database.URL{ID: 1, Alias: "vault", URL: "https://ok.com", PasswordHash: string(hash)}
+
+	signedIn := func(r *http.Request) *http.Request {
+		r.AddCookie(&http.Cookie{Name: zapmv.SessionCookie, Value: "token"})
+		return r
+	}
+
+	t.Run("unlock needs no CSRF token", func(t *testing.T) {
+		repo.EXPECT().Get(gomock.Any(), database.AnyWorkspace, "", "vault").Return(protected, nil)
+		req := signedIn(httptest.NewRequest(http.MethodPost, "/api/urls/vault", strings.NewReader(url.Values{"password": {"secret"}}.Encode())))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusSeeOther, rec.Code)
+		require.Equal(t, "https://ok.com", rec.Header().Get("Location"))
+	})
+
+	t.Run("resolve still served by the API", func(t *testing.T) {
+		repo.EXPECT().Get(gomock.Any(), database.AnyWorkspace, "", "vault").Return(protected, nil)
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, signedIn(httptest.NewRequest(http.MethodGet, "/api/urls/vault", nil)))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), `<form method="post">`)
+	})
+
+	t.Run("other unsafe requests need the CSRF token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, signedIn(httptest.NewRequest(http.MethodDelete, "/api/urls/vault", nil)))
+
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Contains(t, rec.Body.String(), "invalid CSRF token")
+	})
+
+	t.Run("with the CSRF token", func(t *testing.T) {
+		repo.EXPECT().Delete(gomock.Any(), service.DefaultWorkspace, "", "vault").Return(nil)
+		req := signedIn(httptest.NewRequest(http.MethodDelete, "/api/urls/vault", nil))
+		req.Header.Set(zapmv.CSRFHeader, "csrf")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusNoContent, rec.Code)
+	})
+}
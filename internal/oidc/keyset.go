@@ -0,0 +1,283 @@
+// Package oidc verifies JWTs of an OpenID Connect issuer and signs users in
+// with its authorization code flow.
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultCacheTTL        = time.Hour
+	DefaultRefreshInterval = 30 * time.Second
+
+	maxJWKSBytes = 1 << 20
+	loadTimeout  = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type KeySetOptions struct {
+	// CacheTTL is how long keys are used before the set is reloaded.
+	CacheTTL time.Duration
+	// RefreshInterval is the least time between reloads made for tokens
+	// with unknown key IDs, so that they cannot be used to flood the
+	// issuer.
+	RefreshInterval time.Duration
+	HTTPClient      *http.Client
+}
+
+// KeySet is the cached JSON Web Key Set of an issuer, loaded from a URL or
+// a local file. It is reloaded once the cache TTL expires and, to pick up
+// rotated keys, when a token is signed with a key it does not know yet.
+// Concurrent reloads are merged into one, and lookups of known keys do not
+// wait for it.
+type KeySet struct {
+	load    func(ctx context.Context) ([]byte, error)
+	ttl     time.Duration
+	refresh time.Duration
+	loads   singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// NewRemoteKeySet returns the key set served at url.
+func NewRemoteKeySet(url string, opts KeySetOptions) *KeySet {
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return newKeySet(func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+		}
+
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	}, opts)
+}
+
+// NewFileKeySet returns the key set stored in the file at path. The file is
+// read again after the cache TTL, so that keys can be rotated without a
+// restart.
+func NewFileKeySet(path string, opts KeySetOptions) *KeySet {
+	return newKeySet(func(context.Context) ([]byte, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %w", err)
+		}
+
+		return b, nil
+	}, opts)
+}
+
+func newKeySet(load func(ctx context.Context) ([]byte, error), opts KeySetOptions) *KeySet {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultRefreshInterval
+	}
+
+	return &KeySet{load: load, ttl: opts.CacheTTL, refresh: opts.RefreshInterval}
+}
+
+// Key returns the public key with the key ID. An empty kid matches the only
+// key of a set with one key.
+func (s *KeySet) Key(ctx context.Context, kid string) (any, error) {
+	s.mu.RLock()
+	key, ok := s.lookup(kid)
+	age := time.Since(s.fetchedAt)
+	expired := s.keys == nil || age >= s.ttl
+	s.mu.RUnlock()
+
+	if expired || (!ok && age >= s.refresh) {
+		if err := s.reload(ctx); err != nil {
+			return nil, err
+		}
+
+		s.mu.RLock()
+		key, ok = s.lookup(kid)
+		s.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	return key, nil
+}
+
+// lookup must be called with s.mu held.
+func (s *KeySet) lookup(kid string) (any, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+
+	return key, ok
+}
+
+// reload loads the keys again without holding s.mu, so that lookups are
+// not blocked by the issuer. Callers arriving during a reload wait for it
+// instead of starting another one; the load is detached from the first
+// caller's cancellation. When it fails, stale keys are kept and the load is
+// retried after the refresh interval.
+func (s *KeySet) reload(ctx context.Context) error {
+	_, err, _ := s.loads.Do("", func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		b, err := s.load(ctx)
+		var keys map[string]any
+		if err == nil {
+			keys, err = parseJWKS(b)
+		}
+		now := time.Now()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			if s.keys != nil {
+				s.fetchedAt = now.Add(s.refresh - s.ttl)
+				return nil, nil
+			}
+			return nil, err
+		}
+		s.keys = keys
+		s.fetchedAt = now
+
+		return nil, nil
+	})
+
+	return err
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the RSA and EC signing keys of a JWKS document by key
+// ID. Keys of other types are skipped.
+func parseJWKS(b []byte) (map[string]any, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]any, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key any
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k)
+		case "EC":
+			key, err = ecKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	modulus := new(big.Int).SetBytes(n)
+	if modulus.BitLen() < 2048 {
+		return nil, errors.New("modulus shorter than 2048 bits")
+	}
+
+	return &rsa.PublicKey{N: modulus, E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	var (
+		curve elliptic.Curve
+		point ecdh.Curve
+	)
+	switch k.Crv {
+	case "P-256":
+		curve, point = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, point = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, point = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil || len(x) != size || len(y) != size {
+		return nil, errors.New("invalid coordinates")
+	}
+
+	// ecdh rejects points that are not on the curve.
+	if _, err := point.NewPublicKey(bytes.Join([][]byte{{4}, x, y}, nil)); err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
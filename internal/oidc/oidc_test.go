@@ -0,0 +1,275 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/oidc"
+	"github.com/finlleyl/shorty_reborn/internal/oidc/oidctest"
+)
+
+func TestVerify(t *testing.T) {
+	issuer := oidctest.NewIssuer()
+	defer issuer.Close()
+
+	keys := oidc.NewRemoteKeySet(issuer.URL+"/jwks", oidc.KeySetOptions{})
+	verifier := oidc.NewVerifier(keys, oidc.VerifierOptions{
+		Issuer:         issuer.URL,
+		Audience:       oidctest.ClientID,
+		RolesClaim:     "realm_access.roles",
+		WorkspaceClaim: "team",
+	})
+	ctx := context.Background()
+
+	t.Run("valid", func(t *testing.T) {
+		token := issuer.Sign(jwt.MapClaims{
+			"sub":          "u1",
+			"email":        "A@example.com",
+			"realm_access": map[string]any{"roles": []string{"editor"}},
+			"team":         "marketing",
+		})
+
+		c, err := verifier.Verify(ctx, token)
+		require.NoError(t, err)
+		require.Equal(t, "a@example.com", c.Email)
+		require.Equal(t, []string{"editor"}, c.Roles)
+		require.Equal(t, "marketing", c.Workspace)
+	})
+
+	t.Run("default workspace", func(t *testing.T) {
+		c, err := verifier.Verify(ctx, issuer.Sign(jwt.MapClaims{"sub": "u1", "email": "a@example.com"}))
+		require.NoError(t, err)
+		require.Equal(t, oidc.DefaultWorkspace, c.Workspace)
+		require.Empty(t, c.Roles)
+	})
+
+	rejected := map[string]jwt.MapClaims{
+		"expired":          {"sub": "u1", "email": "a@example.com", "exp": time.Now().Add(-time.Hour).Unix()},
+		"no expiry":        {"sub": "u1", "email": "a@example.com", "exp": nil},
+		"other audience":   {"sub": "u1", "email": "a@example.com", "aud": "other"},
+		"other issuer":     {"sub": "u1", "email": "a@example.com", "iss": "https://evil.example.com"},
+		"no email":         {"sub": "u1"},
+		"unverified email": {"sub": "u1", "email": "a@example.com", "email_verified": false},
+	}
+	for name, claims := range rejected {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Verify(ctx, issuer.Sign(claims))
+			require.ErrorIs(t, err, oidc.ErrInvalidToken)
+		})
+	}
+
+	t.Run("symmetric algorithm", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": issuer.URL, "aud": oidctest.ClientID, "sub": "u1", "email": "a@example.com",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, token)
+		require.ErrorIs(t, err, oidc.ErrInvalidToken)
+	})
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	issuer := oidctest.NewIssuer()
+	defer issuer.Close()
+	ctx := context.Background()
+	claims := jwt.MapClaims{"sub": "u1", "email": "a@example.com"}
+	opts := oidc.VerifierOptions{Issuer: issuer.URL, Audience: oidctest.ClientID}
+
+	t.Run("cached", func(t *testing.T) {
+		keys := oidc.NewRemoteKeySet(issuer.URL+"/jwks", oidc.KeySetOptions{})
+		verifier := oidc.NewVerifier(keys, opts)
+		before := issuer.JWKSRequests()
+
+		for range 3 {
+			_, err := verifier.Verify(ctx, issuer.Sign(claims))
+			require.NoError(t, err)
+		}
+		require.Equal(t, before+1, issuer.JWKSRequests())
+	})
+
+	t.Run("unknown key refreshes", func(t *testing.T) {
+		keys := oidc.NewRemoteKeySet(issuer.URL+"/jwks", oidc.KeySetOptions{RefreshInterval: time.Nanosecond})
+		verifier := oidc.NewVerifier(keys, opts)
+
+		old := issuer.Sign(claims)
+		_, err := verifier.Verify(ctx, old)
+		require.NoError(t, err)
+
+		issuer.Rotate()
+		_, err = verifier.Verify(ctx, issuer.Sign(claims))
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(ctx, old)
+		require.ErrorIs(t, err, oidc.ErrUnknownKey)
+	})
+
+	t.Run("refresh is rate limited", func(t *testing.T) {
+		keys := oidc.NewRemoteKeySet(issuer.URL+"/jwks", oidc.KeySetOptions{RefreshInterval: time.Hour})
+		verifier := oidc.NewVerifier(keys, opts)
+
+		_, err := verifier.Verify(ctx, issuer.Sign(claims))
+		require.NoError(t, err)
+
+		issuer.Rotate()
+		_, err = verifier.Verify(ctx, issuer.Sign(claims))
+		require.ErrorIs(t, err, oidc.ErrUnknownKey)
+	})
+}
+
+func TestKeySet_ConcurrentReload(t *testing.T) {
+	issuer := oidctest.NewIssuer()
+	defer issuer.Close()
+
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	gate := make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		if n > 1 {
+			<-gate
+		}
+		w.Write(issuer.JWKS())
+	}))
+	defer jwks.Close()
+
+	refresh := 50 * time.Millisecond
+	keys := oidc.NewRemoteKeySet(jwks.URL, oidc.KeySetOptions{RefreshInterval: refresh})
+	verifier := oidc.NewVerifier(keys, oidc.VerifierOptions{Issuer: issuer.URL, Audience: oidctest.ClientID})
+	ctx := context.Background()
+	claims := jwt.MapClaims{"sub": "u1", "email": "a@example.com"}
+
+	known := issuer.Sign(claims)
+	_, err := verifier.Verify(ctx, known)
+	require.NoError(t, err)
+	time.Sleep(refresh)
+
+	// Tokens of an unknown key start a reload that hangs at the issuer.
+	errs := make(chan error, 5)
+	var wg sync.WaitGroup
+	for range cap(errs) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.Key(ctx, "rotated")
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests == 2
+	}, time.Second, time.Millisecond)
+
+	// Known keys are still served meanwhile.
+	_, err = verifier.Verify(ctx, known)
+	require.NoError(t, err)
+
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.ErrorIs(t, err, oidc.ErrUnknownKey)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 2, requests)
+}
+
+func TestKeySet_File(t *testing.T) {
+	issuer := oidctest.NewIssuer()
+	defer issuer.Close()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, issuer.JWKS(), 0o600))
+
+	keys := oidc.NewFileKeySet(path, oidc.KeySetOptions{RefreshInterval: time.Nanosecond})
+	verifier := oidc.NewVerifier(keys, oidc.VerifierOptions{Issuer: issuer.URL, Audience: oidctest.ClientID})
+	claims := jwt.MapClaims{"sub": "u1", "email": "a@example.com"}
+
+	_, err := verifier.Verify(context.Background(), issuer.Sign(claims))
+	require.NoError(t, err)
+
+	issuer.Rotate()
+	require.NoError(t, os.WriteFile(path, issuer.JWKS(), 0o600))
+	_, err = verifier.Verify(context.Background(), issuer.Sign(claims))
+	require.NoError(t, err)
+}
+
+func TestProvider_SignIn(t *testing.T) {
+	issuer := oidctest.NewIssuer()
+	defer issuer.Close()
+	ctx := context.Background()
+	verifier := "verifier-verifier-verifier-verifier-verifier"
+
+	p, err := oidc.Discover(ctx, oidc.ProviderOptions{
+		Issuer:       issuer.URL,
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	// signIn follows the issuer's sign-in page back to the callback and
+	// returns the code it carries.
+	signIn := func(t *testing.T, nonce string) string {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(p.AuthCodeURL("state", nonce, verifier))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, "state", callback.Query().Get("state"))
+
+		return callback.Query().Get("code")
+	}
+	issuer.SignInAs(jwt.MapClaims{"sub": "u1", "email": "a@example.com", "roles": []string{"admin"}})
+
+	t.Run("success", func(t *testing.T) {
+		c, err := p.Exchange(ctx, signIn(t, "nonce"), verifier, "nonce")
+		require.NoError(t, err)
+		require.Equal(t, "a@example.com", c.Email)
+		require.Equal(t, []string{"admin"}, c.Roles)
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		_, err := p.Exchange(ctx, signIn(t, "other"), verifier, "nonce")
+		require.ErrorIs(t, err, oidc.ErrNonceMismatch)
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, err := p.Exchange(ctx, signIn(t, "nonce"), "another-verifier-another-verifier-another", "nonce")
+		require.Error(t, err)
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		c, err := p.Verify(ctx, issuer.Sign(jwt.MapClaims{"sub": "u1", "email": "a@example.com"}))
+		require.NoError(t, err)
+		require.Equal(t, "u1", c.Subject)
+	})
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	issuer := oidctest.NewIssuer()
+	defer issuer.Close()
+
+	_, err := oidc.Discover(context.Background(), oidc.ProviderOptions{Issuer: issuer.URL + "/"})
+	require.ErrorIs(t, err, oidc.ErrDiscovery)
+}
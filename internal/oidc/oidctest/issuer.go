@@ -0,0 +1,243 @@
+// Package oidctest provides an in-process OpenID Connect issuer for tests.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ClientID     = "shorty"
+	ClientSecret = "secret"
+)
+
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+type grant struct {
+	claims      jwt.MapClaims
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Issuer serves discovery, JWKS, authorization and token endpoints. Its
+// authorization endpoint signs in the identity set with SignInAs without
+// any user interaction.
+type Issuer struct {
+	URL string
+
+	server *httptest.Server
+
+	mu           sync.Mutex
+	keys         []signingKey
+	identity     jwt.MapClaims
+	grants       map[string]grant
+	jwksRequests int
+}
+
+func NewIssuer() *Issuer {
+	i := &Issuer{grants: make(map[string]grant)}
+	i.Rotate()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("GET /jwks", i.jwks)
+	mux.HandleFunc("GET /authorize", i.authorize)
+	mux.HandleFunc("POST /token", i.token)
+
+	i.server = httptest.NewServer(mux)
+	i.URL = i.server.URL
+
+	return i
+}
+
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// Rotate replaces the signing key with a new one. Tokens signed with the
+// old key no longer verify once the key set is refreshed.
+func (i *Issuer) Rotate() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys = []signingKey{{kid: rand.Text()[:12], key: key}}
+}
+
+// Sign returns a token with the claims signed by the current key. The
+// issuer, audience, issue and expiry time default to the issuer, ClientID,
+// now and an hour from now.
+func (i *Issuer) Sign(claims jwt.MapClaims) string {
+	i.mu.Lock()
+	k := i.keys[0]
+	i.mu.Unlock()
+
+	c := jwt.MapClaims{
+		"iss": i.URL,
+		"aud": ClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, v := range claims {
+		c[name] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		panic(err)
+	}
+
+	return signed
+}
+
+// SignInAs sets the claims of the ID tokens issued by the following
+// sign-ins.
+func (i *Issuer) SignInAs(claims jwt.MapClaims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.identity = claims
+}
+
+// JWKS returns the JSON Web Key Set of the current key.
+func (i *Issuer) JWKS() []byte {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	keys := make([]map[string]string, 0, len(i.keys))
+	for _, k := range i.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"kid": k.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+
+	b, _ := json.Marshal(map[string]any{"keys": keys})
+
+	return b
+}
+
+// JWKSRequests returns how often the key set was fetched.
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.jwksRequests
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	i.mu.Lock()
+	i.jwksRequests++
+	i.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(i.JWKS())
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+	i.mu.Lock()
+	i.grants[code] = grant{
+		claims:      i.identity,
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		redirectURI: redirect.String(),
+	}
+	i.mu.Unlock()
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", q.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != ClientID || secret != ClientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.grants[r.PostForm.Get("code")]
+	delete(i.grants, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{"nonce": g.nonce}
+	for name, v := range g.claims {
+		claims[name] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     i.Sign(claims),
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
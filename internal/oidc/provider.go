@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrDiscovery     = errors.New("failed to discover issuer")
+	ErrNonceMismatch = errors.New("nonce mismatch")
+)
+
+type ProviderOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes requested on sign-in, "openid email profile" by default.
+	Scopes []string
+	// Audience of bearer tokens, ClientID when empty.
+	Audience string
+	// JWKSURL and JWKSFile replace the jwks_uri of the discovery document.
+	JWKSURL  string
+	JWKSFile string
+	KeySet   KeySetOptions
+
+	RolesClaim     string
+	WorkspaceClaim string
+	Workspace      string
+	HTTPClient     *http.Client
+}
+
+// Provider is an OpenID Connect issuer. It verifies the bearer tokens of
+// API clients and signs browsers in with the authorization code flow and
+// PKCE.
+type Provider struct {
+	oauth    oauth2.Config
+	client   *http.Client
+	idTokens *Verifier
+	bearer   *Verifier
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover loads the discovery document of the issuer and returns its
+// provider.
+func Discover(ctx context.Context, opts ProviderOptions) (*Provider, error) {
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	opts.KeySet.HTTPClient = client
+
+	doc, err := fetchDiscovery(ctx, client, opts.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys *KeySet
+	switch {
+	case opts.JWKSFile != "":
+		keys = NewFileKeySet(opts.JWKSFile, opts.KeySet)
+	case opts.JWKSURL != "":
+		keys = NewRemoteKeySet(opts.JWKSURL, opts.KeySet)
+	case doc.JWKSURI != "":
+		keys = NewRemoteKeySet(doc.JWKSURI, opts.KeySet)
+	default:
+		return nil, fmt.Errorf("%w: no jwks_uri", ErrDiscovery)
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	audience := opts.Audience
+	if audience == "" {
+		audience = opts.ClientID
+	}
+	verifierOpts := VerifierOptions{
+		Issuer:         opts.Issuer,
+		Audience:       opts.ClientID,
+		RolesClaim:     opts.RolesClaim,
+		WorkspaceClaim: opts.WorkspaceClaim,
+		Workspace:      opts.Workspace,
+	}
+	bearerOpts := verifierOpts
+	bearerOpts.Audience = audience
+
+	return &Provider{
+		oauth: oauth2.Config{
+			ClientID:     opts.ClientID,
+			ClientSecret: opts.ClientSecret,
+			RedirectURL:  opts.RedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+		},
+		client:   client,
+		idTokens: NewVerifier(keys, verifierOpts),
+		bearer:   NewVerifier(keys, bearerOpts),
+	}, nil
+}
+
+func fetchDiscovery(ctx context.Context, client *http.Client, issuer string) (*discovery, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	url := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrDiscovery, resp.StatusCode)
+	}
+
+	var doc discovery
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("%w: document is for issuer %q", ErrDiscovery, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+
+	return &doc, nil
+}
+
+// AuthCodeURL returns the URL of the issuer's sign-in page. The state,
+// nonce and PKCE verifier have to be kept by the client until the callback.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+// Exchange redeems the code of a sign-in callback and returns the claims
+// of the ID token issued for it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrInvalidToken)
+	}
+
+	claims, err := p.idTokens.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	return claims, nil
+}
+
+// Verify verifies a bearer token of an API client.
+func (p *Provider) Verify(ctx context.Context, raw string) (*Claims, error) {
+	return p.bearer.Verify(ctx, raw)
+}
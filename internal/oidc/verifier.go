@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DefaultRolesClaim = "roles"
+	DefaultWorkspace  = "default"
+	DefaultLeeway     = time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// signingMethods are the algorithms tokens may be signed with. Symmetric
+// algorithms and "none" are never accepted.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Claims is the identity a token asserts, mapped to the users and roles of
+// the shortener.
+type Claims struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+	Roles   []string
+	// Workspace is the name of the user's workspace.
+	Workspace string
+	Nonce     string
+	Expiry    time.Time
+}
+
+type VerifierOptions struct {
+	Issuer   string
+	Audience string
+	// RolesClaim and WorkspaceClaim name the claims holding the user's
+	// roles and workspace. Nested claims are given as dotted paths, e.g.
+	// "realm_access.roles".
+	RolesClaim     string
+	WorkspaceClaim string
+	// Workspace is the workspace of users whose token has no
+	// WorkspaceClaim.
+	Workspace string
+	Leeway    time.Duration
+}
+
+type Verifier struct {
+	keys *KeySet
+	opts VerifierOptions
+}
+
+func NewVerifier(keys *KeySet, opts VerifierOptions) *Verifier {
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = DefaultRolesClaim
+	}
+	if opts.Workspace == "" {
+		opts.Workspace = DefaultWorkspace
+	}
+	if opts.Leeway <= 0 {
+		opts.Leeway = DefaultLeeway
+	}
+
+	return &Verifier{keys: keys, opts: opts}
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a JWT and
+// returns its claims. Tokens without an email or with an unverified one are
+// rejected, since users are identified by email.
+func (v *Verifier) Verify(ctx context.Context, raw string) (*Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(v.opts.Issuer),
+		jwt.WithAudience(v.opts.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.opts.Leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	c := &Claims{
+		Issuer:    stringClaim(claims, "iss"),
+		Subject:   stringClaim(claims, "sub"),
+		Email:     strings.ToLower(stringClaim(claims, "email")),
+		Name:      stringClaim(claims, "name"),
+		Roles:     stringsClaim(claims, v.opts.RolesClaim),
+		Workspace: v.opts.Workspace,
+		Nonce:     stringClaim(claims, "nonce"),
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		c.Expiry = exp.Time
+	}
+	if v.opts.WorkspaceClaim != "" {
+		if w := stringClaim(claims, v.opts.WorkspaceClaim); w != "" {
+			c.Workspace = w
+		}
+	}
+
+	if c.Subject == "" || c.Email == "" {
+		return nil, fmt.Errorf("%w: sub and email are required", ErrInvalidToken)
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, fmt.Errorf("%w: email is not verified", ErrInvalidToken)
+	}
+
+	return c, nil
+}
+
+// claim returns the value at a dotted path of nested claims.
+func claim(claims map[string]any, path string) any {
+	var v any = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+
+	return v
+}
+
+func stringClaim(claims map[string]any, path string) string {
+	s, _ := claim(claims, path).(string)
+
+	return s
+}
+
+// stringsClaim returns a claim holding a list of strings or a single
+// space-separated string.
+func stringsClaim(claims map[string]any, path string) []string {
+	switch v := claim(claims, path).(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
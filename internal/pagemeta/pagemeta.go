@@ -0,0 +1,313 @@
+// Package pagemeta fetches a web page and extracts its title, OpenGraph
+// properties and favicon.
+package pagemeta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxBytes     = 1 << 20
+	DefaultMaxRedirects = 5
+
+	maxFieldLength = 1024
+	userAgent      = "shorty-reborn/1.0 (+link preview)"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("unsupported url scheme")
+	ErrNotHTML           = errors.New("response is not html")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrForbiddenAddress  = errors.New("destination address is not allowed")
+)
+
+// Page is the metadata extracted from a page. URLs are absolute.
+type Page struct {
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+	Favicon     string
+}
+
+type Options struct {
+	// Timeout bounds the whole fetch including redirects.
+	Timeout time.Duration
+	// MaxBytes is the most of the body that is read; the head of a page is
+	// expected well within it.
+	MaxBytes     int64
+	MaxRedirects int
+	// AllowPrivate permits loopback, private and link-local destinations.
+	// It is off by default so that links cannot be used to probe the
+	// internal network.
+	AllowPrivate bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:      DefaultTimeout,
+		MaxBytes:     DefaultMaxBytes,
+		MaxRedirects: DefaultMaxRedirects,
+	}
+}
+
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+func NewFetcher(opts Options) *Fetcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if opts.MaxRedirects < 0 {
+		opts.MaxRedirects = 0
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		// Checked on the resolved address of every connection, so DNS
+		// names and redirects cannot bypass it.
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > opts.MaxRedirects {
+					return ErrTooManyRedirects
+				}
+				return checkScheme(req.URL)
+			},
+		},
+		maxBytes: opts.MaxBytes,
+	}
+}
+
+// Fetch downloads rawURL and extracts its metadata. Only the first MaxBytes
+// of the body are parsed.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+	if err := checkScheme(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to fetch page: unexpected status %d", resp.StatusCode)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+			return nil, fmt.Errorf("%w: %s", ErrNotHTML, ct)
+		}
+	}
+
+	return parse(io.LimitReader(resp.Body, f.maxBytes), resp.Request.URL), nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	return nil
+}
+
+func isPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// parse walks the document up to the end of <head>. Relative URLs are
+// resolved against base, the final URL after redirects.
+func parse(r io.Reader, base *url.URL) *Page {
+	var (
+		page     Page
+		ogTitle  string
+		favicon  string
+		inTitle  bool
+		title    strings.Builder
+		tokenize = html.NewTokenizer(r)
+	)
+
+loop:
+	for {
+		tt := tokenize.Next()
+		switch tt {
+		case html.ErrorToken:
+			break loop
+		case html.TextToken:
+			if inTitle {
+				title.Write(tokenize.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenize.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				break loop
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenize.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = tt == html.StartTagToken && title.Len() == 0
+			case atom.Body:
+				break loop
+			case atom.Meta:
+				if !hasAttr {
+					continue
+				}
+				attrs := attributes(tokenize)
+				key := strings.ToLower(attrs["property"])
+				if key == "" {
+					key = strings.ToLower(attrs["name"])
+				}
+				content := attrs["content"]
+				switch key {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					page.Description = content
+				case "description":
+					if page.Description == "" {
+						page.Description = content
+					}
+				case "og:image", "og:image:url":
+					if page.Image == "" {
+						page.Image = resolve(base, content)
+					}
+				case "og:site_name":
+					page.SiteName = content
+				}
+			case atom.Link:
+				if !hasAttr {
+					continue
+				}
+				attrs := attributes(tokenize)
+				if favicon == "" && isIconRel(attrs["rel"]) {
+					favicon = resolve(base, attrs["href"])
+				}
+			}
+		}
+	}
+
+	page.Title = title.String()
+	if strings.TrimSpace(page.Title) == "" {
+		page.Title = ogTitle
+	}
+	if favicon == "" {
+		favicon = base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	}
+	page.Favicon = favicon
+
+	page.Title = clean(page.Title)
+	page.Description = clean(page.Description)
+	page.SiteName = clean(page.SiteName)
+
+	return &page
+}
+
+func attributes(z *html.Tokenizer) map[string]string {
+	attrs := make(map[string]string)
+	for {
+		key, val, more := z.TagAttr()
+		attrs[strings.ToLower(string(key))] = string(val)
+		if !more {
+			return attrs
+		}
+	}
+}
+
+func isIconRel(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "icon" || r == "apple-touch-icon" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || ref == "" {
+		return ""
+	}
+	u = base.ResolveReference(u)
+	if checkScheme(u) != nil || len(u.String()) > maxFieldLength {
+		return ""
+	}
+
+	return u.String()
+}
+
+// clean collapses whitespace and bounds the length of extracted text.
+func clean(s string) string {
+	return truncate(strings.Join(strings.Fields(s), " "))
+}
+
+func truncate(s string) string {
+	if len(s) <= maxFieldLength {
+		return s
+	}
+
+	// Drop a multi-byte character cut in half.
+	return strings.ToValidUTF8(s[:maxFieldLength], "")
+}
@@ -0,0 +1,141 @@
+package pagemeta_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/pagemeta"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>
+  Spring   sale &amp; more
+</title>
+<meta name="description" content="Plain description">
+<meta property="og:title" content="OG title">
+<meta property="og:description" content="OG description">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+<link rel="shortcut icon" href="static/favicon.png">
+</head>
+<body><title>not this one</title></body>
+</html>`
+
+func testOptions() pagemeta.Options {
+	opts := pagemeta.DefaultOptions()
+	opts.AllowPrivate = true
+	return opts
+}
+
+func TestFetch(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/landing/page", http.StatusFound)
+	})
+	mux.HandleFunc("/landing/page", func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.UserAgent(), "shorty")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	got, err := pagemeta.NewFetcher(testOptions()).Fetch(context.Background(), srv.URL+"/start")
+	require.NoError(t, err)
+	require.Equal(t, &pagemeta.Page{
+		Title:       "Spring sale & more",
+		Description: "OG description",
+		Image:       srv.URL + "/img/cover.png",
+		SiteName:    "Example",
+		Favicon:     srv.URL + "/landing/static/favicon.png",
+	}, got)
+}
+
+func TestFetch_Fallbacks(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><meta property="og:title" content="Only OG"><meta name="description" content="Plain"></head></html>`)
+	}))
+	defer srv.Close()
+
+	got, err := pagemeta.NewFetcher(testOptions()).Fetch(context.Background(), srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, "Only OG", got.Title)
+	require.Equal(t, "Plain", got.Description)
+	require.Equal(t, srv.URL+"/favicon.ico", got.Favicon)
+}
+
+func TestFetch_Limits(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head>"+strings.Repeat("<!-- padding -->", 1<<12)+"<title>Too late</title></head></html>")
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	opts := testOptions()
+	opts.Timeout = 200 * time.Millisecond
+	opts.MaxBytes = 1 << 10
+	f := pagemeta.NewFetcher(opts)
+	ctx := context.Background()
+
+	_, err := f.Fetch(ctx, srv.URL+"/loop")
+	require.ErrorIs(t, err, pagemeta.ErrTooManyRedirects)
+
+	_, err = f.Fetch(ctx, srv.URL+"/slow")
+	require.Error(t, err)
+
+	got, err := f.Fetch(ctx, srv.URL+"/huge")
+	require.NoError(t, err)
+	require.Empty(t, got.Title)
+
+	_, err = f.Fetch(ctx, srv.URL+"/image")
+	require.ErrorIs(t, err, pagemeta.ErrNotHTML)
+
+	_, err = f.Fetch(ctx, srv.URL+"/missing")
+	require.Error(t, err)
+
+	_, err = f.Fetch(ctx, "ftp://example.com/file")
+	require.ErrorIs(t, err, pagemeta.ErrUnsupportedScheme)
+}
+
+func TestFetch_PrivateAddresses(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, page)
+	}))
+	defer srv.Close()
+
+	_, err := pagemeta.NewFetcher(pagemeta.DefaultOptions()).Fetch(context.Background(), srv.URL)
+	require.ErrorIs(t, err, pagemeta.ErrForbiddenAddress)
+}
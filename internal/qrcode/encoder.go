@@ -0,0 +1,519 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The encoder implements the byte mode of ISO/IEC 18004 for versions 1 to
+// 40, which is all short links need: aliases and hosts are mostly
+// lowercase, so the numeric and alphanumeric modes would rarely apply.
+
+var errTooLong = errors.New("content too long")
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// levelIndex returns the row of the level in the error correction tables.
+func (l Level) levelIndex() (int, error) {
+	switch l {
+	case Low:
+		return 0, nil
+	case Medium:
+		return 1, nil
+	case High:
+		return 2, nil
+	case Highest:
+		return 3, nil
+	default:
+		return 0, ErrInvalidLevel
+	}
+}
+
+// formatBits are the error correction bits of the format information,
+// indexed like the tables below.
+var formatBits = [4]int{1, 0, 3, 2}
+
+// eccPerBlock is the number of error correction codewords of each block,
+// and eccBlocks the number of blocks, per level and version.
+var eccPerBlock = [4][maxVersion + 1]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var eccBlocks = [4][maxVersion + 1]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// rawCodewords returns the number of codewords that fit into a symbol of
+// the version, i.e. its modules less the function patterns, in bytes.
+func rawCodewords(version int) int {
+	modules := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		modules -= (25*align-10)*align - 55
+		if version >= 7 {
+			modules -= 36
+		}
+	}
+
+	return modules / 8
+}
+
+func dataCodewords(version, level int) int {
+	return rawCodewords(version) - eccPerBlock[level][version]*eccBlocks[level][version]
+}
+
+// matrix encodes data in byte mode into the smallest symbol of the level
+// that fits it and returns its modules, dark ones true, without a quiet
+// zone.
+func matrix(data []byte, l Level) ([][]bool, error) {
+	level, err := l.levelIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	for version := minVersion; version <= maxVersion; version++ {
+		countBits := 8
+		if version > 9 {
+			countBits = 16
+		}
+		if len(data) >= 1<<countBits || 4+countBits+8*len(data) > 8*dataCodewords(version, level) {
+			continue
+		}
+
+		return newSymbol(version, level, data, countBits, -1).modules, nil
+	}
+
+	return nil, fmt.Errorf("%w: %d bytes", errTooLong, len(data))
+}
+
+type symbol struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// newSymbol lays out the symbol with the given mask, or with the one of
+// the lowest penalty when mask is negative.
+func newSymbol(version, level int, data []byte, countBits, mask int) *symbol {
+	size := 4*version + 17
+	s := &symbol{version: version, size: size, modules: grid(size), function: grid(size)}
+	s.drawFunctionPatterns()
+	s.drawCodewords(codewords(version, level, data, countBits))
+
+	if mask < 0 {
+		best := 0
+		for m := range 8 {
+			s.applyMask(m)
+			s.drawFormat(level, m)
+			if p := s.penalty(); m == 0 || p < best {
+				best, mask = p, m
+			}
+			s.applyMask(m)
+		}
+	}
+	s.applyMask(mask)
+	s.drawFormat(level, mask)
+
+	return s
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for y := range g {
+		g[y] = make([]bool, size)
+	}
+
+	return g
+}
+
+func (s *symbol) set(x, y int, dark bool) {
+	s.modules[y][x] = dark
+	s.function[y][x] = true
+}
+
+func (s *symbol) drawFunctionPatterns() {
+	for i := range s.size {
+		s.set(6, i, i%2 == 0)
+		s.set(i, 6, i%2 == 0)
+	}
+
+	s.drawFinder(3, 3)
+	s.drawFinder(s.size-4, 3)
+	s.drawFinder(3, s.size-4)
+
+	positions := alignmentPositions(s.version, s.size)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The corners with finder patterns have none.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			s.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format and version areas; drawFormat fills them in.
+	s.drawFormat(0, 0)
+	s.drawVersion()
+}
+
+// drawFinder draws a finder pattern with its separator around the centre.
+func (s *symbol) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= s.size || y < 0 || y >= s.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			s.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (s *symbol) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			s.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the coordinates of the rows and columns of
+// alignment patterns, which are spread evenly between column 6 and the
+// last but six.
+func alignmentPositions(version, size int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, size-7; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	return positions
+}
+
+// drawFormat writes both copies of the format information, the level and
+// mask protected by a BCH(15,5) code.
+func (s *symbol) drawFormat(level, mask int) {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		s.set(8, i, bit(i))
+	}
+	s.set(8, 7, bit(6))
+	s.set(8, 8, bit(7))
+	s.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		s.set(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		s.set(s.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		s.set(8, s.size-15+i, bit(i))
+	}
+	s.set(8, s.size-8, true)
+}
+
+// drawVersion writes both copies of the version information of versions 7
+// and up, protected by a BCH(18,6) code.
+func (s *symbol) drawVersion() {
+	if s.version < 7 {
+		return
+	}
+
+	rem := s.version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	bits := s.version<<12 | rem
+
+	for i := range 18 {
+		dark := bits>>i&1 != 0
+		a, b := s.size-11+i%3, i/3
+		s.set(a, b, dark)
+		s.set(b, a, dark)
+	}
+}
+
+// drawCodewords fills the modules outside the function patterns in the
+// zigzag order of the standard, in two-module columns from the bottom
+// right. Remainder modules stay light.
+func (s *symbol) drawCodewords(data []byte) {
+	i := 0
+	for right := s.size - 1; right >= 1; right -= 2 {
+		// The vertical timing pattern shifts the columns left of it.
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range s.size {
+			y := vert
+			if upward {
+				y = s.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if s.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				s.modules[y][x] = data[i>>3]>>(7-i&7)&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules the mask pattern selects. Applying
+// the same mask twice undoes it.
+func (s *symbol) applyMask(mask int) {
+	for y := range s.size {
+		for x := range s.size {
+			if s.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				s.modules[y][x] = !s.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol by the rules of the standard: long runs of one
+// colour, 2×2 blocks, finder-like patterns and an unbalanced share of dark
+// modules. Lower is better.
+func (s *symbol) penalty() int {
+	penalty := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return s.modules[x][y]
+		}
+		return s.modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := range s.size {
+			run := 1
+			for x := 1; x < s.size; x++ {
+				if at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				penalty += run - 2
+			}
+
+			for x := 0; x+7 <= s.size; x++ {
+				if !finderLike(func(i int) bool { return at(x+i, y, vertical) }) {
+					continue
+				}
+				lightBefore := x >= 4 && !at(x-1, y, vertical) && !at(x-2, y, vertical) && !at(x-3, y, vertical) && !at(x-4, y, vertical)
+				lightAfter := x+11 <= s.size && !at(x+7, y, vertical) && !at(x+8, y, vertical) && !at(x+9, y, vertical) && !at(x+10, y, vertical)
+				if lightBefore || lightAfter {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range s.size {
+		for x := range s.size {
+			if s.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := s.modules[y][x]
+				if c == s.modules[y][x-1] && c == s.modules[y-1][x] && c == s.modules[y-1][x-1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := s.size * s.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	penalty += k * 10
+
+	return penalty
+}
+
+// finderLike reports whether the seven modules read dark, light, dark ×3,
+// light, dark.
+func finderLike(at func(i int) bool) bool {
+	return at(0) && !at(1) && at(2) && at(3) && at(4) && !at(5) && at(6)
+}
+
+// codewords returns the data and error correction codewords in the order
+// they are placed: the data segment, terminated and padded, is split into
+// blocks, and the blocks are interleaved codeword by codeword.
+func codewords(version, level int, data []byte, countBits int) []byte {
+	capacity := dataCodewords(version, level)
+
+	var w bitWriter
+	w.write(0b0100, 4)
+	w.write(len(data), countBits)
+	for _, b := range data {
+		w.write(int(b), 8)
+	}
+	w.write(0, min(4, capacity*8-w.n))
+	w.write(0, (8-w.n%8)%8)
+	for pad := 0; len(w.buf) < capacity; pad++ {
+		w.write([]int{0xec, 0x11}[pad%2], 8)
+	}
+
+	blocks := eccBlocks[level][version]
+	ecc := eccPerBlock[level][version]
+	raw := rawCodewords(version)
+	short := blocks - raw%blocks
+	shortLen := raw/blocks - ecc
+	generator := rsGenerator(ecc)
+
+	dataBlocks := make([][]byte, blocks)
+	eccData := make([][]byte, blocks)
+	for i, off := 0, 0; i < blocks; i++ {
+		n := shortLen
+		if i >= short {
+			n++
+		}
+		dataBlocks[i] = w.buf[off : off+n]
+		eccData[i] = rsRemainder(dataBlocks[i], generator)
+		off += n
+	}
+
+	out := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for _, b := range dataBlocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := range ecc {
+		for _, b := range eccData {
+			out = append(out, b[i])
+		}
+	}
+
+	return out
+}
+
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) write(v, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>i&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+// rsGenerator returns the coefficients, highest degree first and without
+// the leading 1, of the Reed-Solomon generator polynomial of the degree.
+func rsGenerator(degree int) []byte {
+	g := make([]byte, degree)
+	g[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		// Multiply by (x - root).
+		for j := range g {
+			g[j] = gfMul(g[j], root)
+			if j+1 < len(g) {
+				g[j] ^= g[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+
+	return g
+}
+
+// rsRemainder returns the error correction codewords of the data, the
+// remainder of its division by the generator.
+func rsRemainder(data, generator []byte) []byte {
+	rem := make([]byte, len(generator))
+	for _, b := range data {
+		factor := b ^ rem[0]
+		copy(rem, rem[1:])
+		rem[len(rem)-1] = 0
+		for i, c := range generator {
+			rem[i] ^= gfMul(c, factor)
+		}
+	}
+
+	return rem
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(a, b byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(b>>i&1) * int(a)
+	}
+
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,285 @@
+package qrcode
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Format string
+
+const (
+	PNG Format = "png"
+	SVG Format = "svg"
+)
+
+type Level string
+
+const (
+	Low     Level = "L"
+	Medium  Level = "M"
+	High    Level = "Q"
+	Highest Level = "H"
+)
+
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid format")
+	ErrInvalidSize   = errors.New("invalid size")
+	ErrInvalidMargin = errors.New("invalid margin")
+	ErrInvalidLevel  = errors.New("invalid error correction level")
+	ErrInvalidColor  = errors.New("invalid color")
+)
+
+type Options struct {
+	Format     Format
+	Size       int
+	Margin     int
+	Level      Level
+	Foreground color.RGBA
+	Background color.RGBA
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Format:     PNG,
+		Size:       256,
+		Margin:     4,
+		Level:      Medium,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+func (o Options) Validate() error {
+	switch o.Format {
+	case PNG, SVG:
+	default:
+		return ErrInvalidFormat
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("%w: must be between %d and %d", ErrInvalidSize, MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("%w: must be between 0 and %d", ErrInvalidMargin, MaxMargin)
+	}
+	if _, err := o.Level.levelIndex(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o Options) ContentType() string {
+	if o.Format == SVG {
+		return "image/svg+xml"
+	}
+
+	return "image/png"
+}
+
+func ParseLevel(s string) (Level, error) {
+	l := Level(strings.ToUpper(s))
+	if _, err := l.levelIndex(); err != nil {
+		return "", err
+	}
+
+	return l, nil
+}
+
+// ParseColor accepts "rgb", "rrggbb" or "rrggbbaa" hex notation with an
+// optional leading "#".
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return color.RGBA{}, ErrInvalidColor
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidColor
+	}
+
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func Encode(content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	modules, err := matrix([]byte(content), opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr code: %w", err)
+	}
+
+	if opts.Format == SVG {
+		return renderSVG(modules, opts), nil
+	}
+
+	return renderPNG(modules, opts)
+}
+
+func renderPNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	scale := opts.Size / modules
+	if scale < 1 {
+		return nil, fmt.Errorf("%w: must be at least %d for this content", ErrInvalidSize, modules)
+	}
+	// Modules are a whole number of pixels so that they stay crisp; the
+	// code is centred and the remainder of the size added to the margin.
+	offset := (opts.Size-modules*scale)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				start := img.PixOffset(offset+x*scale, offset+y*scale+dy)
+				for dx := 0; dx < scale; dx++ {
+					img.Pix[start+dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, opts Options) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"%s/>`, hexColor(opts.Background), opacity(opts.Background))
+	fmt.Fprintf(&buf, `<path fill="%s"%s d="`, hexColor(opts.Foreground), opacity(opts.Foreground))
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// Merge horizontal runs of dark modules into a single rectangle.
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+opts.Margin, y+opts.Margin, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes()
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func opacity(c color.RGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+
+	return fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+}
+
+// ETag returns a strong entity tag for the image that Encode would produce
+// for the given content and options, without rendering it.
+func ETag(content string, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%s|%s|%d|%s|%d",
+		content, opts.Format, opts.Size, opts.Margin, opts.Level,
+		hexColor(opts.Foreground), opts.Foreground.A, hexColor(opts.Background), opts.Background.A)
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Cache is a concurrency-safe LRU cache of rendered images keyed by ETag.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+func NewCache(capacity int) *Cache {
+	return &Cache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Render returns the encoded image together with its ETag, reusing a
+// previously rendered image when one is cached.
+func (c *Cache) Render(content string, opts Options) ([]byte, string, error) {
+	etag := ETag(content, opts)
+
+	c.mu.Lock()
+	if el, ok := c.items[etag]; ok {
+		c.ll.MoveToFront(el)
+		data := el.Value.(*cacheEntry).data
+		c.mu.Unlock()
+		return data, etag, nil
+	}
+	c.mu.Unlock()
+
+	data, err := Encode(content, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[etag]; !ok && c.capacity > 0 {
+		c.items[etag] = c.ll.PushFront(&cacheEntry{key: etag, data: data})
+		for c.ll.Len() > c.capacity {
+			oldest := c.ll.Back()
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*cacheEntry).key)
+		}
+	}
+
+	return data, etag, nil
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
@@ -0,0 +1,157 @@
+package qrcode_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/finlleyl/shorty_reborn/internal/qrcode"
+)
+
+func TestEncodePNG(t *testing.T) {
+	opts := qrcode.DefaultOptions()
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	for _, size := range []int{64, 100, 256, 257, 1000} {
+		opts.Size = size
+		data, err := qrcode.Encode("http://localhost:8080/api/urls/abc123", opts)
+		require.NoError(t, err)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		bounds := img.Bounds()
+		require.Equal(t, size, bounds.Dx())
+		require.Equal(t, size, bounds.Dy())
+
+		// The margin is rendered in the background colour, the finder
+		// pattern in the top-left corner in the foreground colour. The
+		// code is centred.
+		r, g, b, _ := img.At(0, 0).RGBA()
+		require.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, b})
+		offset := 0
+		for ; offset < bounds.Dx(); offset++ {
+			if r, _, _, _ := img.At(offset, offset).RGBA(); r != 0xffff {
+				break
+			}
+		}
+		r, g, b, _ = img.At(offset, offset).RGBA()
+		require.Equal(t, []uint32{0x1111, 0x2222, 0x3333}, []uint32{r, g, b})
+		right := size - 1
+		for ; right > offset; right-- {
+			if r, _, _, _ := img.At(right, offset).RGBA(); r != 0xffff {
+				break
+			}
+		}
+		require.InDelta(t, offset, size-1-right, 1)
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	opts := qrcode.DefaultOptions()
+	opts.Format = qrcode.SVG
+
+	// 37 bytes need version 3 at level M, 29 modules plus the margin.
+	data, err := qrcode.Encode("http://localhost:8080/api/urls/abc123", opts)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `viewBox="0 0 37 37"`)
+
+	// Version 40 at level H holds at most 1273 bytes.
+	opts.Level = qrcode.Highest
+	data, err = qrcode.Encode(strings.Repeat("a", 1273), opts)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `viewBox="0 0 185 185"`)
+
+	_, err = qrcode.Encode(strings.Repeat("a", 1274), opts)
+	require.Error(t, err)
+
+	// A PNG needs at least a pixel per module.
+	opts.Format = qrcode.PNG
+	opts.Size = 128
+	_, err = qrcode.Encode(strings.Repeat("a", 1273), opts)
+	require.ErrorIs(t, err, qrcode.ErrInvalidSize)
+}
+
+func TestEncodeSVG(t *testing.T) {
+	opts := qrcode.DefaultOptions()
+	opts.Format = qrcode.SVG
+	opts.Background = color.RGBA{R: 0xff, A: 0x80}
+
+	data, err := qrcode.Encode("http://localhost:8080/api/urls/abc123", opts)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("<svg")))
+	require.Contains(t, string(data), `width="256"`)
+	require.Contains(t, string(data), `fill="#ff0000" fill-opacity="0.502"`)
+	require.Contains(t, string(data), `<path fill="#000000" d="M4 4h7v1h-7z`)
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]func(o *qrcode.Options){
+		"format":     func(o *qrcode.Options) { o.Format = "gif" },
+		"small size": func(o *qrcode.Options) { o.Size = 10 },
+		"big size":   func(o *qrcode.Options) { o.Size = 100000 },
+		"margin":     func(o *qrcode.Options) { o.Margin = -1 },
+		"level":      func(o *qrcode.Options) { o.Level = "X" },
+	}
+
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			opts := qrcode.DefaultOptions()
+			mutate(&opts)
+			_, err := qrcode.Encode("content", opts)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := qrcode.ParseColor("#0af")
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{R: 0x00, G: 0xaa, B: 0xff, A: 0xff}, c)
+
+	c, err = qrcode.ParseColor("11223344")
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x44}, c)
+
+	_, err = qrcode.ParseColor("zzzzzz")
+	require.ErrorIs(t, err, qrcode.ErrInvalidColor)
+
+	_, err = qrcode.ParseColor("12345")
+	require.ErrorIs(t, err, qrcode.ErrInvalidColor)
+}
+
+func TestETag(t *testing.T) {
+	opts := qrcode.DefaultOptions()
+	etag := qrcode.ETag("a", opts)
+	require.Equal(t, etag, qrcode.ETag("a", opts))
+	require.NotEqual(t, etag, qrcode.ETag("b", opts))
+
+	opts.Margin = 2
+	require.NotEqual(t, etag, qrcode.ETag("a", opts))
+}
+
+func TestCache(t *testing.T) {
+	cache := qrcode.NewCache(2)
+	opts := qrcode.DefaultOptions()
+
+	first, etag, err := cache.Render("a", opts)
+	require.NoError(t, err)
+	require.Equal(t, qrcode.ETag("a", opts), etag)
+
+	again, _, err := cache.Render("a", opts)
+	require.NoError(t, err)
+	require.Same(t, &first[0], &again[0])
+
+	_, _, err = cache.Render("b", opts)
+	require.NoError(t, err)
+	_, _, err = cache.Render("c", opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, cache.Len())
+
+	evicted, _, err := cache.Render("a", opts)
+	require.NoError(t, err)
+	require.NotSame(t, &first[0], &evicted[0])
+}
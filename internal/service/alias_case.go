@@ -0,0 +1,39 @@
+package service
+
+import "strings"
+
+// UnambiguousAlphabet is the alphabet of generated aliases in
+// case-insensitive mode: lowercase letters and digits without the
+// look-alikes 0/o, 1/l/i.
+const UnambiguousAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// WithCaseInsensitiveAliases makes aliases case-insensitive, so "Promo" and
+// "promo" are the same link. Aliases keep the case they were created with;
+// the repository has to be created with database.CaseInsensitiveAliases to
+// look them up regardless of case.
+func WithCaseInsensitiveAliases() Option {
+	return func(s *urlService) {
+		s.caseInsensitive = true
+	}
+}
+
+// canonicalAlias returns the form aliases are stored and looked up in: NFC
+// with Unicode aliases.
+func (s *urlService) canonicalAlias(alias string) string {
+	if s.maxGraphemes > 0 {
+		alias = normalizeUnicodeAlias(alias)
+	}
+
+	return alias
+}
+
+// aliasKey identifies an alias in in-memory state such as the password
+// attempt limits: lowercase in case-insensitive mode, so that spelling an
+// alias differently does not yield a fresh budget.
+func (s *urlService) aliasKey(alias string) string {
+	if s.caseInsensitive {
+		return strings.ToLower(alias)
+	}
+
+	return alias
+}
@@ -0,0 +1,69 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestCaseInsensitiveAliases(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithCaseInsensitiveAliases())
+
+	// The repository compares aliases regardless of case; the service
+	// keeps them as typed.
+	t.Run("create keeps the alias as typed", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "ProMo").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, "ProMo", u.Alias)
+				return u, nil
+			})
+
+		out, err := svc.Create(ctx, "https://ok.com", "ProMo")
+		require.NoError(t, err)
+		require.Equal(t, "ProMo", out.Alias)
+	})
+
+	t.Run("unlock attempts are counted regardless of case", func(t *testing.T) {
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		require.NoError(t, err)
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", gomock.Any()).
+			Return(&database.URL{ID: 2, Alias: "Vault", URL: "https://ok.com", PasswordHash: string(hash)}, nil).
+			Times(5)
+
+		for _, alias := range []string{"vault", "Vault", "VAULT", "vAULT", "VaulT"} {
+			_, err := svc.Unlock(ctx, alias, "wrong", service.Visitor{IP: "203.0.113.9"})
+			require.ErrorIs(t, err, service.ErrWrongPassword)
+		}
+		_, err = svc.Unlock(ctx, "vauLT", "secret", service.Visitor{IP: "203.0.113.9"})
+		require.ErrorIs(t, err, service.ErrTooManyAttempts)
+	})
+}
+
+func TestUnambiguousAlphabet(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, strings.ToLower(service.UnambiguousAlphabet), service.UnambiguousAlphabet)
+	for _, c := range []string{"0", "o", "1", "l", "i"} {
+		require.NotContains(t, service.UnambiguousAlphabet, c)
+	}
+
+	g, err := service.NewRandomAliasGenerator(service.UnambiguousAlphabet, 6)
+	require.NoError(t, err)
+	requireUnique(t, g, 1000, service.UnambiguousAlphabet)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// Alphabets for generated aliases.
+const (
+	// Base64URLAlphabet is the alphabet of random aliases by default.
+	Base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	// Base62Alphabet is the alphabet of sequential aliases by default.
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var (
+	ErrInvalidAlphabet = errors.New("invalid alias alphabet")
+	ErrMissingSalt     = errors.New("hashids aliases require a salt")
+)
+
+// AliasGenerator produces aliases for links created without one. Create
+// still checks generated aliases against the alias policy and existing
+// links, and asks for another one when they are rejected or taken.
+type AliasGenerator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// WithAliasGenerator replaces the default generator of random 6-character
+// aliases.
+func WithAliasGenerator(g AliasGenerator) Option {
+	return func(s *urlService) {
+		s.generator = g
+	}
+}
+
+// generateAlias returns a generated alias accepted by the alias policy
+// that is neither used in the domain nor held for a recently deleted link.
+func (s *urlService) generateAlias(ctx context.Context, domain string) (string, error) {
+	for range maxAliasAttempts {
+		alias, err := s.generator.Generate(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate alias: %w", err)
+		}
+		if s.aliases.Check(alias) != nil {
+			continue
+		}
+		err = s.checkAliasFree(ctx, domain, alias)
+		if errors.Is(err, ErrAliasExists) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return alias, nil
+	}
+
+	return "", fmt.Errorf("failed to generate alias: %d candidates rejected", maxAliasAttempts)
+}
+
+type randomAliasGenerator struct {
+	alphabet string
+	length   int
+}
+
+// NewRandomAliasGenerator returns a generator of aliases of the given
+// length with characters picked uniformly from alphabet by crypto/rand.
+func NewRandomAliasGenerator(alphabet string, length int) (AliasGenerator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if length < 3 || length > 10 {
+		return nil, fmt.Errorf("invalid alias length %d: must be between 3 and 10", length)
+	}
+
+	return &randomAliasGenerator{alphabet: alphabet, length: length}, nil
+}
+
+func (g *randomAliasGenerator) Generate(context.Context) (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	b := make([]byte, g.length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = g.alphabet[n.Int64()]
+	}
+
+	return string(b), nil
+}
+
+type sequenceAliasGenerator struct {
+	seq      database.AliasSequence
+	alphabet string
+}
+
+// NewSequenceAliasGenerator returns a generator that encodes the next value
+// of a database sequence in alphabet, base62 by default. Aliases are short
+// and never collide with each other, but they are predictable.
+func NewSequenceAliasGenerator(seq database.AliasSequence, alphabet string) (AliasGenerator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	return &sequenceAliasGenerator{seq: seq, alphabet: alphabet}, nil
+}
+
+func (g *sequenceAliasGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeNumber(uint64(n), g.alphabet), nil
+}
+
+type hashidsAliasGenerator struct {
+	seq      database.AliasSequence
+	alphabet string
+	salt     string
+}
+
+// NewHashidsAliasGenerator returns a generator that obfuscates the next
+// value of a database sequence the way Hashids does: the alphabet is
+// shuffled by the salt and, for every number, again by a lottery character
+// that leads the alias. Aliases stay unique without revealing the count of
+// links to those who do not know the salt.
+func NewHashidsAliasGenerator(seq database.AliasSequence, alphabet, salt string) (AliasGenerator, error) {
+	if err := checkAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	// Without a salt the alphabet is not shuffled and aliases can be
+	// decoded by anyone who knows it.
+	if salt == "" {
+		return nil, ErrMissingSalt
+	}
+
+	return &hashidsAliasGenerator{
+		seq:      seq,
+		alphabet: consistentShuffle(alphabet, salt),
+		salt:     salt,
+	}, nil
+}
+
+func (g *hashidsAliasGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return g.encode(uint64(n)), nil
+}
+
+func (g *hashidsAliasGenerator) encode(n uint64) string {
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	buffer := string(lottery) + g.salt + g.alphabet
+	alphabet := consistentShuffle(g.alphabet, buffer[:len(g.alphabet)])
+
+	return string(lottery) + encodeNumber(n, alphabet)
+}
+
+// encodeNumber writes n in the positional system whose digits are the
+// characters of alphabet.
+func encodeNumber(n uint64, alphabet string) string {
+	base := uint64(len(alphabet))
+	if n == 0 {
+		return alphabet[:1]
+	}
+
+	var b []byte
+	for ; n > 0; n /= base {
+		b = append(b, alphabet[n%base])
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return string(b)
+}
+
+// consistentShuffle permutes alphabet deterministically by salt, as in
+// Hashids.
+func consistentShuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	b := []byte(alphabet)
+	for i, v, p := len(b)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		c := int(salt[v])
+		p += c
+		j := (c + v + p) % i
+		b[i], b[j] = b[j], b[i]
+		v++
+	}
+
+	return string(b)
+}
+
+// checkAlphabet requires at least 16 distinct characters that are all
+// valid in aliases.
+func checkAlphabet(alphabet string) error {
+	if len(alphabet) < 16 {
+		return fmt.Errorf("%w: at least 16 characters required", ErrInvalidAlphabet)
+	}
+
+	seen := make(map[rune]bool, len(alphabet))
+	for _, r := range alphabet {
+		if !isAliasChar(r) {
+			return fmt.Errorf("%w: %q is not allowed in aliases", ErrInvalidAlphabet, r)
+		}
+		if seen[r] {
+			return fmt.Errorf("%w: duplicate %q", ErrInvalidAlphabet, r)
+		}
+		seen[r] = true
+	}
+
+	return nil
+}
+
+func isAliasChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+}
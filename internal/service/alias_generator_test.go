@@ -0,0 +1,193 @@
+package service_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+// counter returns a mock sequence handing out start, start+1, ...
+func counter(ctrl *gomock.Controller, start int64) database.AliasSequence {
+	seq := servicetest.NewMockAliasSequence(ctrl)
+	n := start - 1
+	seq.EXPECT().Next(gomock.Any()).DoAndReturn(func(context.Context) (int64, error) {
+		n++
+		return n, nil
+	}).AnyTimes()
+
+	return seq
+}
+
+func requireUnique(t *testing.T, g service.AliasGenerator, n int, alphabet string) {
+	t.Helper()
+
+	valid := regexp.MustCompile(`^[` + regexp.QuoteMeta(alphabet) + `]{3,10}$`)
+	seen := make(map[string]bool, n)
+	for range n {
+		alias, err := g.Generate(context.Background())
+		require.NoError(t, err)
+		require.Regexp(t, valid, alias)
+		require.False(t, seen[alias], "duplicate alias %q", alias)
+		seen[alias] = true
+	}
+}
+
+func TestRandomAliasGenerator(t *testing.T) {
+	t.Parallel()
+
+	g, err := service.NewRandomAliasGenerator(service.Base62Alphabet, 8)
+	require.NoError(t, err)
+	requireUnique(t, g, 10000, service.Base62Alphabet)
+
+	alias, err := g.Generate(context.Background())
+	require.NoError(t, err)
+	require.Len(t, alias, 8)
+
+	_, err = service.NewRandomAliasGenerator(service.Base62Alphabet, 2)
+	require.Error(t, err)
+}
+
+func TestSequenceAliasGenerator(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	g, err := service.NewSequenceAliasGenerator(counter(ctrl, 3844), service.Base62Alphabet)
+	require.NoError(t, err)
+
+	first, err := g.Generate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "100", first)
+	second, err := g.Generate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "101", second)
+
+	requireUnique(t, g, 10000, service.Base62Alphabet)
+}
+
+func TestHashidsAliasGenerator(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	g, err := service.NewHashidsAliasGenerator(counter(ctrl, 3844), service.Base62Alphabet, "pepper")
+	require.NoError(t, err)
+	requireUnique(t, g, 10000, service.Base62Alphabet)
+
+	// The same number encodes differently under another salt.
+	a, err := service.NewHashidsAliasGenerator(counter(ctrl, 5000), service.Base62Alphabet, "pepper")
+	require.NoError(t, err)
+	b, err := service.NewHashidsAliasGenerator(counter(ctrl, 5000), service.Base62Alphabet, "salt")
+	require.NoError(t, err)
+	x, err := a.Generate(context.Background())
+	require.NoError(t, err)
+	y, err := b.Generate(context.Background())
+	require.NoError(t, err)
+	require.NotEqual(t, x, y)
+
+	// Consecutive numbers do not produce consecutive aliases.
+	seq, err := service.NewSequenceAliasGenerator(counter(ctrl, 5000), service.Base62Alphabet)
+	require.NoError(t, err)
+	plain, err := seq.Generate(context.Background())
+	require.NoError(t, err)
+	require.NotEqual(t, plain, x)
+}
+
+func TestAliasGenerator_InvalidAlphabet(t *testing.T) {
+	t.Parallel()
+
+	for _, alphabet := range []string{"abc", "abcdefghijklmnop/", strings.Repeat("a", 20)} {
+		_, err := service.NewRandomAliasGenerator(alphabet, 6)
+		require.ErrorIs(t, err, service.ErrInvalidAlphabet, alphabet)
+	}
+}
+
+func TestCreate_AliasGenerator(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	g, err := service.NewSequenceAliasGenerator(counter(ctrl, 3844), service.Base62Alphabet)
+	require.NoError(t, err)
+	svc := service.NewURLService(repo,
+		service.WithAliasGenerator(g),
+		service.WithAliasPolicy(service.NewAliasPolicy([]string{"100"}, nil)),
+	)
+
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "101").Return(false, nil)
+	repo.EXPECT().
+		Save(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+			return u, nil
+		})
+
+	out, err := svc.Create(ctx, "https://ok.com", "")
+	require.NoError(t, err)
+	require.Equal(t, "101", out.Alias)
+}
+
+func TestCreate_GeneratedAliasCollisions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	newService := func(ctrl *gomock.Controller, repo database.URLRepository) service.URLService {
+		g, err := service.NewSequenceAliasGenerator(counter(ctrl, 3844), service.Base62Alphabet)
+		require.NoError(t, err)
+		return service.NewURLService(repo, service.WithAliasGenerator(g), service.WithDeleteGrace(time.Hour))
+	}
+
+	t.Run("taken aliases are skipped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := servicetest.NewMockURLRepository(ctrl)
+		svc := newService(ctrl, repo)
+
+		// 100 exists, 101 was deleted recently, 102 is taken in another
+		// workspace and 103 is free.
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "100").Return(true, nil)
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "101").Return(false, nil)
+		repo.EXPECT().DeletedSince(ctx, database.AnyWorkspace, "", "101", gomock.Any()).Return(true, nil)
+		for _, alias := range []string{"102", "103"} {
+			repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", alias).Return(false, nil)
+			repo.EXPECT().DeletedSince(ctx, database.AnyWorkspace, "", alias, gomock.Any()).Return(false, nil)
+		}
+		gomock.InOrder(
+			repo.EXPECT().Save(ctx, gomock.Any()).Return(nil, database.ErrAliasInUse),
+			repo.EXPECT().
+				Save(ctx, gomock.Any()).
+				DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+					return u, nil
+				}),
+		)
+
+		out, err := svc.Create(ctx, "https://ok.com", "")
+		require.NoError(t, err)
+		require.Equal(t, "103", out.Alias)
+	})
+
+	t.Run("attempts are bounded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := servicetest.NewMockURLRepository(ctrl)
+		svc := newService(ctrl, repo)
+
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).Return(true, nil).Times(10)
+
+		_, err := svc.Create(ctx, "https://ok.com", "")
+		require.Error(t, err)
+		require.NotErrorIs(t, err, service.ErrAliasExists)
+	})
+}
+
+func TestHashidsAliasGenerator_RequiresSalt(t *testing.T) {
+	t.Parallel()
+
+	_, err := service.NewHashidsAliasGenerator(counter(gomock.NewController(t), 3844), service.Base62Alphabet, "")
+	require.ErrorIs(t, err, service.ErrMissingSalt)
+}
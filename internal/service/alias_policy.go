@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrAliasNotAllowed = errors.New("alias not allowed")
+
+// maxAliasAttempts bounds how many generated aliases are tried before
+// giving up when the alias policy keeps rejecting them.
+const maxAliasAttempts = 10
+
+// AliasPolicy rejects reserved and blocked aliases. Reserved words match
+// the whole alias case-insensitively. Blocked words match whole words of
+// the alias, separated by "-", "_", "." or spaces, after leetspeak
+// normalization: "badword" catches "b4dw0rd", "bad_word" and "my-badword",
+// but not "badwords". Runs of words are joined, so that separators cannot
+// split a blocked word. A nil policy allows everything.
+type AliasPolicy struct {
+	reserved map[string]struct{}
+	blocked  map[string]struct{}
+}
+
+// WithAliasPolicy applies the policy to custom aliases and to generated
+// ones, which are regenerated until the policy accepts them.
+func WithAliasPolicy(p *AliasPolicy) Option {
+	return func(s *urlService) {
+		s.aliases = p
+	}
+}
+
+func NewAliasPolicy(reserved, blocked []string) *AliasPolicy {
+	p := &AliasPolicy{
+		reserved: make(map[string]struct{}, len(reserved)),
+		blocked:  make(map[string]struct{}, len(blocked)),
+	}
+	for _, w := range reserved {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			p.reserved[w] = struct{}{}
+		}
+	}
+	for _, w := range blocked {
+		for _, n := range normalizeLeet(strings.Join(aliasWords(w), "")) {
+			if n != "" {
+				p.blocked[n] = struct{}{}
+			}
+		}
+	}
+
+	return p
+}
+
+// LoadBlocklist reads blocked words from a file, one per line. Blank lines
+// and lines starting with # are ignored.
+func LoadBlocklist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blocklist: %w", err)
+	}
+	defer f.Close()
+
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+
+	return words, nil
+}
+
+// Check returns ErrAliasNotAllowed if the alias is reserved or contains a
+// blocked word. The blocked word itself is not disclosed.
+func (p *AliasPolicy) Check(alias string) error {
+	if p == nil {
+		return nil
+	}
+
+	if _, ok := p.reserved[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("%w: reserved", ErrAliasNotAllowed)
+	}
+	words := aliasWords(alias)
+	for i := range words {
+		for j := i + 1; j <= len(words); j++ {
+			for _, n := range normalizeLeet(strings.Join(words[i:j], "")) {
+				if _, ok := p.blocked[n]; ok {
+					return fmt.Errorf("%w: blocked word", ErrAliasNotAllowed)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// aliasWords splits s at the separators "-", "_", "." and spaces.
+func aliasWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ' '
+	})
+}
+
+var leetReplacer = strings.NewReplacer(
+	"0", "o",
+	"3", "e",
+	"4", "a",
+	"5", "s",
+	"6", "g",
+	"7", "t",
+	"8", "b",
+	"9", "g",
+	"@", "a",
+	"$", "s",
+)
+
+// normalizeLeet lowercases s and undoes common leetspeak substitutions.
+// "1" stands for both "i" and "l", so two spellings are returned.
+func normalizeLeet(s string) []string {
+	s = leetReplacer.Replace(strings.ToLower(s))
+	if !strings.Contains(s, "1") {
+		return []string{s}
+	}
+
+	return []string{strings.ReplaceAll(s, "1", "i"), strings.ReplaceAll(s, "1", "l")}
+}
@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestAliasPolicy_Check(t *testing.T) {
+	t.Parallel()
+
+	p := service.NewAliasPolicy([]string{"admin", "API"}, []string{"badword", "evil", "cock", "cunt", "ass"})
+
+	for _, alias := range []string{
+		"admin", "Admin", "api", "badword", "BadWord", "b4dw0rd", "bad_word", "bad-w0rd", "b.a.d.w.o.r.d",
+		"ev1l", "x-3v1l", "my-badword-promo", "promo.evil", "C0CK", "a$$",
+	} {
+		require.ErrorIs(t, p.Check(alias), service.ErrAliasNotAllowed, alias)
+	}
+	for _, alias := range []string{
+		"admins", "apis", "promo", "bad", "evi", "x3v1lx", "badwords",
+		"peacock", "scunthorpe", "assets", "class-pass", "cocktail_bar", "bad-promo-word",
+	} {
+		require.NoError(t, p.Check(alias), alias)
+	}
+
+	var nilPolicy *service.AliasPolicy
+	require.NoError(t, nilPolicy.Check("admin"))
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nbadword\n\n  evil  \n"), 0o600))
+
+	words, err := service.LoadBlocklist(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"badword", "evil"}, words)
+
+	_, err = service.LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
+
+func TestCreate_AliasPolicy(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithAliasPolicy(service.NewAliasPolicy([]string{"login"}, []string{"evil"})))
+
+	t.Run("reserved", func(t *testing.T) {
+		_, err := svc.Create(ctx, "https://ok.com", "LOGIN")
+		require.ErrorIs(t, err, service.ErrAliasNotAllowed)
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		_, err := svc.Create(ctx, "https://ok.com", "my-3vil")
+		require.ErrorIs(t, err, service.ErrAliasNotAllowed)
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).Return(false, nil)
+		repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 1, Alias: "abc123", URL: "https://ok.com"}, nil)
+
+		_, err := svc.Create(ctx, "https://ok.com", "")
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultMaxAliasGraphemes is the default length limit of Unicode aliases.
+const DefaultMaxAliasGraphemes = 16
+
+// maxUnicodeAliasBytes bounds the encoded size of Unicode aliases, which
+// can pack many code points into one grapheme.
+const maxUnicodeAliasBytes = 128
+
+// WithUnicodeAliases accepts custom aliases made of Unicode letters,
+// digits and emoji besides "-" and "_", such as "привет" or "🔥sale".
+// Aliases are normalized to NFC and limited to maxGraphemes user-perceived
+// characters. To prevent spoofing, an alias may not mix scripts (except
+// Han with kana or Hangul, optionally with Latin) and may not consist only
+// of Cyrillic or Greek letters that look like Latin ones, such as "рау".
+func WithUnicodeAliases(maxGraphemes int) Option {
+	return func(s *urlService) {
+		if maxGraphemes <= 0 {
+			maxGraphemes = DefaultMaxAliasGraphemes
+		}
+		s.maxGraphemes = maxGraphemes
+	}
+}
+
+// validateAlias checks a custom alias that has already been canonicalized.
+func (s *urlService) validateAlias(alias string) error {
+	if s.maxGraphemes == 0 {
+		if !isValidAlias(alias) {
+			return ErrInvalidAlias
+		}
+		return nil
+	}
+
+	if !utf8.ValidString(alias) {
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidAlias)
+	}
+	if n := graphemes(alias); n == 0 || n > s.maxGraphemes || len(alias) > maxUnicodeAliasBytes {
+		return fmt.Errorf("%w: must be 1 to %d characters long", ErrInvalidAlias, s.maxGraphemes)
+	}
+	for _, r := range alias {
+		if !isUnicodeAliasRune(r) {
+			return fmt.Errorf("%w: %q is not allowed", ErrInvalidAlias, r)
+		}
+	}
+	if mixesScripts(alias) {
+		return fmt.Errorf("%w: mixes scripts", ErrInvalidAlias)
+	}
+	if latinConfusable(alias) {
+		return fmt.Errorf("%w: confusable with a Latin alias", ErrInvalidAlias)
+	}
+
+	return nil
+}
+
+const zeroWidthJoiner = '\u200d'
+
+// isUnicodeAliasRune allows letters, combining marks, decimal digits, "-",
+// "_" and the code points emoji are made of. Punctuation, spaces, and
+// format characters other than those in emoji sequences, such as
+// bidirectional overrides, are rejected.
+func isUnicodeAliasRune(r rune) bool {
+	switch {
+	case r == '-' || r == '_':
+		return true
+	case unicode.In(r, unicode.L, unicode.M, unicode.Nd):
+		return true
+	case unicode.Is(unicode.So, r), isEmojiModifier(r), isEmojiTag(r), r == zeroWidthJoiner:
+		return true
+	}
+
+	return false
+}
+
+func isEmojiModifier(r rune) bool     { return r >= 0x1f3fb && r <= 0x1f3ff }
+func isEmojiTag(r rune) bool          { return r >= 0xe0020 && r <= 0xe007f }
+func isRegionalIndicator(r rune) bool { return r >= 0x1f1e6 && r <= 0x1f1ff }
+
+// graphemes approximates the number of user-perceived characters in s:
+// combining marks, emoji modifiers, variation selectors, tags and
+// characters joined by ZWJ extend the previous cluster, and regional
+// indicators pair up into flags.
+func graphemes(s string) int {
+	n := 0
+	afterZWJ, openFlag := false, false
+	for _, r := range s {
+		switch {
+		case n > 0 && (afterZWJ || r == zeroWidthJoiner || unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) || isEmojiModifier(r) || isEmojiTag(r)):
+		case openFlag && isRegionalIndicator(r):
+			openFlag = false
+		default:
+			n++
+			openFlag = isRegionalIndicator(r)
+		}
+		afterZWJ = r == zeroWidthJoiner
+	}
+
+	return n
+}
+
+// Script combinations allowed in one alias, after the "highly restrictive"
+// level of Unicode TS #39.
+var scriptSets = [][]*unicode.RangeTable{
+	{unicode.Latin, unicode.Han, unicode.Hiragana, unicode.Katakana},
+	{unicode.Latin, unicode.Han, unicode.Hangul},
+	{unicode.Latin, unicode.Han, unicode.Bopomofo},
+}
+
+// mixesScripts reports whether the letters of s belong to scripts that do
+// not occur together in one writing system, e.g. Latin and Cyrillic.
+func mixesScripts(s string) bool {
+	var scripts []*unicode.RangeTable
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		script := scriptOf(r)
+		if script == nil || containsTable(scripts, script) {
+			continue
+		}
+		scripts = append(scripts, script)
+	}
+	if len(scripts) <= 1 {
+		return false
+	}
+
+	for _, set := range scriptSets {
+		ok := true
+		for _, script := range scripts {
+			if !containsTable(set, script) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func scriptOf(r rune) *unicode.RangeTable {
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+		if unicode.Is(table, r) {
+			return table
+		}
+	}
+
+	return nil
+}
+
+func containsTable(tables []*unicode.RangeTable, t *unicode.RangeTable) bool {
+	for _, x := range tables {
+		if x == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// latinLookalikes maps Cyrillic and Greek letters to the Latin letters they
+// are commonly confused with.
+var latinLookalikes = map[rune]rune{
+	// Cyrillic.
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x',
+	'і': 'i', 'ј': 'j', 'ѕ': 's', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	// Greek.
+	'ο': 'o', 'ν': 'v', 'ρ': 'p', 'ι': 'i', 'κ': 'k', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// latinConfusable reports whether s has letters and all of them look like
+// Latin letters although none of them is one: such an alias can pass for
+// a different, Latin alias.
+func latinConfusable(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if _, ok := latinLookalikes[r]; !ok {
+			return false
+		}
+		letters++
+	}
+
+	return letters > 0
+}
+
+// normalizeUnicodeAlias returns s in NFC so that differently composed
+// spellings of an alias are the same alias. Invalid UTF-8 is returned
+// unchanged and rejected by validation.
+func normalizeUnicodeAlias(s string) string {
+	if !utf8.ValidString(s) {
+		return s
+	}
+
+	return norm.NFC.String(s)
+}
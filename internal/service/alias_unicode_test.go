@@ -0,0 +1,86 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestUnicodeAliases(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithUnicodeAliases(0))
+
+	accepted := []struct {
+		name, alias, stored string
+	}{
+		{name: "cyrillic", alias: "привет", stored: "привет"},
+		{name: "emoji", alias: "🔥sale", stored: "🔥sale"},
+		{name: "flag", alias: "🇯🇵", stored: "🇯🇵"},
+		{name: "japanese", alias: "東京タワー", stored: "東京タワー"},
+		{name: "nfd", alias: "cafe\u0301", stored: "café"},
+		{name: "zwj sequence", alias: strings.Repeat("👨\u200d👩\u200d👧", 4), stored: strings.Repeat("👨\u200d👩\u200d👧", 4)},
+	}
+	for _, tt := range accepted {
+		t.Run("accepts "+tt.name, func(t *testing.T) {
+			repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", tt.stored).Return(false, nil)
+			repo.EXPECT().
+				Save(ctx, gomock.Any()).
+				DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+					require.Equal(t, tt.stored, u.Alias)
+					return u, nil
+				})
+
+			out, err := svc.Create(ctx, "https://ok.com", tt.alias)
+			require.NoError(t, err)
+			require.Equal(t, tt.stored, out.Alias)
+		})
+	}
+
+	rejected := []struct {
+		name, alias string
+	}{
+		{name: "mixed scripts", alias: "p\u0430ypal"},
+		{name: "latin confusable", alias: "рау"},
+		{name: "bidi override", alias: "abc\u202edef"},
+		{name: "space", alias: "a b"},
+		{name: "slash", alias: "a/b"},
+		{name: "too long", alias: strings.Repeat("я", 17)},
+		{name: "too many bytes", alias: strings.Repeat("a"+strings.Repeat("\u0301", 8), 10)},
+		{name: "invalid utf-8", alias: "ab\xff"},
+	}
+	for _, tt := range rejected {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			_, err := svc.Create(ctx, "https://ok.com", tt.alias)
+			require.True(t, errors.Is(err, service.ErrInvalidAlias), "got %v", err)
+		})
+	}
+
+	t.Run("lookup normalizes", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "café").Return(&database.URL{ID: 1, Alias: "café", URL: "https://ok.com"}, nil)
+
+		out, err := svc.Get(ctx, "", "cafe\u0301")
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", out.OrigURL)
+	})
+}
+
+func TestUnicodeAliasesDisabled(t *testing.T) {
+	t.Parallel()
+
+	svc := service.NewURLService(servicetest.NewMockURLRepository(gomock.NewController(t)))
+
+	_, err := svc.Create(context.Background(), "https://ok.com", "привет")
+	require.ErrorIs(t, err, service.ErrInvalidAlias)
+}
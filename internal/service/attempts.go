@@ -0,0 +1,119 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	maxPasswordAttempts = 5
+	// maxLinkPasswordAttempts is how many failures a link takes across all
+	// clients, so that guessing from many addresses does not multiply the
+	// budget, before it is slowed down to one attempt per
+	// LinkAttemptInterval. It is larger than the per-client limit to leave
+	// room for visitors who mistype while someone else is guessing.
+	maxLinkPasswordAttempts = 20
+	PasswordAttemptWindow   = 15 * time.Minute
+	// LinkAttemptInterval is the least time between password attempts on a
+	// link that reached maxLinkPasswordAttempts. Visitors are slowed down,
+	// not locked out, so that guessing cannot deny everyone access.
+	LinkAttemptInterval = 10 * time.Second
+)
+
+// attemptLimiter counts attempts per key in a fixed window. Once a key
+// reaches the limit it is blocked until the window started by its first
+// attempt expires or, with an interval, allowed one attempt per interval.
+// Attempts are counted when they start, so that concurrent ones cannot all
+// slip through; callers give back the ones that succeeded.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	interval time.Duration
+	now      func() time.Time
+	attempts map[string]*attemptWindow
+	pruned   time.Time
+}
+
+type attemptWindow struct {
+	count   int
+	resetAt time.Time
+	// next is when the next attempt over the limit is allowed.
+	next time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		now:      time.Now,
+		attempts: make(map[string]*attemptWindow),
+	}
+}
+
+// newAttemptThrottle is an attemptLimiter that allows one attempt per
+// interval over the limit instead of blocking the key.
+func newAttemptThrottle(max int, window, interval time.Duration) *attemptLimiter {
+	l := newAttemptLimiter(max, window)
+	l.interval = interval
+
+	return l
+}
+
+// Take counts an attempt for the key and reports whether it is allowed.
+// Refused attempts are not counted.
+func (l *attemptLimiter) Take(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	w, ok := l.attempts[key]
+	if !ok || !now.Before(w.resetAt) {
+		l.prune(now)
+		w = &attemptWindow{resetAt: now.Add(l.window)}
+		l.attempts[key] = w
+	}
+	if w.count >= l.max && (l.interval == 0 || now.Before(w.next)) {
+		return false
+	}
+	w.count++
+	if l.interval > 0 && w.count >= l.max {
+		w.next = now.Add(l.interval)
+	}
+
+	return true
+}
+
+// Undo gives back an attempt taken for the key, e.g. one that succeeded
+// or was not a guess at all.
+func (l *attemptLimiter) Undo(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if w, ok := l.attempts[key]; ok && w.count > 0 {
+		w.count--
+	}
+}
+
+// Reset forgets all attempts of the key.
+func (l *attemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// prune drops expired windows so that the map does not grow without bound.
+// It runs at most once per window and must be called with l.mu held.
+func (l *attemptLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.window {
+		return
+	}
+	l.pruned = now
+
+	for key, w := range l.attempts {
+		if !now.Before(w.resetAt) {
+			delete(l.attempts, key)
+		}
+	}
+}
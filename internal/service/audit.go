@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// Audited actions.
+const (
+	AuditLinkCreate    = "link.create"
+	AuditLinkDelete    = "link.delete"
+	AuditLinkRestore   = "link.restore"
+	AuditDomainCreate  = "domain.create"
+	AuditDomainDelete  = "domain.delete"
+	AuditWebhookCreate = "webhook.create"
+	AuditWebhookDelete = "webhook.delete"
+)
+
+// AnonymousActor is recorded for requests without credentials.
+const AnonymousActor = "anonymous"
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+// Actor describes who performs a request. Transports put it into the
+// request context with ContextWithActor.
+type Actor struct {
+	ID        string
+	RequestID string
+	IP        string
+	// Workspace scopes the links the actor sees, DefaultWorkspace when
+	// unset.
+	Workspace int64
+	// User is the ID of the signed-in user, zero for API keys and
+	// anonymous requests.
+	User  int64
+	Roles []string
+	// Authenticated is set for actors who presented a valid API key,
+	// session or token.
+	Authenticated bool
+}
+
+type actorKey struct{}
+
+func ContextWithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// ActorFromContext returns the actor of the request, AnonymousActor when
+// none was set.
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	if a.ID == "" {
+		a.ID = AnonymousActor
+	}
+	if a.Workspace == 0 {
+		a.Workspace = DefaultWorkspace
+	}
+
+	return a
+}
+
+// ActorID returns the actor ID for an Authorization header value: "key:"
+// followed by the first 12 hex digits of the SHA-256 of the credential, or
+// AnonymousActor when there is none. The credential itself never reaches
+// the audit log.
+func ActorID(authorization string) string {
+	key := credential(authorization)
+	if key == "" {
+		return AnonymousActor
+	}
+
+	return "key:" + KeyHash(key)[:12]
+}
+
+// UserActorID returns the actor ID of a signed-in user.
+func UserActorID(id int64) string {
+	return "user:" + strconv.FormatInt(id, 10)
+}
+
+// credential returns the credential of an Authorization header value,
+// without the optional Bearer scheme.
+func credential(authorization string) string {
+	c := strings.TrimSpace(authorization)
+	if scheme, rest, _ := strings.Cut(c, " "); strings.EqualFold(scheme, "Bearer") {
+		c = strings.TrimSpace(rest)
+	}
+
+	return c
+}
+
+type AuditEntry struct {
+	ID        int64
+	Action    string
+	Domain    string
+	Alias     string
+	Actor     string
+	RequestID string
+	IP        string
+	// OldValue and NewValue are JSON snapshots, nil when the resource did
+	// not exist before or after the change.
+	OldValue  json.RawMessage
+	NewValue  json.RawMessage
+	CreatedAt time.Time
+}
+
+type AuditFilter = database.AuditFilter
+
+type AuditService interface {
+	// List returns entries of the context actor's workspace matching the
+	// filter, newest first. The filter's Workspace is ignored.
+	List(ctx context.Context, f AuditFilter) ([]*AuditEntry, error)
+}
+
+type auditService struct {
+	repo database.AuditRepository
+}
+
+func NewAuditService(r database.AuditRepository) AuditService {
+	return &auditService{repo: r}
+}
+
+func (s *auditService) List(ctx context.Context, f AuditFilter) ([]*AuditEntry, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultListLimit
+	}
+	if f.Limit > maxListLimit {
+		f.Limit = maxListLimit
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return nil, fmt.Errorf("list audit: %w: from must be before to", ErrInvalidAuditFilter)
+	}
+	f.Workspace = ActorFromContext(ctx).Workspace
+
+	entries, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("list audit: %w", err)
+	}
+
+	out := make([]*AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, &AuditEntry{
+			ID:        e.ID,
+			Action:    e.Action,
+			Domain:    e.Domain,
+			Alias:     e.Alias,
+			Actor:     e.Actor,
+			RequestID: e.RequestID,
+			IP:        e.IP,
+			OldValue:  e.OldValue,
+			NewValue:  e.NewValue,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+
+	return out, nil
+}
+
+// auditor appends entries for the audited service decorators. Entries are
+// written after the change succeeded; a failed write is logged and does
+// not fail the operation, which has already been applied.
+type auditor struct {
+	repo   database.AuditRepository
+	logger *zap.SugaredLogger
+}
+
+func (a auditor) record(ctx context.Context, action, domain, alias string, oldValue, newValue any) {
+	actor := ActorFromContext(ctx)
+	entry := &database.AuditEntry{
+		Workspace: actor.Workspace,
+		Action:    action,
+		Domain:    domain,
+		Alias:     alias,
+		Actor:     actor.ID,
+		RequestID: actor.RequestID,
+		IP:        actor.IP,
+	}
+
+	var err error
+	if entry.OldValue, err = snapshot(oldValue); err == nil {
+		entry.NewValue, err = snapshot(newValue)
+	}
+	if err == nil {
+		err = a.repo.Append(ctx, entry)
+	}
+	if err != nil {
+		a.logger.Errorw("failed to write audit entry", "action", action, "domain", domain, "alias", alias, "actor", actor.ID, "error", err)
+	}
+}
+
+func snapshot(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(v)
+}
+
+// linkValue is the audited snapshot of a link. The password hash is never
+// recorded.
+type linkValue struct {
+	Domain       string            `json:"domain,omitempty"`
+	Alias        string            `json:"alias"`
+	URL          string            `json:"url"`
+	Protected    bool              `json:"protected,omitempty"`
+	MaxClicks    *int64            `json:"max_clicks,omitempty"`
+	ClicksLeft   *int64            `json:"clicks_left,omitempty"`
+	Rules        []Rule            `json:"rules,omitempty"`
+	Variants     []Variant         `json:"variants,omitempty"`
+	QueryMode    string            `json:"query_mode,omitempty"`
+	UTM          UTM               `json:"utm,omitzero"`
+	Title        string            `json:"title,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	ForcePreview bool              `json:"force_preview,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+func toLinkValue(u *URL) *linkValue {
+	if u == nil {
+		return nil
+	}
+
+	return &linkValue{
+		Domain:       u.Domain,
+		Alias:        u.Alias,
+		URL:          u.OrigURL,
+		Protected:    u.Protected,
+		MaxClicks:    u.MaxClicks,
+		ClicksLeft:   u.ClicksLeft,
+		Rules:        u.Rules,
+		Variants:     u.Variants,
+		QueryMode:    u.QueryMode,
+		UTM:          u.UTM,
+		Title:        u.Title,
+		Description:  u.Description,
+		Tags:         u.Tags,
+		Metadata:     u.Metadata,
+		ForcePreview: u.ForcePreview,
+		CreatedAt:    u.CreatedAt,
+	}
+}
+
+type auditedURLService struct {
+	URLService
+	audit auditor
+}
+
+// NewAuditedURLService records link creations, deletions and restores made
+// through the wrapped service in the audit log.
+func NewAuditedURLService(inner URLService, repo database.AuditRepository, logger *zap.SugaredLogger) URLService {
+	return &auditedURLService{URLService: inner, audit: auditor{repo: repo, logger: logger}}
+}
+
+func (s *auditedURLService) Create(ctx context.Context, url, alias string, opts ...CreateOption) (*URL, error) {
+	u, err := s.URLService.Create(ctx, url, alias, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if u.Reused {
+		return u, nil
+	}
+
+	s.audit.record(ctx, AuditLinkCreate, u.Domain, u.Alias, nil, toLinkValue(u))
+
+	return u, nil
+}
+
+func (s *auditedURLService) Delete(ctx context.Context, domain, alias string) error {
+	// The snapshot is best-effort; Delete reports a missing link itself.
+	old, _ := s.URLService.Get(ctx, domain, alias)
+
+	if err := s.URLService.Delete(ctx, domain, alias); err != nil {
+		return err
+	}
+
+	if old != nil {
+		domain = old.Domain
+	}
+	s.audit.record(ctx, AuditLinkDelete, domain, alias, toLinkValue(old), nil)
+
+	return nil
+}
+
+func (s *auditedURLService) Restore(ctx context.Context, domain, alias string) (*URL, error) {
+	u, err := s.URLService.Restore(ctx, domain, alias)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.record(ctx, AuditLinkRestore, u.Domain, u.Alias, nil, toLinkValue(u))
+
+	return u, nil
+}
+
+type domainValue struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+}
+
+type auditedDomainService struct {
+	DomainService
+	audit auditor
+}
+
+// NewAuditedDomainService records domain registrations and removals in the
+// audit log.
+func NewAuditedDomainService(inner DomainService, repo database.AuditRepository, logger *zap.SugaredLogger) DomainService {
+	return &auditedDomainService{DomainService: inner, audit: auditor{repo: repo, logger: logger}}
+}
+
+func (s *auditedDomainService) Create(ctx context.Context, name string) (*Domain, error) {
+	d, err := s.DomainService.Create(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.record(ctx, AuditDomainCreate, d.Name, "", nil, domainValue{Name: d.Name, CreatedAt: d.CreatedAt})
+
+	return d, nil
+}
+
+func (s *auditedDomainService) Delete(ctx context.Context, name string) error {
+	if err := s.DomainService.Delete(ctx, name); err != nil {
+		return err
+	}
+
+	name = normalizeDomain(name)
+	s.audit.record(ctx, AuditDomainDelete, name, "", domainValue{Name: name}, nil)
+
+	return nil
+}
+
+type webhookValue struct {
+	ID     int64    `json:"id"`
+	URL    string   `json:"url,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+type auditedWebhookService struct {
+	WebhookService
+	audit auditor
+}
+
+// NewAuditedWebhookService records webhook subscriptions and removals in
+// the audit log. Secrets are never recorded.
+func NewAuditedWebhookService(inner WebhookService, repo database.AuditRepository, logger *zap.SugaredLogger) WebhookService {
+	return &auditedWebhookService{WebhookService: inner, audit: auditor{repo: repo, logger: logger}}
+}
+
+func (s *auditedWebhookService) Create(ctx context.Context, url string, events []string, secret string) (*Webhook, error) {
+	w, err := s.WebhookService.Create(ctx, url, events, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.record(ctx, AuditWebhookCreate, "", "", nil, webhookValue{ID: w.ID, URL: w.URL, Events: w.Events})
+
+	return w, nil
+}
+
+func (s *auditedWebhookService) Delete(ctx context.Context, id int64) error {
+	if err := s.WebhookService.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit.record(ctx, AuditWebhookDelete, "", "", webhookValue{ID: id}, nil)
+
+	return nil
+}
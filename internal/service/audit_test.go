@@ -0,0 +1,145 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestAuditedURLService(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := service.ContextWithActor(context.Background(), service.Actor{ID: "key:abc", RequestID: "req-1", IP: "203.0.113.7"})
+	repo := servicetest.NewMockURLRepository(ctrl)
+	audit := servicetest.NewMockAuditRepository(ctrl)
+	svc := service.NewAuditedURLService(service.NewURLService(repo), audit, zap.NewNop().Sugar())
+
+	t.Run("create", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+		repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com", PasswordHash: "hash"}, nil)
+		audit.EXPECT().
+			Append(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *database.AuditEntry) error {
+				require.Equal(t, service.AuditLinkCreate, e.Action)
+				require.Equal(t, "promo", e.Alias)
+				require.Equal(t, "key:abc", e.Actor)
+				require.Equal(t, "req-1", e.RequestID)
+				require.Equal(t, "203.0.113.7", e.IP)
+				require.Nil(t, e.OldValue)
+				require.JSONEq(t, `{"alias":"promo","url":"https://ok.com","protected":true,"created_at":"0001-01-01T00:00:00Z"}`, string(e.NewValue))
+				return nil
+			})
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo", service.WithPassword("secret"))
+		require.NoError(t, err)
+	})
+
+	t.Run("delete records old value", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "promo").Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+		repo.EXPECT().Delete(ctx, service.DefaultWorkspace, "", "promo").Return(nil)
+		audit.EXPECT().
+			Append(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, e *database.AuditEntry) error {
+				require.Equal(t, service.AuditLinkDelete, e.Action)
+				require.Contains(t, string(e.OldValue), `"url":"https://ok.com"`)
+				require.Nil(t, e.NewValue)
+				return nil
+			})
+
+		require.NoError(t, svc.Delete(ctx, "", "promo"))
+	})
+
+	t.Run("failed delete is not recorded", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "gone").Return(nil, database.ErrNotFound)
+		repo.EXPECT().Delete(ctx, service.DefaultWorkspace, "", "gone").Return(database.ErrNotFound)
+
+		require.ErrorIs(t, svc.Delete(ctx, "", "gone"), service.ErrURLNotFound)
+	})
+
+	t.Run("audit failure does not fail the change", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "promo").Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+		repo.EXPECT().Delete(ctx, service.DefaultWorkspace, "", "promo").Return(nil)
+		audit.EXPECT().Append(ctx, gomock.Any()).Return(database.ErrNotFound)
+
+		require.NoError(t, svc.Delete(ctx, "", "promo"))
+	})
+}
+
+func TestAuditedWebhookService_OmitsSecret(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockWebhookRepository(ctrl)
+	audit := servicetest.NewMockAuditRepository(ctrl)
+	svc := service.NewAuditedWebhookService(service.NewWebhookService(repo, false), audit, zap.NewNop().Sugar())
+
+	repo.EXPECT().Create(ctx, gomock.Any()).Return(&database.Webhook{ID: 3, URL: "https://crm.example.com", Secret: "0123456789abcdef"}, nil)
+	audit.EXPECT().
+		Append(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, e *database.AuditEntry) error {
+			require.Equal(t, service.AuditWebhookCreate, e.Action)
+			require.Equal(t, service.AnonymousActor, e.Actor)
+			require.JSONEq(t, `{"id":3,"url":"https://crm.example.com"}`, string(e.NewValue))
+			return nil
+		})
+
+	w, err := svc.Create(ctx, "https://crm.example.com", nil, "0123456789abcdef")
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef", w.Secret)
+}
+
+func TestAuditService_List(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockAuditRepository(ctrl)
+	svc := service.NewAuditService(repo)
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("defaults limit", func(t *testing.T) {
+		repo.EXPECT().
+			List(ctx, database.AuditFilter{Workspace: service.DefaultWorkspace, Alias: "promo", From: from, Limit: 20}).
+			Return([]*database.AuditEntry{{ID: 1, Action: service.AuditLinkDelete, Alias: "promo", OldValue: []byte(`{}`)}}, nil)
+
+		entries, err := svc.List(ctx, service.AuditFilter{Alias: "promo", From: from})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.JSONEq(t, `{}`, string(entries[0].OldValue))
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		_, err := svc.List(ctx, service.AuditFilter{From: from, To: from})
+		require.ErrorIs(t, err, service.ErrInvalidAuditFilter)
+	})
+
+	t.Run("scoped to the actor's workspace", func(t *testing.T) {
+		wctx := service.ContextWithActor(ctx, service.Actor{Workspace: 4})
+		repo.EXPECT().
+			List(wctx, database.AuditFilter{Workspace: 4, Limit: 20}).
+			Return(nil, nil)
+
+		_, err := svc.List(wctx, service.AuditFilter{Workspace: 1})
+		require.NoError(t, err)
+	})
+}
+
+func TestActorID(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, service.AnonymousActor, service.ActorID(""))
+	require.Equal(t, service.AnonymousActor, service.ActorID("Bearer "))
+	require.Equal(t, service.ActorID("token"), service.ActorID("Bearer token"))
+	require.Regexp(t, `^key:[0-9a-f]{12}$`, service.ActorID("Bearer token"))
+	require.NotEqual(t, service.ActorID("Bearer a"), service.ActorID("Bearer b"))
+}
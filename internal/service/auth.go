@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+const (
+	maxLoginAttempts = 5
+	maxKeyNameLength = 100
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrUnauthenticated    = errors.New("not signed in")
+	ErrInvalidAccount     = errors.New("invalid account")
+	ErrInvalidKeyName     = errors.New("invalid API key name")
+	ErrAPIKeyNotFound     = database.ErrAPIKeyNotFound
+)
+
+// Account is a user of the web dashboard. Accounts are provisioned from the
+// configuration with a bcrypt hash of the password, so that the password
+// itself is not stored there.
+type Account struct {
+	Email        string
+	PasswordHash string
+	// Workspace is the name of the workspace the user works in, "default"
+	// when empty.
+	Workspace string
+	Roles     []string
+}
+
+// User is a signed-in user.
+type User struct {
+	ID        int64
+	Email     string
+	Workspace int64
+	Roles     []string
+}
+
+// Identity is a user as asserted by the SSO provider. Workspace is the name
+// of the user's workspace.
+type Identity struct {
+	// Issuer and Subject name the user at the SSO provider. Identify
+	// caches users by them when both are set.
+	Issuer    string
+	Subject   string
+	Email     string
+	Roles     []string
+	Workspace string
+}
+
+// Session is a signed-in browser. Token is the value of the session cookie
+// and CSRFToken has to accompany every unsafe request made with it.
+type Session struct {
+	Token     string
+	CSRFToken string
+	ExpiresAt time.Time
+	User      User
+}
+
+// APIKey is a key a user created for scripts. Key is only set when the key
+// is created, since just its hash is stored.
+type APIKey struct {
+	ID        int64
+	Name      string
+	Key       string
+	CreatedAt time.Time
+}
+
+type AuthService interface {
+	// SyncUsers creates or updates the accounts by email.
+	SyncUsers(ctx context.Context, accounts []Account) error
+	// Login starts a session of the user with the email and password. Failed
+	// attempts are throttled per email, after which ErrTooManyAttempts is
+	// returned until the window expires.
+	Login(ctx context.Context, email, password string) (*Session, error)
+	// SignInSSO starts a session of the user with the identity, creating
+	// or updating the user.
+	SignInSSO(ctx context.Context, id Identity) (*Session, error)
+	// Identify returns the user with the identity of a bearer token,
+	// creating or updating the user.
+	Identify(ctx context.Context, id Identity) (*User, error)
+	Logout(ctx context.Context, token string) error
+	// Session returns the session of a cookie token, ErrUnauthenticated when
+	// it is unknown or expired.
+	Session(ctx context.Context, token string) (*Session, error)
+	// CreateAPIKey, ListAPIKeys and DeleteAPIKey manage the keys of the
+	// signed-in user of the context, ErrUnauthenticated when there is none.
+	// Created keys belong to the user's workspace.
+	CreateAPIKey(ctx context.Context, name string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+	DeleteAPIKey(ctx context.Context, id int64) error
+}
+
+type authService struct {
+	users      database.UserRepository
+	workspaces database.WorkspaceRepository
+	ttl        time.Duration
+	logins     *attemptLimiter
+	identities *identityCache
+	// dummyHash is compared against for unknown emails, so that they take
+	// as long to reject as wrong passwords.
+	dummyHash []byte
+}
+
+func NewAuthService(users database.UserRepository, workspaces database.WorkspaceRepository, sessionTTL time.Duration) AuthService {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+	return &authService{
+		users:      users,
+		workspaces: workspaces,
+		ttl:        sessionTTL,
+		logins:     newAttemptLimiter(maxLoginAttempts, PasswordAttemptWindow),
+		identities: newIdentityCache(identityCacheTTL),
+		dummyHash:  dummyHash,
+	}
+}
+
+func (s *authService) SyncUsers(ctx context.Context, accounts []Account) error {
+	for _, a := range accounts {
+		email, err := normalizeEmail(a.Email)
+		if err != nil {
+			return fmt.Errorf("sync users: %w", err)
+		}
+		if _, err := bcrypt.Cost([]byte(a.PasswordHash)); err != nil {
+			return fmt.Errorf("sync users: %w: %q: password must be given as bcrypt hash", ErrInvalidAccount, email)
+		}
+
+		roles, err := parseRoles(a.Roles)
+		if err != nil {
+			return fmt.Errorf("sync users: %w: %q: %w", ErrInvalidAccount, email, err)
+		}
+
+		workspace := strings.TrimSpace(a.Workspace)
+		if workspace == "" {
+			workspace = "default"
+		}
+
+		_, err = s.users.Upsert(ctx, &database.User{Email: email, PasswordHash: a.PasswordHash, Roles: roles}, workspace)
+		if err != nil {
+			return fmt.Errorf("sync user %q: %w", email, err)
+		}
+	}
+
+	return nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", fmt.Errorf("%w: %q is not an email address", ErrInvalidAccount, email)
+	}
+
+	return email, nil
+}
+
+func (s *authService) Login(ctx context.Context, email, password string) (*Session, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !s.logins.Take(email) {
+		return nil, fmt.Errorf("login: %w", ErrTooManyAttempts)
+	}
+
+	u, err := s.users.ByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, database.ErrUserNotFound) {
+			s.logins.Undo(email)
+			return nil, fmt.Errorf("login: %w", err)
+		}
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	s.logins.Reset(email)
+
+	sess, err := s.startSession(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	return sess, nil
+}
+
+func (s *authService) SignInSSO(ctx context.Context, id Identity) (*Session, error) {
+	u, err := s.upsertIdentity(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("sign in: %w", err)
+	}
+
+	sess, err := s.startSession(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("sign in: %w", err)
+	}
+
+	return sess, nil
+}
+
+// Identify runs on every request with a bearer token, so the user is only
+// written again when the token's email, roles or workspace changed or the
+// cached user is older than identityCacheTTL.
+func (s *authService) Identify(ctx context.Context, id Identity) (*User, error) {
+	if u, ok := s.identities.Get(id); ok {
+		return &u, nil
+	}
+
+	u, err := s.upsertIdentity(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("identify: %w", err)
+	}
+
+	user := toUser(u)
+	s.identities.Put(id, user)
+
+	return &user, nil
+}
+
+func (s *authService) upsertIdentity(ctx context.Context, id Identity) (*database.User, error) {
+	email, err := normalizeEmail(id.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.users.UpsertSSO(ctx, &database.User{Email: email, Roles: id.Roles}, id.Workspace)
+}
+
+func (s *authService) startSession(ctx context.Context, u *database.User) (*Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.ttl).UTC()
+	err = s.users.CreateSession(ctx, &database.Session{
+		TokenHash: KeyHash(token),
+		UserID:    u.ID,
+		CSRFToken: csrf,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Token:     token,
+		CSRFToken: csrf,
+		ExpiresAt: expiresAt,
+		User:      toUser(u),
+	}, nil
+}
+
+func (s *authService) Logout(ctx context.Context, token string) error {
+	if err := s.users.DeleteSession(ctx, KeyHash(token)); err != nil {
+		return fmt.Errorf("logout: %w", err)
+	}
+
+	return nil
+}
+
+func (s *authService) Session(ctx context.Context, token string) (*Session, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	sess, u, err := s.users.Session(ctx, KeyHash(token), time.Now())
+	if err != nil {
+		if errors.Is(err, database.ErrSessionNotFound) {
+			return nil, ErrUnauthenticated
+		}
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	return &Session{
+		Token:     token,
+		CSRFToken: sess.CSRFToken,
+		ExpiresAt: sess.ExpiresAt,
+		User:      toUser(u),
+	}, nil
+}
+
+func toUser(u *database.User) User {
+	return User{
+		ID:        u.ID,
+		Email:     u.Email,
+		Workspace: u.Workspace,
+		Roles:     u.Roles,
+	}
+}
+
+func (s *authService) CreateAPIKey(ctx context.Context, name string) (*APIKey, error) {
+	actor := ActorFromContext(ctx)
+	if actor.User == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	name = strings.TrimSpace(name)
+	if len(name) > maxKeyNameLength {
+		return nil, fmt.Errorf("%w: must be at most %d bytes", ErrInvalidKeyName, maxKeyNameLength)
+	}
+
+	key, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("create API key: %w", err)
+	}
+
+	k, err := s.workspaces.CreateKey(ctx, &database.APIKey{
+		Name:      name,
+		KeyHash:   KeyHash(key),
+		Workspace: actor.Workspace,
+		UserID:    &actor.User,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create API key: %w", err)
+	}
+
+	out := toAPIKey(k)
+	out.Key = key
+
+	return out, nil
+}
+
+func (s *authService) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	actor := ActorFromContext(ctx)
+	if actor.User == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	keys, err := s.workspaces.ListKeys(ctx, actor.User)
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %w", err)
+	}
+
+	out := make([]*APIKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, toAPIKey(k))
+	}
+
+	return out, nil
+}
+
+func (s *authService) DeleteAPIKey(ctx context.Context, id int64) error {
+	actor := ActorFromContext(ctx)
+	if actor.User == 0 {
+		return ErrUnauthenticated
+	}
+
+	if err := s.workspaces.DeleteKey(ctx, actor.User, id); err != nil {
+		if errors.Is(err, database.ErrAPIKeyNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return fmt.Errorf("delete API key: %w", err)
+	}
+
+	return nil
+}
+
+func toAPIKey(k *database.APIKey) *APIKey {
+	return &APIKey{
+		ID:        k.ID,
+		Name:      k.Name,
+		CreatedAt: k.CreatedAt,
+	}
+}
+
+// randomToken returns 32 random bytes encoded as unpadded base64url.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
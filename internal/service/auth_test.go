@@ -0,0 +1,250 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestLogin(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	users := servicetest.NewMockUserRepository(ctrl)
+	svc := service.NewAuthService(users, servicetest.NewMockWorkspaceRepository(ctrl), time.Hour)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &database.User{ID: 1, Email: "a@example.com", PasswordHash: string(hash), Workspace: 2}
+
+	t.Run("success", func(t *testing.T) {
+		users.EXPECT().ByEmail(ctx, "a@example.com").Return(user, nil)
+		users.EXPECT().
+			CreateSession(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, s *database.Session) error {
+				require.Equal(t, int64(1), s.UserID)
+				require.NotEmpty(t, s.CSRFToken)
+				require.WithinDuration(t, time.Now().Add(time.Hour), s.ExpiresAt, time.Minute)
+				return nil
+			})
+
+		s, err := svc.Login(ctx, " A@example.com ", "secret")
+		require.NoError(t, err)
+		require.NotEmpty(t, s.Token)
+		require.NotEqual(t, s.Token, s.CSRFToken)
+		require.Equal(t, service.User{ID: 1, Email: "a@example.com", Workspace: 2}, s.User)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		users.EXPECT().ByEmail(ctx, "b@example.com").Return(nil, database.ErrUserNotFound)
+
+		_, err := svc.Login(ctx, "b@example.com", "secret")
+		require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		users.EXPECT().ByEmail(ctx, "a@example.com").Return(user, nil).Times(5)
+
+		for range 5 {
+			_, err := svc.Login(ctx, "a@example.com", "wrong")
+			require.ErrorIs(t, err, service.ErrInvalidCredentials)
+		}
+		_, err := svc.Login(ctx, "a@example.com", "secret")
+		require.ErrorIs(t, err, service.ErrTooManyAttempts)
+	})
+}
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	users := servicetest.NewMockUserRepository(ctrl)
+	svc := service.NewAuthService(users, servicetest.NewMockWorkspaceRepository(ctrl), time.Hour)
+
+	t.Run("valid", func(t *testing.T) {
+		users.EXPECT().
+			Session(ctx, service.KeyHash("token"), gomock.Any()).
+			Return(&database.Session{UserID: 1, CSRFToken: "csrf"}, &database.User{ID: 1, Email: "a@example.com", Workspace: 2}, nil)
+
+		s, err := svc.Session(ctx, "token")
+		require.NoError(t, err)
+		require.Equal(t, "csrf", s.CSRFToken)
+		require.Equal(t, int64(2), s.User.Workspace)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		users.EXPECT().Session(ctx, service.KeyHash("old"), gomock.Any()).Return(nil, nil, database.ErrSessionNotFound)
+
+		_, err := svc.Session(ctx, "old")
+		require.ErrorIs(t, err, service.ErrUnauthenticated)
+	})
+
+	t.Run("no cookie", func(t *testing.T) {
+		_, err := svc.Session(ctx, "")
+		require.ErrorIs(t, err, service.ErrUnauthenticated)
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		users.EXPECT().DeleteSession(ctx, service.KeyHash("token")).Return(nil)
+
+		require.NoError(t, svc.Logout(ctx, "token"))
+	})
+}
+
+func TestSyncUsers(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	users := servicetest.NewMockUserRepository(ctrl)
+	svc := service.NewAuthService(users, servicetest.NewMockWorkspaceRepository(ctrl), time.Hour)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	t.Run("default workspace", func(t *testing.T) {
+		users.EXPECT().
+			Upsert(ctx, &database.User{Email: "a@example.com", PasswordHash: string(hash)}, "default").
+			Return(&database.User{ID: 1}, nil)
+
+		err := svc.SyncUsers(ctx, []service.Account{{Email: "A@Example.com", PasswordHash: string(hash)}})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		err := svc.SyncUsers(ctx, []service.Account{{Email: "Alice <a@example.com>", PasswordHash: string(hash)}})
+		require.ErrorIs(t, err, service.ErrInvalidAccount)
+	})
+
+	t.Run("unknown role", func(t *testing.T) {
+		err := svc.SyncUsers(ctx, []service.Account{{Email: "a@example.com", PasswordHash: string(hash), Roles: []string{"owner"}}})
+		require.ErrorIs(t, err, service.ErrInvalidAccount)
+		require.ErrorIs(t, err, service.ErrInvalidRole)
+	})
+
+	t.Run("plain password", func(t *testing.T) {
+		err := svc.SyncUsers(ctx, []service.Account{{Email: "a@example.com", PasswordHash: "secret"}})
+		require.ErrorIs(t, err, service.ErrInvalidAccount)
+	})
+}
+
+func TestSSO(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	users := servicetest.NewMockUserRepository(ctrl)
+	svc := service.NewAuthService(users, servicetest.NewMockWorkspaceRepository(ctrl), time.Hour)
+	user := &database.User{ID: 1, Email: "a@example.com", Workspace: 2, Roles: database.Tags{"editor"}}
+
+	t.Run("sign in", func(t *testing.T) {
+		users.EXPECT().
+			UpsertSSO(ctx, &database.User{Email: "a@example.com", Roles: database.Tags{"editor"}}, "team").
+			Return(user, nil)
+		users.EXPECT().CreateSession(ctx, gomock.Any()).Return(nil)
+
+		s, err := svc.SignInSSO(ctx, service.Identity{Email: "A@example.com", Roles: []string{"editor"}, Workspace: "team"})
+		require.NoError(t, err)
+		require.NotEmpty(t, s.Token)
+		require.Equal(t, service.User{ID: 1, Email: "a@example.com", Workspace: 2, Roles: []string{"editor"}}, s.User)
+	})
+
+	t.Run("identify", func(t *testing.T) {
+		users.EXPECT().
+			UpsertSSO(ctx, &database.User{Email: "a@example.com", Roles: database.Tags{"editor"}}, "team").
+			Return(user, nil)
+
+		u, err := svc.Identify(ctx, service.Identity{Email: "a@example.com", Roles: []string{"editor"}, Workspace: "team"})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), u.ID)
+	})
+
+	t.Run("identify caches by subject", func(t *testing.T) {
+		id := service.Identity{Issuer: "https://sso.example.com", Subject: "u1", Email: "a@example.com", Roles: []string{"editor"}, Workspace: "team"}
+		users.EXPECT().
+			UpsertSSO(ctx, &database.User{Email: "a@example.com", Roles: database.Tags{"editor"}}, "team").
+			Return(user, nil)
+
+		for range 3 {
+			u, err := svc.Identify(ctx, id)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), u.ID)
+		}
+
+		// Changed claims are written again.
+		id.Roles = []string{"admin"}
+		users.EXPECT().
+			UpsertSSO(ctx, &database.User{Email: "a@example.com", Roles: database.Tags{"admin"}}, "team").
+			Return(&database.User{ID: 1, Email: "a@example.com", Workspace: 2, Roles: database.Tags{"admin"}}, nil)
+
+		u, err := svc.Identify(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, []string{"admin"}, u.Roles)
+	})
+
+	t.Run("unknown workspace", func(t *testing.T) {
+		users.EXPECT().UpsertSSO(ctx, gomock.Any(), "nope").Return(nil, database.ErrWorkspaceNotFound)
+
+		_, err := svc.Identify(ctx, service.Identity{Email: "a@example.com", Workspace: "nope"})
+		require.ErrorIs(t, err, service.ErrWorkspaceNotFound)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		_, err := svc.SignInSSO(ctx, service.Identity{Email: "not an email", Workspace: "team"})
+		require.ErrorIs(t, err, service.ErrInvalidAccount)
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	workspaces := servicetest.NewMockWorkspaceRepository(ctrl)
+	svc := service.NewAuthService(servicetest.NewMockUserRepository(ctrl), workspaces, time.Hour)
+	ctx := service.ContextWithActor(context.Background(), service.Actor{ID: service.UserActorID(1), User: 1, Workspace: 2})
+
+	t.Run("create", func(t *testing.T) {
+		var stored string
+		workspaces.EXPECT().
+			CreateKey(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, k *database.APIKey) (*database.APIKey, error) {
+				require.Equal(t, int64(2), k.Workspace)
+				require.Equal(t, int64(1), *k.UserID)
+				stored = k.KeyHash
+				return &database.APIKey{ID: 5, Name: k.Name}, nil
+			})
+
+		k, err := svc.CreateAPIKey(ctx, " ci ")
+		require.NoError(t, err)
+		require.Equal(t, "ci", k.Name)
+		require.Equal(t, service.KeyHash(k.Key), stored)
+	})
+
+	t.Run("list omits keys", func(t *testing.T) {
+		workspaces.EXPECT().ListKeys(ctx, int64(1)).Return([]*database.APIKey{{ID: 5, Name: "ci", KeyHash: "abc"}}, nil)
+
+		keys, err := svc.ListAPIKeys(ctx)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		require.Empty(t, keys[0].Key)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		workspaces.EXPECT().DeleteKey(ctx, int64(1), int64(6)).Return(database.ErrAPIKeyNotFound)
+
+		require.ErrorIs(t, svc.DeleteAPIKey(ctx, 6), service.ErrAPIKeyNotFound)
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		_, err := svc.CreateAPIKey(context.Background(), "ci")
+		require.ErrorIs(t, err, service.ErrUnauthenticated)
+	})
+}
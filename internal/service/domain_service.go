@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+var (
+	ErrInvalidDomain  = errors.New("invalid domain")
+	ErrDomainExists   = database.ErrDomainExists
+	ErrDomainNotFound = database.ErrDomainNotFound
+	ErrDomainInUse    = database.ErrDomainInUse
+)
+
+type Domain struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DomainService interface {
+	Create(ctx context.Context, name string) (*Domain, error)
+	List(ctx context.Context) ([]*Domain, error)
+	// Delete removes a domain. Domains that still have links are kept and
+	// ErrDomainInUse is returned.
+	Delete(ctx context.Context, name string) error
+}
+
+type domainService struct {
+	repo          database.DomainRepository
+	defaultDomain string
+}
+
+func NewDomainService(r database.DomainRepository, defaultDomain string) DomainService {
+	return &domainService{repo: r, defaultDomain: normalizeDomain(defaultDomain)}
+}
+
+func (s *domainService) Create(ctx context.Context, name string) (*Domain, error) {
+	name = normalizeDomain(name)
+	if !isValidDomain(name) {
+		return nil, ErrInvalidDomain
+	}
+	if name == s.defaultDomain {
+		return nil, ErrDomainExists
+	}
+
+	d, err := s.repo.Create(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("create domain: %w", err)
+	}
+
+	return &Domain{Name: d.Name, CreatedAt: d.CreatedAt}, nil
+}
+
+func (s *domainService) List(ctx context.Context) ([]*Domain, error) {
+	domains, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list domains: %w", err)
+	}
+
+	out := make([]*Domain, 0, len(domains))
+	for _, d := range domains {
+		out = append(out, &Domain{Name: d.Name, CreatedAt: d.CreatedAt})
+	}
+
+	return out, nil
+}
+
+func (s *domainService) Delete(ctx context.Context, name string) error {
+	if err := s.repo.Delete(ctx, normalizeDomain(name)); err != nil {
+		return fmt.Errorf("delete domain: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeDomain lowercases a host and strips the port and trailing dot, so
+// that "Go.Example.com:443" and "go.example.com" name the same domain.
+func normalizeDomain(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+var domainRegexp = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+func isValidDomain(name string) bool {
+	return len(name) <= 253 && domainRegexp.MatchString(name)
+}
@@ -0,0 +1,113 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestDomainService_Create(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockDomainRepository(ctrl)
+	svc := service.NewDomainService(repo, "sho.rt")
+
+	t.Run("normalizes name", func(t *testing.T) {
+		repo.EXPECT().
+			Create(ctx, "go.example.com").
+			Return(&database.Domain{ID: 1, Name: "go.example.com", CreatedAt: time.Now()}, nil)
+
+		d, err := svc.Create(ctx, "Go.Example.COM.")
+		require.NoError(t, err)
+		require.Equal(t, "go.example.com", d.Name)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, name := range []string{"", "localhost", "-bad.com", "bad_domain.com", "http://x.com"} {
+			_, err := svc.Create(ctx, name)
+			require.ErrorIs(t, err, service.ErrInvalidDomain, name)
+		}
+	})
+
+	t.Run("default domain is implicit", func(t *testing.T) {
+		_, err := svc.Create(ctx, "sho.rt")
+		require.ErrorIs(t, err, service.ErrDomainExists)
+	})
+}
+
+func TestURLService_Domains(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	domains := servicetest.NewMockDomainRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithDomains(domains, "sho.rt"))
+
+	t.Run("create in custom domain", func(t *testing.T) {
+		domains.EXPECT().Exists(ctx, "go.example.com").Return(true, nil)
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "go.example.com", "promo").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, &database.URL{Domain: "go.example.com", Alias: "promo", URL: "https://ok.com", URLHash: urlHash("https://ok.com"), CreatedBy: service.AnonymousActor, Workspace: service.DefaultWorkspace}).
+			Return(&database.URL{ID: 1, Domain: "go.example.com", Alias: "promo", URL: "https://ok.com"}, nil)
+
+		out, err := svc.Create(ctx, "https://ok.com", "promo", service.WithDomain("GO.example.com"))
+		require.NoError(t, err)
+		require.Equal(t, "go.example.com", out.Domain)
+	})
+
+	t.Run("create in default domain", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, &database.URL{Alias: "promo", URL: "https://ok.com", URLHash: urlHash("https://ok.com"), CreatedBy: service.AnonymousActor, Workspace: service.DefaultWorkspace}).
+			Return(&database.URL{ID: 2, Alias: "promo", URL: "https://ok.com"}, nil)
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo", service.WithDomain("sho.rt"))
+		require.NoError(t, err)
+	})
+
+	t.Run("create in unknown domain", func(t *testing.T) {
+		domains.EXPECT().Exists(ctx, "evil.com").Return(false, nil)
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo", service.WithDomain("evil.com"))
+		require.ErrorIs(t, err, service.ErrDomainNotFound)
+	})
+
+	t.Run("resolve by host", func(t *testing.T) {
+		domains.EXPECT().Exists(ctx, "go.example.com").Return(true, nil)
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "go.example.com", "promo").
+			Return(&database.URL{Domain: "go.example.com", Alias: "promo", URL: "https://brand.com"}, nil)
+
+		out, err := svc.Resolve(ctx, "promo", service.Visitor{Host: "go.example.com:443"})
+		require.NoError(t, err)
+		require.Equal(t, "https://brand.com", out.OrigURL)
+	})
+
+	t.Run("unknown host falls back to default namespace", func(t *testing.T) {
+		domains.EXPECT().Exists(ctx, "10.0.0.1").Return(false, nil)
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", "promo").
+			Return(&database.URL{Alias: "promo", URL: "https://ok.com"}, nil)
+
+		out, err := svc.Resolve(ctx, "promo", service.Visitor{Host: "10.0.0.1:8080"})
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", out.OrigURL)
+	})
+
+	t.Run("delete in unknown domain", func(t *testing.T) {
+		domains.EXPECT().Exists(ctx, "evil.com").Return(false, nil)
+
+		err := svc.Delete(ctx, "evil.com", "promo")
+		require.ErrorIs(t, err, service.ErrDomainNotFound)
+	})
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// identityCacheTTL bounds how long changes made to a user outside the
+// token, e.g. by a configuration sync, take to apply to bearer requests.
+const identityCacheTTL = time.Minute
+
+// identityCache remembers the users bearer tokens resolved to, by the
+// issuer and subject of the token. An entry only matches a token with the
+// same email, roles and workspace.
+type identityCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[identityKey]*identityEntry
+	pruned  time.Time
+}
+
+type identityKey struct {
+	issuer, subject string
+}
+
+type identityEntry struct {
+	identity  Identity
+	user      User
+	expiresAt time.Time
+}
+
+func newIdentityCache(ttl time.Duration) *identityCache {
+	return &identityCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[identityKey]*identityEntry),
+	}
+}
+
+func (c *identityCache) Get(id Identity) (User, bool) {
+	if id.Issuer == "" || id.Subject == "" {
+		return User{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[identityKey{id.Issuer, id.Subject}]
+	if !ok || !c.now().Before(e.expiresAt) || !sameIdentity(e.identity, id) {
+		return User{}, false
+	}
+
+	return e.user, true
+}
+
+func (c *identityCache) Put(id Identity, u User) {
+	if id.Issuer == "" || id.Subject == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.prune(now)
+	c.entries[identityKey{id.Issuer, id.Subject}] = &identityEntry{
+		identity:  id,
+		user:      u,
+		expiresAt: now.Add(c.ttl),
+	}
+}
+
+// prune drops expired entries so that the map does not grow without bound.
+// It runs at most once per TTL and must be called with c.mu held.
+func (c *identityCache) prune(now time.Time) {
+	if now.Sub(c.pruned) < c.ttl {
+		return
+	}
+	c.pruned = now
+
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func sameIdentity(a, b Identity) bool {
+	return a.Email == b.Email && a.Workspace == b.Workspace && slices.Equal(a.Roles, b.Roles)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 2000
+	maxTags              = 20
+	maxMetadataKeys      = 50
+	maxMetadataKeyLength = 64
+	maxMetadataValueSize = 1024
+	maxSearchLength      = 200
+)
+
+var (
+	ErrInvalidTag      = errors.New("invalid tag")
+	ErrInvalidMetadata = errors.New("invalid metadata")
+	ErrInvalidSearch   = errors.New("invalid search")
+)
+
+// ListFilter selects a page of links, newest first. Empty Tag and Search
+// match every link.
+type ListFilter = database.ListFilter
+
+// WithTitle sets a human-readable title of the link.
+func WithTitle(title string) CreateOption {
+	return func(o *createOptions) {
+		o.title = title
+	}
+}
+
+// WithDescription sets free-form notes on why the link exists.
+func WithDescription(description string) CreateOption {
+	return func(o *createOptions) {
+		o.description = description
+	}
+}
+
+// WithTags labels the link. Tags are case-insensitive and deduplicated.
+func WithTags(tags []string) CreateOption {
+	return func(o *createOptions) {
+		o.tags = tags
+	}
+}
+
+// WithMetadata attaches arbitrary key/value pairs to the link.
+func WithMetadata(metadata map[string]string) CreateOption {
+	return func(o *createOptions) {
+		o.metadata = metadata
+	}
+}
+
+var tagRegexp = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}_.:-]{0,31}$`)
+
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if !tagRegexp.MatchString(tag) {
+		return "", fmt.Errorf("%w %q", ErrInvalidTag, tag)
+	}
+
+	return tag, nil
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+
+	if len(out) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTag, maxTags)
+	}
+
+	return out, nil
+}
+
+func normalizeDetails(title, description string, metadata map[string]string) (string, string, map[string]string, error) {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return "", "", nil, fmt.Errorf("%w: title must not exceed %d characters", ErrInvalidMetadata, maxTitleLength)
+	}
+
+	description = strings.TrimSpace(description)
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return "", "", nil, fmt.Errorf("%w: description must not exceed %d characters", ErrInvalidMetadata, maxDescriptionLength)
+	}
+
+	if len(metadata) > maxMetadataKeys {
+		return "", "", nil, fmt.Errorf("%w: at most %d keys are allowed", ErrInvalidMetadata, maxMetadataKeys)
+	}
+	for k, v := range metadata {
+		if k == "" || len(k) > maxMetadataKeyLength {
+			return "", "", nil, fmt.Errorf("%w: keys must be 1 to %d bytes", ErrInvalidMetadata, maxMetadataKeyLength)
+		}
+		if len(v) > maxMetadataValueSize {
+			return "", "", nil, fmt.Errorf("%w: value of %q exceeds %d bytes", ErrInvalidMetadata, k, maxMetadataValueSize)
+		}
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	return title, description, metadata, nil
+}
@@ -0,0 +1,64 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestCreate_Metadata(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	t.Run("normalizes", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "spring").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, "Spring sale", u.Title)
+				require.Equal(t, "Flyers for the spring campaign", u.Description)
+				require.Equal(t, database.Tags{"flyer", "promo", "q2:2025"}, u.Tags)
+				require.Equal(t, database.Metadata{"owner": "growth"}, u.Metadata)
+				return u, nil
+			})
+
+		out, err := svc.Create(ctx, "https://example.com", "spring",
+			service.WithTitle("  Spring sale "),
+			service.WithDescription("Flyers for the spring campaign\n"),
+			service.WithTags([]string{"Promo", "flyer", "promo", "q2:2025"}),
+			service.WithMetadata(map[string]string{"owner": "growth"}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, "Spring sale", out.Title)
+		require.Equal(t, []string{"flyer", "promo", "q2:2025"}, out.Tags)
+	})
+
+	invalid := map[string]struct {
+		opt  service.CreateOption
+		want error
+	}{
+		"tag":           {service.WithTags([]string{"two words"}), service.ErrInvalidTag},
+		"empty tag":     {service.WithTags([]string{" "}), service.ErrInvalidTag},
+		"too many tags": {service.WithTags(strings.Fields("a b c d e f g h i j k l m n o p q r s t u")), service.ErrInvalidTag},
+		"long title":    {service.WithTitle(strings.Repeat("x", 201)), service.ErrInvalidMetadata},
+		"empty key":     {service.WithMetadata(map[string]string{"": "x"}), service.ErrInvalidMetadata},
+		"long value":    {service.WithMetadata(map[string]string{"k": strings.Repeat("x", 1025)}), service.ErrInvalidMetadata},
+	}
+	for name, tc := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Create(ctx, "https://example.com", "spring", tc.opt)
+			require.ErrorIs(t, err, tc.want)
+		})
+	}
+}
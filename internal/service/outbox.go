@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// EventSink receives link events relayed from the outbox. An event is
+// marked as published only after every sink accepted it, so sinks have to
+// tolerate receiving the same event ID more than once, and may be called
+// for several events at once.
+type EventSink interface {
+	Send(ctx context.Context, e Event) error
+}
+
+// WithOutbox makes the service write link events to the outbox: created and
+// deleted events in the same transaction as the change, click events right
+// after the click. They are published by an OutboxRelay.
+func WithOutbox(outbox database.OutboxRepository) Option {
+	return func(s *urlService) {
+		s.outbox = outbox
+	}
+}
+
+// outboxEvents returns the event to write along with a change, or nil when
+// the outbox is disabled.
+func (s *urlService) outboxEvents(eventType string, workspace int64, link EventLink, click *EventClick) ([]*database.OutboxEvent, error) {
+	if s.outbox == nil {
+		return nil, nil
+	}
+
+	e := newEvent(eventType, workspace, link, click)
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	return []*database.OutboxEvent{{EventID: e.ID, Type: e.Type, Payload: payload}}, nil
+}
+
+// recordClickEvent writes a click event to the outbox. Like the click
+// itself, it is best-effort and never fails the redirect.
+func (s *urlService) recordClickEvent(ctx context.Context, u *database.URL, out *URL) {
+	click := &EventClick{Destination: out.OrigURL, Variant: out.Variant}
+	if s.outbox == nil {
+		s.emit(EventLinkClicked, u.Workspace, eventLink(u), click)
+		return
+	}
+
+	events, err := s.outboxEvents(EventLinkClicked, u.Workspace, eventLink(u), click)
+	if err != nil {
+		return
+	}
+	_ = s.outbox.Add(ctx, events...)
+}
+
+type OutboxOptions struct {
+	// Interval is the delay between polls of the outbox once it is drained.
+	Interval  time.Duration
+	BatchSize int
+	// Workers is the number of events of a batch relayed at once.
+	Workers int
+	// MaxAttempts is the number of attempts after which a failing event is
+	// dead-lettered.
+	MaxAttempts int
+	// Backoff is the delay before an event is retried. It doubles on every
+	// further failure up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long published events are kept before being purged.
+	// Zero keeps them forever.
+	Retention time.Duration
+}
+
+// OutboxRelay publishes pending outbox events to the sinks, several at once
+// and oldest first, which gives at-least-once delivery but no ordering. A
+// failed event is retried with backoff without holding up the others, and
+// dead-lettered once it failed MaxAttempts times or cannot be decoded.
+// Dead events stay in the outbox with their last error. Several relays
+// running against the same database may publish an event more than once.
+type OutboxRelay struct {
+	repo   database.OutboxRepository
+	sinks  []EventSink
+	logger *zap.SugaredLogger
+	opts   OutboxOptions
+}
+
+func NewOutboxRelay(repo database.OutboxRepository, logger *zap.SugaredLogger, opts OutboxOptions, sinks ...EventSink) *OutboxRelay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = opts.Interval
+	}
+	if opts.MaxBackoff < opts.Backoff {
+		opts.MaxBackoff = opts.Backoff
+	}
+
+	return &OutboxRelay{
+		repo:   repo,
+		sinks:  sinks,
+		logger: logger,
+		opts:   opts,
+	}
+}
+
+const outboxPurgeInterval = time.Hour
+
+// Run relays events until ctx is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	var purged time.Time
+	for {
+		r.drain(ctx)
+
+		if r.opts.Retention > 0 && time.Since(purged) >= outboxPurgeInterval {
+			purged = time.Now()
+			if _, err := r.repo.Purge(ctx, purged.Add(-r.opts.Retention)); err != nil {
+				r.logger.Errorw("failed to purge outbox", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// errMalformedEvent marks events that can never be relayed.
+var errMalformedEvent = errors.New("malformed event")
+
+// drain relays batches until no event is due or the outbox cannot be
+// updated.
+func (r *OutboxRelay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := r.repo.Pending(ctx, r.opts.BatchSize)
+		if err != nil {
+			r.logger.Errorw("failed to load outbox events", "error", err)
+			return
+		}
+
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			stuck bool
+		)
+		workers := make(chan struct{}, r.opts.Workers)
+		for _, e := range events {
+			workers <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() { <-workers; wg.Done() }()
+				if err := r.process(ctx, e); err != nil {
+					r.logger.Errorw("failed to update outbox event", "event_id", e.EventID, "error", err)
+					mu.Lock()
+					stuck = true
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if stuck || len(events) < r.opts.BatchSize {
+			return
+		}
+	}
+}
+
+// process relays an event and records the outcome. It only fails when the
+// outcome cannot be stored.
+func (r *OutboxRelay) process(ctx context.Context, e *database.OutboxEvent) error {
+	err := r.relay(ctx, e)
+	if err == nil {
+		return r.repo.MarkPublished(ctx, e.ID)
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the event stays due.
+		return nil
+	}
+
+	attempt := e.Attempts + 1
+	if attempt >= r.opts.MaxAttempts || errors.Is(err, errMalformedEvent) {
+		r.logger.Errorw("dead-lettering outbox event", "event_id", e.EventID, "event", e.Type, "attempts", attempt, "error", err)
+		return r.repo.MarkDead(ctx, e.ID, err.Error())
+	}
+
+	r.logger.Warnw("failed to relay outbox event", "event_id", e.EventID, "event", e.Type, "attempts", attempt, "error", err)
+	return r.repo.MarkFailed(ctx, e.ID, err.Error(), time.Now().Add(r.backoff(attempt)))
+}
+
+func (r *OutboxRelay) relay(ctx context.Context, stored *database.OutboxEvent) error {
+	var e Event
+	if err := json.Unmarshal(stored.Payload, &e); err != nil {
+		return fmt.Errorf("%w: %w", errMalformedEvent, err)
+	}
+
+	for _, sink := range r.sinks {
+		if err := sink.Send(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backoff returns the delay after the given failed attempt: Backoff doubled
+// per previous failure, capped at MaxBackoff.
+func (r *OutboxRelay) backoff(attempt int) time.Duration {
+	delay := r.opts.Backoff
+	for i := 1; i < attempt && delay < r.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, r.opts.MaxBackoff)
+}
+
+// LogSink writes events to the application log.
+type LogSink struct {
+	logger *zap.SugaredLogger
+}
+
+func NewLogSink(logger *zap.SugaredLogger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (s *LogSink) Send(_ context.Context, e Event) error {
+	s.logger.Infow("link event", "event_id", e.ID, "event", e.Type, "domain", e.Data.Link.Domain, "alias", e.Data.Link.Alias)
+	return nil
+}
+
+// FileSink appends events to a file as JSON lines and syncs the file after
+// every event.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open event file: %w", err)
+	}
+
+	return &FileSink{file: f}, nil
+}
+
+func (s *FileSink) Send(_ context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync event file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
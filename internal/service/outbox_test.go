@@ -0,0 +1,290 @@
+package service_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestCreate_WritesOutboxEvent(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	outbox := servicetest.NewMockOutboxRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithOutbox(outbox))
+
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+	repo.EXPECT().
+		Save(ctx, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, u *database.URL, events ...*database.OutboxEvent) (*database.URL, error) {
+			require.Len(t, events, 1)
+			require.Equal(t, service.EventLinkCreated, events[0].Type)
+
+			var e service.Event
+			require.NoError(t, json.Unmarshal(events[0].Payload, &e))
+			require.Equal(t, events[0].EventID, e.ID)
+			require.Equal(t, "promo", e.Data.Link.Alias)
+			require.Equal(t, "https://ok.com", e.Data.Link.URL)
+
+			u.ID = 1
+			return u, nil
+		})
+
+	_, err := svc.Create(ctx, "https://ok.com", "promo")
+	require.NoError(t, err)
+}
+
+func TestDelete_WritesOutboxEvent(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	outbox := servicetest.NewMockOutboxRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithOutbox(outbox))
+
+	repo.EXPECT().
+		Delete(ctx, service.DefaultWorkspace, "", "promo", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int64, _, _ string, events ...*database.OutboxEvent) error {
+			require.Len(t, events, 1)
+			require.Equal(t, service.EventLinkDeleted, events[0].Type)
+			return database.ErrNotFound
+		})
+
+	// The event is rolled back together with the failed delete.
+	require.ErrorIs(t, svc.Delete(ctx, "", "promo"), service.ErrURLNotFound)
+}
+
+func TestResolve_WritesClickToOutbox(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	outbox := servicetest.NewMockOutboxRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithOutbox(outbox))
+
+	repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+	outbox.EXPECT().
+		Add(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, events ...*database.OutboxEvent) error {
+			require.Len(t, events, 1)
+			require.Equal(t, service.EventLinkClicked, events[0].Type)
+			return errors.New("db down")
+		})
+
+	// Failing to store the event does not fail the redirect.
+	u, err := svc.Resolve(ctx, "promo", service.Visitor{})
+	require.NoError(t, err)
+	require.Equal(t, "https://ok.com", u.OrigURL)
+}
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []service.Event
+	// failing lists the IDs of the events the sink rejects, "*" for all.
+	failing []string
+}
+
+func (s *recordingSink) Send(_ context.Context, e service.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if slices.Contains(s.failing, "*") || slices.Contains(s.failing, e.ID) {
+		return errors.New("sink unavailable")
+	}
+	s.events = append(s.events, e)
+
+	return nil
+}
+
+func (s *recordingSink) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.events))
+	for _, e := range s.events {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func outboxEvent(t *testing.T, id int64, eventID string) *database.OutboxEvent {
+	t.Helper()
+
+	payload, err := json.Marshal(service.Event{ID: eventID, Type: service.EventLinkCreated})
+	require.NoError(t, err)
+
+	return &database.OutboxEvent{ID: id, EventID: eventID, Type: service.EventLinkCreated, Payload: payload}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	t.Parallel()
+
+	t.Run("publishes to every sink", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		repo := servicetest.NewMockOutboxRepository(ctrl)
+		first, second := &recordingSink{}, &recordingSink{}
+		relay := service.NewOutboxRelay(repo, zap.NewNop().Sugar(), service.OutboxOptions{Interval: time.Hour, BatchSize: 10, Workers: 2}, first, second)
+
+		var published atomic.Int32
+		repo.EXPECT().Pending(gomock.Any(), 10).Return([]*database.OutboxEvent{outboxEvent(t, 1, "evt_1"), outboxEvent(t, 2, "evt_2")}, nil)
+		repo.EXPECT().
+			MarkPublished(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(context.Context, int64) error {
+				if published.Add(1) == 2 {
+					cancel()
+				}
+				return nil
+			}).
+			Times(2)
+
+		require.NoError(t, relay.Run(ctx))
+		for _, sink := range []*recordingSink{first, second} {
+			require.ElementsMatch(t, []string{"evt_1", "evt_2"}, sink.ids())
+		}
+	})
+
+	t.Run("failure does not hold up later events", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		repo := servicetest.NewMockOutboxRepository(ctrl)
+		sink := &recordingSink{failing: []string{"evt_1"}}
+		relay := service.NewOutboxRelay(repo, zap.NewNop().Sugar(), service.OutboxOptions{
+			Interval:    time.Hour,
+			BatchSize:   10,
+			MaxAttempts: 5,
+			Backoff:     time.Minute,
+			MaxBackoff:  time.Hour,
+		}, sink)
+
+		failed := outboxEvent(t, 1, "evt_1")
+		failed.Attempts = 2
+		repo.EXPECT().Pending(gomock.Any(), 10).Return([]*database.OutboxEvent{failed, outboxEvent(t, 2, "evt_2")}, nil)
+		repo.EXPECT().
+			MarkFailed(gomock.Any(), int64(1), "sink unavailable", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, _ string, retryAt time.Time) error {
+				// The third failure waits 4 times the backoff.
+				require.WithinDuration(t, time.Now().Add(4*time.Minute), retryAt, 10*time.Second)
+				return nil
+			})
+		repo.EXPECT().
+			MarkPublished(gomock.Any(), int64(2)).
+			DoAndReturn(func(context.Context, int64) error {
+				cancel()
+				return nil
+			})
+
+		require.NoError(t, relay.Run(ctx))
+		require.Equal(t, []string{"evt_2"}, sink.ids())
+	})
+
+	t.Run("dead-letters after the last attempt", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		repo := servicetest.NewMockOutboxRepository(ctrl)
+		relay := service.NewOutboxRelay(repo, zap.NewNop().Sugar(), service.OutboxOptions{Interval: time.Hour, BatchSize: 10, MaxAttempts: 5}, &recordingSink{failing: []string{"*"}})
+
+		e := outboxEvent(t, 1, "evt_1")
+		e.Attempts = 4
+		repo.EXPECT().Pending(gomock.Any(), 10).Return([]*database.OutboxEvent{e}, nil)
+		repo.EXPECT().
+			MarkDead(gomock.Any(), int64(1), "sink unavailable").
+			DoAndReturn(func(context.Context, int64, string) error {
+				cancel()
+				return nil
+			})
+
+		require.NoError(t, relay.Run(ctx))
+	})
+
+	t.Run("dead-letters malformed events", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		repo := servicetest.NewMockOutboxRepository(ctrl)
+		sink := &recordingSink{}
+		relay := service.NewOutboxRelay(repo, zap.NewNop().Sugar(), service.OutboxOptions{Interval: time.Hour, BatchSize: 10, MaxAttempts: 5}, sink)
+
+		repo.EXPECT().
+			Pending(gomock.Any(), 10).
+			Return([]*database.OutboxEvent{{ID: 1, EventID: "evt_1", Type: service.EventLinkCreated, Payload: []byte("{")}}, nil)
+		repo.EXPECT().
+			MarkDead(gomock.Any(), int64(1), gomock.Any()).
+			DoAndReturn(func(context.Context, int64, string) error {
+				cancel()
+				return nil
+			})
+
+		require.NoError(t, relay.Run(ctx))
+		require.Empty(t, sink.ids())
+	})
+
+	t.Run("purges published events", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		repo := servicetest.NewMockOutboxRepository(ctrl)
+		relay := service.NewOutboxRelay(repo, zap.NewNop().Sugar(), service.OutboxOptions{Interval: time.Hour, Retention: 24 * time.Hour})
+
+		repo.EXPECT().Pending(gomock.Any(), 100).Return(nil, nil)
+		repo.EXPECT().
+			Purge(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, before time.Time) (int64, error) {
+				require.WithinDuration(t, time.Now().Add(-24*time.Hour), before, time.Minute)
+				cancel()
+				return 3, nil
+			})
+
+		require.NoError(t, relay.Run(ctx))
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := service.NewFileSink(path)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, sink.Send(ctx, service.Event{ID: "evt_1", Type: service.EventLinkCreated}))
+	require.NoError(t, sink.Send(ctx, service.Event{ID: "evt_2", Type: service.EventLinkDeleted}))
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e service.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		ids = append(ids, e.ID)
+	}
+	require.Equal(t, []string{"evt_1", "evt_2"}, ids)
+}
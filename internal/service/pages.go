@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/pagemeta"
+)
+
+// PageMeta describes the destination page of a link. It is nil on links
+// whose page has not been fetched yet.
+type PageMeta = database.PageMeta
+
+type PageFetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*pagemeta.Page, error)
+}
+
+type pageJob struct {
+	id  int64
+	url string
+}
+
+// PageWorker fetches destination pages of new links in the background and
+// stores their metadata on the link. Jobs are kept in memory only: links
+// created while the queue is full, or not yet processed on shutdown, are
+// left without metadata.
+type PageWorker struct {
+	repo    database.URLRepository
+	fetcher PageFetcher
+	logger  *zap.SugaredLogger
+	workers int
+	jobs    chan pageJob
+}
+
+func NewPageWorker(repo database.URLRepository, fetcher PageFetcher, logger *zap.SugaredLogger, workers, queueSize int) *PageWorker {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+
+	return &PageWorker{
+		repo:    repo,
+		fetcher: fetcher,
+		logger:  logger,
+		workers: workers,
+		jobs:    make(chan pageJob, queueSize),
+	}
+}
+
+// WithPageWorker makes Create enqueue a fetch of the destination page.
+func WithPageWorker(w *PageWorker) Option {
+	return func(s *urlService) {
+		s.pages = w
+	}
+}
+
+// Enqueue schedules a fetch without blocking. It reports false when the
+// queue is full and the job was dropped.
+func (w *PageWorker) Enqueue(id int64, url string) bool {
+	select {
+	case w.jobs <- pageJob{id: id, url: url}:
+		return true
+	default:
+		w.logger.Warnw("page metadata queue is full, dropping job", "url_id", id)
+		return false
+	}
+}
+
+// Run processes jobs until ctx is cancelled.
+func (w *PageWorker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range w.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-w.jobs:
+					w.process(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (w *PageWorker) process(ctx context.Context, job pageJob) {
+	page, err := w.fetcher.Fetch(ctx, job.url)
+	if err != nil {
+		w.logger.Infow("failed to fetch page metadata", "url_id", job.id, "error", err)
+		return
+	}
+
+	meta := &PageMeta{
+		Title:       page.Title,
+		Description: page.Description,
+		Image:       page.Image,
+		SiteName:    page.SiteName,
+		Favicon:     page.Favicon,
+		FetchedAt:   time.Now().UTC(),
+	}
+	if err := w.repo.SetPage(ctx, job.id, meta); err != nil {
+		w.logger.Errorw("failed to store page metadata", "url_id", job.id, "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/pagemeta"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestCreate_FetchesPage(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Landing</title><meta property="og:image" content="/cover.png"></head></html>`)
+	}))
+	defer srv.Close()
+
+	ctrl := gomock.NewController(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := servicetest.NewMockURLRepository(ctrl)
+
+	opts := pagemeta.DefaultOptions()
+	opts.AllowPrivate = true
+	worker := service.NewPageWorker(repo, pagemeta.NewFetcher(opts), zap.NewNop().Sugar(), 1, 10)
+	svc := service.NewURLService(repo, service.WithPageWorker(worker))
+
+	stored := make(chan *database.PageMeta, 1)
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "landing").Return(false, nil)
+	repo.EXPECT().
+		Save(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+			u.ID = 42
+			return u, nil
+		})
+	repo.EXPECT().
+		SetPage(gomock.Any(), int64(42), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int64, page *database.PageMeta) error {
+			stored <- page
+			return nil
+		})
+
+	done := make(chan error, 1)
+	go func() { done <- worker.Run(ctx) }()
+
+	out, err := svc.Create(ctx, srv.URL+"/landing", "landing")
+	require.NoError(t, err)
+	require.Nil(t, out.Page)
+
+	select {
+	case page := <-stored:
+		require.Equal(t, "Landing", page.Title)
+		require.Equal(t, srv.URL+"/cover.png", page.Image)
+		require.Equal(t, srv.URL+"/favicon.ico", page.Favicon)
+		require.False(t, page.FetchedAt.IsZero())
+	case <-time.After(5 * time.Second):
+		t.Fatal("page metadata was not stored")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+type failingFetcher struct{}
+
+func (failingFetcher) Fetch(context.Context, string) (*pagemeta.Page, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestPageWorker_QueueFull(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	worker := service.NewPageWorker(repo, failingFetcher{}, zap.NewNop().Sugar(), 1, 1)
+
+	require.True(t, worker.Enqueue(1, "https://example.com"))
+	require.False(t, worker.Enqueue(2, "https://example.com"))
+
+	// A failed fetch stores nothing.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.NoError(t, worker.Run(ctx))
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+var ErrPreviewRequired = errors.New("preview required")
+
+// WithForcePreview shows the preview interstitial to every visitor of the
+// link instead of redirecting straight away.
+func WithForcePreview(force bool) CreateOption {
+	return func(o *createOptions) {
+		o.forcePreview = force
+	}
+}
+
+func (s *urlService) Preview(ctx context.Context, alias string, v Visitor) (*URL, error) {
+	alias = s.canonicalAlias(alias)
+
+	domain, err := s.hostScope(ctx, v.Host)
+	if err != nil {
+		return nil, fmt.Errorf("preview: %w", err)
+	}
+
+	u, err := s.repo.Get(ctx, database.AnyWorkspace, domain, alias)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, fmt.Errorf("preview: %w", ErrURLNotFound)
+		}
+		return nil, fmt.Errorf("preview: %w", err)
+	}
+
+	if u.PasswordHash != "" {
+		return nil, fmt.Errorf("preview: %w", ErrPasswordRequired)
+	}
+	if u.ClicksLeft != nil && *u.ClicksLeft <= 0 {
+		return nil, fmt.Errorf("preview: %w", ErrLinkExhausted)
+	}
+
+	return s.destination(u, v), nil
+}
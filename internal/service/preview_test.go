@@ -0,0 +1,132 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestPreview(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	clicks := servicetest.NewMockClickRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithClicks(clicks))
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	one, zero := int64(1), int64(0)
+
+	t.Run("has no side effects", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(&database.URL{
+			ID:         7,
+			Alias:      "promo",
+			URL:        "https://example.com/?a=1",
+			MaxClicks:  &one,
+			ClicksLeft: &one,
+			QueryMode:  service.QueryMerge,
+			Rules:      database.TargetRules{{Platform: "ios", URL: "https://apps.apple.com/app/id1"}},
+			CreatedAt:  created,
+		}, nil)
+
+		out, err := svc.Preview(ctx, "promo", service.Visitor{UserAgent: desktopUA, Query: "ref=x"})
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/?a=1&ref=x", out.OrigURL)
+		require.Equal(t, created, out.CreatedAt)
+	})
+
+	t.Run("password is not disclosed", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "secret").Return(&database.URL{Alias: "secret", URL: "https://example.com", PasswordHash: "hash"}, nil)
+
+		_, err := svc.Preview(ctx, "secret", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrPasswordRequired)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "once").Return(&database.URL{Alias: "once", URL: "https://example.com", MaxClicks: &one, ClicksLeft: &zero}, nil)
+
+		_, err := svc.Preview(ctx, "once", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrLinkExhausted)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "nope").Return(nil, database.ErrNotFound)
+
+		_, err := svc.Preview(ctx, "nope", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrURLNotFound)
+	})
+}
+
+func TestResolve_ForcePreview(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	link := &database.URL{Alias: "ext", URL: "https://example.com", ForcePreview: true}
+	repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "ext").Return(link, nil).Times(2)
+
+	_, err := svc.Resolve(ctx, "ext", service.Visitor{})
+	require.ErrorIs(t, err, service.ErrPreviewRequired)
+
+	out, err := svc.Resolve(ctx, "ext", service.Visitor{SkipPreview: true})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", out.OrigURL)
+}
+
+func TestCreate_ForcePreview(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "ext").Return(false, nil)
+	repo.EXPECT().
+		Save(ctx, &database.URL{Alias: "ext", URL: "https://example.com", ForcePreview: true, URLHash: urlHash("https://example.com"), CreatedBy: service.AnonymousActor, Workspace: service.DefaultWorkspace}).
+		DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+			return u, nil
+		})
+
+	out, err := svc.Create(ctx, "https://example.com", "ext", service.WithForcePreview(true))
+	require.NoError(t, err)
+	require.True(t, out.ForcePreview)
+}
+
+func TestUnlock_ForcePreview(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	link := &database.URL{Alias: "ext", URL: "https://example.com", PasswordHash: string(hash), ForcePreview: true}
+	repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "ext").Return(link, nil).Times(3)
+
+	_, err = svc.Unlock(ctx, "ext", "wrong", service.Visitor{})
+	require.ErrorIs(t, err, service.ErrWrongPassword)
+
+	out, err := svc.Unlock(ctx, "ext", "secret", service.Visitor{})
+	require.ErrorIs(t, err, service.ErrPreviewRequired)
+	require.Equal(t, "https://example.com", out.OrigURL)
+
+	out, err = svc.Unlock(ctx, "ext", "secret", service.Visitor{SkipPreview: true})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", out.OrigURL)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// Query modes of a link. QueryDrop, the default, discards the query string
+// of the short link; QueryMerge adds incoming parameters the destination
+// does not already have; QueryOverride replaces destination parameters of
+// the same name.
+const (
+	QueryDrop     = ""
+	QueryMerge    = "merge"
+	QueryOverride = "override"
+)
+
+const maxUTMValueLength = 256
+
+var (
+	ErrInvalidQueryMode = errors.New("invalid query mode")
+	ErrInvalidUTM       = errors.New("invalid utm parameters")
+)
+
+// UTM holds the utm_* parameters attached to the destination on redirect.
+// Values may contain the placeholders {alias}, {domain}, {variant} and
+// {platform}, expanded for every visitor.
+type UTM = database.UTM
+
+// WithQueryMode sets how the query string of the short link is forwarded
+// to the destination.
+func WithQueryMode(mode string) CreateOption {
+	return func(o *createOptions) {
+		o.queryMode = mode
+	}
+}
+
+// WithUTM attaches UTM parameters to the destination. They replace utm_*
+// parameters already present in the stored URL.
+func WithUTM(utm UTM) CreateOption {
+	return func(o *createOptions) {
+		o.utm = utm
+	}
+}
+
+func normalizeQueryMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case QueryDrop, QueryMerge, QueryOverride:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w %q: must be %q or %q", ErrInvalidQueryMode, mode, QueryMerge, QueryOverride)
+	}
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+var utmPlaceholders = map[string]bool{
+	"alias":    true,
+	"domain":   true,
+	"variant":  true,
+	"platform": true,
+}
+
+func normalizeUTM(utm UTM) (UTM, error) {
+	fields := []*string{&utm.Source, &utm.Medium, &utm.Campaign, &utm.Term, &utm.Content}
+	for _, f := range fields {
+		*f = strings.TrimSpace(*f)
+		if len(*f) > maxUTMValueLength {
+			return UTM{}, fmt.Errorf("%w: values must not exceed %d bytes", ErrInvalidUTM, maxUTMValueLength)
+		}
+		for _, m := range placeholderRegexp.FindAllStringSubmatch(*f, -1) {
+			if !utmPlaceholders[m[1]] {
+				return UTM{}, fmt.Errorf("%w: unknown placeholder %q", ErrInvalidUTM, m[0])
+			}
+		}
+	}
+
+	return utm, nil
+}
+
+// UTMVariesByPlatform reports whether a UTM value uses the {platform}
+// placeholder, so the destination depends on the visitor's User-Agent.
+func UTMVariesByPlatform(utm UTM) bool {
+	for _, v := range []string{utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content} {
+		if strings.Contains(v, "{platform}") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// utmParams returns the non-empty UTM parameters in their conventional
+// order with placeholders expanded.
+func utmParams(utm UTM, vars map[string]string) []queryPair {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	}
+
+	params := make([]queryPair, 0, len(fields))
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		value := placeholderRegexp.ReplaceAllStringFunc(f.value, func(m string) string {
+			return vars[m[1:len(m)-1]]
+		})
+		params = append(params, queryPair{
+			key: f.name,
+			raw: url.QueryEscape(f.name) + "=" + url.QueryEscape(value),
+		})
+	}
+
+	return params
+}
+
+// decorate adds the link's UTM parameters and, depending on the query mode,
+// the visitor's query string to the destination. Parameters of the stored
+// URL that are not replaced keep their original order and encoding, and
+// the fragment is preserved.
+func decorate(dst string, u *database.URL, variant string, v Visitor) string {
+	forward := u.QueryMode != QueryDrop && v.Query != ""
+	if u.UTM == (UTM{}) && !forward {
+		return dst
+	}
+
+	target, err := url.Parse(dst)
+	if err != nil {
+		return dst
+	}
+
+	pairs := splitQuery(target.RawQuery)
+
+	utm := utmParams(u.UTM, map[string]string{
+		"alias":    u.Alias,
+		"domain":   normalizeDomain(v.Host),
+		"variant":  variant,
+		"platform": detectPlatform(v.UserAgent),
+	})
+	pairs = setParams(pairs, utm, true)
+
+	if forward {
+		pairs = setParams(pairs, splitQuery(v.Query), u.QueryMode == QueryOverride)
+	}
+
+	raw := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		raw = append(raw, p.raw)
+	}
+	target.RawQuery = strings.Join(raw, "&")
+
+	return target.String()
+}
+
+type queryPair struct {
+	key string
+	// raw is the pair as it appears in the query string.
+	raw string
+}
+
+// splitQuery splits a raw query string into its pairs without re-encoding
+// them. Pairs that cannot be decoded are dropped.
+func splitQuery(rawQuery string) []queryPair {
+	var pairs []queryPair
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		k, val, _ := strings.Cut(raw, "=")
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			continue
+		}
+		if _, err := url.QueryUnescape(val); err != nil {
+			continue
+		}
+		pairs = append(pairs, queryPair{key: key, raw: raw})
+	}
+
+	return pairs
+}
+
+// setParams appends params to pairs. With override, existing pairs with
+// the same key are removed first; without it, params whose key is already
+// present are skipped. Repeated keys within params are all kept.
+func setParams(pairs, params []queryPair, override bool) []queryPair {
+	if len(params) == 0 {
+		return pairs
+	}
+
+	keys := make(map[string]bool, len(params))
+	for _, p := range params {
+		keys[p.key] = true
+	}
+
+	out := pairs[:0:0]
+	present := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		if override && keys[p.key] {
+			continue
+		}
+		present[p.key] = true
+		out = append(out, p)
+	}
+
+	for _, p := range params {
+		if !present[p.key] {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestResolve_Query(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		link  database.URL
+		query string
+		want  string
+	}{
+		{
+			name:  "dropped by default",
+			link:  database.URL{URL: "https://example.com/page?a=1"},
+			query: "ref=newsletter",
+			want:  "https://example.com/page?a=1",
+		},
+		{
+			name:  "merge keeps destination values",
+			link:  database.URL{URL: "https://example.com/page?a=1&b=2#top", QueryMode: service.QueryMerge},
+			query: "b=3&ref=newsletter",
+			want:  "https://example.com/page?a=1&b=2&ref=newsletter#top",
+		},
+		{
+			name:  "override replaces destination values",
+			link:  database.URL{URL: "https://example.com/page?a=1&b=2#top", QueryMode: service.QueryOverride},
+			query: "b=3&b=4&ref=newsletter",
+			want:  "https://example.com/page?a=1&b=3&b=4&ref=newsletter#top",
+		},
+		{
+			name:  "destination without query",
+			link:  database.URL{URL: "https://example.com/#/app/route", QueryMode: service.QueryMerge},
+			query: "ref=a%20b",
+			want:  "https://example.com/?ref=a%20b#/app/route",
+		},
+		{
+			name:  "stored encoding is preserved",
+			link:  database.URL{URL: "https://example.com/?q=a+b&path=%2Fx", QueryMode: service.QueryMerge},
+			query: "ref=x",
+			want:  "https://example.com/?q=a+b&path=%2Fx&ref=x",
+		},
+		{
+			name: "utm replaces stored utm",
+			link: database.URL{
+				Alias: "promo",
+				URL:   "https://example.com/?utm_source=old&id=5#f",
+				UTM:   database.UTM{Source: "shorty", Medium: "qr", Campaign: "{alias}-{platform}"},
+			},
+			want: "https://example.com/?id=5&utm_source=shorty&utm_medium=qr&utm_campaign=promo-ios#f",
+		},
+		{
+			name: "merged query does not override utm",
+			link: database.URL{
+				URL:       "https://example.com/",
+				QueryMode: service.QueryMerge,
+				UTM:       database.UTM{Source: "shorty"},
+			},
+			query: "utm_source=evil&ref=x",
+			want:  "https://example.com/?utm_source=shorty&ref=x",
+		},
+		{
+			name: "overriding query wins over utm",
+			link: database.URL{
+				URL:       "https://example.com/",
+				QueryMode: service.QueryOverride,
+				UTM:       database.UTM{Source: "shorty", Medium: "email"},
+			},
+			query: "utm_source=partner",
+			want:  "https://example.com/?utm_medium=email&utm_source=partner",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			ctx := context.Background()
+			repo := servicetest.NewMockURLRepository(ctrl)
+			svc := service.NewURLService(repo)
+
+			link := tc.link
+			repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(&link, nil)
+
+			out, err := svc.Resolve(ctx, "promo", service.Visitor{UserAgent: iPhoneUA, Query: tc.query})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, out.OrigURL)
+		})
+	}
+}
+
+func TestResolve_UTMVariant(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	link := splitLink()
+	link.UTM = database.UTM{Content: "{variant}", Source: "{domain}"}
+	repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(link, nil)
+
+	out, err := svc.Resolve(ctx, "promo", service.Visitor{Host: "Go.Example.com:443", Variant: "b"})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/b?utm_source=go.example.com&utm_content=b", out.OrigURL)
+}
+
+func TestCreate_Query(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	t.Run("normalizes", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, service.QueryOverride, u.QueryMode)
+				require.Equal(t, database.UTM{Source: "shorty", Campaign: "{alias}"}, u.UTM)
+				return u, nil
+			})
+
+		_, err := svc.Create(ctx, "https://example.com", "promo",
+			service.WithQueryMode(" Override "),
+			service.WithUTM(service.UTM{Source: " shorty ", Campaign: "{alias}"}),
+		)
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, err := svc.Create(ctx, "https://example.com", "promo", service.WithQueryMode("append"))
+		require.ErrorIs(t, err, service.ErrInvalidQueryMode)
+	})
+
+	t.Run("unknown placeholder", func(t *testing.T) {
+		_, err := svc.Create(ctx, "https://example.com", "promo", service.WithUTM(service.UTM{Source: "{user}"}))
+		require.ErrorIs(t, err, service.ErrInvalidUTM)
+	})
+}
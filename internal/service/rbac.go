@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Role is a set of permissions granted to users and API keys. Roles are
+// ordered: every role has the permissions of the ones before it.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// Permission is an operation on links that is subject to roles.
+type Permission string
+
+const (
+	// PermView covers reading a link without following it.
+	PermView      Permission = "view"
+	PermCreate    Permission = "create"
+	PermUpdate    Permission = "update"
+	PermDelete    Permission = "delete"
+	PermViewStats Permission = "view_stats"
+	PermExport    Permission = "export"
+	// PermWebhooks covers registering, listing and removing webhooks.
+	PermWebhooks Permission = "manage_webhooks"
+	// PermDomains covers registering and removing domains, which are
+	// shared by all workspaces.
+	PermDomains Permission = "manage_domains"
+	PermAudit   Permission = "view_audit"
+)
+
+var (
+	// ErrForbidden is returned for operations none of the caller's roles
+	// permits.
+	ErrForbidden   = errors.New("permission denied")
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// rolePermissions lists what each role may do. Viewers read links, their
+// statistics and list them, editors also create and restore them and
+// manage webhooks, and only admins delete them, manage domains and read
+// the audit log.
+var rolePermissions = map[Role][]Permission{
+	RoleViewer: {PermView, PermViewStats, PermExport},
+	RoleEditor: {PermView, PermViewStats, PermExport, PermCreate, PermUpdate, PermWebhooks},
+	RoleAdmin:  {PermView, PermViewStats, PermExport, PermCreate, PermUpdate, PermDelete, PermWebhooks, PermDomains, PermAudit},
+}
+
+// ParseRole returns the role with the name, an error wrapping
+// ErrInvalidRole for unknown ones.
+func ParseRole(name string) (Role, error) {
+	r := Role(name)
+	if _, ok := rolePermissions[r]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRole, name)
+	}
+
+	return r, nil
+}
+
+// parseRoles checks that all names are roles.
+func parseRoles(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	roles := make([]string, 0, len(names))
+	for _, name := range names {
+		r, err := ParseRole(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, string(r))
+	}
+
+	return roles, nil
+}
+
+// Allowed reports whether any of the roles grants the permission. Names
+// that are not roles, e.g. other groups asserted by the SSO provider, are
+// ignored.
+func Allowed(roles []string, p Permission) bool {
+	for _, name := range roles {
+		if slices.Contains(rolePermissions[Role(name)], p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorizer checks the roles of the context's actor. Actors without a
+// role, e.g. anonymous callers, have the defaultRoles.
+type authorizer struct {
+	defaultRoles []string
+}
+
+func (a authorizer) authorize(ctx context.Context, p Permission) error {
+	roles := ActorFromContext(ctx).Roles
+	if !slices.ContainsFunc(roles, func(name string) bool { return rolePermissions[Role(name)] != nil }) {
+		roles = a.defaultRoles
+	}
+	if !Allowed(roles, p) {
+		return fmt.Errorf("%w: %s is not allowed", ErrForbidden, p)
+	}
+
+	return nil
+}
+
+// authenticate is authorize for operations that are never open to
+// anonymous callers, whatever the defaultRoles; they get
+// ErrUnauthenticated.
+func (a authorizer) authenticate(ctx context.Context, p Permission) error {
+	if !ActorFromContext(ctx).Authenticated {
+		return ErrUnauthenticated
+	}
+
+	return a.authorize(ctx, p)
+}
+
+type authorizedURLService struct {
+	URLService
+	authorizer
+}
+
+// NewAuthorizedURLService checks the roles of the context's actor before
+// creating, reading, restoring, deleting, listing links and reading their
+// stats, returning ErrForbidden when none of them permits it. Actors
+// without a role, e.g. anonymous callers, have the defaultRoles. Following
+// and previewing links stays open to everyone.
+func NewAuthorizedURLService(inner URLService, defaultRoles []string) URLService {
+	return &authorizedURLService{URLService: inner, authorizer: authorizer{defaultRoles: defaultRoles}}
+}
+
+func (s *authorizedURLService) Create(ctx context.Context, url, alias string, opts ...CreateOption) (*URL, error) {
+	if err := s.authorize(ctx, PermCreate); err != nil {
+		return nil, err
+	}
+
+	return s.URLService.Create(ctx, url, alias, opts...)
+}
+
+func (s *authorizedURLService) Get(ctx context.Context, domain, alias string) (*URL, error) {
+	if err := s.authorize(ctx, PermView); err != nil {
+		return nil, err
+	}
+
+	return s.URLService.Get(ctx, domain, alias)
+}
+
+func (s *authorizedURLService) Restore(ctx context.Context, domain, alias string) (*URL, error) {
+	if err := s.authorize(ctx, PermUpdate); err != nil {
+		return nil, err
+	}
+
+	return s.URLService.Restore(ctx, domain, alias)
+}
+
+func (s *authorizedURLService) Delete(ctx context.Context, domain, alias string) error {
+	if err := s.authorize(ctx, PermDelete); err != nil {
+		return err
+	}
+
+	return s.URLService.Delete(ctx, domain, alias)
+}
+
+func (s *authorizedURLService) List(ctx context.Context, f ListFilter) ([]*URL, error) {
+	if err := s.authorize(ctx, PermExport); err != nil {
+		return nil, err
+	}
+
+	return s.URLService.List(ctx, f)
+}
+
+func (s *authorizedURLService) Stats(ctx context.Context, domain, alias string) (*Stats, error) {
+	if err := s.authorize(ctx, PermViewStats); err != nil {
+		return nil, err
+	}
+
+	return s.URLService.Stats(ctx, domain, alias)
+}
+
+type authorizedDomainService struct {
+	DomainService
+	authorizer
+}
+
+// NewAuthorizedDomainService lets actors with PermView list domains and
+// restricts registering and removing them to authenticated actors with
+// PermDomains, i.e. admins.
+func NewAuthorizedDomainService(inner DomainService, defaultRoles []string) DomainService {
+	return &authorizedDomainService{DomainService: inner, authorizer: authorizer{defaultRoles: defaultRoles}}
+}
+
+func (s *authorizedDomainService) Create(ctx context.Context, name string) (*Domain, error) {
+	if err := s.authenticate(ctx, PermDomains); err != nil {
+		return nil, err
+	}
+
+	return s.DomainService.Create(ctx, name)
+}
+
+func (s *authorizedDomainService) List(ctx context.Context) ([]*Domain, error) {
+	if err := s.authorize(ctx, PermView); err != nil {
+		return nil, err
+	}
+
+	return s.DomainService.List(ctx)
+}
+
+func (s *authorizedDomainService) Delete(ctx context.Context, name string) error {
+	if err := s.authenticate(ctx, PermDomains); err != nil {
+		return err
+	}
+
+	return s.DomainService.Delete(ctx, name)
+}
+
+type authorizedWebhookService struct {
+	WebhookService
+	authorizer
+}
+
+// NewAuthorizedWebhookService restricts webhooks to authenticated actors
+// with PermWebhooks. Anonymous callers get ErrUnauthenticated, the others
+// ErrForbidden when none of their roles permits it.
+func NewAuthorizedWebhookService(inner WebhookService, defaultRoles []string) WebhookService {
+	return &authorizedWebhookService{WebhookService: inner, authorizer: authorizer{defaultRoles: defaultRoles}}
+}
+
+func (s *authorizedWebhookService) Create(ctx context.Context, url string, events []string, secret string) (*Webhook, error) {
+	if err := s.authenticate(ctx, PermWebhooks); err != nil {
+		return nil, err
+	}
+
+	return s.WebhookService.Create(ctx, url, events, secret)
+}
+
+func (s *authorizedWebhookService) List(ctx context.Context) ([]*Webhook, error) {
+	if err := s.authenticate(ctx, PermWebhooks); err != nil {
+		return nil, err
+	}
+
+	return s.WebhookService.List(ctx)
+}
+
+func (s *authorizedWebhookService) Delete(ctx context.Context, id int64) error {
+	if err := s.authenticate(ctx, PermWebhooks); err != nil {
+		return err
+	}
+
+	return s.WebhookService.Delete(ctx, id)
+}
+
+func (s *authorizedWebhookService) Deliveries(ctx context.Context, id int64, limit int) ([]*WebhookDelivery, error) {
+	if err := s.authenticate(ctx, PermWebhooks); err != nil {
+		return nil, err
+	}
+
+	return s.WebhookService.Deliveries(ctx, id, limit)
+}
+
+type authorizedAuditService struct {
+	AuditService
+	authorizer
+}
+
+// NewAuthorizedAuditService restricts the audit log to authenticated
+// actors with PermAudit, i.e. admins.
+func NewAuthorizedAuditService(inner AuditService, defaultRoles []string) AuditService {
+	return &authorizedAuditService{AuditService: inner, authorizer: authorizer{defaultRoles: defaultRoles}}
+}
+
+func (s *authorizedAuditService) List(ctx context.Context, f AuditFilter) ([]*AuditEntry, error) {
+	if err := s.authenticate(ctx, PermAudit); err != nil {
+		return nil, err
+	}
+
+	return s.AuditService.List(ctx, f)
+}
@@ -0,0 +1,190 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		roles []string
+		perm  service.Permission
+		want  bool
+	}{
+		{[]string{"viewer"}, service.PermView, true},
+		{[]string{"viewer"}, service.PermViewStats, true},
+		{[]string{"viewer"}, service.PermExport, true},
+		{[]string{"viewer"}, service.PermCreate, false},
+		{[]string{"editor"}, service.PermUpdate, true},
+		{[]string{"editor"}, service.PermDelete, false},
+		{[]string{"viewer", "admin"}, service.PermDelete, true},
+		{[]string{"editor"}, service.PermDomains, false},
+		{[]string{"admin"}, service.PermDomains, true},
+		{[]string{"offline_access"}, service.PermExport, false},
+		{nil, service.PermViewStats, false},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, service.Allowed(tt.roles, tt.perm), "%v %s", tt.roles, tt.perm)
+	}
+}
+
+func TestAuthorizedURLService(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewAuthorizedURLService(service.NewURLService(repo), []string{"viewer"})
+	as := func(roles ...string) context.Context {
+		return service.ContextWithActor(context.Background(), service.Actor{ID: "user:1", Workspace: service.DefaultWorkspace, Roles: roles})
+	}
+
+	t.Run("viewer cannot create", func(t *testing.T) {
+		_, err := svc.Create(as("viewer"), "https://ok.com", "promo")
+		require.ErrorIs(t, err, service.ErrForbidden)
+	})
+
+	t.Run("editor creates", func(t *testing.T) {
+		ctx := as("editor")
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+		repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo")
+		require.NoError(t, err)
+	})
+
+	t.Run("editor cannot delete", func(t *testing.T) {
+		require.ErrorIs(t, svc.Delete(as("editor"), "", "promo"), service.ErrForbidden)
+	})
+
+	t.Run("admin deletes", func(t *testing.T) {
+		ctx := as("admin")
+		repo.EXPECT().Delete(ctx, service.DefaultWorkspace, "", "promo").Return(nil)
+
+		require.NoError(t, svc.Delete(ctx, "", "promo"))
+	})
+
+	t.Run("no known role falls back to default roles", func(t *testing.T) {
+		_, err := svc.Restore(as("offline_access"), "", "promo")
+		require.ErrorIs(t, err, service.ErrForbidden)
+
+		ctx := as()
+		repo.EXPECT().List(ctx, gomock.Any()).Return(nil, nil)
+
+		_, err = svc.List(ctx, service.ListFilter{})
+		require.NoError(t, err)
+	})
+
+	t.Run("reading a link needs a role", func(t *testing.T) {
+		ctx := as("offline_access")
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "promo").Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+
+		_, err := svc.Get(ctx, "", "promo")
+		require.NoError(t, err)
+
+		closed := service.NewAuthorizedURLService(service.NewURLService(repo), nil)
+		_, err = closed.Get(ctx, "", "promo")
+		require.ErrorIs(t, err, service.ErrForbidden)
+	})
+}
+
+func TestAuthorizedDomainService(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockDomainRepository(ctrl)
+	svc := service.NewAuthorizedDomainService(service.NewDomainService(repo, ""), []string{"admin"})
+	as := func(roles ...string) context.Context {
+		return service.ContextWithActor(context.Background(), service.Actor{ID: "user:1", Workspace: 4, Roles: roles, Authenticated: true})
+	}
+
+	t.Run("anonymous callers cannot manage domains whatever the default roles", func(t *testing.T) {
+		_, err := svc.Create(context.Background(), "go.example.com")
+		require.ErrorIs(t, err, service.ErrUnauthenticated)
+
+		require.ErrorIs(t, svc.Delete(context.Background(), "go.example.com"), service.ErrUnauthenticated)
+	})
+
+	t.Run("editor cannot manage domains", func(t *testing.T) {
+		_, err := svc.Create(as("editor"), "go.example.com")
+		require.ErrorIs(t, err, service.ErrForbidden)
+	})
+
+	t.Run("viewer lists domains", func(t *testing.T) {
+		ctx := as("viewer")
+		repo.EXPECT().List(ctx).Return(nil, nil)
+
+		_, err := svc.List(ctx)
+		require.NoError(t, err)
+	})
+
+	t.Run("admin registers domains", func(t *testing.T) {
+		ctx := as("admin")
+		repo.EXPECT().Create(ctx, "go.example.com").Return(&database.Domain{ID: 1, Name: "go.example.com"}, nil)
+
+		_, err := svc.Create(ctx, "go.example.com")
+		require.NoError(t, err)
+	})
+}
+
+func TestAuthorizedWebhookService(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockWebhookRepository(ctrl)
+	svc := service.NewAuthorizedWebhookService(service.NewWebhookService(repo, false), []string{"admin"})
+	as := func(roles ...string) context.Context {
+		return service.ContextWithActor(context.Background(), service.Actor{ID: "key:abc", Workspace: 4, Roles: roles, Authenticated: true})
+	}
+
+	t.Run("anonymous callers are rejected whatever the default roles", func(t *testing.T) {
+		_, err := svc.List(context.Background())
+		require.ErrorIs(t, err, service.ErrUnauthenticated)
+
+		_, err = svc.Create(context.Background(), "https://crm.example.com/hooks", nil, "")
+		require.ErrorIs(t, err, service.ErrUnauthenticated)
+	})
+
+	t.Run("viewer cannot manage webhooks", func(t *testing.T) {
+		require.ErrorIs(t, svc.Delete(as("viewer"), 1), service.ErrForbidden)
+	})
+
+	t.Run("editor lists the webhooks of its workspace", func(t *testing.T) {
+		ctx := as("editor")
+		repo.EXPECT().List(ctx, int64(4)).Return([]*database.Webhook{{ID: 1, Workspace: 4}}, nil)
+
+		webhooks, err := svc.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+	})
+}
+
+func TestAuthorizedAuditService(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockAuditRepository(ctrl)
+	svc := service.NewAuthorizedAuditService(service.NewAuditService(repo), []string{"admin"})
+	as := func(roles ...string) context.Context {
+		return service.ContextWithActor(context.Background(), service.Actor{ID: "user:1", Workspace: 4, Roles: roles, Authenticated: true})
+	}
+
+	_, err := svc.List(context.Background(), service.AuditFilter{})
+	require.ErrorIs(t, err, service.ErrUnauthenticated)
+
+	_, err = svc.List(as("editor"), service.AuditFilter{})
+	require.ErrorIs(t, err, service.ErrForbidden)
+
+	ctx := as("admin")
+	repo.EXPECT().List(ctx, database.AuditFilter{Workspace: 4, Limit: 20}).Return(nil, nil)
+	_, err = svc.List(ctx, service.AuditFilter{})
+	require.NoError(t, err)
+}
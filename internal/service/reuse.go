@@ -0,0 +1,58 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// WithReuse makes Create return the caller's existing link to the same
+// destination in its workspace instead of creating a new one. Only plain
+// links, without a password, click limit or any other per-link option, are
+// reused, and only for plain requests without an alias. Anonymous callers
+// cannot be told apart and always get a new link.
+func WithReuse(reuse bool) CreateOption {
+	return func(o *createOptions) {
+		o.reuse = reuse
+	}
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizeDestination returns the canonical form of a destination used
+// for deduplication: lowercase scheme and host, no default port, no
+// trailing slash and query parameters sorted by name.
+func normalizeDestination(u *url.URL) string {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == defaultPorts[n.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	n.Host = host
+
+	n.Path = strings.TrimRight(n.Path, "/")
+	n.RawPath = ""
+	n.RawQuery = n.Query().Encode()
+	n.ForceQuery = false
+
+	return n.String()
+}
+
+// destinationHash is the hex SHA-256 of the normalized destination.
+func destinationHash(u *url.URL) string {
+	sum := sha256.Sum256([]byte(normalizeDestination(u)))
+
+	return hex.EncodeToString(sum[:])
+}
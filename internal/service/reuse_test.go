@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+// urlHash returns the hash stored for a destination already in normal form.
+func urlHash(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCreate_NormalizesDestinationHash(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	want := urlHash("https://example.com/path?a=1&b=2")
+	for _, raw := range []string{
+		"https://example.com/path?a=1&b=2",
+		"HTTPS://Example.COM:443/path/?b=2&a=1",
+		"https://example.com/path/?a=1&b=2",
+	} {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, want, u.URLHash, raw)
+				return u, nil
+			})
+
+		_, err := svc.Create(ctx, raw, "")
+		require.NoError(t, err)
+	}
+
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).Return(false, nil)
+	repo.EXPECT().
+		Save(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+			require.NotEqual(t, want, u.URLHash)
+			return u, nil
+		})
+	_, err := svc.Create(ctx, "http://example.com/path?a=1&b=2", "")
+	require.NoError(t, err)
+}
+
+func TestCreate_Reuse(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := service.ContextWithActor(context.Background(), service.Actor{ID: "key:abc", Workspace: 3})
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+	hash := urlHash("https://example.com/path")
+
+	t.Run("existing link", func(t *testing.T) {
+		repo.EXPECT().
+			FindReusable(ctx, int64(3), "", hash, "key:abc").
+			Return(&database.URL{ID: 7, Alias: "old", URL: "https://example.com/path/"}, nil)
+
+		out, err := svc.Create(ctx, "https://EXAMPLE.com/path/", "", service.WithReuse(true))
+		require.NoError(t, err)
+		require.Equal(t, "old", out.Alias)
+		require.True(t, out.Reused)
+	})
+
+	t.Run("no existing link", func(t *testing.T) {
+		repo.EXPECT().FindReusable(ctx, int64(3), "", hash, "key:abc").Return(nil, database.ErrNotFound)
+		repo.EXPECT().Exists(ctx, int64(3), "", gomock.Any()).Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, "key:abc", u.CreatedBy)
+				return u, nil
+			})
+
+		out, err := svc.Create(ctx, "https://example.com/path", "", service.WithReuse(true))
+		require.NoError(t, err)
+		require.False(t, out.Reused)
+	})
+
+	t.Run("custom alias is not reused", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, int64(3), "", "mine").Return(false, nil)
+		repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 8, Alias: "mine", URL: "https://example.com/path"}, nil)
+
+		_, err := svc.Create(ctx, "https://example.com/path", "mine", service.WithReuse(true))
+		require.NoError(t, err)
+	})
+
+	t.Run("links with options are not reused", func(t *testing.T) {
+		for name, opt := range map[string]service.CreateOption{
+			"rules":         service.WithRules([]service.Rule{{Platform: "ios", URL: "https://apps.apple.com/app"}}),
+			"variants":      service.WithVariants([]service.Variant{{Name: "a", URL: "https://a.example.com", Weight: 1}, {Name: "b", URL: "https://b.example.com", Weight: 1}}),
+			"utm":           service.WithUTM(service.UTM{Source: "newsletter"}),
+			"query mode":    service.WithQueryMode(service.QueryMerge),
+			"force preview": service.WithForcePreview(true),
+			"title":         service.WithTitle("Sale"),
+			"tags":          service.WithTags([]string{"promo"}),
+		} {
+			repo.EXPECT().Exists(ctx, int64(3), "", gomock.Any()).Return(false, nil)
+			repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 9, Alias: "fresh", URL: "https://example.com/path"}, nil)
+
+			out, err := svc.Create(ctx, "https://example.com/path", "", service.WithReuse(true), opt)
+			require.NoError(t, err, name)
+			require.False(t, out.Reused, name)
+		}
+	})
+
+	t.Run("anonymous callers are not reused", func(t *testing.T) {
+		anon := context.Background()
+		repo.EXPECT().Exists(anon, service.DefaultWorkspace, "", gomock.Any()).Return(false, nil)
+		repo.EXPECT().Save(anon, gomock.Any()).Return(&database.URL{ID: 10, Alias: "fresh", URL: "https://example.com/path"}, nil)
+
+		out, err := svc.Create(anon, "https://example.com/path", "", service.WithReuse(true))
+		require.NoError(t, err)
+		require.False(t, out.Reused)
+	})
+}
@@ -0,0 +1,56 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/alias_sequence.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/alias_sequence.go -destination=internal/service/servicetest/alias_sequence_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAliasSequence is a mock of AliasSequence interface.
+type MockAliasSequence struct {
+	ctrl     *gomock.Controller
+	recorder *MockAliasSequenceMockRecorder
+	isgomock struct{}
+}
+
+// MockAliasSequenceMockRecorder is the mock recorder for MockAliasSequence.
+type MockAliasSequenceMockRecorder struct {
+	mock *MockAliasSequence
+}
+
+// NewMockAliasSequence creates a new mock instance.
+func NewMockAliasSequence(ctrl *gomock.Controller) *MockAliasSequence {
+	mock := &MockAliasSequence{ctrl: ctrl}
+	mock.recorder = &MockAliasSequenceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAliasSequence) EXPECT() *MockAliasSequenceMockRecorder {
+	return m.recorder
+}
+
+// Next mocks base method.
+func (m *MockAliasSequence) Next(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Next", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Next indicates an expected call of Next.
+func (mr *MockAliasSequenceMockRecorder) Next(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Next", reflect.TypeOf((*MockAliasSequence)(nil).Next), ctx)
+}
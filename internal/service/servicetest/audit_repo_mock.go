@@ -0,0 +1,71 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/audit_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/audit_repository.go -destination=internal/service/servicetest/audit_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAuditRepository is a mock of AuditRepository interface.
+type MockAuditRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockAuditRepositoryMockRecorder is the mock recorder for MockAuditRepository.
+type MockAuditRepositoryMockRecorder struct {
+	mock *MockAuditRepository
+}
+
+// NewMockAuditRepository creates a new mock instance.
+func NewMockAuditRepository(ctrl *gomock.Controller) *MockAuditRepository {
+	mock := &MockAuditRepository{ctrl: ctrl}
+	mock.recorder = &MockAuditRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditRepository) EXPECT() *MockAuditRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Append mocks base method.
+func (m *MockAuditRepository) Append(ctx context.Context, e *database.AuditEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Append", ctx, e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Append indicates an expected call of Append.
+func (mr *MockAuditRepositoryMockRecorder) Append(ctx, e any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Append", reflect.TypeOf((*MockAuditRepository)(nil).Append), ctx, e)
+}
+
+// List mocks base method.
+func (m *MockAuditRepository) List(ctx context.Context, f database.AuditFilter) ([]*database.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, f)
+	ret0, _ := ret[0].([]*database.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAuditRepositoryMockRecorder) List(ctx, f any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAuditRepository)(nil).List), ctx, f)
+}
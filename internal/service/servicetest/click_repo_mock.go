@@ -0,0 +1,87 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/click_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/click_repository.go -destination=internal/service/servicetest/click_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockClickRepository is a mock of ClickRepository interface.
+type MockClickRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockClickRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockClickRepositoryMockRecorder is the mock recorder for MockClickRepository.
+type MockClickRepositoryMockRecorder struct {
+	mock *MockClickRepository
+}
+
+// NewMockClickRepository creates a new mock instance.
+func NewMockClickRepository(ctrl *gomock.Controller) *MockClickRepository {
+	mock := &MockClickRepository{ctrl: ctrl}
+	mock.recorder = &MockClickRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClickRepository) EXPECT() *MockClickRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CountByDay mocks base method.
+func (m *MockClickRepository) CountByDay(ctx context.Context, urlID int64, since time.Time) ([]database.DailyClicks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountByDay", ctx, urlID, since)
+	ret0, _ := ret[0].([]database.DailyClicks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountByDay indicates an expected call of CountByDay.
+func (mr *MockClickRepositoryMockRecorder) CountByDay(ctx, urlID, since any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountByDay", reflect.TypeOf((*MockClickRepository)(nil).CountByDay), ctx, urlID, since)
+}
+
+// CountByVariant mocks base method.
+func (m *MockClickRepository) CountByVariant(ctx context.Context, urlID int64) ([]database.VariantClicks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountByVariant", ctx, urlID)
+	ret0, _ := ret[0].([]database.VariantClicks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountByVariant indicates an expected call of CountByVariant.
+func (mr *MockClickRepositoryMockRecorder) CountByVariant(ctx, urlID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountByVariant", reflect.TypeOf((*MockClickRepository)(nil).CountByVariant), ctx, urlID)
+}
+
+// Record mocks base method.
+func (m *MockClickRepository) Record(ctx context.Context, c *database.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", ctx, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockClickRepositoryMockRecorder) Record(ctx, c any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockClickRepository)(nil).Record), ctx, c)
+}
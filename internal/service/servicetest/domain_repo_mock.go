@@ -0,0 +1,101 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/domain_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/domain_repository.go -destination=internal/service/servicetest/domain_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockDomainRepository is a mock of DomainRepository interface.
+type MockDomainRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockDomainRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockDomainRepositoryMockRecorder is the mock recorder for MockDomainRepository.
+type MockDomainRepositoryMockRecorder struct {
+	mock *MockDomainRepository
+}
+
+// NewMockDomainRepository creates a new mock instance.
+func NewMockDomainRepository(ctrl *gomock.Controller) *MockDomainRepository {
+	mock := &MockDomainRepository{ctrl: ctrl}
+	mock.recorder = &MockDomainRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDomainRepository) EXPECT() *MockDomainRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockDomainRepository) Create(ctx context.Context, name string) (*database.Domain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, name)
+	ret0, _ := ret[0].(*database.Domain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockDomainRepositoryMockRecorder) Create(ctx, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDomainRepository)(nil).Create), ctx, name)
+}
+
+// Delete mocks base method.
+func (m *MockDomainRepository) Delete(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockDomainRepositoryMockRecorder) Delete(ctx, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDomainRepository)(nil).Delete), ctx, name)
+}
+
+// Exists mocks base method.
+func (m *MockDomainRepository) Exists(ctx context.Context, name string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", ctx, name)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockDomainRepositoryMockRecorder) Exists(ctx, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockDomainRepository)(nil).Exists), ctx, name)
+}
+
+// List mocks base method.
+func (m *MockDomainRepository) List(ctx context.Context) ([]*database.Domain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]*database.Domain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockDomainRepositoryMockRecorder) List(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDomainRepository)(nil).List), ctx)
+}
@@ -0,0 +1,134 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/outbox_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/outbox_repository.go -destination=internal/service/servicetest/outbox_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockOutboxRepository is a mock of OutboxRepository interface.
+type MockOutboxRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOutboxRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockOutboxRepositoryMockRecorder is the mock recorder for MockOutboxRepository.
+type MockOutboxRepositoryMockRecorder struct {
+	mock *MockOutboxRepository
+}
+
+// NewMockOutboxRepository creates a new mock instance.
+func NewMockOutboxRepository(ctrl *gomock.Controller) *MockOutboxRepository {
+	mock := &MockOutboxRepository{ctrl: ctrl}
+	mock.recorder = &MockOutboxRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOutboxRepository) EXPECT() *MockOutboxRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method.
+func (m *MockOutboxRepository) Add(ctx context.Context, events ...*database.OutboxEvent) error {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx}
+	for _, a := range events {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Add", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add.
+func (mr *MockOutboxRepositoryMockRecorder) Add(ctx any, events ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx}, events...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockOutboxRepository)(nil).Add), varargs...)
+}
+
+// MarkDead mocks base method.
+func (m *MockOutboxRepository) MarkDead(ctx context.Context, id int64, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDead", ctx, id, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDead indicates an expected call of MarkDead.
+func (mr *MockOutboxRepositoryMockRecorder) MarkDead(ctx, id, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDead", reflect.TypeOf((*MockOutboxRepository)(nil).MarkDead), ctx, id, reason)
+}
+
+// MarkFailed mocks base method.
+func (m *MockOutboxRepository) MarkFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkFailed", ctx, id, reason, retryAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkFailed indicates an expected call of MarkFailed.
+func (mr *MockOutboxRepositoryMockRecorder) MarkFailed(ctx, id, reason, retryAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkFailed", reflect.TypeOf((*MockOutboxRepository)(nil).MarkFailed), ctx, id, reason, retryAt)
+}
+
+// MarkPublished mocks base method.
+func (m *MockOutboxRepository) MarkPublished(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkPublished", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkPublished indicates an expected call of MarkPublished.
+func (mr *MockOutboxRepositoryMockRecorder) MarkPublished(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkPublished", reflect.TypeOf((*MockOutboxRepository)(nil).MarkPublished), ctx, id)
+}
+
+// Pending mocks base method.
+func (m *MockOutboxRepository) Pending(ctx context.Context, limit int) ([]*database.OutboxEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pending", ctx, limit)
+	ret0, _ := ret[0].([]*database.OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Pending indicates an expected call of Pending.
+func (mr *MockOutboxRepositoryMockRecorder) Pending(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pending", reflect.TypeOf((*MockOutboxRepository)(nil).Pending), ctx, limit)
+}
+
+// Purge mocks base method.
+func (m *MockOutboxRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockOutboxRepositoryMockRecorder) Purge(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockOutboxRepository)(nil).Purge), ctx, before)
+}
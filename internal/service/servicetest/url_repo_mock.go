@@ -12,6 +12,7 @@ package servicetest
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	database "github.com/finlleyl/shorty_reborn/internal/database"
 	gomock "go.uber.org/mock/gomock"
@@ -41,61 +42,180 @@ func (m *MockURLRepository) EXPECT() *MockURLRepositoryMockRecorder {
 	return m.recorder
 }
 
+// ConsumeClick mocks base method.
+func (m *MockURLRepository) ConsumeClick(ctx context.Context, domain, alias string, month time.Time) (*database.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeClick", ctx, domain, alias, month)
+	ret0, _ := ret[0].(*database.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeClick indicates an expected call of ConsumeClick.
+func (mr *MockURLRepositoryMockRecorder) ConsumeClick(ctx, domain, alias, month any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeClick", reflect.TypeOf((*MockURLRepository)(nil).ConsumeClick), ctx, domain, alias, month)
+}
+
 // Delete mocks base method.
-func (m *MockURLRepository) Delete(ctx context.Context, alias string) error {
+func (m *MockURLRepository) Delete(ctx context.Context, workspace int64, domain, alias string, events ...*database.OutboxEvent) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", ctx, alias)
+	varargs := []any{ctx, workspace, domain, alias}
+	for _, a := range events {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Delete", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockURLRepositoryMockRecorder) Delete(ctx, alias any) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) Delete(ctx, workspace, domain, alias any, events ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, workspace, domain, alias}, events...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockURLRepository)(nil).Delete), varargs...)
+}
+
+// DeletedSince mocks base method.
+func (m *MockURLRepository) DeletedSince(ctx context.Context, workspace int64, domain, alias string, since time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletedSince", ctx, workspace, domain, alias, since)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletedSince indicates an expected call of DeletedSince.
+func (mr *MockURLRepositoryMockRecorder) DeletedSince(ctx, workspace, domain, alias, since any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockURLRepository)(nil).Delete), ctx, alias)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletedSince", reflect.TypeOf((*MockURLRepository)(nil).DeletedSince), ctx, workspace, domain, alias, since)
 }
 
 // Exists mocks base method.
-func (m *MockURLRepository) Exists(ctx context.Context, alias string) (bool, error) {
+func (m *MockURLRepository) Exists(ctx context.Context, workspace int64, domain, alias string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Exists", ctx, alias)
+	ret := m.ctrl.Call(m, "Exists", ctx, workspace, domain, alias)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Exists indicates an expected call of Exists.
-func (mr *MockURLRepositoryMockRecorder) Exists(ctx, alias any) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) Exists(ctx, workspace, domain, alias any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockURLRepository)(nil).Exists), ctx, alias)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockURLRepository)(nil).Exists), ctx, workspace, domain, alias)
+}
+
+// FindReusable mocks base method.
+func (m *MockURLRepository) FindReusable(ctx context.Context, workspace int64, domain, urlHash, createdBy string) (*database.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindReusable", ctx, workspace, domain, urlHash, createdBy)
+	ret0, _ := ret[0].(*database.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindReusable indicates an expected call of FindReusable.
+func (mr *MockURLRepositoryMockRecorder) FindReusable(ctx, workspace, domain, urlHash, createdBy any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindReusable", reflect.TypeOf((*MockURLRepository)(nil).FindReusable), ctx, workspace, domain, urlHash, createdBy)
 }
 
 // Get mocks base method.
-func (m *MockURLRepository) Get(ctx context.Context, alias string) (*database.URL, error) {
+func (m *MockURLRepository) Get(ctx context.Context, workspace int64, domain, alias string) (*database.URL, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", ctx, alias)
+	ret := m.ctrl.Call(m, "Get", ctx, workspace, domain, alias)
 	ret0, _ := ret[0].(*database.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockURLRepositoryMockRecorder) Get(ctx, alias any) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) Get(ctx, workspace, domain, alias any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockURLRepository)(nil).Get), ctx, workspace, domain, alias)
+}
+
+// List mocks base method.
+func (m *MockURLRepository) List(ctx context.Context, f database.ListFilter) ([]*database.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, f)
+	ret0, _ := ret[0].([]*database.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockURLRepositoryMockRecorder) List(ctx, f any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockURLRepository)(nil).List), ctx, f)
+}
+
+// Purge mocks base method.
+func (m *MockURLRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockURLRepositoryMockRecorder) Purge(ctx, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockURLRepository)(nil).Purge), ctx, before)
+}
+
+// Restore mocks base method.
+func (m *MockURLRepository) Restore(ctx context.Context, workspace int64, domain, alias string, since time.Time, quota bool, events ...*database.OutboxEvent) (*database.URL, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, workspace, domain, alias, since, quota}
+	for _, a := range events {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Restore", varargs...)
+	ret0, _ := ret[0].(*database.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockURLRepositoryMockRecorder) Restore(ctx, workspace, domain, alias, since, quota any, events ...any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockURLRepository)(nil).Get), ctx, alias)
+	varargs := append([]any{ctx, workspace, domain, alias, since, quota}, events...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockURLRepository)(nil).Restore), varargs...)
 }
 
 // Save mocks base method.
-func (m *MockURLRepository) Save(ctx context.Context, alias, url string) (*database.URL, error) {
+func (m *MockURLRepository) Save(ctx context.Context, u *database.URL, events ...*database.OutboxEvent) (*database.URL, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Save", ctx, alias, url)
+	varargs := []any{ctx, u}
+	for _, a := range events {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Save", varargs...)
 	ret0, _ := ret[0].(*database.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Save indicates an expected call of Save.
-func (mr *MockURLRepositoryMockRecorder) Save(ctx, alias, url any) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) Save(ctx, u any, events ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, u}, events...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockURLRepository)(nil).Save), varargs...)
+}
+
+// SetPage mocks base method.
+func (m *MockURLRepository) SetPage(ctx context.Context, id int64, page *database.PageMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPage", ctx, id, page)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPage indicates an expected call of SetPage.
+func (mr *MockURLRepositoryMockRecorder) SetPage(ctx, id, page any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockURLRepository)(nil).Save), ctx, alias, url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPage", reflect.TypeOf((*MockURLRepository)(nil).SetPage), ctx, id, page)
 }
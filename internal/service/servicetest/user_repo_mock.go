@@ -0,0 +1,132 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/user_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/user_repository.go -destination=internal/service/servicetest/user_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockUserRepository is a mock of UserRepository interface.
+type MockUserRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockUserRepositoryMockRecorder is the mock recorder for MockUserRepository.
+type MockUserRepositoryMockRecorder struct {
+	mock *MockUserRepository
+}
+
+// NewMockUserRepository creates a new mock instance.
+func NewMockUserRepository(ctrl *gomock.Controller) *MockUserRepository {
+	mock := &MockUserRepository{ctrl: ctrl}
+	mock.recorder = &MockUserRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ByEmail mocks base method.
+func (m *MockUserRepository) ByEmail(ctx context.Context, email string) (*database.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ByEmail", ctx, email)
+	ret0, _ := ret[0].(*database.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ByEmail indicates an expected call of ByEmail.
+func (mr *MockUserRepositoryMockRecorder) ByEmail(ctx, email any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ByEmail", reflect.TypeOf((*MockUserRepository)(nil).ByEmail), ctx, email)
+}
+
+// CreateSession mocks base method.
+func (m *MockUserRepository) CreateSession(ctx context.Context, s *database.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", ctx, s)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockUserRepositoryMockRecorder) CreateSession(ctx, s any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockUserRepository)(nil).CreateSession), ctx, s)
+}
+
+// DeleteSession mocks base method.
+func (m *MockUserRepository) DeleteSession(ctx context.Context, tokenHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSession", ctx, tokenHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteSession indicates an expected call of DeleteSession.
+func (mr *MockUserRepositoryMockRecorder) DeleteSession(ctx, tokenHash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockUserRepository)(nil).DeleteSession), ctx, tokenHash)
+}
+
+// Session mocks base method.
+func (m *MockUserRepository) Session(ctx context.Context, tokenHash string, now time.Time) (*database.Session, *database.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Session", ctx, tokenHash, now)
+	ret0, _ := ret[0].(*database.Session)
+	ret1, _ := ret[1].(*database.User)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Session indicates an expected call of Session.
+func (mr *MockUserRepositoryMockRecorder) Session(ctx, tokenHash, now any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Session", reflect.TypeOf((*MockUserRepository)(nil).Session), ctx, tokenHash, now)
+}
+
+// Upsert mocks base method.
+func (m *MockUserRepository) Upsert(ctx context.Context, u *database.User, workspace string) (*database.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, u, workspace)
+	ret0, _ := ret[0].(*database.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockUserRepositoryMockRecorder) Upsert(ctx, u, workspace any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockUserRepository)(nil).Upsert), ctx, u, workspace)
+}
+
+// UpsertSSO mocks base method.
+func (m *MockUserRepository) UpsertSSO(ctx context.Context, u *database.User, workspace string) (*database.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertSSO", ctx, u, workspace)
+	ret0, _ := ret[0].(*database.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpsertSSO indicates an expected call of UpsertSSO.
+func (mr *MockUserRepositoryMockRecorder) UpsertSSO(ctx, u, workspace any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertSSO", reflect.TypeOf((*MockUserRepository)(nil).UpsertSSO), ctx, u, workspace)
+}
@@ -0,0 +1,160 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/webhook_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/webhook_repository.go -destination=internal/service/servicetest/webhook_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockWebhookRepository is a mock of WebhookRepository interface.
+type MockWebhookRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockWebhookRepositoryMockRecorder is the mock recorder for MockWebhookRepository.
+type MockWebhookRepositoryMockRecorder struct {
+	mock *MockWebhookRepository
+}
+
+// NewMockWebhookRepository creates a new mock instance.
+func NewMockWebhookRepository(ctrl *gomock.Controller) *MockWebhookRepository {
+	mock := &MockWebhookRepository{ctrl: ctrl}
+	mock.recorder = &MockWebhookRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookRepository) EXPECT() *MockWebhookRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockWebhookRepository) Create(ctx context.Context, w *database.Webhook) (*database.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, w)
+	ret0, _ := ret[0].(*database.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockWebhookRepositoryMockRecorder) Create(ctx, w any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockWebhookRepository)(nil).Create), ctx, w)
+}
+
+// Delete mocks base method.
+func (m *MockWebhookRepository) Delete(ctx context.Context, workspace, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, workspace, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockWebhookRepositoryMockRecorder) Delete(ctx, workspace, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWebhookRepository)(nil).Delete), ctx, workspace, id)
+}
+
+// Deliveries mocks base method.
+func (m *MockWebhookRepository) Deliveries(ctx context.Context, webhookID int64, limit int) ([]*database.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Deliveries", ctx, webhookID, limit)
+	ret0, _ := ret[0].([]*database.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Deliveries indicates an expected call of Deliveries.
+func (mr *MockWebhookRepositoryMockRecorder) Deliveries(ctx, webhookID, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deliveries", reflect.TypeOf((*MockWebhookRepository)(nil).Deliveries), ctx, webhookID, limit)
+}
+
+// EventDeliveries mocks base method.
+func (m *MockWebhookRepository) EventDeliveries(ctx context.Context, eventID string) ([]*database.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EventDeliveries", ctx, eventID)
+	ret0, _ := ret[0].([]*database.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EventDeliveries indicates an expected call of EventDeliveries.
+func (mr *MockWebhookRepositoryMockRecorder) EventDeliveries(ctx, eventID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventDeliveries", reflect.TypeOf((*MockWebhookRepository)(nil).EventDeliveries), ctx, eventID)
+}
+
+// Get mocks base method.
+func (m *MockWebhookRepository) Get(ctx context.Context, workspace, id int64) (*database.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, workspace, id)
+	ret0, _ := ret[0].(*database.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockWebhookRepositoryMockRecorder) Get(ctx, workspace, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockWebhookRepository)(nil).Get), ctx, workspace, id)
+}
+
+// List mocks base method.
+func (m *MockWebhookRepository) List(ctx context.Context, workspace int64) ([]*database.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, workspace)
+	ret0, _ := ret[0].([]*database.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWebhookRepositoryMockRecorder) List(ctx, workspace any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWebhookRepository)(nil).List), ctx, workspace)
+}
+
+// ListForEvent mocks base method.
+func (m *MockWebhookRepository) ListForEvent(ctx context.Context, workspace int64, event string) ([]*database.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListForEvent", ctx, workspace, event)
+	ret0, _ := ret[0].([]*database.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListForEvent indicates an expected call of ListForEvent.
+func (mr *MockWebhookRepositoryMockRecorder) ListForEvent(ctx, workspace, event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListForEvent", reflect.TypeOf((*MockWebhookRepository)(nil).ListForEvent), ctx, workspace, event)
+}
+
+// LogDelivery mocks base method.
+func (m *MockWebhookRepository) LogDelivery(ctx context.Context, d *database.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogDelivery", ctx, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LogDelivery indicates an expected call of LogDelivery.
+func (mr *MockWebhookRepositoryMockRecorder) LogDelivery(ctx, d any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogDelivery", reflect.TypeOf((*MockWebhookRepository)(nil).LogDelivery), ctx, d)
+}
@@ -0,0 +1,161 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/database/workspace_repository.go
+//
+// Generated by this command:
+//
+//	mockgen -source=internal/database/workspace_repository.go -destination=internal/service/servicetest/workspace_repo_mock.go -package=servicetest
+//
+
+// Package servicetest is a generated GoMock package.
+package servicetest
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	database "github.com/finlleyl/shorty_reborn/internal/database"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockWorkspaceRepository is a mock of WorkspaceRepository interface.
+type MockWorkspaceRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWorkspaceRepositoryMockRecorder
+	isgomock struct{}
+}
+
+// MockWorkspaceRepositoryMockRecorder is the mock recorder for MockWorkspaceRepository.
+type MockWorkspaceRepositoryMockRecorder struct {
+	mock *MockWorkspaceRepository
+}
+
+// NewMockWorkspaceRepository creates a new mock instance.
+func NewMockWorkspaceRepository(ctrl *gomock.Controller) *MockWorkspaceRepository {
+	mock := &MockWorkspaceRepository{ctrl: ctrl}
+	mock.recorder = &MockWorkspaceRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWorkspaceRepository) EXPECT() *MockWorkspaceRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ByKey mocks base method.
+func (m *MockWorkspaceRepository) ByKey(ctx context.Context, keyHash string) (*database.KeyOwner, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ByKey", ctx, keyHash)
+	ret0, _ := ret[0].(*database.KeyOwner)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ByKey indicates an expected call of ByKey.
+func (mr *MockWorkspaceRepositoryMockRecorder) ByKey(ctx, keyHash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ByKey", reflect.TypeOf((*MockWorkspaceRepository)(nil).ByKey), ctx, keyHash)
+}
+
+// ConsumeClick mocks base method.
+func (m *MockWorkspaceRepository) ConsumeClick(ctx context.Context, id int64, month time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeClick", ctx, id, month)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConsumeClick indicates an expected call of ConsumeClick.
+func (mr *MockWorkspaceRepositoryMockRecorder) ConsumeClick(ctx, id, month any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeClick", reflect.TypeOf((*MockWorkspaceRepository)(nil).ConsumeClick), ctx, id, month)
+}
+
+// CountLinks mocks base method.
+func (m *MockWorkspaceRepository) CountLinks(ctx context.Context, id int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountLinks", ctx, id)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountLinks indicates an expected call of CountLinks.
+func (mr *MockWorkspaceRepositoryMockRecorder) CountLinks(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountLinks", reflect.TypeOf((*MockWorkspaceRepository)(nil).CountLinks), ctx, id)
+}
+
+// CreateKey mocks base method.
+func (m *MockWorkspaceRepository) CreateKey(ctx context.Context, k *database.APIKey) (*database.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateKey", ctx, k)
+	ret0, _ := ret[0].(*database.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateKey indicates an expected call of CreateKey.
+func (mr *MockWorkspaceRepositoryMockRecorder) CreateKey(ctx, k any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateKey", reflect.TypeOf((*MockWorkspaceRepository)(nil).CreateKey), ctx, k)
+}
+
+// DeleteKey mocks base method.
+func (m *MockWorkspaceRepository) DeleteKey(ctx context.Context, userID, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteKey", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteKey indicates an expected call of DeleteKey.
+func (mr *MockWorkspaceRepositoryMockRecorder) DeleteKey(ctx, userID, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteKey", reflect.TypeOf((*MockWorkspaceRepository)(nil).DeleteKey), ctx, userID, id)
+}
+
+// Get mocks base method.
+func (m *MockWorkspaceRepository) Get(ctx context.Context, id int64) (*database.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*database.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockWorkspaceRepositoryMockRecorder) Get(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockWorkspaceRepository)(nil).Get), ctx, id)
+}
+
+// ListKeys mocks base method.
+func (m *MockWorkspaceRepository) ListKeys(ctx context.Context, userID int64) ([]*database.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListKeys", ctx, userID)
+	ret0, _ := ret[0].([]*database.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListKeys indicates an expected call of ListKeys.
+func (mr *MockWorkspaceRepositoryMockRecorder) ListKeys(ctx, userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListKeys", reflect.TypeOf((*MockWorkspaceRepository)(nil).ListKeys), ctx, userID)
+}
+
+// Upsert mocks base method.
+func (m *MockWorkspaceRepository) Upsert(ctx context.Context, w *database.Workspace, keyHashes []string) (*database.Workspace, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, w, keyHashes)
+	ret0, _ := ret[0].(*database.Workspace)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *MockWorkspaceRepositoryMockRecorder) Upsert(ctx, w, keyHashes any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockWorkspaceRepository)(nil).Upsert), ctx, w, keyHashes)
+}
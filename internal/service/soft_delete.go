@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// WithDeleteGrace sets how long deleted links can be restored. During the
+// grace period their aliases are not given to new links. Zero disables
+// restoring.
+func WithDeleteGrace(d time.Duration) Option {
+	return func(s *urlService) {
+		s.deleteGrace = d
+	}
+}
+
+func (s *urlService) Restore(ctx context.Context, domain, alias string) (*URL, error) {
+	alias = s.canonicalAlias(alias)
+
+	domain, err := s.scope(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	if s.deleteGrace <= 0 {
+		return nil, fmt.Errorf("restore: %w", ErrURLNotFound)
+	}
+
+	workspace := ActorFromContext(ctx).Workspace
+	events, err := s.outboxEvents(EventLinkRestored, workspace, EventLink{Domain: domain, Alias: alias}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+
+	// The link quota is checked by the repository in the transaction that
+	// restores the link, the same limit Create enforces.
+	u, err := s.repo.Restore(ctx, workspace, domain, alias, time.Now().Add(-s.deleteGrace), s.workspaces != nil, events...)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			return nil, fmt.Errorf("restore: %w", ErrURLNotFound)
+		case errors.Is(err, database.ErrAliasInUse):
+			return nil, fmt.Errorf("restore: %w", ErrAliasExists)
+		default:
+			return nil, fmt.Errorf("restore: %w", err)
+		}
+	}
+
+	s.emit(EventLinkRestored, workspace, eventLink(u), nil)
+
+	return toURL(u), nil
+}
+
+// Purger permanently removes links whose grace period has expired.
+type Purger struct {
+	repo     database.URLRepository
+	logger   *zap.SugaredLogger
+	grace    time.Duration
+	interval time.Duration
+}
+
+func NewPurger(repo database.URLRepository, logger *zap.SugaredLogger, grace, interval time.Duration) *Purger {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	return &Purger{
+		repo:     repo,
+		logger:   logger,
+		grace:    grace,
+		interval: interval,
+	}
+}
+
+// Run purges expired links until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.repo.Purge(ctx, time.Now().Add(-p.grace))
+		if err != nil {
+			p.logger.Errorw("failed to purge deleted links", "error", err)
+		} else if n > 0 {
+			p.logger.Infow("purged deleted links", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestCreate_RecentlyDeletedAlias(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithDeleteGrace(time.Hour))
+
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+	repo.EXPECT().
+		DeletedSince(ctx, database.AnyWorkspace, "", "promo", gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int64, _, _ string, since time.Time) (bool, error) {
+			require.WithinDuration(t, time.Now().Add(-time.Hour), since, time.Minute)
+			return true, nil
+		})
+
+	_, err := svc.Create(ctx, "https://ok.com", "promo")
+	require.ErrorIs(t, err, service.ErrAliasExists)
+}
+
+func TestRestore(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithDeleteGrace(time.Hour))
+
+	t.Run("success", func(t *testing.T) {
+		repo.EXPECT().
+			Restore(ctx, service.DefaultWorkspace, "", "promo", gomock.Any(), false).
+			Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+
+		u, err := svc.Restore(ctx, "", "promo")
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", u.OrigURL)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo.EXPECT().Restore(ctx, service.DefaultWorkspace, "", "gone", gomock.Any(), false).Return(nil, database.ErrNotFound)
+
+		_, err := svc.Restore(ctx, "", "gone")
+		require.ErrorIs(t, err, service.ErrURLNotFound)
+	})
+
+	t.Run("alias reused", func(t *testing.T) {
+		repo.EXPECT().Restore(ctx, service.DefaultWorkspace, "", "promo", gomock.Any(), false).Return(nil, database.ErrAliasInUse)
+
+		_, err := svc.Restore(ctx, "", "promo")
+		require.ErrorIs(t, err, service.ErrAliasExists)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, err := service.NewURLService(repo).Restore(ctx, "", "promo")
+		require.ErrorIs(t, err, service.ErrURLNotFound)
+	})
+}
+
+func TestPurger(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	repo.EXPECT().
+		Purge(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, before time.Time) (int64, error) {
+			require.WithinDuration(t, time.Now().Add(-24*time.Hour), before, time.Minute)
+			cancel()
+			return 2, nil
+		})
+
+	require.NoError(t, service.NewPurger(repo, zap.NewNop().Sugar(), 24*time.Hour, time.Hour).Run(ctx))
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+const (
+	maxVariants   = 10
+	maxWeight     = 1000
+	defaultWeight = 1
+	// statsDays is the number of days, today included, that Stats breaks
+	// clicks down by.
+	statsDays = 30
+)
+
+var (
+	ErrInvalidVariant    = errors.New("invalid variant")
+	ErrAnalyticsDisabled = errors.New("click analytics is disabled")
+)
+
+// Variant is one weighted destination of an A/B split link. Weight
+// defaults to 1.
+type Variant = database.Variant
+
+type VariantStats struct {
+	Name   string
+	URL    string
+	Weight int
+	Clicks int64
+}
+
+// DailyClicks is the number of clicks on one UTC day.
+type DailyClicks = database.DailyClicks
+
+type Stats struct {
+	Alias    string
+	Clicks   int64
+	Variants []VariantStats
+	// Daily has the clicks of each of the last statsDays days, oldest
+	// first, including days without clicks.
+	Daily []DailyClicks
+}
+
+// WithClicks enables click analytics: every followed link is recorded,
+// together with the variant that was served.
+func WithClicks(clicks database.ClickRepository) Option {
+	return func(s *urlService) {
+		s.clicks = clicks
+	}
+}
+
+// WithVariants splits the link's traffic between weighted destinations.
+// Targeting rules still take precedence over the split.
+func WithVariants(variants []Variant) CreateOption {
+	return func(o *createOptions) {
+		o.variants = variants
+	}
+}
+
+var variantNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+func normalizeVariants(variants []Variant) ([]Variant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	if len(variants) < 2 || len(variants) > maxVariants {
+		return nil, fmt.Errorf("%w: between 2 and %d variants are required", ErrInvalidVariant, maxVariants)
+	}
+
+	seen := make(map[string]bool, len(variants))
+	out := make([]Variant, 0, len(variants))
+	for _, v := range variants {
+		if !variantNameRegexp.MatchString(v.Name) {
+			return nil, fmt.Errorf("%w: invalid name %q", ErrInvalidVariant, v.Name)
+		}
+		if seen[v.Name] {
+			return nil, fmt.Errorf("%w: duplicate name %q", ErrInvalidVariant, v.Name)
+		}
+		seen[v.Name] = true
+
+		if v.Weight == 0 {
+			v.Weight = defaultWeight
+		}
+		if v.Weight < 0 || v.Weight > maxWeight {
+			return nil, fmt.Errorf("%w %q: weight must be between 1 and %d", ErrInvalidVariant, v.Name, maxWeight)
+		}
+
+		target, err := url.ParseRequestURI(v.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w: %s", ErrInvalidVariant, v.Name, ErrInvalidURL, err)
+		}
+		v.URL = target.String()
+
+		out = append(out, v)
+	}
+
+	return out, nil
+}
+
+// pickVariant keeps returning visitors on the variant named by their sticky
+// cookie. New visitors are assigned by a hash of the link and their IP, so
+// that clients without cookies stay sticky too, or at random when the IP is
+// unknown.
+func pickVariant(linkID int64, variants []Variant, v Visitor) *Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	if v.Variant != "" {
+		for i := range variants {
+			if variants[i].Name == v.Variant {
+				return &variants[i]
+			}
+		}
+	}
+
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+
+	var n int
+	if v.IP != "" {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d|%s", linkID, v.IP)
+		n = int(h.Sum64() % uint64(total))
+	} else {
+		n = rand.IntN(total)
+	}
+
+	for i := range variants {
+		n -= variants[i].Weight
+		if n < 0 {
+			return &variants[i]
+		}
+	}
+
+	return &variants[len(variants)-1]
+}
+
+// record stores a click. Analytics are best effort: a failed insert must not
+// break the redirect, so the error is dropped.
+func (s *urlService) record(ctx context.Context, u *database.URL, variant string) {
+	if s.clicks == nil {
+		return
+	}
+
+	_ = s.clicks.Record(ctx, &database.Click{URLID: u.ID, Variant: variant})
+}
+
+func (s *urlService) Stats(ctx context.Context, domain, alias string) (*Stats, error) {
+	alias = s.canonicalAlias(alias)
+
+	if s.clicks == nil {
+		return nil, fmt.Errorf("stats: %w", ErrAnalyticsDisabled)
+	}
+
+	domain, err := s.scope(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+
+	u, err := s.repo.Get(ctx, ActorFromContext(ctx).Workspace, domain, alias)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, fmt.Errorf("stats: %w", ErrURLNotFound)
+		}
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+
+	counts, err := s.clicks.CountByVariant(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+
+	byVariant := make(map[string]int64, len(counts))
+	stats := &Stats{Alias: u.Alias}
+	for _, c := range counts {
+		byVariant[c.Variant] = c.Clicks
+		stats.Clicks += c.Clicks
+	}
+
+	for _, v := range u.Variants {
+		stats.Variants = append(stats.Variants, VariantStats{
+			Name:   v.Name,
+			URL:    v.URL,
+			Weight: v.Weight,
+			Clicks: byVariant[v.Name],
+		})
+		delete(byVariant, v.Name)
+	}
+	// Clicks on variants that have since been removed from the link, or
+	// served before the split was configured, are still reported.
+	for _, c := range counts {
+		if n, ok := byVariant[c.Variant]; ok && c.Variant != "" {
+			stats.Variants = append(stats.Variants, VariantStats{Name: c.Variant, Clicks: n})
+		}
+	}
+
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), now.Day()-(statsDays-1), 0, 0, 0, 0, time.UTC)
+	days, err := s.clicks.CountByDay(ctx, u.ID, since)
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+
+	byDay := make(map[time.Time]int64, len(days))
+	for _, d := range days {
+		byDay[d.Day.UTC()] = d.Clicks
+	}
+	for i := range statsDays {
+		day := since.AddDate(0, 0, i)
+		stats.Daily = append(stats.Daily, DailyClicks{Day: day, Clicks: byDay[day]})
+	}
+
+	return stats, nil
+}
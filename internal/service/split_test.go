@@ -0,0 +1,227 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func splitLink() *database.URL {
+	return &database.URL{
+		ID:    7,
+		Alias: "promo",
+		URL:   "https://example.com",
+		Rules: database.TargetRules{{Platform: "ios", URL: "https://apps.apple.com/app/id1"}},
+		Variants: database.Variants{
+			{Name: "a", URL: "https://example.com/a", Weight: 1},
+			{Name: "b", URL: "https://example.com/b", Weight: 3},
+		},
+	}
+}
+
+func TestResolve_Split(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	clicks := servicetest.NewMockClickRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithClicks(clicks))
+
+	t.Run("records the served variant", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil)
+		clicks.EXPECT().
+			Record(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, c *database.Click) error {
+				require.Equal(t, int64(7), c.URLID)
+				require.Contains(t, []string{"a", "b"}, c.Variant)
+				return nil
+			})
+
+		out, err := svc.Resolve(ctx, "promo", service.Visitor{IP: "10.0.0.1"})
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/"+out.Variant, out.OrigURL)
+	})
+
+	t.Run("sticky by ip", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil).Times(5)
+		clicks.EXPECT().Record(ctx, gomock.Any()).Return(nil).Times(5)
+
+		first, err := svc.Resolve(ctx, "promo", service.Visitor{IP: "192.0.2.10"})
+		require.NoError(t, err)
+		for range 4 {
+			out, err := svc.Resolve(ctx, "promo", service.Visitor{IP: "192.0.2.10"})
+			require.NoError(t, err)
+			require.Equal(t, first.Variant, out.Variant)
+		}
+	})
+
+	t.Run("sticky by cookie", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil).Times(2)
+		clicks.EXPECT().Record(ctx, gomock.Any()).Return(nil).Times(2)
+
+		for _, name := range []string{"a", "b"} {
+			out, err := svc.Resolve(ctx, "promo", service.Visitor{IP: "192.0.2.10", Variant: name})
+			require.NoError(t, err)
+			require.Equal(t, name, out.Variant)
+			require.Equal(t, "https://example.com/"+name, out.OrigURL)
+		}
+	})
+
+	t.Run("unknown cookie is reassigned", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil)
+		clicks.EXPECT().Record(ctx, gomock.Any()).Return(nil)
+
+		out, err := svc.Resolve(ctx, "promo", service.Visitor{Variant: "removed"})
+		require.NoError(t, err)
+		require.Contains(t, []string{"a", "b"}, out.Variant)
+	})
+
+	t.Run("rules take precedence", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil)
+		clicks.EXPECT().
+			Record(ctx, &database.Click{URLID: 7}).
+			Return(nil)
+
+		out, err := svc.Resolve(ctx, "promo", service.Visitor{UserAgent: iPhoneUA, Variant: "a"})
+		require.NoError(t, err)
+		require.Empty(t, out.Variant)
+		require.Equal(t, "https://apps.apple.com/app/id1", out.OrigURL)
+	})
+
+	t.Run("failed recording does not break the redirect", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil)
+		clicks.EXPECT().Record(ctx, gomock.Any()).Return(errors.New("db down"))
+
+		_, err := svc.Resolve(ctx, "promo", service.Visitor{})
+		require.NoError(t, err)
+	})
+}
+
+func TestResolve_SplitWeights(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	const visitors = 2000
+	repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "promo").Return(splitLink(), nil).Times(visitors)
+
+	served := map[string]int{}
+	for i := range visitors {
+		out, err := svc.Resolve(ctx, "promo", service.Visitor{IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256)})
+		require.NoError(t, err)
+		served[out.Variant]++
+	}
+
+	// b carries three quarters of the weight.
+	require.InDelta(t, 0.75, float64(served["b"])/visitors, 0.05)
+}
+
+func TestCreate_Variants(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	t.Run("defaults weights", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, database.Variants{
+					{Name: "a", URL: "https://example.com/a", Weight: 1},
+					{Name: "b", URL: "https://example.com/b", Weight: 2},
+				}, u.Variants)
+				return u, nil
+			})
+
+		_, err := svc.Create(ctx, "https://example.com", "promo", service.WithVariants([]service.Variant{
+			{Name: "a", URL: "https://example.com/a"},
+			{Name: "b", URL: "https://example.com/b", Weight: 2},
+		}))
+		require.NoError(t, err)
+	})
+
+	ok := service.Variant{Name: "a", URL: "https://example.com/a"}
+	invalid := map[string][]service.Variant{
+		"single":    {ok},
+		"duplicate": {ok, ok},
+		"name":      {ok, {Name: "b c", URL: "https://example.com/b"}},
+		"weight":    {ok, {Name: "b", URL: "https://example.com/b", Weight: 1001}},
+		"negative":  {ok, {Name: "b", URL: "https://example.com/b", Weight: -1}},
+		"url":       {ok, {Name: "b", URL: "not a url"}},
+	}
+	for name, variants := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Create(ctx, "https://example.com", "promo", service.WithVariants(variants))
+			require.ErrorIs(t, err, service.ErrInvalidVariant)
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	clicks := servicetest.NewMockClickRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithClicks(clicks))
+
+	t.Run("per variant", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "promo").Return(splitLink(), nil)
+		clicks.EXPECT().CountByVariant(ctx, int64(7)).Return([]database.VariantClicks{
+			{Variant: "", Clicks: 2},
+			{Variant: "b", Clicks: 5},
+			{Variant: "old", Clicks: 1},
+		}, nil)
+		now := time.Now().UTC()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		clicks.EXPECT().
+			CountByDay(ctx, int64(7), today.AddDate(0, 0, -29)).
+			Return([]database.DailyClicks{{Day: today.AddDate(0, 0, -1), Clicks: 6}, {Day: today, Clicks: 2}}, nil)
+
+		stats, err := svc.Stats(ctx, "", "promo")
+		require.NoError(t, err)
+		require.Len(t, stats.Daily, 30)
+		require.Equal(t, service.DailyClicks{Day: today.AddDate(0, 0, -29)}, stats.Daily[0])
+		require.Equal(t, []service.DailyClicks{{Day: today.AddDate(0, 0, -1), Clicks: 6}, {Day: today, Clicks: 2}}, stats.Daily[28:])
+
+		stats.Daily = nil
+		require.Equal(t, &service.Stats{
+			Alias:  "promo",
+			Clicks: 8,
+			Variants: []service.VariantStats{
+				{Name: "a", URL: "https://example.com/a", Weight: 1},
+				{Name: "b", URL: "https://example.com/b", Weight: 3, Clicks: 5},
+				{Name: "old", Clicks: 1},
+			},
+		}, stats)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, "", "nope").Return(nil, database.ErrNotFound)
+
+		_, err := svc.Stats(ctx, "", "nope")
+		require.ErrorIs(t, err, service.ErrURLNotFound)
+	})
+
+	t.Run("analytics disabled", func(t *testing.T) {
+		_, err := service.NewURLService(repo).Stats(ctx, "", "promo")
+		require.ErrorIs(t, err, service.ErrAnalyticsDisabled)
+	})
+}
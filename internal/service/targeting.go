@@ -0,0 +1,276 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+const maxRules = 20
+
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Rule sends visitors matching all of its non-empty conditions to Rule.URL.
+// Platform is one of the Platform* constants, Language a BCP 47 tag matched
+// against the visitor's preferred language ("pt" matches "pt-BR", "pt-BR"
+// only matches itself) and Country an ISO 3166-1 alpha-2 code.
+type Rule = database.TargetRule
+
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformWindows = "windows"
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+	// PlatformMobile matches iOS and Android, PlatformDesktop everything else.
+	PlatformMobile  = "mobile"
+	PlatformDesktop = "desktop"
+)
+
+// Visitor holds the request attributes links are resolved for.
+type Visitor struct {
+	Host           string
+	IP             string
+	UserAgent      string
+	AcceptLanguage string
+	// Query is the raw query string of the short link request.
+	Query string
+	// SkipPreview is set once the visitor has seen the preview
+	// interstitial and chose to continue.
+	SkipPreview bool
+	// Variant is the split variant the visitor was served before, taken
+	// from the sticky cookie.
+	Variant string
+}
+
+// CountryLookup resolves an IP address to an ISO 3166-1 alpha-2 country
+// code. geoip.Reader implements it.
+type CountryLookup interface {
+	Country(ip net.IP) (string, error)
+}
+
+// WithGeoIP enables country conditions in targeting rules. Without it such
+// rules never match.
+func WithGeoIP(geo CountryLookup) Option {
+	return func(s *urlService) {
+		s.geo = geo
+	}
+}
+
+// WithRules attaches an ordered list of targeting rules to the link. The
+// first matching rule wins; the link URL is used when none match.
+func WithRules(rules []Rule) CreateOption {
+	return func(o *createOptions) {
+		o.rules = rules
+	}
+}
+
+var countryRegexp = regexp.MustCompile(`^[A-Z]{2}$`)
+
+func normalizeRules(rules []Rule) ([]Rule, error) {
+	if len(rules) > maxRules {
+		return nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidRule, maxRules)
+	}
+
+	out := make([]Rule, 0, len(rules))
+	for i, r := range rules {
+		r.Platform = strings.ToLower(strings.TrimSpace(r.Platform))
+		r.Country = strings.ToUpper(strings.TrimSpace(r.Country))
+		r.Language = strings.TrimSpace(r.Language)
+
+		switch r.Platform {
+		case "", PlatformIOS, PlatformAndroid, PlatformWindows, PlatformMacOS, PlatformLinux, PlatformMobile, PlatformDesktop:
+		default:
+			return nil, fmt.Errorf("%w %d: unknown platform %q", ErrInvalidRule, i, r.Platform)
+		}
+		if r.Country != "" && !countryRegexp.MatchString(r.Country) {
+			return nil, fmt.Errorf("%w %d: country must be an ISO 3166-1 alpha-2 code", ErrInvalidRule, i)
+		}
+		if r.Language != "" {
+			tag, err := language.Parse(r.Language)
+			if err != nil {
+				return nil, fmt.Errorf("%w %d: invalid language %q", ErrInvalidRule, i, r.Language)
+			}
+			r.Language = tag.String()
+		}
+		if r.Platform == "" && r.Country == "" && r.Language == "" {
+			return nil, fmt.Errorf("%w %d: at least one condition is required", ErrInvalidRule, i)
+		}
+
+		target, err := url.ParseRequestURI(r.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %w: %s", ErrInvalidRule, i, ErrInvalidURL, err)
+		}
+		r.URL = target.String()
+
+		out = append(out, r)
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	return out, nil
+}
+
+// target picks the destination for v: the URL of the first matching rule,
+// or fallback.
+func (s *urlService) target(rules []Rule, fallback string, v Visitor) string {
+	if len(rules) == 0 {
+		return fallback
+	}
+
+	platform := detectPlatform(v.UserAgent)
+	lang := preferredLanguage(v.AcceptLanguage)
+	country, countryLooked := "", false
+
+	match := func(r Rule) languageMatch {
+		if r.Platform != "" && !platformMatches(r.Platform, platform) {
+			return languageMismatch
+		}
+		m := languageExact
+		if r.Language != "" {
+			if m = matchLanguage(r.Language, lang); m == languageMismatch {
+				return languageMismatch
+			}
+		}
+		if r.Country != "" {
+			// The lookup is deferred until a rule actually needs it.
+			if !countryLooked {
+				country = s.country(v.IP)
+				countryLooked = true
+			}
+			if r.Country != country {
+				return languageMismatch
+			}
+		}
+
+		return m
+	}
+
+	for i, r := range rules {
+		m := match(r)
+		if m == languageMismatch {
+			continue
+		}
+		if m == languageBase {
+			// A rule for the visitor's exact regional variant wins over a
+			// rule for the base language, whichever is listed first.
+			for _, later := range rules[i+1:] {
+				if later.Language != "" && match(later) == languageExact {
+					return later.URL
+				}
+			}
+		}
+
+		return r.URL
+	}
+
+	return fallback
+}
+
+func (s *urlService) country(ip string) string {
+	if s.geo == nil {
+		return ""
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	country, err := s.geo.Country(parsed)
+	if err != nil {
+		return ""
+	}
+
+	return country
+}
+
+func detectPlatform(ua string) string {
+	ua = strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return PlatformIOS
+	case strings.Contains(ua, "android"):
+		return PlatformAndroid
+	case strings.Contains(ua, "windows"):
+		return PlatformWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return PlatformMacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"), strings.Contains(ua, "cros"):
+		return PlatformLinux
+	default:
+		return ""
+	}
+}
+
+func platformMatches(want, got string) bool {
+	switch want {
+	case PlatformMobile:
+		return got == PlatformIOS || got == PlatformAndroid
+	case PlatformDesktop:
+		return got == PlatformWindows || got == PlatformMacOS || got == PlatformLinux
+	default:
+		return want == got
+	}
+}
+
+func preferredLanguage(header string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return language.Und
+	}
+
+	return tags[0]
+}
+
+// languageMatch tells how closely a rule's language matches the visitor's.
+type languageMatch int
+
+const (
+	languageMismatch languageMatch = iota
+	// languageBase is a rule for the base language matching any region.
+	languageBase
+	// languageExact is a rule naming the visitor's region, or any rule
+	// when the visitor sent no region.
+	languageExact
+)
+
+func matchLanguage(want string, got language.Tag) languageMatch {
+	if got == language.Und {
+		return languageMismatch
+	}
+
+	tag, err := language.Parse(want)
+	if err != nil {
+		return languageMismatch
+	}
+
+	wantBase, _ := tag.Base()
+	gotBase, _ := got.Base()
+	if wantBase != gotBase {
+		return languageMismatch
+	}
+
+	wantRegion, wantConf := tag.Region()
+	gotRegion, gotConf := got.Region()
+	switch {
+	case wantConf == language.Exact && wantRegion == gotRegion:
+		return languageExact
+	case wantConf == language.Exact:
+		return languageMismatch
+	case gotConf != language.Exact:
+		return languageExact
+	default:
+		return languageBase
+	}
+}
@@ -0,0 +1,183 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0"
+)
+
+type fakeGeo map[string]string
+
+func (g fakeGeo) Country(ip net.IP) (string, error) {
+	return g[ip.String()], nil
+}
+
+func TestResolve_Targeting(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithGeoIP(fakeGeo{"81.2.69.142": "GB", "1.2.3.4": "DE"}))
+
+	link := &database.URL{
+		Alias: "app",
+		URL:   "https://example.com",
+		Rules: database.TargetRules{
+			{Platform: "ios", URL: "https://apps.apple.com/app/id1"},
+			{Platform: "android", URL: "https://play.google.com/store/apps/details?id=app"},
+			{Country: "GB", Language: "en", URL: "https://example.co.uk"},
+			{Language: "pt-BR", URL: "https://example.com.br"},
+			{Language: "de", URL: "https://example.de"},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		visitor service.Visitor
+		want    string
+	}{
+		{"ios", service.Visitor{UserAgent: iPhoneUA}, "https://apps.apple.com/app/id1"},
+		{"android", service.Visitor{UserAgent: androidUA}, "https://play.google.com/store/apps/details?id=app"},
+		{"country and language", service.Visitor{UserAgent: desktopUA, IP: "81.2.69.142", AcceptLanguage: "en-GB,en;q=0.8"}, "https://example.co.uk"},
+		{"country without language", service.Visitor{UserAgent: desktopUA, IP: "81.2.69.142", AcceptLanguage: "fr"}, "https://example.com"},
+		{"exact region", service.Visitor{AcceptLanguage: "pt-BR"}, "https://example.com.br"},
+		{"other region", service.Visitor{AcceptLanguage: "pt-PT"}, "https://example.com"},
+		{"base language", service.Visitor{AcceptLanguage: "de-AT, en;q=0.5"}, "https://example.de"},
+		{"preferred language only", service.Visitor{AcceptLanguage: "en;q=0.5, de;q=0.4"}, "https://example.com"},
+		{"fallback", service.Visitor{UserAgent: desktopUA}, "https://example.com"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "app").Return(link, nil)
+
+			out, err := svc.Resolve(ctx, "app", tc.visitor)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, out.OrigURL)
+		})
+	}
+}
+
+func TestResolve_TargetingPrefersExactLanguage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	link := &database.URL{
+		Alias: "app",
+		URL:   "https://example.com",
+		Rules: database.TargetRules{
+			{Language: "en", URL: "https://example.com/en"},
+			{Language: "en-GB", URL: "https://example.co.uk"},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		visitor service.Visitor
+		want    string
+	}{
+		{"exact region", service.Visitor{AcceptLanguage: "en-GB"}, "https://example.co.uk"},
+		{"other region", service.Visitor{AcceptLanguage: "en-US"}, "https://example.com/en"},
+		{"base language", service.Visitor{AcceptLanguage: "en"}, "https://example.com/en"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "app").Return(link, nil)
+
+			out, err := svc.Resolve(ctx, "app", tc.visitor)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, out.OrigURL)
+		})
+	}
+}
+
+func TestResolve_TargetingMobileDesktop(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	// Without a GeoIP database country rules never match.
+	svc := service.NewURLService(repo)
+
+	link := &database.URL{
+		Alias: "app",
+		URL:   "https://example.com",
+		Rules: database.TargetRules{
+			{Country: "DE", URL: "https://example.de"},
+			{Platform: "mobile", URL: "https://m.example.com"},
+			{Platform: "desktop", URL: "https://www.example.com"},
+		},
+	}
+
+	repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "app").Return(link, nil).Times(3)
+
+	out, err := svc.Resolve(ctx, "app", service.Visitor{UserAgent: androidUA, IP: "1.2.3.4"})
+	require.NoError(t, err)
+	require.Equal(t, "https://m.example.com", out.OrigURL)
+
+	out, err = svc.Resolve(ctx, "app", service.Visitor{UserAgent: desktopUA})
+	require.NoError(t, err)
+	require.Equal(t, "https://www.example.com", out.OrigURL)
+
+	out, err = svc.Resolve(ctx, "app", service.Visitor{UserAgent: "curl/8.0"})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", out.OrigURL)
+}
+
+func TestCreate_Rules(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	t.Run("normalizes rules", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "app").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, database.TargetRules{
+					{Platform: "ios", Country: "US", Language: "en-US", URL: "https://apps.apple.com/app"},
+				}, u.Rules)
+				return u, nil
+			})
+
+		_, err := svc.Create(ctx, "https://example.com", "app", service.WithRules([]service.Rule{
+			{Platform: "iOS", Country: "us", Language: "en-us", URL: "https://apps.apple.com/app"},
+		}))
+		require.NoError(t, err)
+	})
+
+	invalid := map[string]service.Rule{
+		"platform":      {Platform: "symbian", URL: "https://ok.com"},
+		"country":       {Country: "USA", URL: "https://ok.com"},
+		"language":      {Language: "not a language", URL: "https://ok.com"},
+		"no conditions": {URL: "https://ok.com"},
+		"url":           {Platform: "ios", URL: "not a url"},
+	}
+	for name, rule := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.Create(ctx, "https://example.com", "app", service.WithRules([]service.Rule{rule}))
+			require.ErrorIs(t, err, service.ErrInvalidRule)
+		})
+	}
+}
@@ -2,77 +2,402 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/url"
 	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/finlleyl/shorty_reborn/internal/database"
 )
 
 var (
-	ErrInvalidURL   = errors.New("invalid URL")
-	ErrInvalidAlias = errors.New("invalid alias")
-	ErrAliasExists  = errors.New("alias already exists")
-	ErrURLNotFound  = database.ErrNotFound
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrInvalidAlias     = errors.New("invalid alias")
+	ErrAliasExists      = errors.New("alias already exists")
+	ErrURLNotFound      = database.ErrNotFound
+	ErrInvalidPassword  = errors.New("invalid password")
+	ErrPasswordRequired = errors.New("password required")
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrTooManyAttempts  = errors.New("too many attempts")
+	ErrInvalidMaxClicks = errors.New("invalid max clicks")
+	ErrLinkExhausted    = database.ErrExhausted
+	// ErrLinkThrottled is an ErrTooManyAttempts for links that are slowed
+	// down across all visitors; retry after LinkAttemptInterval.
+	ErrLinkThrottled = fmt.Errorf("%w: link is throttled", ErrTooManyAttempts)
 )
 
 type URL struct {
-	Alias   string
-	OrigURL string
+	// Domain is empty for links in the default domain's namespace.
+	Domain    string
+	Alias     string
+	OrigURL   string
+	Protected bool
+	// MaxClicks and ClicksLeft are nil for links without a click limit.
+	MaxClicks    *int64
+	ClicksLeft   *int64
+	Rules        []Rule
+	Variants     []Variant
+	QueryMode    string
+	UTM          UTM
+	Title        string
+	Description  string
+	Tags         []string
+	Metadata     map[string]string
+	Page         *PageMeta
+	ForcePreview bool
+	CreatedAt    time.Time
+	// Variant is the name of the variant served by Resolve or Unlock.
+	Variant string
+	// Reused is set when Create returned an existing link, see WithReuse.
+	Reused bool
 }
 
 type URLService interface {
-	Create(ctx context.Context, url, alias string) (*URL, error)
-	Resolve(ctx context.Context, alias string) (*URL, error)
-	Delete(ctx context.Context, alias string) error
+	Create(ctx context.Context, url, alias string, opts ...CreateOption) (*URL, error)
+	// Get returns the link without following it: no password is checked and
+	// no click is consumed.
+	Get(ctx context.Context, domain, alias string) (*URL, error)
+	// Resolve follows the link found under the visitor's host. Hosts that
+	// are not registered domains resolve in the default namespace. OrigURL of
+	// the result is the destination picked by the link's targeting rules.
+	// It returns ErrPasswordRequired for password-protected links, which can
+	// only be followed through Unlock, ErrPreviewRequired for links that
+	// force the preview interstitial unless the visitor skips it, and
+	// ErrLinkExhausted once a click-limited link has been used up.
+	Resolve(ctx context.Context, alias string, v Visitor) (*URL, error)
+	// Preview returns the link with OrigURL set to the destination the
+	// visitor would be redirected to, without consuming or recording a
+	// click. Password-protected links return ErrPasswordRequired so that
+	// their destination is not disclosed.
+	Preview(ctx context.Context, alias string, v Visitor) (*URL, error)
+	// Unlock resolves a password-protected link. Attempts are limited per
+	// alias and visitor IP, after which ErrTooManyAttempts is returned
+	// until the throttling window expires. Across all visitors a link is
+	// only slowed down: once it took too many failures, attempts faster
+	// than LinkAttemptInterval get ErrLinkThrottled. Links that force the
+	// preview return ErrPreviewRequired like Resolve does, together with
+	// the link as Preview would return it, once the password is verified.
+	Unlock(ctx context.Context, alias, password string, v Visitor) (*URL, error)
+	// Delete soft-deletes the link; it can be restored during the grace
+	// period set with WithDeleteGrace.
+	Delete(ctx context.Context, domain, alias string) error
+	// Restore undeletes a link deleted within the grace period. It returns
+	// ErrURLNotFound when there is none, ErrAliasExists when the alias has
+	// been reused since and ErrQuotaExceeded when the workspace has used up
+	// its link quota.
+	Restore(ctx context.Context, domain, alias string) (*URL, error)
+	// List returns a page of links, optionally only those with a tag.
+	List(ctx context.Context, f ListFilter) ([]*URL, error)
+	// Stats returns the number of clicks on the link, broken down per
+	// variant for split links.
+	Stats(ctx context.Context, domain, alias string) (*Stats, error)
 }
 
 type urlService struct {
-	repo database.URLRepository
+	repo          database.URLRepository
+	domains       database.DomainRepository
+	defaultDomain string
+	geo           CountryLookup
+	clicks        database.ClickRepository
+	pages         *PageWorker
+	webhooks      *WebhookDispatcher
+	outbox        database.OutboxRepository
+	attempts      *attemptLimiter
+	linkAttempts  *attemptLimiter
+	deleteGrace   time.Duration
+	aliases       *AliasPolicy
+	generator     AliasGenerator
+	// caseInsensitive ignores the case of aliases, see
+	// WithCaseInsensitiveAliases.
+	caseInsensitive bool
+	// maxGraphemes is non-zero when Unicode aliases are accepted, see
+	// WithUnicodeAliases.
+	maxGraphemes int
+	workspaces   database.WorkspaceRepository
+}
+
+type Option func(*urlService)
+
+// WithDomains enables custom domains. defaultDomain is the host that serves
+// the default namespace; any other domain has to be registered in domains.
+func WithDomains(domains database.DomainRepository, defaultDomain string) Option {
+	return func(s *urlService) {
+		s.domains = domains
+		s.defaultDomain = normalizeDomain(defaultDomain)
+	}
+}
+
+func NewURLService(r database.URLRepository, opts ...Option) URLService {
+	s := &urlService{
+		repo:         r,
+		attempts:     newAttemptLimiter(maxPasswordAttempts, PasswordAttemptWindow),
+		linkAttempts: newAttemptThrottle(maxLinkPasswordAttempts, PasswordAttemptWindow, LinkAttemptInterval),
+		generator:    &randomAliasGenerator{alphabet: Base64URLAlphabet, length: 6},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-func NewURLService(r database.URLRepository) URLService {
-	return &urlService{repo: r}
+type createOptions struct {
+	password     string
+	maxClicks    int64
+	domain       string
+	rules        []Rule
+	variants     []Variant
+	queryMode    string
+	utm          UTM
+	title        string
+	description  string
+	tags         []string
+	metadata     map[string]string
+	forcePreview bool
+	reuse        bool
 }
 
-func (s *urlService) Create(ctx context.Context, RawURL, alias string) (*URL, error) {
+type CreateOption func(*createOptions)
+
+// WithPassword protects the link with a password. An empty password leaves
+// the link public.
+func WithPassword(password string) CreateOption {
+	return func(o *createOptions) {
+		o.password = password
+	}
+}
+
+// WithMaxClicks makes the link stop resolving after n clicks. Zero means no
+// limit.
+func WithMaxClicks(n int64) CreateOption {
+	return func(o *createOptions) {
+		o.maxClicks = n
+	}
+}
+
+// WithDomain creates the link in the namespace of a registered domain
+// instead of the default one.
+func WithDomain(domain string) CreateOption {
+	return func(o *createOptions) {
+		o.domain = domain
+	}
+}
+
+func (s *urlService) Create(ctx context.Context, RawURL, alias string, opts ...CreateOption) (*URL, error) {
+	var o createOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	parsed, err := url.ParseRequestURI(RawURL)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, err)
 	}
 
-	if alias == "" {
-		alias = generateAlias()
-	} else { 
-		if !isValidAlias(alias) {
-			return nil, ErrInvalidAlias
+	if o.maxClicks < 0 {
+		return nil, fmt.Errorf("%w: must not be negative", ErrInvalidMaxClicks)
+	}
+
+	rules, err := normalizeRules(o.rules)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := normalizeVariants(o.variants)
+	if err != nil {
+		return nil, err
+	}
+
+	queryMode, err := normalizeQueryMode(o.queryMode)
+	if err != nil {
+		return nil, err
+	}
+
+	utm, err := normalizeUTM(o.utm)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := normalizeTags(o.tags)
+	if err != nil {
+		return nil, err
+	}
+
+	title, description, metadata, err := normalizeDetails(o.title, o.description, o.metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var passwordHash string
+	if o.password != "" {
+		passwordHash, err = hashPassword(o.password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	domain, err := s.scope(ctx, o.domain)
+	if err != nil {
+		return nil, err
+	}
+
+	urlHash := destinationHash(parsed)
+	actor := ActorFromContext(ctx)
+	createdBy := actor.ID
+	plain := o.password == "" && o.maxClicks == 0 && len(rules) == 0 && len(variants) == 0 &&
+		queryMode == QueryDrop && utm == (UTM{}) && title == "" && description == "" &&
+		len(tags) == 0 && len(metadata) == 0 && !o.forcePreview
+	if o.reuse && alias == "" && plain && createdBy != AnonymousActor {
+		existing, err := s.repo.FindReusable(ctx, actor.Workspace, domain, urlHash, createdBy)
+		switch {
+		case err == nil:
+			out := toURL(existing)
+			out.Reused = true
+			return out, nil
+		case !errors.Is(err, database.ErrNotFound):
+			return nil, fmt.Errorf("failed to find reusable url: %s", err)
 		}
 	}
 
-	exists, err := s.repo.Exists(ctx, alias)
+	if err := s.checkLinkQuota(ctx, actor.Workspace); err != nil {
+		return nil, err
+	}
+
+	alias = s.canonicalAlias(alias)
+	generated := alias == ""
+	if generated {
+		alias, err = s.generateAlias(ctx, domain)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.validateAlias(alias); err != nil {
+			return nil, err
+		}
+		if err := s.aliases.Check(alias); err != nil {
+			return nil, err
+		}
+		if err := s.checkAliasFree(ctx, domain, alias); err != nil {
+			return nil, err
+		}
+	}
+
+	entity := &database.URL{
+		Domain:       domain,
+		URL:          parsed.String(),
+		PasswordHash: passwordHash,
+		Rules:        rules,
+		Variants:     variants,
+		QueryMode:    queryMode,
+		UTM:          utm,
+		Title:        title,
+		Description:  description,
+		Tags:         tags,
+		Metadata:     metadata,
+		ForcePreview: o.forcePreview,
+		URLHash:      urlHash,
+		CreatedBy:    createdBy,
+		Workspace:    actor.Workspace,
+	}
+	if o.maxClicks > 0 {
+		entity.MaxClicks = &o.maxClicks
+	}
+
+	var u *database.URL
+	for attempt := 1; ; attempt++ {
+		entity.Alias = alias
+		events, err := s.outboxEvents(EventLinkCreated, entity.Workspace, eventLink(entity), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		u, err = s.repo.Save(ctx, entity, events...)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, database.ErrAliasInUse) {
+			return nil, fmt.Errorf("failed to save url: %s", err)
+		}
+		// The alias is taken in another workspace, or was taken meanwhile.
+		// Only an alias the caller chose is reported; a generated one is
+		// replaced.
+		if !generated {
+			return nil, ErrAliasExists
+		}
+		if attempt == maxAliasAttempts {
+			return nil, fmt.Errorf("failed to generate alias: %d candidates taken", maxAliasAttempts)
+		}
+		if alias, err = s.generateAlias(ctx, domain); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.pages != nil {
+		s.pages.Enqueue(u.ID, u.URL)
+	}
+
+	s.emit(EventLinkCreated, entity.Workspace, eventLink(u), nil)
+
+	return toURL(u), nil
+}
+
+// checkAliasFree returns ErrAliasExists when the alias is used in the
+// domain or held for a link deleted within the grace period. Save still
+// catches aliases taken in other workspaces or meanwhile.
+func (s *urlService) checkAliasFree(ctx context.Context, domain, alias string) error {
+	exists, err := s.repo.Exists(ctx, ActorFromContext(ctx).Workspace, domain, alias)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if alias exists: %s", err)
+		return fmt.Errorf("failed to check if alias exists: %s", err)
 	}
 	if exists {
-		return nil, ErrAliasExists
+		return ErrAliasExists
+	}
+	if s.deleteGrace > 0 {
+		// The alias space is shared, so are aliases held for a restore.
+		deleted, err := s.repo.DeletedSince(ctx, database.AnyWorkspace, domain, alias, time.Now().Add(-s.deleteGrace))
+		if err != nil {
+			return fmt.Errorf("failed to check if alias was deleted: %s", err)
+		}
+		if deleted {
+			return fmt.Errorf("%w: recently deleted", ErrAliasExists)
+		}
+	}
+
+	return nil
+}
+
+func (s *urlService) Get(ctx context.Context, domain, alias string) (*URL, error) {
+	alias = s.canonicalAlias(alias)
+
+	domain, err := s.scope(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("get: %w", err)
 	}
 
-	u, err := s.repo.Save(ctx, alias, parsed.String())
+	u, err := s.repo.Get(ctx, ActorFromContext(ctx).Workspace, domain, alias)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save url: %s", err)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, fmt.Errorf("get: %w", ErrURLNotFound)
+		}
+		return nil, fmt.Errorf("get: %w", err)
 	}
 
-	return &URL{
-		Alias:   u.Alias,
-		OrigURL: u.URL,
-	}, nil
+	return toURL(u), nil
 }
 
-func (s *urlService) Resolve(ctx context.Context, alias string) (*URL, error) {
-    u, err := s.repo.Get(ctx, alias)
+func (s *urlService) Resolve(ctx context.Context, alias string, v Visitor) (*URL, error) {
+    alias = s.canonicalAlias(alias)
+
+    domain, err := s.hostScope(ctx, v.Host)
+    if err != nil {
+        return nil, fmt.Errorf("resolve: %w", err)
+    }
+
+    u, err := s.repo.Get(ctx, database.AnyWorkspace, domain, alias)
     if err != nil {
         if errors.Is(err, database.ErrNotFound) {
             return nil, fmt.Errorf("resolve: %w", ErrURLNotFound)
@@ -80,14 +405,134 @@ func (s *urlService) Resolve(ctx context.Context, alias string) (*URL, error) {
         return nil, fmt.Errorf("resolve: %w", err)
     }
 
-    return &URL{
-        Alias:   u.Alias,
-        OrigURL: u.URL,
-    }, nil
+    if u.PasswordHash != "" {
+        return nil, fmt.Errorf("resolve: %w", ErrPasswordRequired)
+    }
+
+    if u.ForcePreview && !v.SkipPreview {
+        return nil, fmt.Errorf("resolve: %w", ErrPreviewRequired)
+    }
+
+    out, err := s.follow(ctx, u, v)
+    if err != nil {
+        return nil, fmt.Errorf("resolve: %w", err)
+    }
+
+    return out, nil
 }
 
-func (s *urlService) Delete(ctx context.Context, alias string) error {
-	err := s.repo.Delete(ctx, alias)
+func (s *urlService) Unlock(ctx context.Context, alias, password string, v Visitor) (*URL, error) {
+	alias = s.canonicalAlias(alias)
+
+	domain, err := s.hostScope(ctx, v.Host)
+	if err != nil {
+		return nil, fmt.Errorf("unlock: %w", err)
+	}
+
+	linkKey := domain + "|" + s.aliasKey(alias)
+	key := linkKey + "|" + v.IP
+	// Attempts are counted before the password is compared, so that
+	// concurrent guesses cannot all pass the limit while bcrypt runs.
+	// Attempts that turn out not to be failures are given back.
+	if !s.attempts.Take(key) {
+		return nil, fmt.Errorf("unlock: %w", ErrTooManyAttempts)
+	}
+	if !s.linkAttempts.Take(linkKey) {
+		s.attempts.Undo(key)
+		return nil, fmt.Errorf("unlock: %w", ErrLinkThrottled)
+	}
+
+	u, err := s.repo.Get(ctx, database.AnyWorkspace, domain, alias)
+	if err != nil {
+		s.attempts.Undo(key)
+		s.linkAttempts.Undo(linkKey)
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, fmt.Errorf("unlock: %w", ErrURLNotFound)
+		}
+		return nil, fmt.Errorf("unlock: %w", err)
+	}
+
+	if u.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+			return nil, fmt.Errorf("unlock: %w", ErrWrongPassword)
+		}
+	}
+	// Only this attempt is given back to the link: a visitor who knows
+	// the password must not restore the guesses of others.
+	s.attempts.Reset(key)
+	s.linkAttempts.Undo(linkKey)
+
+	if u.ForcePreview && !v.SkipPreview {
+		return s.destination(u, v), fmt.Errorf("unlock: %w", ErrPreviewRequired)
+	}
+
+	out, err := s.follow(ctx, u, v)
+	if err != nil {
+		return nil, fmt.Errorf("unlock: %w", err)
+	}
+
+	return out, nil
+}
+
+// follow counts a click against limited links, picks the destination for
+// the visitor, adds UTM and forwarded query parameters, records the click
+// and publishes a click event. The decrement happens in a single statement in the repository, so
+// concurrent resolves cannot exceed the limit. The workspace quota is
+// charged in the same transaction, so an exhausted link does not use it up
+// and an exceeded quota does not use up the link. Targeting rules win over
+// the A/B split; the split only applies to visitors no rule matched.
+func (s *urlService) follow(ctx context.Context, u *database.URL, v Visitor) (*URL, error) {
+	if u.MaxClicks != nil {
+		consumed, err := s.repo.ConsumeClick(ctx, u.Domain, u.Alias, s.usageMonth())
+		if err != nil {
+			return nil, err
+		}
+		u = consumed
+	} else if err := s.consumeWorkspaceClick(ctx, u.Workspace); err != nil {
+		return nil, err
+	}
+
+	out := s.destination(u, v)
+
+	s.record(ctx, u, out.Variant)
+	s.recordClickEvent(ctx, u, out)
+
+	return out, nil
+}
+
+// destination returns the link with OrigURL set to where the visitor is
+// sent, without any side effects.
+func (s *urlService) destination(u *database.URL, v Visitor) *URL {
+	out := toURL(u)
+	out.OrigURL = s.target(out.Rules, "", v)
+	if out.OrigURL == "" {
+		out.OrigURL = u.URL
+		if variant := pickVariant(u.ID, u.Variants, v); variant != nil {
+			out.OrigURL = variant.URL
+			out.Variant = variant.Name
+		}
+	}
+
+	out.OrigURL = decorate(out.OrigURL, u, out.Variant, v)
+
+	return out
+}
+
+func (s *urlService) Delete(ctx context.Context, domain, alias string) error {
+	alias = s.canonicalAlias(alias)
+
+	domain, err := s.scope(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	workspace := ActorFromContext(ctx).Workspace
+	events, err := s.outboxEvents(EventLinkDeleted, workspace, EventLink{Domain: domain, Alias: alias}, nil)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	err = s.repo.Delete(ctx, workspace, domain, alias, events...)
 	if err != nil {
 		switch {
 			case errors.Is(err, database.ErrNotFound):
@@ -96,19 +541,120 @@ func (s *urlService) Delete(ctx context.Context, alias string) error {
 				return fmt.Errorf("delete: %w", err)
 		}
 	}
+
+	s.emit(EventLinkDeleted, workspace, EventLink{Domain: domain, Alias: alias}, nil)
 	
 	return nil
 }
 
-func generateAlias() string {
-	b := make([]byte, 6)
-	_, _ = rand.Read(b)
-	s := base64.RawURLEncoding.EncodeToString(b)
-	if len(s) > 6 {
-		return s[:6]
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+func (s *urlService) List(ctx context.Context, f ListFilter) ([]*URL, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultListLimit
+	}
+	if f.Limit > maxListLimit {
+		f.Limit = maxListLimit
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	if f.Tag != "" {
+		tag, err := normalizeTag(f.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("list: %w", err)
+		}
+		f.Tag = tag
+	}
+	f.Search = strings.TrimSpace(f.Search)
+	if len(f.Search) > maxSearchLength {
+		return nil, fmt.Errorf("list: %w: must be at most %d bytes", ErrInvalidSearch, maxSearchLength)
+	}
+	f.Workspace = ActorFromContext(ctx).Workspace
+
+	urls, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("list: %w", err)
 	}
 
-	return s
+	out := make([]*URL, 0, len(urls))
+	for _, u := range urls {
+		out = append(out, toURL(u))
+	}
+
+	return out, nil
+}
+
+// scope maps a domain name to the namespace stored on links: the empty
+// string for the default domain, the normalized name for registered ones.
+func (s *urlService) scope(ctx context.Context, domain string) (string, error) {
+	domain = normalizeDomain(domain)
+	if domain == "" || domain == s.defaultDomain {
+		return "", nil
+	}
+	if s.domains == nil {
+		return "", ErrDomainNotFound
+	}
+
+	exists, err := s.domains.Exists(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", ErrDomainNotFound
+	}
+
+	return domain, nil
+}
+
+// hostScope is scope for request hosts: unknown hosts (IP addresses,
+// internal names) fall back to the default namespace.
+func (s *urlService) hostScope(ctx context.Context, host string) (string, error) {
+	domain, err := s.scope(ctx, host)
+	if errors.Is(err, ErrDomainNotFound) {
+		return "", nil
+	}
+
+	return domain, err
+}
+
+func toURL(u *database.URL) *URL {
+	return &URL{
+		Domain:       u.Domain,
+		Alias:        u.Alias,
+		OrigURL:      u.URL,
+		Protected:    u.PasswordHash != "",
+		MaxClicks:    u.MaxClicks,
+		ClicksLeft:   u.ClicksLeft,
+		Rules:        u.Rules,
+		Variants:     u.Variants,
+		QueryMode:    u.QueryMode,
+		UTM:          u.UTM,
+		Title:        u.Title,
+		Description:  u.Description,
+		Tags:         u.Tags,
+		Metadata:     u.Metadata,
+		Page:         u.Page,
+		ForcePreview: u.ForcePreview,
+		CreatedAt:    u.CreatedAt,
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	// bcrypt silently ignores everything past 72 bytes.
+	if len(password) > 72 {
+		return "", fmt.Errorf("%w: must be at most 72 bytes", ErrInvalidPassword)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return string(hash), nil
 }
 
 var aliasRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{3,10}$`)
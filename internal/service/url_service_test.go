@@ -2,14 +2,19 @@ package service_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/finlleyl/shorty_reborn/internal/database"
 	"github.com/finlleyl/shorty_reborn/internal/service"
 	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCreate_AllCases(t *testing.T) {
@@ -35,7 +40,7 @@ func TestCreate_AllCases(t *testing.T) {
 	t.Run("exists check error", func(t *testing.T) {
 		raw := "https://ok.com"
 		repo.EXPECT().
-			Exists(ctx, gomock.Any()).
+			Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).
 			Return(false, fmt.Errorf("db down"))
 		_, err := svc.Create(ctx, raw, "")
 		require.Error(t, err)
@@ -45,7 +50,7 @@ func TestCreate_AllCases(t *testing.T) {
 	t.Run("alias already exists", func(t *testing.T) {
 		raw := "https://ok.com"
 		repo.EXPECT().
-			Exists(ctx, gomock.Any()).
+			Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).
 			Return(true, nil)
 		_, err := svc.Create(ctx, raw, "foo123")
 		require.ErrorIs(t, err, service.ErrAliasExists)
@@ -55,10 +60,10 @@ func TestCreate_AllCases(t *testing.T) {
 		raw := "https://ok.com"
 		validAlias := "alias1"
 		repo.EXPECT().
-			Exists(ctx, validAlias).
+			Exists(ctx, service.DefaultWorkspace, "", validAlias).
 			Return(false, nil)
 		repo.EXPECT().
-			Save(ctx, validAlias, raw).
+			Save(ctx, &database.URL{Alias: validAlias, URL: raw, URLHash: urlHash(raw), CreatedBy: service.AnonymousActor, Workspace: service.DefaultWorkspace}).
 			Return(nil, fmt.Errorf("write fail"))
 		_, err := svc.Create(ctx, raw, validAlias)
 		require.Error(t, err)
@@ -69,10 +74,10 @@ func TestCreate_AllCases(t *testing.T) {
 		raw := "https://ok.com"
 		given := "myalias"
 		repo.EXPECT().
-			Exists(ctx, given).
+			Exists(ctx, service.DefaultWorkspace, "", given).
 			Return(false, nil)
 		repo.EXPECT().
-			Save(ctx, given, raw).
+			Save(ctx, &database.URL{Alias: given, URL: raw, URLHash: urlHash(raw), CreatedBy: service.AnonymousActor, Workspace: service.DefaultWorkspace}).
 			Return(&database.URL{ID: 42, Alias: given, URL: raw}, nil)
 
 		out, err := svc.Create(ctx, raw, given)
@@ -86,14 +91,15 @@ func TestCreate_AllCases(t *testing.T) {
 		raw := "https://golang.org"
 		// любой alias проходит Exists и Save
 		repo.EXPECT().
-			Exists(ctx, gomock.Any()).
+			Exists(ctx, service.DefaultWorkspace, "", gomock.Any()).
 			Return(false, nil)
 		repo.EXPECT().
-			Save(ctx, gomock.Any(), raw).
-			DoAndReturn(func(_ context.Context, alias, url string) (*database.URL, error) {
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
 				// проверяем, что alias сгенерирован и валиден по regexp
-				require.Regexp(t, `^[A-Za-z0-9_-]{6}$`, alias)
-				return &database.URL{ID: 1, Alias: alias, URL: url}, nil
+				require.Regexp(t, `^[A-Za-z0-9_-]{6}$`, u.Alias)
+				require.Equal(t, raw, u.URL)
+				return &database.URL{ID: 1, Alias: u.Alias, URL: u.URL}, nil
 			})
 
 		out, err := svc.Create(ctx, raw, "")
@@ -115,29 +121,29 @@ func TestResolve(t *testing.T) {
 
 	t.Run("not found", func(t *testing.T) {
 		repo.EXPECT().
-			Get(ctx, "foo").
+			Get(ctx, database.AnyWorkspace, "", "foo").
 			Return(nil, database.ErrNotFound)
 
-		_, err := svc.Resolve(ctx, "foo")
+		_, err := svc.Resolve(ctx, "foo", service.Visitor{})
 		require.ErrorIs(t, err, service.ErrURLNotFound)
 	})
 
 	t.Run("db error", func(t *testing.T) {
 		repo.EXPECT().
-			Get(ctx, "alias").
+			Get(ctx, database.AnyWorkspace, "", "alias").
 			Return(nil, fmt.Errorf("oops"))
 
-		_, err := svc.Resolve(ctx, "alias")
+		_, err := svc.Resolve(ctx, "alias", service.Visitor{})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "resolve:")
 	})
 
 	t.Run("success", func(t *testing.T) {
 		repo.EXPECT().
-			Get(ctx, "good").
+			Get(ctx, database.AnyWorkspace, "", "good").
 			Return(&database.URL{Alias: "good", URL: "https://ok.com"}, nil)
 
-		out, err := svc.Resolve(ctx, "good")
+		out, err := svc.Resolve(ctx, "good", service.Visitor{})
 		require.NoError(t, err)
 		require.Equal(t, "good", out.Alias)
 		require.Equal(t, "https://ok.com", out.OrigURL)
@@ -156,29 +162,289 @@ func TestDelete(t *testing.T) {
 
 	t.Run("not found", func(t *testing.T) {
 		repo.EXPECT().
-			Delete(ctx, "missing").
+			Delete(ctx, service.DefaultWorkspace, "", "missing").
 			Return(database.ErrNotFound)
 
-		err := svc.Delete(ctx, "missing")
+		err := svc.Delete(ctx, "", "missing")
 		require.ErrorIs(t, err, service.ErrURLNotFound)
 	})
 
 	t.Run("db error", func(t *testing.T) {
 		repo.EXPECT().
-			Delete(ctx, "alias").
+			Delete(ctx, service.DefaultWorkspace, "", "alias").
 			Return(fmt.Errorf("cannot delete"))
 
-		err := svc.Delete(ctx, "alias")
+		err := svc.Delete(ctx, "", "alias")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "delete:")
 	})
 
 	t.Run("success", func(t *testing.T) {
 		repo.EXPECT().
-			Delete(ctx, "foo").
+			Delete(ctx, service.DefaultWorkspace, "", "foo").
 			Return(nil)
 
-		err := svc.Delete(ctx, "foo")
+		err := svc.Delete(ctx, "", "foo")
 		require.NoError(t, err)
 	})
 }
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	t.Run("default limit", func(t *testing.T) {
+		repo.EXPECT().
+			List(ctx, database.ListFilter{Workspace: service.DefaultWorkspace, Limit: 20}).
+			Return([]*database.URL{{ID: 1, Alias: "foo", URL: "https://ok.com"}}, nil)
+
+		out, err := svc.List(ctx, service.ListFilter{Offset: -5})
+		require.NoError(t, err)
+		require.Len(t, out, 1)
+		require.Equal(t, "foo", out[0].Alias)
+		require.Equal(t, "https://ok.com", out[0].OrigURL)
+	})
+
+	t.Run("limit is capped", func(t *testing.T) {
+		repo.EXPECT().
+			List(ctx, database.ListFilter{Workspace: service.DefaultWorkspace, Limit: 100, Offset: 40}).
+			Return([]*database.URL{}, nil)
+
+		out, err := svc.List(ctx, service.ListFilter{Limit: 1000, Offset: 40})
+		require.NoError(t, err)
+		require.Empty(t, out)
+	})
+
+	t.Run("by tag", func(t *testing.T) {
+		repo.EXPECT().
+			List(ctx, database.ListFilter{Workspace: service.DefaultWorkspace, Tag: "promo", Limit: 20}).
+			Return([]*database.URL{{ID: 3, Alias: "spring", Tags: database.Tags{"promo"}}}, nil)
+
+		out, err := svc.List(ctx, service.ListFilter{Tag: " Promo "})
+		require.NoError(t, err)
+		require.Len(t, out, 1)
+		require.Equal(t, []string{"promo"}, out[0].Tags)
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		_, err := svc.List(ctx, service.ListFilter{Tag: "no spaces"})
+		require.ErrorIs(t, err, service.ErrInvalidTag)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		repo.EXPECT().
+			List(ctx, database.ListFilter{Workspace: service.DefaultWorkspace, Search: "spring sale", Limit: 20}).
+			Return([]*database.URL{}, nil)
+
+		_, err := svc.List(ctx, service.ListFilter{Search: "  spring sale "})
+		require.NoError(t, err)
+	})
+
+	t.Run("search too long", func(t *testing.T) {
+		_, err := svc.List(ctx, service.ListFilter{Search: strings.Repeat("a", 201)})
+		require.ErrorIs(t, err, service.ErrInvalidSearch)
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		repo.EXPECT().
+			List(ctx, database.ListFilter{Workspace: service.DefaultWorkspace, Limit: 5}).
+			Return(nil, fmt.Errorf("oops"))
+
+		_, err := svc.List(ctx, service.ListFilter{Limit: 5})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "list:")
+	})
+}
+
+func TestPasswordProtected(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	protected := &database.URL{ID: 1, Alias: "secret", URL: "https://ok.com", PasswordHash: string(hash)}
+
+	t.Run("create hashes password", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "secret").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.NotEqual(t, "s3cret", u.PasswordHash)
+				require.NoError(t, bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte("s3cret")))
+				return &database.URL{ID: 1, Alias: u.Alias, URL: u.URL, PasswordHash: u.PasswordHash}, nil
+			})
+
+		out, err := svc.Create(ctx, "https://ok.com", "secret", service.WithPassword("s3cret"))
+		require.NoError(t, err)
+		require.True(t, out.Protected)
+	})
+
+	t.Run("create rejects long password", func(t *testing.T) {
+		_, err := svc.Create(ctx, "https://ok.com", "secret", service.WithPassword(strings.Repeat("a", 73)))
+		require.ErrorIs(t, err, service.ErrInvalidPassword)
+	})
+
+	t.Run("resolve requires password", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "secret").Return(protected, nil)
+
+		_, err := svc.Resolve(ctx, "secret", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrPasswordRequired)
+	})
+
+	t.Run("unlock success", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "secret").Return(protected, nil)
+
+		out, err := svc.Unlock(ctx, "secret", "s3cret", service.Visitor{IP: "10.0.0.1"})
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", out.OrigURL)
+	})
+
+	t.Run("unlock not found", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "missing").Return(nil, database.ErrNotFound)
+
+		_, err := svc.Unlock(ctx, "missing", "s3cret", service.Visitor{IP: "10.0.0.1"})
+		require.ErrorIs(t, err, service.ErrURLNotFound)
+	})
+
+	t.Run("unlock throttles failed attempts", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "secret").Return(protected, nil).Times(5)
+
+		for i := 0; i < 5; i++ {
+			_, err := svc.Unlock(ctx, "secret", "wrong", service.Visitor{IP: "10.0.0.2"})
+			require.ErrorIs(t, err, service.ErrWrongPassword)
+		}
+
+		// Even the correct password is refused once the client is throttled.
+		_, err := svc.Unlock(ctx, "secret", "s3cret", service.Visitor{IP: "10.0.0.2"})
+		require.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+		// Other clients are not affected.
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "secret").Return(protected, nil)
+		_, err = svc.Unlock(ctx, "secret", "s3cret", service.Visitor{IP: "10.0.0.3"})
+		require.NoError(t, err)
+	})
+
+	t.Run("unlock throttles failed attempts per link", func(t *testing.T) {
+		vault := &database.URL{ID: 2, Alias: "vault", URL: "https://ok.com", PasswordHash: protected.PasswordHash}
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "vault").Return(vault, nil).Times(20)
+
+		// Rotating the client address does not buy more guesses.
+		for i := 0; i < 20; i++ {
+			_, err := svc.Unlock(ctx, "vault", "wrong", service.Visitor{IP: fmt.Sprintf("10.1.0.%d", i)})
+			require.ErrorIs(t, err, service.ErrWrongPassword)
+		}
+
+		// The link is slowed down, not locked: the refused attempt
+		// does not count against the client.
+		_, err := svc.Unlock(ctx, "vault", "wrong", service.Visitor{IP: "10.1.1.1"})
+		require.ErrorIs(t, err, service.ErrLinkThrottled)
+		require.ErrorIs(t, err, service.ErrTooManyAttempts)
+	})
+
+	t.Run("unlock counts concurrent attempts", func(t *testing.T) {
+		safe := &database.URL{ID: 3, Alias: "safe", URL: "https://ok.com", PasswordHash: protected.PasswordHash}
+		repo.EXPECT().Get(ctx, database.AnyWorkspace, "", "safe").Return(safe, nil).Times(5)
+
+		errs := make(chan error, 10)
+		var wg sync.WaitGroup
+		for range cap(errs) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := svc.Unlock(ctx, "safe", "wrong", service.Visitor{IP: "10.2.0.1"})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		var wrong, throttled int
+		for err := range errs {
+			switch {
+			case errors.Is(err, service.ErrWrongPassword):
+				wrong++
+			case errors.Is(err, service.ErrTooManyAttempts):
+				throttled++
+			}
+		}
+		require.Equal(t, 5, wrong)
+		require.Equal(t, 5, throttled)
+	})
+}
+
+func TestMaxClicks(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+
+	one, zero := int64(1), int64(0)
+
+	t.Run("create with limit", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "once").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, &database.URL{Alias: "once", URL: "https://ok.com", MaxClicks: &one, URLHash: urlHash("https://ok.com"), CreatedBy: service.AnonymousActor, Workspace: service.DefaultWorkspace}).
+			Return(&database.URL{ID: 1, Alias: "once", URL: "https://ok.com", MaxClicks: &one, ClicksLeft: &one}, nil)
+
+		out, err := svc.Create(ctx, "https://ok.com", "once", service.WithMaxClicks(1))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), *out.MaxClicks)
+	})
+
+	t.Run("create rejects negative limit", func(t *testing.T) {
+		_, err := svc.Create(ctx, "https://ok.com", "once", service.WithMaxClicks(-1))
+		require.ErrorIs(t, err, service.ErrInvalidMaxClicks)
+	})
+
+	t.Run("resolve consumes click", func(t *testing.T) {
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", "once").
+			Return(&database.URL{Alias: "once", URL: "https://ok.com", MaxClicks: &one, ClicksLeft: &one}, nil)
+		repo.EXPECT().
+			ConsumeClick(ctx, "", "once", time.Time{}).
+			Return(&database.URL{Alias: "once", URL: "https://ok.com", MaxClicks: &one, ClicksLeft: &zero}, nil)
+
+		out, err := svc.Resolve(ctx, "once", service.Visitor{})
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", out.OrigURL)
+		require.Equal(t, int64(0), *out.ClicksLeft)
+	})
+
+	t.Run("resolve exhausted", func(t *testing.T) {
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", "once").
+			Return(&database.URL{Alias: "once", URL: "https://ok.com", MaxClicks: &one, ClicksLeft: &zero}, nil)
+		repo.EXPECT().
+			ConsumeClick(ctx, "", "once", time.Time{}).
+			Return(nil, database.ErrExhausted)
+
+		_, err := svc.Resolve(ctx, "once", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrLinkExhausted)
+	})
+
+	t.Run("get does not consume", func(t *testing.T) {
+		repo.EXPECT().
+			Get(ctx, service.DefaultWorkspace, "", "once").
+			Return(&database.URL{Alias: "once", URL: "https://ok.com", MaxClicks: &one, ClicksLeft: &one}, nil)
+
+		out, err := svc.Get(ctx, "", "once")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), *out.ClicksLeft)
+	})
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+var (
+	ErrInvalidWebhookURL = errors.New("invalid webhook URL")
+	ErrInvalidEvent      = errors.New("invalid event")
+	ErrInvalidSecret     = errors.New("invalid secret")
+	ErrWebhookNotFound   = database.ErrWebhookNotFound
+)
+
+const (
+	minSecretLength = 16
+	maxSecretLength = 256
+
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+type Webhook struct {
+	ID  int64
+	URL string
+	// Events is empty for webhooks subscribed to every event.
+	Events []string
+	// Secret is only returned by Create.
+	Secret    string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery = database.WebhookDelivery
+
+// WebhookService manages the webhooks of the context actor's workspace.
+type WebhookService interface {
+	// Create subscribes url to the events of the workspace's links. A
+	// signing secret is generated when secret is empty. URLs of loopback,
+	// private and link-local hosts are rejected with ErrInvalidWebhookURL.
+	Create(ctx context.Context, url string, events []string, secret string) (*Webhook, error)
+	List(ctx context.Context) ([]*Webhook, error)
+	Delete(ctx context.Context, id int64) error
+	// Deliveries returns the latest delivery attempts of a webhook, newest
+	// first.
+	Deliveries(ctx context.Context, id int64, limit int) ([]*WebhookDelivery, error)
+}
+
+type webhookService struct {
+	repo         database.WebhookRepository
+	allowPrivate bool
+}
+
+// NewWebhookService returns the webhook service. allowPrivate accepts URLs
+// of loopback and private hosts, for development only.
+func NewWebhookService(r database.WebhookRepository, allowPrivate bool) WebhookService {
+	return &webhookService{repo: r, allowPrivate: allowPrivate}
+}
+
+func (s *webhookService) Create(ctx context.Context, rawURL string, events []string, secret string) (*Webhook, error) {
+	parsed, err := url.ParseRequestURI(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	if !s.allowPrivate {
+		if err := checkWebhookHost(parsed.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
+	events, err = normalizeEvents(events)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == "" {
+		secret = generateSecret()
+	} else if len(secret) < minSecretLength || len(secret) > maxSecretLength {
+		return nil, fmt.Errorf("%w: must be %d to %d bytes", ErrInvalidSecret, minSecretLength, maxSecretLength)
+	}
+
+	w, err := s.repo.Create(ctx, &database.Webhook{
+		Workspace: ActorFromContext(ctx).Workspace,
+		URL:       parsed.String(),
+		Secret:    secret,
+		Events:    events,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create webhook: %w", err)
+	}
+
+	out := toWebhook(w)
+	out.Secret = w.Secret
+
+	return out, nil
+}
+
+func (s *webhookService) List(ctx context.Context) ([]*Webhook, error) {
+	webhooks, err := s.repo.List(ctx, ActorFromContext(ctx).Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+
+	out := make([]*Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		out = append(out, toWebhook(w))
+	}
+
+	return out, nil
+}
+
+func (s *webhookService) Delete(ctx context.Context, id int64) error {
+	if err := s.repo.Delete(ctx, ActorFromContext(ctx).Workspace, id); err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (s *webhookService) Deliveries(ctx context.Context, id int64, limit int) ([]*WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+	if limit > maxDeliveriesLimit {
+		limit = maxDeliveriesLimit
+	}
+
+	if _, err := s.repo.Get(ctx, ActorFromContext(ctx).Workspace, id); err != nil {
+		return nil, fmt.Errorf("webhook deliveries: %w", err)
+	}
+
+	deliveries, err := s.repo.Deliveries(ctx, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// normalizeEvents validates, sorts and deduplicates event names.
+func normalizeEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	out := make([]string, 0, len(events))
+	for _, e := range events {
+		if !slices.Contains(webhookEvents, e) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidEvent, e)
+		}
+		out = append(out, e)
+	}
+	slices.Sort(out)
+
+	return slices.Compact(out), nil
+}
+
+// checkWebhookHost rejects hosts that are, or are named like, loopback,
+// private or link-local addresses. Names resolving to them are only caught
+// when the dispatcher connects, see isPublicIP.
+func checkWebhookHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s is not a public host", ErrInvalidWebhookURL, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s is not a public address", ErrInvalidWebhookURL, host)
+	}
+
+	return nil
+}
+
+func generateSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func toWebhook(w *database.Webhook) *Webhook {
+	return &Webhook{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.Events,
+		CreatedAt: w.CreatedAt,
+	}
+}
@@ -0,0 +1,144 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestWebhookService_Create(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockWebhookRepository(ctrl)
+	svc := service.NewWebhookService(repo, false)
+
+	t.Run("generates secret", func(t *testing.T) {
+		repo.EXPECT().
+			Create(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, w *database.Webhook) (*database.Webhook, error) {
+				require.Len(t, w.Secret, 64)
+				require.Equal(t, service.DefaultWorkspace, w.Workspace)
+				require.Equal(t, database.Tags{service.EventLinkClicked, service.EventLinkCreated}, w.Events)
+				return &database.Webhook{ID: 1, URL: w.URL, Secret: w.Secret, Events: w.Events, CreatedAt: time.Now()}, nil
+			})
+
+		w, err := svc.Create(ctx, "https://crm.example.com/hooks", []string{"link.created", "link.clicked", "link.created"}, "")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), w.ID)
+		require.Len(t, w.Secret, 64)
+	})
+
+	t.Run("all events", func(t *testing.T) {
+		repo.EXPECT().
+			Create(ctx, &database.Webhook{Workspace: service.DefaultWorkspace, URL: "https://crm.example.com/hooks", Secret: "0123456789abcdef"}).
+			Return(&database.Webhook{ID: 2, URL: "https://crm.example.com/hooks", Secret: "0123456789abcdef"}, nil)
+
+		w, err := svc.Create(ctx, "https://crm.example.com/hooks", nil, "0123456789abcdef")
+		require.NoError(t, err)
+		require.Empty(t, w.Events)
+		require.Equal(t, "0123456789abcdef", w.Secret)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := svc.Create(ctx, "ftp://crm.example.com", nil, "")
+		require.ErrorIs(t, err, service.ErrInvalidWebhookURL)
+
+		_, err = svc.Create(ctx, "https://crm.example.com", []string{"link.exploded"}, "")
+		require.ErrorIs(t, err, service.ErrInvalidEvent)
+
+		_, err = svc.Create(ctx, "https://crm.example.com", nil, "short")
+		require.ErrorIs(t, err, service.ErrInvalidSecret)
+	})
+
+	t.Run("private addresses", func(t *testing.T) {
+		for _, u := range []string{
+			"http://localhost:8080/hooks",
+			"http://api.localhost/hooks",
+			"http://127.0.0.1/hooks",
+			"http://10.0.0.5/hooks",
+			"http://192.168.1.1/hooks",
+			"http://172.16.0.1/hooks",
+			"http://169.254.169.254/latest/meta-data",
+			"http://[::1]/hooks",
+			"http://[fe80::1]/hooks",
+			"http://0.0.0.0/hooks",
+		} {
+			_, err := svc.Create(ctx, u, nil, "")
+			require.ErrorIs(t, err, service.ErrInvalidWebhookURL, u)
+		}
+	})
+
+	t.Run("scoped to the workspace", func(t *testing.T) {
+		wctx := service.ContextWithActor(ctx, service.Actor{Workspace: 4})
+		repo.EXPECT().
+			Create(wctx, &database.Webhook{Workspace: 4, URL: "https://crm.example.com/hooks", Secret: "0123456789abcdef"}).
+			Return(&database.Webhook{ID: 3, Workspace: 4, URL: "https://crm.example.com/hooks"}, nil)
+
+		_, err := svc.Create(wctx, "https://crm.example.com/hooks", nil, "0123456789abcdef")
+		require.NoError(t, err)
+	})
+}
+
+func TestWebhookService_AllowPrivate(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockWebhookRepository(ctrl)
+	svc := service.NewWebhookService(repo, true)
+
+	repo.EXPECT().Create(ctx, gomock.Any()).Return(&database.Webhook{ID: 1, URL: "http://127.0.0.1:9000/hooks"}, nil)
+
+	_, err := svc.Create(ctx, "http://127.0.0.1:9000/hooks", nil, "")
+	require.NoError(t, err)
+}
+
+func TestWebhookService_ListHidesSecret(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockWebhookRepository(ctrl)
+	svc := service.NewWebhookService(repo, false)
+
+	repo.EXPECT().List(ctx, service.DefaultWorkspace).Return([]*database.Webhook{{ID: 1, URL: "https://crm.example.com", Secret: "0123456789abcdef"}}, nil)
+
+	webhooks, err := svc.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Empty(t, webhooks[0].Secret)
+}
+
+func TestWebhookService_Deliveries(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockWebhookRepository(ctrl)
+	svc := service.NewWebhookService(repo, false)
+
+	t.Run("clamps limit", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, int64(1)).Return(&database.Webhook{ID: 1}, nil)
+		repo.EXPECT().Deliveries(ctx, int64(1), 500).Return([]*database.WebhookDelivery{{ID: 3, WebhookID: 1}}, nil)
+
+		deliveries, err := svc.Deliveries(ctx, 1, 10000)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, service.DefaultWorkspace, int64(2)).Return(nil, database.ErrWebhookNotFound)
+
+		_, err := svc.Deliveries(ctx, 2, 0)
+		require.ErrorIs(t, err, service.ErrWebhookNotFound)
+	})
+}
@@ -0,0 +1,474 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// Link events delivered to webhooks.
+const (
+	EventLinkCreated = "link.created"
+	// EventLinkUpdated is reserved for link edits, which are not supported
+	// yet; subscriptions to it are accepted.
+	EventLinkUpdated  = "link.updated"
+	EventLinkDeleted  = "link.deleted"
+	EventLinkRestored = "link.restored"
+	EventLinkClicked  = "link.clicked"
+)
+
+var webhookEvents = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkRestored, EventLinkClicked}
+
+// Headers set on webhook requests. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, prefixed with
+// "sha256=". The delivery header carries the event ID, which stays the same
+// across retries.
+const (
+	WebhookEventHeader     = "X-Shorty-Event"
+	WebhookDeliveryHeader  = "X-Shorty-Delivery"
+	WebhookTimestampHeader = "X-Shorty-Timestamp"
+	WebhookSignatureHeader = "X-Shorty-Signature"
+)
+
+// Event is the JSON payload POSTed to webhooks. Workspace is the one
+// owning the link; only its webhooks receive the event.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Workspace int64     `json:"workspace_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      EventData `json:"data"`
+}
+
+type EventData struct {
+	Link  EventLink   `json:"link"`
+	Click *EventClick `json:"click,omitempty"`
+}
+
+// EventLink describes the link an event is about. Deleted links only carry
+// their domain and alias.
+type EventLink struct {
+	Domain     string            `json:"domain,omitempty"`
+	Alias      string            `json:"alias"`
+	URL        string            `json:"url,omitempty"`
+	Protected  bool              `json:"protected,omitempty"`
+	MaxClicks  *int64            `json:"max_clicks,omitempty"`
+	ClicksLeft *int64            `json:"clicks_left,omitempty"`
+	Title      string            `json:"title,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	CreatedAt  *time.Time        `json:"created_at,omitempty"`
+}
+
+type EventClick struct {
+	Destination string `json:"destination"`
+	Variant     string `json:"variant,omitempty"`
+}
+
+// SignWebhook returns the signature header value for a webhook body.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type WebhookOptions struct {
+	Workers   int
+	QueueSize int
+	// MaxAttempts is the number of delivery attempts per webhook and event
+	// published to the queue. Events relayed from the outbox are retried by
+	// the relay.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles on every
+	// further retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds a single delivery request.
+	Timeout time.Duration
+	// AllowPrivate lets deliveries reach loopback, private and link-local
+	// addresses, e.g. a receiver on the same host during development.
+	AllowPrivate bool
+}
+
+// WebhookDispatcher delivers link events to subscribed webhooks in the
+// background. Every attempt is written to the delivery log. Failed
+// deliveries are retried with exponential backoff on network errors, 429
+// and 5xx responses; other responses are final. Events are kept in memory
+// only: events published while the queue is full, or not yet delivered on
+// shutdown, are lost. For durable delivery use the dispatcher as a sink of
+// an OutboxRelay instead, which then retries the deliveries itself.
+type WebhookDispatcher struct {
+	repo   database.WebhookRepository
+	client *http.Client
+	logger *zap.SugaredLogger
+	opts   WebhookOptions
+	events chan Event
+}
+
+func NewWebhookDispatcher(repo database.WebhookRepository, logger *zap.SugaredLogger, opts WebhookOptions) *WebhookDispatcher {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.MaxBackoff < opts.Backoff {
+		opts.MaxBackoff = opts.Backoff
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		// Checked on the resolved address of every connection, so that
+		// DNS names cannot point deliveries at the internal network.
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s is not a public address", ErrInvalidWebhookURL, host)
+			}
+			return nil
+		}
+	}
+
+	return &WebhookDispatcher{
+		repo: repo,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   opts.Timeout,
+				ResponseHeaderTimeout: opts.Timeout,
+				MaxIdleConns:          10,
+				IdleConnTimeout:       30 * time.Second,
+			},
+			Timeout: opts.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logger,
+		opts:   opts,
+		events: make(chan Event, opts.QueueSize),
+	}
+}
+
+// WithWebhooks makes the service publish link events to the dispatcher.
+func WithWebhooks(d *WebhookDispatcher) Option {
+	return func(s *urlService) {
+		s.webhooks = d
+	}
+}
+
+// Publish queues an event without blocking. It reports false when the
+// queue is full and the event was dropped.
+func (d *WebhookDispatcher) Publish(e Event) bool {
+	select {
+	case d.events <- e:
+		return true
+	default:
+		d.logger.Warnw("webhook queue is full, dropping event", "event", e.Type, "event_id", e.ID)
+		return false
+	}
+}
+
+// Run delivers events until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range d.opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e := <-d.events:
+					d.dispatch(ctx, e)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// dispatch delivers a queued event to every subscribed webhook at once,
+// retrying each of them with backoff.
+func (d *WebhookDispatcher) dispatch(ctx context.Context, e Event) {
+	webhooks, body, err := d.prepare(ctx, e)
+	if err != nil {
+		d.logger.Errorw("failed to dispatch webhook event", "event", e.Type, "event_id", e.ID, "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, w := range webhooks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, w, e, body)
+		}()
+	}
+	wg.Wait()
+}
+
+// Send delivers an event relayed from the outbox. Every webhook of the
+// event's workspace subscribed to it that has not accepted it yet gets one
+// attempt, all of them at once. Retries are left to the relay, so that a
+// slow or failing endpoint holds up neither the other webhooks nor other
+// events: Send fails while any delivery may still succeed, and the webhooks
+// that accepted the event, or rejected it for good, are skipped next time.
+// Events written before workspaces existed belong to the default
+// workspace.
+func (d *WebhookDispatcher) Send(ctx context.Context, e Event) error {
+	webhooks, body, err := d.prepare(ctx, e)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	previous, err := d.repo.EventDeliveries(ctx, e.ID)
+	if err != nil {
+		return fmt.Errorf("list deliveries: %w", err)
+	}
+	attempts, done := make(map[int64]int), make(map[int64]bool)
+	for _, p := range previous {
+		attempts[p.WebhookID] = max(attempts[p.WebhookID], p.Attempt)
+		if p.Error == "" || !retryableStatus(p.StatusCode) {
+			done[p.WebhookID] = true
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
+	for _, w := range webhooks {
+		if done[w.ID] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, retry := d.attempt(ctx, w, e, body, attempts[w.ID]+1)
+			if retry {
+				mu.Lock()
+				failed = append(failed, fmt.Errorf("webhook %d: %s", w.ID, entry.Error))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return errors.Join(failed...)
+}
+
+// prepare returns the webhooks subscribed to an event and its body.
+func (d *WebhookDispatcher) prepare(ctx context.Context, e Event) ([]*database.Webhook, []byte, error) {
+	workspace := e.Workspace
+	if workspace == 0 {
+		workspace = DefaultWorkspace
+	}
+	webhooks, err := d.repo.ListForEvent(ctx, workspace, e.Type)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil, nil, nil
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode event: %w", err)
+	}
+
+	return webhooks, body, nil
+}
+
+// deliver attempts a delivery until it succeeds, fails for good or runs
+// out of attempts.
+func (d *WebhookDispatcher) deliver(ctx context.Context, w *database.Webhook, e Event, body []byte) {
+	for attempt := 1; ; attempt++ {
+		entry, retry := d.attempt(ctx, w, e, body, attempt)
+		if entry.Error == "" {
+			return
+		}
+		if !retry || attempt >= d.opts.MaxAttempts {
+			d.logger.Infow("webhook delivery failed", "webhook_id", w.ID, "event_id", e.ID, "attempts", attempt, "error", entry.Error)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.backoff(attempt)):
+		}
+	}
+}
+
+// attempt posts the event once and writes the attempt to the delivery log.
+// It reports whether a failed attempt is worth retrying.
+func (d *WebhookDispatcher) attempt(ctx context.Context, w *database.Webhook, e Event, body []byte, attempt int) (*database.WebhookDelivery, bool) {
+	start := time.Now()
+	status, err := d.post(ctx, w, e, body)
+
+	entry := &database.WebhookDelivery{
+		WebhookID:  w.ID,
+		EventID:    e.ID,
+		Event:      e.Type,
+		Attempt:    attempt,
+		StatusCode: status,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else if status < 200 || status >= 300 {
+		entry.Error = fmt.Sprintf("unexpected status %d", status)
+	}
+	if logErr := d.repo.LogDelivery(ctx, entry); logErr != nil {
+		d.logger.Errorw("failed to log webhook delivery", "webhook_id", w.ID, "error", logErr)
+	}
+
+	if entry.Error == "" {
+		return entry, false
+	}
+	if err != nil {
+		return entry, !errors.Is(err, ErrInvalidWebhookURL)
+	}
+
+	return entry, retryableStatus(status)
+}
+
+// retryableStatus reports whether a delivery that got the status, zero for
+// none, may succeed when retried.
+func retryableStatus(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, w *database.Webhook, e Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shorty-webhooks")
+	req.Header.Set(WebhookEventHeader, e.Type)
+	req.Header.Set(WebhookDeliveryHeader, e.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(w.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given failed attempt: Backoff doubled
+// per previous retry, capped at MaxBackoff, with up to half of it jittered
+// away so that retries from many events do not line up.
+func (d *WebhookDispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.Backoff
+	for i := 1; i < attempt && delay < d.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, d.opts.MaxBackoff)
+	if delay <= 1 {
+		return delay
+	}
+
+	return delay/2 + rand.N(delay/2)
+}
+
+// isPublicIP reports whether webhooks may be delivered to the address: not
+// loopback, private (RFC 1918, fc00::/7), link-local, including the cloud
+// metadata address 169.254.169.254, unspecified or multicast.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// emit publishes a link event straight to the dispatcher. It does nothing
+// when events go through the outbox instead.
+func (s *urlService) emit(eventType string, workspace int64, link EventLink, click *EventClick) {
+	if s.webhooks == nil || s.outbox != nil {
+		return
+	}
+
+	s.webhooks.Publish(newEvent(eventType, workspace, link, click))
+}
+
+func newEvent(eventType string, workspace int64, link EventLink, click *EventClick) Event {
+	return Event{
+		ID:        newEventID(),
+		Type:      eventType,
+		Workspace: workspace,
+		CreatedAt: time.Now().UTC(),
+		Data:      EventData{Link: link, Click: click},
+	}
+}
+
+func eventLink(u *database.URL) EventLink {
+	link := EventLink{
+		Domain:     u.Domain,
+		Alias:      u.Alias,
+		URL:        u.URL,
+		Protected:  u.PasswordHash != "",
+		MaxClicks:  u.MaxClicks,
+		ClicksLeft: u.ClicksLeft,
+		Title:      u.Title,
+		Tags:       u.Tags,
+		Metadata:   u.Metadata,
+	}
+	// Links written together with their outbox event have no creation
+	// time yet.
+	if !u.CreatedAt.IsZero() {
+		createdAt := u.CreatedAt
+		link.CreatedAt = &createdAt
+	}
+
+	return link
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = crand.Read(b)
+
+	return fmt.Sprintf("evt_%x", b)
+}
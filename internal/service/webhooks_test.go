@@ -0,0 +1,281 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func newTestDispatcher(repo database.WebhookRepository) *service.WebhookDispatcher {
+	return service.NewWebhookDispatcher(repo, zap.NewNop().Sugar(), service.WebhookOptions{
+		Workers:     1,
+		QueueSize:   10,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		Timeout:     time.Second,
+		// The test servers listen on loopback.
+		AllowPrivate: true,
+	})
+}
+
+func TestWebhookDispatcher_RetriesAndSigns(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	received := make(chan service.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		ts, err := strconv.ParseInt(r.Header.Get(service.WebhookTimestampHeader), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, service.SignWebhook("s3cr3t-s3cr3t-s3cr3t", ts, body), r.Header.Get(service.WebhookSignatureHeader))
+		require.Equal(t, service.EventLinkCreated, r.Header.Get(service.WebhookEventHeader))
+
+		var e service.Event
+		require.NoError(t, json.Unmarshal(body, &e))
+		require.Equal(t, e.ID, r.Header.Get(service.WebhookDeliveryHeader))
+		received <- e
+	}))
+	defer srv.Close()
+
+	ctrl := gomock.NewController(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	webhooks := servicetest.NewMockWebhookRepository(ctrl)
+	dispatcher := newTestDispatcher(webhooks)
+	svc := service.NewURLService(repo, service.WithWebhooks(dispatcher))
+
+	repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+	repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+	webhooks.EXPECT().
+		ListForEvent(gomock.Any(), service.DefaultWorkspace, service.EventLinkCreated).
+		Return([]*database.Webhook{{ID: 7, URL: srv.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"}}, nil)
+
+	logged := make(chan *database.WebhookDelivery, 3)
+	webhooks.EXPECT().
+		LogDelivery(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, d *database.WebhookDelivery) error {
+			logged <- d
+			return nil
+		}).
+		Times(3)
+
+	done := make(chan error, 1)
+	go func() { done <- dispatcher.Run(ctx) }()
+
+	_, err := svc.Create(ctx, "https://ok.com", "promo")
+	require.NoError(t, err)
+
+	var attempts []*database.WebhookDelivery
+	for len(attempts) < 3 {
+		select {
+		case d := <-logged:
+			attempts = append(attempts, d)
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook was not delivered")
+		}
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+
+	e := <-received
+	require.Equal(t, service.EventLinkCreated, e.Type)
+	require.Equal(t, "promo", e.Data.Link.Alias)
+	require.Equal(t, "https://ok.com", e.Data.Link.URL)
+
+	for i, d := range attempts {
+		require.Equal(t, int64(7), d.WebhookID)
+		require.Equal(t, e.ID, d.EventID)
+		require.Equal(t, i+1, d.Attempt)
+	}
+	require.Equal(t, http.StatusServiceUnavailable, attempts[0].StatusCode)
+	require.NotEmpty(t, attempts[0].Error)
+	require.Equal(t, http.StatusOK, attempts[2].StatusCode)
+	require.Empty(t, attempts[2].Error)
+}
+
+func TestWebhookDispatcher_ClientErrorIsFinal(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	ctrl := gomock.NewController(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	webhooks := servicetest.NewMockWebhookRepository(ctrl)
+	dispatcher := newTestDispatcher(webhooks)
+	svc := service.NewURLService(repo, service.WithWebhooks(dispatcher))
+
+	logged := make(chan *database.WebhookDelivery, 3)
+	repo.EXPECT().Delete(ctx, service.DefaultWorkspace, "", "promo").Return(nil)
+	webhooks.EXPECT().
+		ListForEvent(gomock.Any(), service.DefaultWorkspace, service.EventLinkDeleted).
+		Return([]*database.Webhook{{ID: 7, URL: srv.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"}}, nil)
+	webhooks.EXPECT().
+		LogDelivery(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, d *database.WebhookDelivery) error {
+			logged <- d
+			return nil
+		})
+
+	done := make(chan error, 1)
+	go func() { done <- dispatcher.Run(ctx) }()
+
+	require.NoError(t, svc.Delete(ctx, "", "promo"))
+
+	select {
+	case d := <-logged:
+		require.Equal(t, service.EventLinkDeleted, d.Event)
+		require.Equal(t, http.StatusGone, d.StatusCode)
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery was not logged")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestWebhookDispatcher_RefusesPrivateAddresses(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	webhooks := servicetest.NewMockWebhookRepository(ctrl)
+	dispatcher := service.NewWebhookDispatcher(webhooks, zap.NewNop().Sugar(), service.WebhookOptions{
+		Workers:     1,
+		QueueSize:   10,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		Timeout:     time.Second,
+	})
+
+	webhooks.EXPECT().
+		ListForEvent(ctx, int64(4), service.EventLinkClicked).
+		Return([]*database.Webhook{{ID: 7, Workspace: 4, URL: srv.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"}}, nil)
+	webhooks.EXPECT().EventDeliveries(ctx, "evt_1").Return(nil, nil)
+	webhooks.EXPECT().
+		LogDelivery(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, d *database.WebhookDelivery) error {
+			require.Equal(t, 1, d.Attempt)
+			require.Contains(t, d.Error, "not a public address")
+			return nil
+		})
+
+	// Refused addresses are final, so the event is not retried.
+	require.NoError(t, dispatcher.Send(ctx, service.Event{ID: "evt_1", Type: service.EventLinkClicked, Workspace: 4}))
+	require.Zero(t, calls.Load())
+}
+
+func TestWebhookDispatcher_SendAttemptsOnce(t *testing.T) {
+	t.Parallel()
+
+	var okCalls, failingCalls atomic.Int32
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		okCalls.Add(1)
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failingCalls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	webhooks := servicetest.NewMockWebhookRepository(ctrl)
+	dispatcher := newTestDispatcher(webhooks)
+
+	webhooks.EXPECT().
+		ListForEvent(ctx, service.DefaultWorkspace, service.EventLinkCreated).
+		Return([]*database.Webhook{
+			{ID: 1, URL: ok.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"},
+			{ID: 2, URL: failing.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"},
+			{ID: 3, URL: ok.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"},
+			{ID: 4, URL: failing.URL, Secret: "s3cr3t-s3cr3t-s3cr3t"},
+		}, nil)
+	// Webhook 1 accepted the event before, 4 rejected it for good and 2
+	// failed twice.
+	webhooks.EXPECT().EventDeliveries(ctx, "evt_1").Return([]*database.WebhookDelivery{
+		{WebhookID: 1, Attempt: 1, StatusCode: http.StatusOK},
+		{WebhookID: 2, Attempt: 1, Error: "connection refused"},
+		{WebhookID: 2, Attempt: 2, StatusCode: http.StatusServiceUnavailable, Error: "unexpected status 503"},
+		{WebhookID: 4, Attempt: 1, StatusCode: http.StatusGone, Error: "unexpected status 410"},
+	}, nil)
+
+	var mu sync.Mutex
+	logged := map[int64]*database.WebhookDelivery{}
+	webhooks.EXPECT().
+		LogDelivery(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, d *database.WebhookDelivery) error {
+			mu.Lock()
+			logged[d.WebhookID] = d
+			mu.Unlock()
+			return nil
+		}).
+		Times(2)
+
+	err := dispatcher.Send(ctx, service.Event{ID: "evt_1", Type: service.EventLinkCreated})
+	require.ErrorContains(t, err, "webhook 2")
+	require.Equal(t, int32(1), okCalls.Load())
+	require.Equal(t, int32(1), failingCalls.Load())
+	require.Equal(t, 3, logged[2].Attempt)
+	require.Equal(t, http.StatusBadGateway, logged[2].StatusCode)
+	require.Equal(t, 1, logged[3].Attempt)
+	require.Empty(t, logged[3].Error)
+}
+
+func TestWebhookDispatcher_QueueFull(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	dispatcher := service.NewWebhookDispatcher(servicetest.NewMockWebhookRepository(ctrl), zap.NewNop().Sugar(), service.WebhookOptions{QueueSize: 1})
+
+	require.True(t, dispatcher.Publish(service.Event{ID: "evt_1", Type: service.EventLinkClicked}))
+	require.False(t, dispatcher.Publish(service.Event{ID: "evt_2", Type: service.EventLinkClicked}))
+}
+
+func TestSignWebhook(t *testing.T) {
+	t.Parallel()
+
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	require.Equal(t,
+		"sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163",
+		service.SignWebhook("secret", 1700000000, []byte("{}")),
+	)
+}
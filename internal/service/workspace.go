@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+)
+
+// DefaultWorkspace owns the links of callers without an API key.
+const DefaultWorkspace = database.DefaultWorkspace
+
+var (
+	// ErrQuotaExceeded is returned by Create once the workspace has as many
+	// links as it may, and on resolve once its monthly clicks are used up.
+	ErrQuotaExceeded     = database.ErrQuotaExceeded
+	ErrUnknownAPIKey     = errors.New("unknown API key")
+	ErrInvalidWorkspace  = errors.New("invalid workspace")
+	ErrWorkspaceNotFound = database.ErrWorkspaceNotFound
+)
+
+// Workspace is a tenant of the deployment. Links belong to the workspace of
+// the API key they were created with and are only visible to its keys,
+// while all workspaces share the namespace of aliases.
+type Workspace struct {
+	Name string
+	// KeyHashes are the hex SHA-256 digests of the workspace's API keys.
+	KeyHashes []string
+	// MaxLinks and MaxMonthlyClicks are zero for no limit.
+	MaxLinks         int64
+	MaxMonthlyClicks int64
+	// Roles are the roles of the workspace's API keys.
+	Roles []string
+}
+
+// Principal is who the caller of an API key acts for. User is zero for
+// keys of the configuration and callers without a key.
+type Principal struct {
+	Workspace int64
+	User      int64
+	Roles     []string
+}
+
+// WithWorkspaces enforces the link and monthly click quotas of workspaces.
+func WithWorkspaces(r database.WorkspaceRepository) Option {
+	return func(s *urlService) {
+		s.workspaces = r
+	}
+}
+
+// checkLinkQuota fails with ErrQuotaExceeded when the workspace may not
+// have another link. Concurrent creates may overshoot the quota slightly.
+func (s *urlService) checkLinkQuota(ctx context.Context, workspace int64) error {
+	if s.workspaces == nil {
+		return nil
+	}
+
+	w, err := s.workspaces.Get(ctx, workspace)
+	if err != nil {
+		return fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if w.MaxLinks == nil {
+		return nil
+	}
+
+	n, err := s.workspaces.CountLinks(ctx, workspace)
+	if err != nil {
+		return fmt.Errorf("failed to count links: %w", err)
+	}
+	if n >= *w.MaxLinks {
+		return fmt.Errorf("%w: %d links", ErrQuotaExceeded, *w.MaxLinks)
+	}
+
+	return nil
+}
+
+// consumeWorkspaceClick counts a click against the monthly quota of the
+// workspace owning the link.
+func (s *urlService) consumeWorkspaceClick(ctx context.Context, workspace int64) error {
+	if s.workspaces == nil {
+		return nil
+	}
+
+	return s.workspaces.ConsumeClick(ctx, workspace, month(time.Now()))
+}
+
+// usageMonth returns the month clicks are counted in, zero when workspace
+// quotas are not tracked.
+func (s *urlService) usageMonth() time.Time {
+	if s.workspaces == nil {
+		return time.Time{}
+	}
+
+	return month(time.Now())
+}
+
+// month returns the first day of t's month in UTC, the period monthly
+// quotas are counted in.
+func month(t time.Time) time.Time {
+	t = t.UTC()
+
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+type WorkspaceService interface {
+	// Sync creates or updates the workspaces by name and replaces their API
+	// keys.
+	Sync(ctx context.Context, workspaces []Workspace) error
+	// Authenticate returns the owner of the API key in an Authorization
+	// header value, a principal of DefaultWorkspace without roles when
+	// there is none, and ErrUnknownAPIKey for unknown keys.
+	Authenticate(ctx context.Context, authorization string) (*Principal, error)
+}
+
+type workspaceService struct {
+	repo database.WorkspaceRepository
+}
+
+func NewWorkspaceService(r database.WorkspaceRepository) WorkspaceService {
+	return &workspaceService{repo: r}
+}
+
+func (s *workspaceService) Sync(ctx context.Context, workspaces []Workspace) error {
+	for _, w := range workspaces {
+		entity, hashes, err := workspaceEntity(w)
+		if err != nil {
+			return fmt.Errorf("sync workspaces: %w", err)
+		}
+		if _, err := s.repo.Upsert(ctx, entity, hashes); err != nil {
+			return fmt.Errorf("sync workspace %q: %w", w.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func workspaceEntity(w Workspace) (*database.Workspace, []string, error) {
+	name := strings.TrimSpace(w.Name)
+	if name == "" {
+		return nil, nil, fmt.Errorf("%w: name is required", ErrInvalidWorkspace)
+	}
+	if w.MaxLinks < 0 || w.MaxMonthlyClicks < 0 {
+		return nil, nil, fmt.Errorf("%w: %q: quotas must not be negative", ErrInvalidWorkspace, name)
+	}
+
+	hashes := make([]string, 0, len(w.KeyHashes))
+	for _, h := range w.KeyHashes {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if b, err := hex.DecodeString(h); err != nil || len(b) != sha256.Size {
+			return nil, nil, fmt.Errorf("%w: %q: API keys must be given as hex SHA-256", ErrInvalidWorkspace, name)
+		}
+		hashes = append(hashes, h)
+	}
+
+	roles, err := parseRoles(w.Roles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %q: %w", ErrInvalidWorkspace, name, err)
+	}
+
+	entity := &database.Workspace{Name: name, KeyRoles: roles}
+	if w.MaxLinks > 0 {
+		entity.MaxLinks = &w.MaxLinks
+	}
+	if w.MaxMonthlyClicks > 0 {
+		entity.MaxMonthlyClicks = &w.MaxMonthlyClicks
+	}
+
+	return entity, hashes, nil
+}
+
+func (s *workspaceService) Authenticate(ctx context.Context, authorization string) (*Principal, error) {
+	key := credential(authorization)
+	if key == "" {
+		return &Principal{Workspace: DefaultWorkspace}, nil
+	}
+
+	o, err := s.repo.ByKey(ctx, KeyHash(key))
+	if err != nil {
+		if errors.Is(err, database.ErrWorkspaceNotFound) {
+			return nil, ErrUnknownAPIKey
+		}
+		return nil, fmt.Errorf("authenticate: %w", err)
+	}
+
+	p := &Principal{Workspace: o.Workspace, Roles: o.Roles}
+	if o.UserID != nil {
+		p.User = *o.UserID
+	}
+
+	return p, nil
+}
+
+// KeyHash returns the hex SHA-256 of an API key, the form keys are
+// configured and stored in.
+func KeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
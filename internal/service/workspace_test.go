@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/finlleyl/shorty_reborn/internal/database"
+	"github.com/finlleyl/shorty_reborn/internal/service"
+	"github.com/finlleyl/shorty_reborn/internal/service/servicetest"
+)
+
+func TestWorkspaceScoping(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	repo := servicetest.NewMockURLRepository(ctrl)
+	svc := service.NewURLService(repo)
+	ctx := service.ContextWithActor(context.Background(), service.Actor{ID: "key:team", Workspace: 7})
+
+	t.Run("create stores workspace", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, int64(7), "", "promo").Return(false, nil)
+		repo.EXPECT().
+			Save(ctx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *database.URL, _ ...*database.OutboxEvent) (*database.URL, error) {
+				require.Equal(t, int64(7), u.Workspace)
+				return u, nil
+			})
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo")
+		require.NoError(t, err)
+	})
+
+	t.Run("alias of another workspace", func(t *testing.T) {
+		repo.EXPECT().Exists(ctx, int64(7), "", "taken").Return(false, nil)
+		repo.EXPECT().Save(ctx, gomock.Any()).Return(nil, database.ErrAliasInUse)
+
+		_, err := svc.Create(ctx, "https://ok.com", "taken")
+		require.ErrorIs(t, err, service.ErrAliasExists)
+	})
+
+	t.Run("get, delete and list are scoped", func(t *testing.T) {
+		repo.EXPECT().Get(ctx, int64(7), "", "other").Return(nil, database.ErrNotFound)
+		_, err := svc.Get(ctx, "", "other")
+		require.ErrorIs(t, err, service.ErrURLNotFound)
+
+		repo.EXPECT().Delete(ctx, int64(7), "", "other").Return(database.ErrNotFound)
+		require.ErrorIs(t, svc.Delete(ctx, "", "other"), service.ErrURLNotFound)
+
+		repo.EXPECT().List(ctx, database.ListFilter{Workspace: 7, Limit: 20}).Return(nil, nil)
+		_, err = svc.List(ctx, service.ListFilter{Workspace: 1})
+		require.NoError(t, err)
+	})
+
+	t.Run("resolve is not scoped", func(t *testing.T) {
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", "other").
+			Return(&database.URL{Alias: "other", URL: "https://ok.com", Workspace: 3}, nil)
+
+		out, err := svc.Resolve(ctx, "other", service.Visitor{})
+		require.NoError(t, err)
+		require.Equal(t, "https://ok.com", out.OrigURL)
+	})
+}
+
+func TestWorkspaceQuotas(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockURLRepository(ctrl)
+	workspaces := servicetest.NewMockWorkspaceRepository(ctrl)
+	svc := service.NewURLService(repo, service.WithWorkspaces(workspaces))
+	maxLinks := int64(2)
+
+	t.Run("link quota", func(t *testing.T) {
+		workspaces.EXPECT().Get(ctx, service.DefaultWorkspace).Return(&database.Workspace{ID: 1, MaxLinks: &maxLinks}, nil)
+		workspaces.EXPECT().CountLinks(ctx, service.DefaultWorkspace).Return(int64(2), nil)
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo")
+		require.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+
+	t.Run("restore checks the link quota", func(t *testing.T) {
+		restoring := service.NewURLService(repo, service.WithWorkspaces(workspaces), service.WithDeleteGrace(time.Hour))
+		repo.EXPECT().Restore(ctx, service.DefaultWorkspace, "", "promo", gomock.Any(), true).Return(nil, database.ErrQuotaExceeded)
+
+		_, err := restoring.Restore(ctx, "", "promo")
+		require.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		workspaces.EXPECT().Get(ctx, service.DefaultWorkspace).Return(&database.Workspace{ID: 1}, nil)
+		repo.EXPECT().Exists(ctx, service.DefaultWorkspace, "", "promo").Return(false, nil)
+		repo.EXPECT().Save(ctx, gomock.Any()).Return(&database.URL{ID: 1, Alias: "promo", URL: "https://ok.com"}, nil)
+
+		_, err := svc.Create(ctx, "https://ok.com", "promo")
+		require.NoError(t, err)
+	})
+
+	t.Run("click quota", func(t *testing.T) {
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", "promo").
+			Return(&database.URL{Alias: "promo", URL: "https://ok.com", Workspace: 3}, nil)
+		workspaces.EXPECT().
+			ConsumeClick(ctx, int64(3), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, month time.Time) error {
+				require.Equal(t, 1, month.Day())
+				require.Equal(t, time.UTC, month.Location())
+				return database.ErrQuotaExceeded
+			})
+
+		_, err := svc.Resolve(ctx, "promo", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrQuotaExceeded)
+	})
+
+	t.Run("limited link charges the quota with the click", func(t *testing.T) {
+		one := int64(1)
+		repo.EXPECT().
+			Get(ctx, database.AnyWorkspace, "", "once").
+			Return(&database.URL{Alias: "once", URL: "https://ok.com", Workspace: 3, MaxClicks: &one, ClicksLeft: &one}, nil)
+		repo.EXPECT().
+			ConsumeClick(ctx, "", "once", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _, _ string, month time.Time) (*database.URL, error) {
+				require.Equal(t, 1, month.Day())
+				return nil, database.ErrExhausted
+			})
+
+		_, err := svc.Resolve(ctx, "once", service.Visitor{})
+		require.ErrorIs(t, err, service.ErrLinkExhausted)
+	})
+}
+
+func TestWorkspaceService(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	repo := servicetest.NewMockWorkspaceRepository(ctrl)
+	svc := service.NewWorkspaceService(repo)
+
+	t.Run("no key", func(t *testing.T) {
+		p, err := svc.Authenticate(ctx, "")
+		require.NoError(t, err)
+		require.Equal(t, &service.Principal{Workspace: service.DefaultWorkspace}, p)
+	})
+
+	t.Run("known key", func(t *testing.T) {
+		repo.EXPECT().
+			ByKey(ctx, service.KeyHash("secret")).
+			Return(&database.KeyOwner{Workspace: 4, Roles: database.Tags{"viewer"}}, nil)
+
+		p, err := svc.Authenticate(ctx, "Bearer secret")
+		require.NoError(t, err)
+		require.Equal(t, &service.Principal{Workspace: 4, Roles: []string{"viewer"}}, p)
+	})
+
+	t.Run("personal key", func(t *testing.T) {
+		user := int64(7)
+		repo.EXPECT().
+			ByKey(ctx, service.KeyHash("mine")).
+			Return(&database.KeyOwner{Workspace: 4, UserID: &user, Roles: database.Tags{"admin"}}, nil)
+
+		p, err := svc.Authenticate(ctx, "Bearer mine")
+		require.NoError(t, err)
+		require.Equal(t, &service.Principal{Workspace: 4, User: 7, Roles: []string{"admin"}}, p)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		repo.EXPECT().ByKey(ctx, service.KeyHash("nope")).Return(nil, database.ErrWorkspaceNotFound)
+
+		_, err := svc.Authenticate(ctx, "nope")
+		require.ErrorIs(t, err, service.ErrUnknownAPIKey)
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		hash := service.KeyHash("secret")
+		maxLinks := int64(100)
+		repo.EXPECT().
+			Upsert(ctx, &database.Workspace{Name: "team", MaxLinks: &maxLinks}, []string{hash}).
+			Return(&database.Workspace{ID: 2, Name: "team"}, nil)
+
+		err := svc.Sync(ctx, []service.Workspace{{Name: " team ", KeyHashes: []string{strings.ToUpper(hash)}, MaxLinks: 100}})
+		require.NoError(t, err)
+	})
+
+	t.Run("sync rejects unknown roles", func(t *testing.T) {
+		err := svc.Sync(ctx, []service.Workspace{{Name: "team", Roles: []string{"owner"}}})
+		require.ErrorIs(t, err, service.ErrInvalidWorkspace)
+		require.ErrorIs(t, err, service.ErrInvalidRole)
+	})
+
+	t.Run("sync rejects plain keys", func(t *testing.T) {
+		err := svc.Sync(ctx, []service.Workspace{{Name: "team", KeyHashes: []string{"secret"}}})
+		require.ErrorIs(t, err, service.ErrInvalidWorkspace)
+	})
+}